@@ -0,0 +1,118 @@
+package db
+
+import (
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+func QueryAdmin(id int64) (*model.Admin, error) {
+	a := &model.Admin{Id: id}
+	has, err := database.Get(a)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, errutil.ErrAdminNotFound
+	}
+	return a, nil
+}
+
+func QueryAdminByAccount(account string) (*model.Admin, error) {
+	a := &model.Admin{Account: account}
+	has, err := database.Get(a)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, errutil.ErrAdminNotFound
+	}
+	return a, nil
+}
+
+// QueryAdminByApiKey 通过API Key的摘要查询管理员
+func QueryAdminByApiKey(digest string) (*model.Admin, error) {
+	if digest == "" {
+		return nil, errutil.ErrAdminNotFound
+	}
+
+	a := &model.Admin{ApiKey: digest}
+	has, err := database.Get(a)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, errutil.ErrAdminNotFound
+	}
+	return a, nil
+}
+
+func AdminCount() (int64, error) {
+	return database.Count(&model.Admin{})
+}
+
+// InsertAdmin 新增管理员, 账号不能重复
+func InsertAdmin(a *model.Admin) error {
+	if a == nil || a.Account == "" {
+		return errutil.ErrInvalidParameter
+	}
+
+	has, err := database.Exist(&model.Admin{Account: a.Account})
+	if err != nil {
+		return err
+	}
+	if has {
+		return errutil.ErrAccountExists
+	}
+
+	_, err = database.Insert(a)
+	return err
+}
+
+// UpdateAdmin 修改管理员的指定字段
+func UpdateAdmin(a *model.Admin, cols ...string) error {
+	if a == nil || len(cols) == 0 {
+		return errutil.ErrInvalidParameter
+	}
+	_, err := database.Cols(cols...).Where("id=?", a.Id).Update(a)
+	return err
+}
+
+func AdminList(offset, count int) ([]model.Admin, int64, error) {
+	total, err := database.Count(&model.Admin{})
+	if err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+
+	list := []model.Admin{}
+	if err := database.Limit(count, offset).Asc("id").Find(&list); err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+	return list, total, nil
+}
+
+// InsertAdminAudit 异步写入后台操作日志
+func InsertAdminAudit(a *model.AdminAudit) {
+	chWrite <- a
+}
+
+// AdminAudits 后台操作日志, adminId为0或者action为空时不过滤
+func AdminAudits(adminId int64, action string, offset, count int) ([]model.AdminAudit, int64, error) {
+	bean := &model.AdminAudit{AdminId: adminId, Action: action}
+	total, err := database.Count(bean)
+	if err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+
+	list := []model.AdminAudit{}
+	if err := database.Limit(count, offset).Desc("id").Find(&list, bean); err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+	return list, total, nil
+}
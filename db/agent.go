@@ -0,0 +1,226 @@
+package db
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-xorm/xorm"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+func QueryAgent(id int64) (*model.Agent, error) {
+	a := &model.Agent{Id: id}
+	has, err := database.Get(a)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, errutil.ErrAgentNotFound
+	}
+	return a, nil
+}
+
+func QueryAgentByAccount(account string) (*model.Agent, error) {
+	a := &model.Agent{Account: account}
+	has, err := database.Get(a)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, errutil.ErrAgentNotFound
+	}
+	return a, nil
+}
+
+// InsertAgent 新增代理, 账号不能重复
+func InsertAgent(a *model.Agent) error {
+	if a == nil || a.Account == "" {
+		return errutil.ErrInvalidParameter
+	}
+
+	has, err := database.Exist(&model.Agent{Account: a.Account})
+	if err != nil {
+		return err
+	}
+	if has {
+		return errutil.ErrAccountExists
+	}
+
+	_, err = database.Insert(a)
+	return err
+}
+
+// UpdateAgentLevel 修改代理等级和佣金比例
+func UpdateAgentLevel(id int64, level, discount int) error {
+	if _, err := QueryAgent(id); err != nil {
+		return err
+	}
+
+	_, err := database.Cols("level", "discount").Where("id=?", id).
+		Update(&model.Agent{Level: level, Discount: discount})
+	return err
+}
+
+func AgentList(offset, count int) ([]model.Agent, int64, error) {
+	bean := &model.Agent{Status: StatusNormal}
+	total, err := database.Count(bean)
+	if err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+
+	list := []model.Agent{}
+	if err := database.Limit(count, offset).Desc("id").Find(&list, bean); err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+	return list, total, nil
+}
+
+// 在事务中修改代理的房卡库存, 同时写入库存变化记录
+func agentTransaction(r *model.AdminRecharge, fn func(session *xorm.Session, a *model.Agent) error) (*model.Agent, error) {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+
+	// 锁定代理, 并发修改库存时不会被覆盖
+	a := &model.Agent{}
+	has, err := session.Where("id=?", r.AgentId).ForUpdate().Get(a)
+	if err != nil {
+		session.Rollback()
+		return nil, err
+	}
+	if !has {
+		session.Rollback()
+		return nil, errutil.ErrAgentNotFound
+	}
+	if a.Status != StatusNormal {
+		session.Rollback()
+		return nil, errutil.ErrAgentDisabled
+	}
+	if a.CardCount+r.CardCount < 0 {
+		session.Rollback()
+		return nil, errutil.ErrAgentCardNotEnough
+	}
+
+	a.CardCount += r.CardCount
+	if _, err := session.Cols("card_count").Where("id=?", a.Id).Update(a); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+
+	if fn != nil {
+		if err := fn(session, a); err != nil {
+			session.Rollback()
+			return nil, err
+		}
+	}
+
+	r.AgentName = a.Name
+	r.AgentAccount = a.Account
+	r.Remain = a.CardCount
+	r.CreateAt = time.Now().Unix()
+	if _, err := session.Insert(r); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// AgentAddCard 后台给代理增加房卡库存, 返回代理当前的库存
+func AgentAddCard(r *model.AdminRecharge) (int64, error) {
+	if r == nil || r.CardCount <= 0 {
+		return 0, errutil.ErrInvalidParameter
+	}
+
+	a, err := agentTransaction(r, nil)
+	if err != nil {
+		return 0, err
+	}
+	return a.CardCount, nil
+}
+
+// AgentRechargePlayer 代理使用自己的库存给玩家充值房卡, 返回玩家当前的房卡
+// 和代理剩余的库存
+func AgentRechargePlayer(agentId, uid, count, commission int64, extra string) (int64, int64, error) {
+	if count <= 0 || uid <= 0 {
+		return 0, 0, errutil.ErrInvalidParameter
+	}
+
+	r := &model.AdminRecharge{
+		AgentId:   agentId,
+		PlayerId:  uid,
+		CardCount: -count,
+		Extra:     extra,
+	}
+
+	var coin int64
+	a, err := agentTransaction(r, func(session *xorm.Session, a *model.Agent) error {
+		var err error
+		coin, _, err = changeWallet(session, &WalletChange{
+			Uid:     uid,
+			Type:    model.WalletAgent,
+			Amount:  count,
+			RefType: model.WalletRefAgent,
+			RefId:   strconv.FormatInt(a.Id, 10),
+			Remark:  extra,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = session.Insert(&model.Recharge{
+			AgentId:      strconv.FormatInt(a.Id, 10),
+			AgentName:    a.Name,
+			AgentAccount: a.Account,
+			PlayerId:     uid,
+			Extra:        extra,
+			CreateAt:     time.Now().Unix(),
+			CardCount:    count,
+			Commission:   commission,
+		})
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return coin, a.CardCount, nil
+}
+
+// AgentRecharges 代理给玩家的充值记录
+func AgentRecharges(agentId int64, offset, count int) ([]model.Recharge, int64, error) {
+	bean := &model.Recharge{AgentId: strconv.FormatInt(agentId, 10)}
+	total, err := database.Count(bean)
+	if err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+
+	list := []model.Recharge{}
+	if err := database.Limit(count, offset).Desc("id").Find(&list, bean); err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+	return list, total, nil
+}
+
+// AgentCommission 代理在时间段内充值的房卡总数和佣金总额
+func AgentCommission(agentId, from, to int64) (int64, int64, error) {
+	sums, err := database.Where("agent_id=? AND create_at BETWEEN ? AND ?", strconv.FormatInt(agentId, 10), from, to).
+		SumsInt(&model.Recharge{}, "card_count", "commission")
+	if err != nil {
+		logger.Error(err)
+		return 0, 0, errutil.ErrDBOperation
+	}
+	return sums[0], sums[1], nil
+}
@@ -3,9 +3,15 @@ package db
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/go-xorm/xorm"
 	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
 )
 
 func IsClubMember(clubId, uid int64) bool {
@@ -50,9 +56,8 @@ func ApplyClub(uid, clubId int64) error {
 	}
 
 	uc := &model.UserClub{
-		Uid:       uid,
-		ClubId:    clubId,
-		CreatedAt: time.Now().Unix(),
+		Uid:    uid,
+		ClubId: clubId,
 	}
 
 	ok, err = database.Get(uc)
@@ -70,7 +75,13 @@ func ApplyClub(uid, clubId int64) error {
 		}
 	}
 
+	if c.Member >= c.MaxMember {
+		return fmt.Errorf("ID为%d的俱乐部成员已满", clubId)
+	}
+
 	uc.Status = model.UserClubStatusApply
+	uc.Role = model.UserClubRoleMember
+	uc.CreatedAt = time.Now().Unix()
 	_, err = database.Insert(uc)
 	return err
 }
@@ -101,36 +112,672 @@ func ClubList(uid int64) ([]model.Club, error) {
 	return ret, nil
 }
 
-func ClubLoseBalance(clubId, balance int64, consume *model.CardConsume) error {
+// ClubLoseBalance 扣除俱乐部房卡并记录流水, 相同的key只扣除一次, 返回扣除后的余额
+func ClubLoseBalance(clubId, balance int64, consume *model.CardConsume, key string) (int64, error) {
+	return clubConsume(clubId, func(session *xorm.Session, c *model.Club) error {
+		prev, err := clubLogByKey(session, clubId, key)
+		if err != nil {
+			return err
+		}
+		if prev != nil {
+			if prev.Type != model.ClubBalanceConsume || prev.Amount != -balance {
+				return errutil.ErrWalletKeyConflict
+			}
+			return nil
+		}
+		return addClubConsume(session, c, -balance, model.ClubBalanceConsume, consume, key)
+	})
+}
+
+// ClubRefundBalance 房间没有完成第一局就解散, 退还幂等键为key的俱乐部开房消耗, 返回退还后的余额.
+// 没有扣除记录时不做任何修改并返回ErrNotFound
+func ClubRefundBalance(clubId int64, key, refundKey string, consume *model.CardConsume) (int64, error) {
+	return clubConsume(clubId, func(session *xorm.Session, c *model.Club) error {
+		prev, err := clubLogByKey(session, clubId, key)
+		if err != nil {
+			return err
+		}
+		if prev == nil || prev.Type != model.ClubBalanceConsume {
+			return errutil.ErrNotFound
+		}
+
+		refund, err := clubLogByKey(session, clubId, refundKey)
+		if err != nil || refund != nil {
+			return err
+		}
+
+		consume.CardCount = int(prev.Amount)
+		return addClubConsume(session, c, -prev.Amount, model.ClubBalanceRefund, consume, refundKey)
+	})
+}
+
+// 在锁定俱乐部的事务中修改房卡, fn返回错误时回滚
+func clubConsume(clubId int64, fn func(session *xorm.Session, c *model.Club) error) (int64, error) {
 	session := database.NewSession()
 	defer session.Close()
 
 	if err := session.Begin(); err != nil {
-		return err
+		return 0, err
 	}
 
-	c := &model.Club{ClubId: clubId}
-	has, err := session.Get(c)
+	// 锁定俱乐部, 并发扣除时余额不会被覆盖, 相同key的扣除和退还也依次执行
+	c := &model.Club{}
+	has, err := session.Where("club_id=?", clubId).ForUpdate().Get(c)
 	if err != nil {
-		return err
+		session.Rollback()
+		return 0, err
 	}
 
 	if !has {
-		return fmt.Errorf("俱乐部不存在，ID=%d", clubId)
+		session.Rollback()
+		return 0, fmt.Errorf("俱乐部不存在，ID=%d", clubId)
+	}
+
+	if err := fn(session, c); err != nil {
+		session.Rollback()
+		return 0, err
 	}
 
-	c.Balance -= balance
+	if err := session.Commit(); err != nil {
+		return 0, err
+	}
+	return c.Balance, nil
+}
+
+// 俱乐部中幂等键为key的流水, 不存在时返回nil
+func clubLogByKey(session *xorm.Session, clubId int64, key string) (*model.ClubBalanceLog, error) {
+	l := &model.ClubBalanceLog{}
+	has, err := session.Where("club_id=? AND idem_key=?", clubId, key).Get(l)
+	if err != nil || !has {
+		return nil, err
+	}
+	return l, nil
+}
+
+func addClubConsume(session *xorm.Session, c *model.Club, amount int64, typ int, consume *model.CardConsume, key string) error {
+	c.Balance += amount
 
 	//FIXED: 用户剩余1的时候, 扣除不成功
-	if _, err := session.Cols("balance").Where("club_id=?", clubId).Update(c); err != nil {
-		session.Rollback()
+	if _, err := session.Cols("balance").Where("club_id=?", c.ClubId).Update(c); err != nil {
 		return err
 	}
 
 	if _, err := session.Insert(consume); err != nil {
+		return err
+	}
+
+	_, err := session.Insert(&model.ClubBalanceLog{
+		ClubId:    c.ClubId,
+		Type:      typ,
+		Amount:    amount,
+		Balance:   c.Balance,
+		DeskId:    consume.DeskId,
+		DeskNo:    consume.DeskNo,
+		Operator:  consume.UserId,
+		IdemKey:   key,
+		CreatedAt: consume.ConsumeAt,
+	})
+	return err
+}
+
+func QueryClub(clubId int64) (*model.Club, error) {
+	c := &model.Club{ClubId: clubId}
+	has, err := database.Get(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, errutil.ErrClubNotFound
+	}
+
+	return c, nil
+}
+
+// ClubRole 玩家在俱乐部中的角色, 不是成员时返回0
+func ClubRole(clubId, uid int64) int {
+	uc := &model.UserClub{Uid: uid, ClubId: clubId, Status: model.UserClubStatusAgree}
+	has, err := database.Get(uc)
+	if err != nil || !has {
+		return 0
+	}
+	return uc.Role
+}
+
+// ClubMembers 俱乐部成员或者申请列表, 按加入时间排序
+func ClubMembers(clubId int64, status int) ([]protocol.ClubMember, error) {
+	list := []model.UserClub{}
+	err := database.Where("club_id=? AND status=?", clubId, status).Asc("created_at").Find(&list)
+	if err != nil {
+		logger.Error(err)
+		return nil, errutil.ErrDBOperation
+	}
+
+	members := make([]protocol.ClubMember, len(list))
+	if len(list) == 0 {
+		return members, nil
+	}
+
+	uids := make([]int64, len(list))
+	for i := range list {
+		uids[i] = list[i].Uid
+	}
+
+	accounts := []model.ThirdAccount{}
+	if err := database.In("uid", uids).Find(&accounts); err != nil {
+		logger.Error(err)
+		return nil, errutil.ErrDBOperation
+	}
+	thirds := map[int64]*model.ThirdAccount{}
+	for i := range accounts {
+		thirds[accounts[i].Uid] = &accounts[i]
+	}
+
+	for i, uc := range list {
+		m := protocol.ClubMember{
+			Uid:       uc.Uid,
+			Name:      protocol.GuestName(uc.Uid),
+			HeadUrl:   protocol.GuestHeadUrl,
+			Role:      uc.Role,
+			CreatedAt: uc.CreatedAt,
+		}
+		if t, ok := thirds[uc.Uid]; ok {
+			m.Name, m.HeadUrl = t.ThirdName, t.HeadUrl
+		}
+		members[i] = m
+	}
+	return members, nil
+}
+
+// 检查操作者的权限, 系统操作不经过此检查
+func checkClubRole(session *xorm.Session, clubId, operator int64, role int) error {
+	uc := &model.UserClub{Uid: operator, ClubId: clubId, Status: model.UserClubStatusAgree}
+	has, err := session.Get(uc)
+	if err != nil {
+		return err
+	}
+	if !has || uc.Role < role {
+		return errutil.ErrPermissionDenied
+	}
+	return nil
+}
+
+// 在事务中修改俱乐部, 俱乐部在事务结束前保持锁定, fn返回错误时回滚
+func clubTransaction(clubId int64, fn func(session *xorm.Session, c *model.Club) error) (*model.Club, error) {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+
+	c := &model.Club{}
+	has, err := session.Where("club_id=?", clubId).ForUpdate().Get(c)
+	if err != nil {
+		session.Rollback()
+		return nil, err
+	}
+	if !has {
 		session.Rollback()
+		return nil, errutil.ErrClubNotFound
+	}
+
+	if err := fn(session, c); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ApproveClubApply 同意玩家的加入申请, 成员数量不能超过俱乐部上限
+func ApproveClubApply(operator, clubId, uid int64) (*model.Club, error) {
+	return clubTransaction(clubId, func(session *xorm.Session, c *model.Club) error {
+		if err := checkClubRole(session, clubId, operator, model.UserClubRoleManager); err != nil {
+			return err
+		}
+
+		if c.Member >= c.MaxMember {
+			return errutil.ErrClubFull
+		}
+
+		uc := &model.UserClub{Uid: uid, ClubId: clubId, Status: model.UserClubStatusApply}
+		has, err := session.Get(uc)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return errutil.ErrClubApplyNotFound
+		}
+
+		uc.Status = model.UserClubStatusAgree
+		uc.Role = model.UserClubRoleMember
+		if _, err := session.Cols("status", "role").Where("id=?", uc.Id).Update(uc); err != nil {
+			return err
+		}
+
+		c.Member++
+		_, err = session.Cols("member").Where("club_id=?", clubId).Update(c)
 		return err
+	})
+}
+
+// RejectClubApply 拒绝玩家的加入申请, 删除申请记录后玩家可以重新申请
+func RejectClubApply(operator, clubId, uid int64) (*model.Club, error) {
+	return clubTransaction(clubId, func(session *xorm.Session, c *model.Club) error {
+		if err := checkClubRole(session, clubId, operator, model.UserClubRoleManager); err != nil {
+			return err
+		}
+
+		n, err := session.Where("club_id=? AND uid=? AND status=?", clubId, uid, model.UserClubStatusApply).
+			Delete(&model.UserClub{})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errutil.ErrClubApplyNotFound
+		}
+		return nil
+	})
+}
+
+// KickClubMember 踢出成员, 只能踢出角色比自己低的成员
+func KickClubMember(operator, clubId, uid int64) (*model.Club, error) {
+	return clubTransaction(clubId, func(session *xorm.Session, c *model.Club) error {
+		if err := checkClubRole(session, clubId, operator, model.UserClubRoleManager); err != nil {
+			return err
+		}
+
+		uc := &model.UserClub{Uid: uid, ClubId: clubId, Status: model.UserClubStatusAgree}
+		has, err := session.Get(uc)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return errutil.ErrClubMemberNotFound
+		}
+
+		if uc.Role == model.UserClubRoleOwner {
+			return errutil.ErrPermissionDenied
+		}
+		if err := checkClubRole(session, clubId, operator, uc.Role+1); err != nil {
+			return err
+		}
+
+		if _, err := session.Where("id=?", uc.Id).Delete(&model.UserClub{}); err != nil {
+			return err
+		}
+
+		if c.Member > 0 {
+			c.Member--
+		}
+		_, err = session.Cols("member").Where("club_id=?", clubId).Update(c)
+		return err
+	})
+}
+
+// TransferClub 部长转让部长, 原部长变为管理员
+func TransferClub(operator, clubId, uid int64) (*model.Club, error) {
+	return clubTransaction(clubId, func(session *xorm.Session, c *model.Club) error {
+		if err := checkClubRole(session, clubId, operator, model.UserClubRoleOwner); err != nil {
+			return err
+		}
+
+		uc := &model.UserClub{Uid: uid, ClubId: clubId, Status: model.UserClubStatusAgree}
+		has, err := session.Get(uc)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return errutil.ErrClubMemberNotFound
+		}
+		return setClubOwner(session, uc)
+	})
+}
+
+// AssignClubOwner 后台指定俱乐部部长, 用于没有部长的俱乐部, 玩家不是成员时直接加入俱乐部
+func AssignClubOwner(clubId, uid int64) (*model.Club, error) {
+	return clubTransaction(clubId, func(session *xorm.Session, c *model.Club) error {
+		uc := &model.UserClub{Uid: uid, ClubId: clubId}
+		has, err := session.Get(uc)
+		if err != nil {
+			return err
+		}
+
+		if !has || uc.Status != model.UserClubStatusAgree {
+			if c.Member >= c.MaxMember {
+				return errutil.ErrClubFull
+			}
+
+			uc.Status = model.UserClubStatusAgree
+			uc.Role = model.UserClubRoleMember
+			if !has {
+				uc.CreatedAt = time.Now().Unix()
+				if _, err := session.Insert(uc); err != nil {
+					return err
+				}
+			} else if _, err := session.Cols("status", "role").Where("id=?", uc.Id).Update(uc); err != nil {
+				return err
+			}
+
+			c.Member++
+			if _, err := session.Cols("member").Where("club_id=?", clubId).Update(c); err != nil {
+				return err
+			}
+		}
+		return setClubOwner(session, uc)
+	})
+}
+
+// 俱乐部只有一个部长, 原部长变为管理员
+func setClubOwner(session *xorm.Session, uc *model.UserClub) error {
+	_, err := session.Cols("role").
+		Where("club_id=? AND role=?", uc.ClubId, model.UserClubRoleOwner).
+		Update(&model.UserClub{Role: model.UserClubRoleManager})
+	if err != nil {
+		return err
+	}
+
+	uc.Role = model.UserClubRoleOwner
+	_, err = session.Cols("role").Where("id=?", uc.Id).Update(uc)
+	return err
+}
+
+// SetClubRole 部长任命或者取消管理员
+func SetClubRole(operator, clubId, uid int64, role int) (*model.Club, error) {
+	if role != model.UserClubRoleMember && role != model.UserClubRoleManager {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	return clubTransaction(clubId, func(session *xorm.Session, c *model.Club) error {
+		if err := checkClubRole(session, clubId, operator, model.UserClubRoleOwner); err != nil {
+			return err
+		}
+
+		uc := &model.UserClub{Uid: uid, ClubId: clubId, Status: model.UserClubStatusAgree}
+		has, err := session.Get(uc)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return errutil.ErrClubMemberNotFound
+		}
+		if uc.Role == model.UserClubRoleOwner {
+			return errutil.ErrPermissionDenied
+		}
+
+		uc.Role = role
+		_, err = session.Cols("role").Where("id=?", uc.Id).Update(uc)
+		return err
+	})
+}
+
+// UpdateClubInfo 部长修改俱乐部名字和简介
+func UpdateClubInfo(operator, clubId int64, name, desc string) (*model.Club, error) {
+	name, desc = strings.TrimSpace(name), strings.TrimSpace(desc)
+	if name == "" || utf8.RuneCountInString(name) > 32 || utf8.RuneCountInString(desc) > 128 {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	return clubTransaction(clubId, func(session *xorm.Session, c *model.Club) error {
+		if err := checkClubRole(session, clubId, operator, model.UserClubRoleOwner); err != nil {
+			return err
+		}
+
+		c.Name, c.Desc = name, desc
+		_, err := session.Cols("name", "desc").Where("club_id=?", clubId).Update(c)
+		return err
+	})
+}
+
+// 每个俱乐部最多可以设置的房间模板数量
+const maxClubTemplates = 10
+
+// ClubTemplates 俱乐部的房间模板, clubId为0时返回所有俱乐部的模板
+func ClubTemplates(clubId int64) ([]model.ClubTemplate, error) {
+	list := []model.ClubTemplate{}
+	s := database.Asc("id")
+	if clubId > 0 {
+		s = s.Where("club_id=?", clubId)
+	}
+	if err := s.Find(&list); err != nil {
+		logger.Error(err)
+		return nil, errutil.ErrDBOperation
+	}
+	return list, nil
+}
+
+// SaveClubTemplate 部长新增或者修改房间模板, Id为0时新增
+func SaveClubTemplate(operator int64, t *model.ClubTemplate) error {
+	_, err := clubTransaction(t.ClubId, func(session *xorm.Session, c *model.Club) error {
+		if err := checkClubRole(session, t.ClubId, operator, model.UserClubRoleOwner); err != nil {
+			return err
+		}
+
+		if t.Id > 0 {
+			n, err := session.Cols("name", "options").Where("id=? AND club_id=?", t.Id, t.ClubId).Update(t)
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return errutil.ErrClubTemplateNotFound
+			}
+			return nil
+		}
+
+		count, err := session.Where("club_id=?", t.ClubId).Count(&model.ClubTemplate{})
+		if err != nil {
+			return err
+		}
+		if count >= maxClubTemplates {
+			return errutil.ErrClubTemplateLimited
+		}
+
+		t.CreatedAt = time.Now().Unix()
+		_, err = session.Insert(t)
+		return err
+	})
+	return err
+}
+
+// DeleteClubTemplate 部长删除房间模板
+func DeleteClubTemplate(operator, clubId, id int64) error {
+	_, err := clubTransaction(clubId, func(session *xorm.Session, c *model.Club) error {
+		if err := checkClubRole(session, clubId, operator, model.UserClubRoleOwner); err != nil {
+			return err
+		}
+
+		n, err := session.Where("id=? AND club_id=?", id, clubId).Delete(&model.ClubTemplate{})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errutil.ErrClubTemplateNotFound
+		}
+		return nil
+	})
+	return err
+}
+
+// ClubRecharge 部长使用自己的房卡给俱乐部充值, 返回充值后的俱乐部余额
+func ClubRecharge(operator, clubId, amount int64, remark string) (int64, error) {
+	if amount <= 0 {
+		return 0, errutil.ErrInvalidParameter
+	}
+
+	c, err := clubTransaction(clubId, func(session *xorm.Session, c *model.Club) error {
+		if err := checkClubRole(session, clubId, operator, model.UserClubRoleOwner); err != nil {
+			return err
+		}
+
+		_, _, err := changeWallet(session, &WalletChange{
+			Uid:     operator,
+			Type:    model.WalletClub,
+			Amount:  -amount,
+			RefType: model.WalletRefClub,
+			RefId:   strconv.FormatInt(clubId, 10),
+			Remark:  remark,
+		})
+		if err != nil {
+			return err
+		}
+		return addClubBalance(session, c, model.ClubBalanceRecharge, amount, operator, remark)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return c.Balance, nil
+}
+
+// AdminClubRecharge 后台给俱乐部充值房卡, operator为管理员ID, 返回充值后的俱乐部余额
+func AdminClubRecharge(operator, clubId, amount int64, remark string) (int64, error) {
+	if amount <= 0 {
+		return 0, errutil.ErrInvalidParameter
 	}
 
-	return session.Commit()
+	c, err := clubTransaction(clubId, func(session *xorm.Session, c *model.Club) error {
+		return addClubBalance(session, c, model.ClubBalanceAdminRecharge, amount, operator, remark)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return c.Balance, nil
+}
+
+// AgentRechargeClub 代理使用自己的库存给俱乐部充值, 返回俱乐部余额和代理剩余的库存
+func AgentRechargeClub(agentId, clubId, amount int64, remark string) (int64, int64, error) {
+	if amount <= 0 {
+		return 0, 0, errutil.ErrInvalidParameter
+	}
+
+	r := &model.AdminRecharge{
+		AgentId:   agentId,
+		CardCount: -amount,
+		Extra:     fmt.Sprintf("俱乐部充值: %d %s", clubId, remark),
+	}
+
+	var balance int64
+	a, err := agentTransaction(r, func(session *xorm.Session, a *model.Agent) error {
+		c := &model.Club{}
+		has, err := session.Where("club_id=?", clubId).ForUpdate().Get(c)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return errutil.ErrClubNotFound
+		}
+
+		if err := addClubBalance(session, c, model.ClubBalanceAgentRecharge, amount, agentId, remark); err != nil {
+			return err
+		}
+		balance = c.Balance
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return balance, a.CardCount, nil
+}
+
+// 增加俱乐部余额并记录流水, 调用者需要在事务中锁定俱乐部
+func addClubBalance(session *xorm.Session, c *model.Club, typ int, amount, operator int64, remark string) error {
+	c.Balance += amount
+	if _, err := session.Cols("balance").Where("club_id=?", c.ClubId).Update(c); err != nil {
+		return err
+	}
+
+	_, err := session.Insert(&model.ClubBalanceLog{
+		ClubId:    c.ClubId,
+		Type:      typ,
+		Amount:    amount,
+		Balance:   c.Balance,
+		Operator:  operator,
+		Remark:    remark,
+		CreatedAt: time.Now().Unix(),
+	})
+	return err
+}
+
+// ClubBalanceLogs 俱乐部房卡流水, 按时间倒序
+func ClubBalanceLogs(clubId int64, offset, count int) ([]model.ClubBalanceLog, int64, error) {
+	bean := &model.ClubBalanceLog{ClubId: clubId}
+	total, err := database.Count(bean)
+	if err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+
+	list := []model.ClubBalanceLog{}
+	if err := database.Limit(count, offset).Desc("id").Find(&list, bean); err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+	return list, total, nil
+}
+
+// ClubDailyReport 俱乐部每日的消耗和充值汇总, 从to开始按日期倒序分页
+func ClubDailyReport(clubId, from, to int64, offset, count int) ([]protocol.ClubDailyReport, int, error) {
+	begin := time.Unix(from, 0)
+	first := time.Date(begin.Year(), begin.Month(), begin.Day(), 0, 0, 0, 0, time.Local).Unix()
+
+	days := []int64{}
+	for i := first; i <= to; i += dayInSecond {
+		days = append([]int64{i}, days...)
+	}
+
+	total := len(days)
+	if offset >= total {
+		return []protocol.ClubDailyReport{}, total, nil
+	}
+	if end := offset + count; end < total {
+		days = days[offset:end]
+	} else {
+		days = days[offset:]
+	}
+
+	ret := make([]protocol.ClubDailyReport, len(days))
+	for i, day := range days {
+		r := protocol.ClubDailyReport{Date: day}
+		result, err := database.Query("SELECT type, SUM(amount) AS amount, COUNT(*) AS times FROM club_balance_log "+
+			"WHERE club_id=? AND created_at BETWEEN ? AND ? GROUP BY type", clubId, day, day+dayInSecond-1)
+		if err != nil {
+			logger.Error(err)
+			return nil, 0, errutil.ErrDBOperation
+		}
+
+		for _, row := range result {
+			typ, _ := strconv.Atoi(string(row["type"]))
+			amount, _ := strconv.ParseInt(string(row["amount"]), 10, 64)
+			times, _ := strconv.Atoi(string(row["times"]))
+			switch typ {
+			case model.ClubBalanceConsume:
+				r.Consume, r.Desks = r.Consume-amount, r.Desks+times
+			case model.ClubBalanceRecharge, model.ClubBalanceAgentRecharge, model.ClubBalanceAdminRecharge:
+				r.Recharge += amount
+			case model.ClubBalanceRefund:
+				r.Consume, r.Desks = r.Consume-amount, r.Desks-times
+			}
+		}
+		ret[i] = r
+	}
+	return ret, total, nil
+}
+
+// ClubAdmins 俱乐部的部长和管理员
+func ClubAdmins(clubId int64) ([]int64, error) {
+	list := []model.UserClub{}
+	err := database.Where("club_id=? AND status=? AND role>=?", clubId, model.UserClubStatusAgree, model.UserClubRoleManager).
+		Find(&list)
+	if err != nil {
+		return nil, err
+	}
+
+	uids := make([]int64, len(list))
+	for i := range list {
+		uids[i] = list[i].Uid
+	}
+	return uids, nil
 }
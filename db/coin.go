@@ -0,0 +1,95 @@
+package db
+
+import (
+	"time"
+
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+// CoinChange 经典场一局结算中一个玩家的金币/银币变化, 输分时Amount为负数
+type CoinChange struct {
+	Uid      int64
+	CoinType int
+	Amount   int64
+	Rake     int64
+	DeskNo   string
+	Key      string // 幂等键, 同一局每个玩家只结算一次
+}
+
+// ChangeUserCoin 锁定玩家修改金币/银币并在同一个事务中写入流水, 扣除时最多扣到0,
+// 幂等键已经存在时不做任何修改, 返回变化后的余额
+func ChangeUserCoin(c *CoinChange) (int64, error) {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return 0, err
+	}
+
+	u := &model.User{Id: c.Uid}
+	has, err := session.ForUpdate().Get(u)
+	if err != nil {
+		session.Rollback()
+		return 0, err
+	}
+	if !has {
+		session.Rollback()
+		return 0, errutil.ErrUserNotFound
+	}
+
+	l := &model.CoinLedger{IdemKey: c.Key}
+	has, err = session.Get(l)
+	if err != nil {
+		session.Rollback()
+		return 0, err
+	}
+	if has {
+		session.Rollback()
+		if l.Uid != c.Uid || l.CoinType != c.CoinType {
+			return 0, errutil.ErrWalletKeyConflict
+		}
+		return l.Balance, nil
+	}
+
+	col, balance := "silver", &u.Silver
+	if c.CoinType == protocol.CoinTypeGold {
+		col, balance = "gold", &u.Gold
+	}
+
+	amount := coinFloor(*balance, c.Amount)
+	*balance += amount
+	if _, err := session.Cols(col).Where("id=?", u.Id).Update(u); err != nil {
+		session.Rollback()
+		return 0, err
+	}
+
+	_, err = session.Insert(&model.CoinLedger{
+		Uid:       c.Uid,
+		CoinType:  c.CoinType,
+		Amount:    amount,
+		Rake:      c.Rake,
+		Balance:   *balance,
+		DeskNo:    c.DeskNo,
+		IdemKey:   c.Key,
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		session.Rollback()
+		return 0, err
+	}
+
+	if err := session.Commit(); err != nil {
+		return 0, err
+	}
+	return *balance, nil
+}
+
+// 实际的变化数量, 并发结算时内存中的余额可能已经过期, 扣除时最多扣到0
+func coinFloor(balance, amount int64) int64 {
+	if balance+amount < 0 {
+		return -balance
+	}
+	return amount
+}
@@ -0,0 +1,24 @@
+package db
+
+import "testing"
+
+func TestCoinFloor(t *testing.T) {
+	cases := []struct {
+		name    string
+		balance int64
+		amount  int64
+		expect  int64
+	}{
+		{"win", 100, 50, 50},
+		{"lose", 100, -50, -50},
+		{"lose all", 100, -100, -100},
+		{"lose more than balance", 100, -150, -100},
+		{"empty", 0, -10, 0},
+	}
+
+	for _, c := range cases {
+		if amount := coinFloor(c.balance, c.amount); amount != c.expect {
+			t.Fatalf("%s: expect %d, got %d", c.name, c.expect, amount)
+		}
+	}
+}
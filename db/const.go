@@ -35,9 +35,12 @@ const (
 
 // 订单状态
 const (
-	OrderStatusCreated  = 1 //创建
-	OrderStatusPayed    = 2 //完成
-	OrderStatusNotified = 3 //已确认订单
+	OrderStatusCreated   = 1 //创建
+	OrderStatusPayed     = 2 //完成
+	OrderStatusNotified  = 3 //已确认订单
+	OrderStatusExpired   = 4 //超时未支付, 已关闭
+	OrderStatusRefunded  = 5 //已退款
+	OrderStatusRefunding = 6 //退款中, 已经扣回房卡, 等待支付平台退款
 )
 
 const (
@@ -17,6 +17,7 @@ var (
 	logger   *log.Entry
 	chWrite  chan interface{} // async write channel
 	chUpdate chan interface{} // async update channel
+	chDone   chan struct{}    // async task finished
 )
 
 type options struct {
@@ -50,22 +51,27 @@ func ShowSQL(show bool) ModelOption {
 }
 
 func envInit() {
-	// async task
+	// async task, 两个channel都关闭并且处理完所有数据后才退出
 	go func() {
-		for {
+		defer close(chDone)
+
+		write, update := chWrite, chUpdate
+		for write != nil || update != nil {
 			select {
-			case t, ok := <-chWrite:
+			case t, ok := <-write:
 				if !ok {
-					return
+					write = nil
+					continue
 				}
 
 				if _, err := database.Insert(t); err != nil {
 					logger.Error(err)
 				}
 
-			case t, ok := <-chUpdate:
+			case t, ok := <-update:
 				if !ok {
-					return
+					update = nil
+					continue
 				}
 
 				if _, err := database.Update(t); err != nil {
@@ -115,6 +121,7 @@ func MustStartup(dsn string, opts ...ModelOption) func() {
 
 	chWrite = make(chan interface{}, asyncTaskBacklog)
 	chUpdate = make(chan interface{}, asyncTaskBacklog)
+	chDone = make(chan struct{})
 
 	// options
 	database.SetMaxIdleConns(settings.maxIdleConns)
@@ -125,8 +132,10 @@ func MustStartup(dsn string, opts ...ModelOption) func() {
 	envInit()
 
 	closer := func() {
+		// 等待异步任务全部写入数据库
 		close(chWrite)
 		close(chUpdate)
+		<-chDone
 		database.Close()
 		logger.Info("stopped")
 	}
@@ -137,19 +146,30 @@ func MustStartup(dsn string, opts ...ModelOption) func() {
 func syncSchema() {
 	database.StoreEngine("InnoDB").Sync2(
 		new(model.Agent),
+		new(model.AdminRecharge),
+		new(model.Admin),
+		new(model.AdminAudit),
 		new(model.CardConsume),
 		new(model.Desk),
 		new(model.History),
 		new(model.Login),
 		new(model.Online),
 		new(model.Order),
+		new(model.Product),
 		new(model.Recharge),
 		new(model.Register),
 		new(model.ThirdAccount),
 		new(model.Trade),
 		new(model.User),
+		new(model.Verification),
 		new(model.Uuid),
+		new(model.WalletLedger),
+		new(model.CoinLedger),
 		new(model.Club),
 		new(model.UserClub),
+		new(model.ClubTemplate),
+		new(model.ClubBalanceLog),
+		new(model.Tournament),
+		new(model.TournamentPlayer),
 	)
 }
@@ -4,3 +4,74 @@ const (
 	UserClubStatusApply = 1
 	UserClubStatusAgree = 2
 )
+
+// 俱乐部成员角色
+const (
+	UserClubRoleMember  = 1 // 普通成员
+	UserClubRoleManager = 2 // 管理员, 可以审核申请和踢出普通成员
+	UserClubRoleOwner   = 3 // 部长, 拥有全部权限
+)
+
+// 俱乐部房卡流水类型
+const (
+	ClubBalanceConsume       = 1 // 开房消耗
+	ClubBalanceRecharge      = 2 // 部长使用自己的房卡充值
+	ClubBalanceAgentRecharge = 3 // 代理使用自己的库存充值
+	ClubBalanceRefund        = 4 // 房间没有完成第一局就解散, 退还开房消耗
+	ClubBalanceAdminRecharge = 5 // 后台充值
+)
+
+// 比赛状态
+const (
+	TournamentStatusRegistering = 1 // 报名中
+	TournamentStatusRunning     = 2 // 比赛中
+	TournamentStatusFinished    = 3 // 已结束
+	TournamentStatusCanceled    = 4 // 已取消, 报名费已退还
+)
+
+// 参赛玩家状态
+const (
+	TournamentPlayerRegistered = 1 // 已报名/晋级中
+	TournamentPlayerEliminated = 2 // 已淘汰
+	TournamentPlayerFinished   = 3 // 进入决赛并完成比赛
+	TournamentPlayerRefunded   = 4 // 退赛或比赛取消, 已退还报名费
+)
+
+// 后台管理员角色
+const (
+	AdminRoleViewer   = 1 // 只读, 查看在线, 统计和玩家信息
+	AdminRoleOperator = 2 // 运营, 踢人, 广播, 重置玩家和停服维护
+	AdminRoleFinance  = 3 // 财务, 给玩家充值
+	AdminRoleSuper    = 4 // 超级管理员, 拥有全部权限并且可以管理后台账号
+)
+
+// 房卡流水类型
+const (
+	WalletOpening     = 1  // 期初余额, 玩家第一次产生流水时记录之前的余额
+	WalletRegister    = 2  // 注册赠送
+	WalletOrder       = 3  // 商城购买
+	WalletDesk        = 4  // 开房消耗
+	WalletAgent       = 5  // 代理充值
+	WalletAdmin       = 6  // 后台充值
+	WalletClub        = 7  // 给俱乐部充值
+	WalletTournament  = 8  // 比赛报名费, 退款和奖励
+	WalletDeskRefund  = 9  // 房间没有完成第一局就解散, 退还开房消耗
+	WalletOrderRefund = 10 // 订单退款, 扣回购买的房卡
+)
+
+// 房卡流水关联的业务类型
+const (
+	WalletRefNone       = 0
+	WalletRefOrder      = 1 // 订单号
+	WalletRefDesk       = 2 // 房间号
+	WalletRefAgent      = 3 // 代理ID
+	WalletRefAdmin      = 4 // 管理员账号
+	WalletRefClub       = 5 // 俱乐部ID
+	WalletRefTournament = 6 // 比赛ID
+)
+
+// 商品状态
+const (
+	ProductStatusOnSale = 1 // 上架
+	ProductStatusOff    = 2 // 下架
+)
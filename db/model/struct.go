@@ -8,9 +8,11 @@ type AdminRecharge struct {
 	AdminId      string `xorm:"not null VARCHAR(32) default"`
 	AdminName    string `xorm:"not null VARCHAR(32) default"`
 	AdminAccount string `xorm:"not null VARCHAR(32) default"`
+	PlayerId     int64  `xorm:"not null BIGINT(20) default"` // 代理转给玩家时的玩家ID, 后台充值为0
 	Extra        string `xorm:"not null VARCHAR(255) default"`
 	CreateAt     int64  `xorm:"not null BIGINT(20) default"`
-	CardCount    int64  `xorm:"not null BIGINT(20) default"`
+	CardCount    int64  `xorm:"not null BIGINT(20) default"` // 代理库存变化, 转给玩家时为负数
+	Remain       int64  `xorm:"not null BIGINT(20) default"` // 变化后的代理库存
 }
 
 type Agent struct {
@@ -127,6 +129,7 @@ type Order struct {
 	CreatedAt      int64  `xorm:"not null BIGINT(11) default"`
 	ProductId      string `xorm:"not null VARCHAR(255) default"`
 	ProductCount   int    `xorm:"not null INT(10) default"`
+	FirstBonus     int    `xorm:"not null INT(10) default 0"` // 首充赠送的房卡, 包含在ProductCount中
 	ProductName    string `xorm:"not null VARCHAR(255) default"`
 	ProductExtra   string `xorm:"not null VARCHAR(255) default"`
 	NotifyUrl      string `xorm:"not null VARCHAR(2048) default"`
@@ -147,6 +150,7 @@ type Recharge struct {
 	Extra        string `xorm:"not null VARCHAR(255) default"`
 	CreateAt     int64  `xorm:"not null BIGINT(20) default"`
 	CardCount    int64  `xorm:"not null BIGINT(20) default"`
+	Commission   int64  `xorm:"not null BIGINT(20) default"` // 代理佣金(分)
 }
 
 type Register struct {
@@ -176,14 +180,15 @@ type ThirdAccount struct {
 type Trade struct {
 	Id            int64
 	OrderId       string `xorm:"not null unique VARCHAR(32) default"`
-	PayOrderId    string `xorm:"not null VARCHAR(255) default"`
-	PayPlatform   string `xorm:"not null VARCHAR(32) default"`
+	PayOrderId    string `xorm:"not null unique(pay_trade) VARCHAR(255) default"`
+	PayPlatform   string `xorm:"not null unique(pay_trade) VARCHAR(32) default"`
 	PayAt         int64  `xorm:"not null BIGINT(11) default"`
 	PayCreateAt   int64  `xorm:"not null BIGINT(11) default"`
 	ComsumerId    string `xorm:"not null VARCHAR(128) default"`
 	MerchantId    string `xorm:"not null VARCHAR(128) default"`
 	ComsumerEmail string `xorm:"not null VARCHAR(64) default"`
 	Raw           string `xorm:"not null VARCHAR(2048) default"`
+	Money         int    `xorm:"not null INT(11) default"` // 实际支付金额(分)
 }
 
 type User struct {
@@ -198,6 +203,8 @@ type User struct {
 	PrivKey         string `xorm:"not null VARCHAR(512) default"`
 	PubKey          string `xorm:"not null VARCHAR(128) default"`
 	Coin            int64  `xorm:"not null BIGINT(20) default 0"`
+	Gold            int64  `xorm:"not null BIGINT(20) default 0"`
+	Silver          int64  `xorm:"not null BIGINT(20) default 0"`
 	RegisterAt      int64  `xorm:"not null index BIGINT(20) default 0"`
 	FirstRechargeAt int64  `xorm:"not null index BIGINT(20) default 0"`
 	Debug           int    `xorm:"not null index TINYINT(1) default 0"`
@@ -229,4 +236,141 @@ type UserClub struct {
 	ClubId    int64 `xorm:"not null index BIGINT(20) default"`
 	CreatedAt int64 `xorm:"not null BIGINT(20) default"`
 	Status    int   `xorm:"not null TINYINT(3) default 1"`
+	Role      int   `xorm:"not null TINYINT(3) default 1"`
+}
+
+type ClubBalanceLog struct {
+	Id        int64
+	ClubId    int64  `xorm:"not null index BIGINT(20) default"`
+	Type      int    `xorm:"not null TINYINT(3) default"`
+	Amount    int64  `xorm:"not null BIGINT(20) default 0"`
+	Balance   int64  `xorm:"not null BIGINT(20) default 0"`
+	DeskId    int64  `xorm:"not null BIGINT(20) default 0"`
+	DeskNo    string `xorm:"not null VARCHAR(32) default"`
+	Operator  int64  `xorm:"not null BIGINT(20) default 0"`
+	Remark    string `xorm:"not null VARCHAR(255) default"`
+	IdemKey   string `xorm:"not null index VARCHAR(64) default"` // 开房消耗和退还的幂等键, 在锁定俱乐部后检查
+	CreatedAt int64  `xorm:"not null index BIGINT(20) default"`
+}
+
+type ClubTemplate struct {
+	Id        int64
+	ClubId    int64  `xorm:"not null index BIGINT(20) default"`
+	Name      string `xorm:"not null VARCHAR(64) default"`
+	Options   string `xorm:"not null TEXT default"`
+	CreatedAt int64  `xorm:"not null BIGINT(20) default"`
+}
+
+type Tournament struct {
+	Id         int64
+	Name       string `xorm:"not null VARCHAR(64) default"`
+	RoomType   int    `xorm:"not null TINYINT(3) default"`
+	Level      int    `xorm:"not null TINYINT(3) default"`
+	Mode       int    `xorm:"not null TINYINT(3) default 4"`
+	Round      int    `xorm:"not null INT(11) default 1"`
+	EntryFee   int64  `xorm:"not null BIGINT(20) default 0"`
+	Prizes     string `xorm:"not null VARCHAR(255) default"`
+	MinPlayers int    `xorm:"not null INT(11) default"`
+	MaxPlayers int    `xorm:"not null INT(11) default"`
+	Stage      int    `xorm:"not null INT(11) default 0"`
+	Status     int    `xorm:"not null index TINYINT(3) default 1"`
+	RegisterAt int64  `xorm:"not null BIGINT(20) default"`
+	StartAt    int64  `xorm:"not null index BIGINT(20) default"`
+	CreatedAt  int64  `xorm:"not null BIGINT(20) default"`
+	FinishedAt int64  `xorm:"not null BIGINT(20) default"`
+}
+
+type TournamentPlayer struct {
+	Id           int64
+	TournamentId int64  `xorm:"not null index BIGINT(20) default"`
+	Uid          int64  `xorm:"not null index BIGINT(20) default"`
+	Name         string `xorm:"not null VARCHAR(64) default"`
+	Score        int    `xorm:"not null INT(11) default 0"`
+	Stage        int    `xorm:"not null INT(11) default 0"`
+	Rank         int    `xorm:"not null INT(11) default 0"`
+	Prize        int64  `xorm:"not null BIGINT(20) default 0"`
+	Status       int    `xorm:"not null TINYINT(3) default 1"`
+	RegisterAt   int64  `xorm:"not null BIGINT(20) default"`
+}
+
+// 后台管理员账号, 可以使用密码登录换取token, 或者使用API Key访问
+type Admin struct {
+	Id        int64
+	Account   string `xorm:"not null VARCHAR(32) unique default"`
+	Name      string `xorm:"not null VARCHAR(32) default"`
+	Password  string `xorm:"not null VARCHAR(64) default"`
+	Salt      string `xorm:"not null VARCHAR(32) default"`
+	Role      int    `xorm:"not null TINYINT(4) default"`
+	ApiKey    string `xorm:"not null VARCHAR(64) index default"` // API Key的SHA256摘要
+	Status    int    `xorm:"not null TINYINT(4) default"`
+	CreatedAt int64  `xorm:"not null BIGINT(20) default"`
+}
+
+// 后台操作日志
+type AdminAudit struct {
+	Id         int64
+	AdminId    int64  `xorm:"not null index BIGINT(20) default"`
+	Account    string `xorm:"not null VARCHAR(32) default"`
+	Action     string `xorm:"not null VARCHAR(32) index default"`
+	Target     int64  `xorm:"not null BIGINT(20) default"` // 被操作的玩家或者账号
+	Detail     string `xorm:"not null VARCHAR(255) default"`
+	RemoteAddr string `xorm:"not null VARCHAR(64) default"`
+	CreatedAt  int64  `xorm:"not null index BIGINT(20) default"`
+}
+
+// 房卡流水, 每次房卡变化都和余额在同一个事务中写入, Balance为变化后的余额
+type WalletLedger struct {
+	Id        int64
+	Uid       int64  `xorm:"not null index BIGINT(20) default"`
+	Type      int    `xorm:"not null TINYINT(4) default"`
+	Amount    int64  `xorm:"not null BIGINT(20) default"` // 增加为正, 扣除为负
+	Balance   int64  `xorm:"not null BIGINT(20) default"`
+	RefType   int    `xorm:"not null TINYINT(4) default"`
+	RefId     string `xorm:"not null VARCHAR(64) default"`        // 订单号, 房间号, 代理ID或者管理员账号等
+	IdemKey   string `xorm:"not null VARCHAR(64) unique default"` // 幂等键, 相同的键只会生效一次
+	Remark    string `xorm:"not null VARCHAR(255) default"`
+	CreatedAt int64  `xorm:"not null index BIGINT(20) default"`
+}
+
+// 金币/银币流水, 每局结算和余额在同一个事务中写入, Balance为变化后的余额
+type CoinLedger struct {
+	Id        int64
+	Uid       int64  `xorm:"not null index BIGINT(20) default"`
+	CoinType  int    `xorm:"not null TINYINT(4) default"`
+	Amount    int64  `xorm:"not null BIGINT(20) default"` // 实际变化, 扣除时最多扣到0
+	Rake      int64  `xorm:"not null BIGINT(20) default"` // 赢家被抽水的数量
+	Balance   int64  `xorm:"not null BIGINT(20) default"`
+	DeskNo    string `xorm:"not null VARCHAR(32) default"`
+	IdemKey   string `xorm:"not null VARCHAR(64) unique default"` // 幂等键, 同一局每个玩家只结算一次
+	CreatedAt int64  `xorm:"not null index BIGINT(20) default"`
+}
+
+// 商城商品, 订单的价格和房卡数量以商品为准
+type Product struct {
+	Id         int64
+	Sku        string `xorm:"not null VARCHAR(32) unique default"` // 苹果内购的商品ID与SKU相同
+	Name       string `xorm:"not null VARCHAR(64) default"`
+	Price      int    `xorm:"not null INT(11) default"` // 价格(分)
+	CardCount  int    `xorm:"not null INT(11) default"`
+	BonusCount int    `xorm:"not null INT(11) default"`      // 赠送的房卡
+	FirstBonus int    `xorm:"not null INT(11) default"`      // 首充额外赠送的房卡
+	FirstOnly  int    `xorm:"not null TINYINT(1) default 0"` // 为1时只有没有充值过的玩家可以购买
+	Channels   string `xorm:"not null VARCHAR(255) default"` // 可以购买的渠道, 逗号隔开, 为空表示所有渠道
+	Sort       int    `xorm:"not null INT(11) default"`
+	Status     int    `xorm:"not null TINYINT(4) default"`
+	CreatedAt  int64  `xorm:"not null BIGINT(20) default"`
+	UpdatedAt  int64  `xorm:"not null BIGINT(20) default"`
+}
+
+// 短信验证码, 验证成功或者错误次数过多后失效
+type Verification struct {
+	Id        int64
+	Phone     string `xorm:"not null index VARCHAR(11) default"`
+	Type      string `xorm:"not null VARCHAR(16) default"`
+	Code      string `xorm:"not null VARCHAR(8) default"`
+	Ip        string `xorm:"not null index VARCHAR(40) default"`
+	Attempts  int    `xorm:"not null INT(11) default 0"` // 错误的次数
+	ExpireAt  int64  `xorm:"not null BIGINT(20) default"`
+	UsedAt    int64  `xorm:"not null BIGINT(20) default 0"`
+	CreatedAt int64  `xorm:"not null index BIGINT(20) default"`
 }
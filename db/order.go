@@ -1,6 +1,7 @@
 package db
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/lonng/nanoserver/db/model"
@@ -130,3 +131,165 @@ func BalanceList(uids []string) (map[string]string, error) {
 	return m, nil
 
 }
+
+func orderWalletKey(orderId string) string {
+	return "order:" + orderId
+}
+
+func refundWalletKey(orderId string) string {
+	return "refund:" + orderId
+}
+
+// PendingOrders 创建时间早于before并且还没有支付的订单
+func PendingOrders(before int64, count int) ([]model.Order, error) {
+	list := []model.Order{}
+	err := database.Where("status=? AND created_at<?", OrderStatusCreated, before).
+		Asc("id").Limit(count).Find(&list)
+	if err != nil {
+		logger.Error(err)
+		return nil, errutil.ErrDBOperation
+	}
+	return list, nil
+}
+
+// ExpireOrder 关闭超时未支付的订单, 订单状态已经变化时不做修改
+func ExpireOrder(orderId string) error {
+	_, err := database.Cols("status").Where("order_id=? AND status=?", orderId, OrderStatusCreated).
+		Update(&model.Order{Status: OrderStatusExpired})
+	if err != nil {
+		logger.Error(err)
+		return errutil.ErrDBOperation
+	}
+	return nil
+}
+
+// BeginRefund 开始订单退款, 锁定订单扣回购买的房卡并标记为退款中, 返回订单和扣除后的房卡余额.
+// 退款中的订单可以重试, 扣回房卡使用幂等键, 重试时不会重复扣除
+func BeginRefund(orderId, remark string) (*model.Order, int64, error) {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return nil, 0, err
+	}
+
+	order := &model.Order{OrderId: orderId}
+	has, err := session.ForUpdate().Get(order)
+	if err != nil {
+		session.Rollback()
+		return nil, 0, err
+	}
+	if !has {
+		session.Rollback()
+		return nil, 0, errutil.ErrOrderNotFound
+	}
+	if order.Status != OrderStatusPayed && order.Status != OrderStatusNotified && order.Status != OrderStatusRefunding {
+		session.Rollback()
+		return nil, 0, errutil.ErrOrderStatus
+	}
+
+	coin, _, err := changeWallet(session, &WalletChange{
+		Uid:     order.Uid,
+		Type:    model.WalletOrderRefund,
+		Amount:  -int64(order.ProductCount),
+		RefType: model.WalletRefOrder,
+		RefId:   order.OrderId,
+		Key:     refundWalletKey(order.OrderId),
+		Remark:  remark,
+	})
+	if err != nil {
+		session.Rollback()
+		return nil, 0, err
+	}
+
+	order.Status = OrderStatusRefunding
+	if _, err := session.Cols("status").Where("order_id=?", orderId).Update(order); err != nil {
+		session.Rollback()
+		return nil, 0, err
+	}
+
+	if err := session.Commit(); err != nil {
+		return nil, 0, err
+	}
+	return order, coin, nil
+}
+
+// FinishRefund 支付平台退款成功后, 将退款中的订单标记为已退款
+func FinishRefund(orderId string) error {
+	_, err := database.Cols("status").Where("order_id=? AND status=?", orderId, OrderStatusRefunding).
+		Update(&model.Order{Status: OrderStatusRefunded})
+	if err != nil {
+		logger.Error(err)
+		return errutil.ErrDBOperation
+	}
+	return nil
+}
+
+// OrderMismatch 订单, 交易和房卡流水不一致的订单
+type OrderMismatch struct {
+	OrderId      string
+	Uid          int64
+	Status       int
+	Money        int
+	ProductCount int
+	PayOrderId   string // 为空表示没有交易记录
+	TradeMoney   int
+	Credited     int64 // 购买发放的房卡, 没有流水时为0
+	Refunded     int64 // 退款扣回的房卡, 没有流水时为0
+}
+
+// OrderMismatches 对账, 找出创建时间在[start, end]之间的问题订单:
+// 已支付但是没有交易或者没有发放房卡, 未支付但是有交易或者发放了房卡,
+// 支付金额与订单金额不一致, 已退款但是没有扣回房卡, 支付平台退款没有完成
+func OrderMismatches(start, end int64, offset, count int) ([]OrderMismatch, int64, error) {
+	start, end = algoutil.TimeRange(start, end)
+
+	const from = " FROM `order` o LEFT JOIN trade t ON t.order_id=o.order_id " +
+		"LEFT JOIN wallet_ledger l ON l.idem_key=CONCAT('order:', o.order_id) " +
+		"LEFT JOIN wallet_ledger r ON r.idem_key=CONCAT('refund:', o.order_id) " +
+		"WHERE o.created_at BETWEEN ? AND ? AND (" +
+		"(o.status IN (?, ?, ?, ?) AND (t.id IS NULL OR l.id IS NULL OR l.amount<>o.product_count)) OR " +
+		"(o.status IN (?, ?) AND (t.id IS NOT NULL OR l.id IS NOT NULL)) OR " +
+		"(t.id IS NOT NULL AND t.money<>o.money) OR " +
+		"(o.status IN (?, ?) AND (r.id IS NULL OR r.amount<>-o.product_count)) OR o.status=?)"
+	args := []interface{}{start, end,
+		OrderStatusPayed, OrderStatusNotified, OrderStatusRefunded, OrderStatusRefunding,
+		OrderStatusCreated, OrderStatusExpired,
+		OrderStatusRefunded, OrderStatusRefunding,
+		OrderStatusRefunding}
+
+	result, err := database.Query(append([]interface{}{"SELECT COUNT(*) AS total" + from}, args...)...)
+	if err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+	var total int64
+	if len(result) > 0 {
+		total, _ = strconv.ParseInt(string(result[0]["total"]), 10, 64)
+	}
+
+	query := "SELECT o.order_id, o.uid, o.status, o.money, o.product_count, " +
+		"IFNULL(t.pay_order_id, '') AS pay_order_id, IFNULL(t.money, 0) AS trade_money, " +
+		"IFNULL(l.amount, 0) AS credited, IFNULL(r.amount, 0) AS refunded" + from +
+		" ORDER BY o.id DESC LIMIT ?, ?"
+	result, err = database.Query(append(append([]interface{}{query}, args...), offset, count)...)
+	if err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+
+	list := make([]OrderMismatch, len(result))
+	for i, row := range result {
+		m := &list[i]
+		m.OrderId = string(row["order_id"])
+		m.Uid, _ = strconv.ParseInt(string(row["uid"]), 10, 64)
+		m.Status, _ = strconv.Atoi(string(row["status"]))
+		m.Money, _ = strconv.Atoi(string(row["money"]))
+		m.ProductCount, _ = strconv.Atoi(string(row["product_count"]))
+		m.PayOrderId = string(row["pay_order_id"])
+		m.TradeMoney, _ = strconv.Atoi(string(row["trade_money"]))
+		m.Credited, _ = strconv.ParseInt(string(row["credited"]), 10, 64)
+		m.Refunded, _ = strconv.ParseInt(string(row["refunded"]), 10, 64)
+	}
+	return list, total, nil
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+func QueryProduct(id int64) (*model.Product, error) {
+	p := &model.Product{Id: id}
+	has, err := database.Get(p)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, errutil.ErrProductNotFound
+	}
+	return p, nil
+}
+
+func QueryProductBySku(sku string) (*model.Product, error) {
+	if sku == "" {
+		return nil, errutil.ErrProductNotFound
+	}
+	p := &model.Product{Sku: sku}
+	has, err := database.Get(p)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, errutil.ErrProductNotFound
+	}
+	return p, nil
+}
+
+// InsertProduct 新增商品, SKU不能重复
+func InsertProduct(p *model.Product) error {
+	if p == nil || p.Sku == "" {
+		return errutil.ErrInvalidParameter
+	}
+
+	has, err := database.Exist(&model.Product{Sku: p.Sku})
+	if err != nil {
+		return err
+	}
+	if has {
+		return errutil.ErrSkuExists
+	}
+
+	_, err = database.Insert(p)
+	return err
+}
+
+// UpdateProduct 修改商品, SKU已经被苹果内购和历史订单使用, 不能修改
+func UpdateProduct(p *model.Product) error {
+	if p == nil {
+		return errutil.ErrInvalidParameter
+	}
+	_, err := database.Cols("name", "price", "card_count", "bonus_count", "first_bonus", "first_only",
+		"channels", "sort", "status", "updated_at").Where("id=?", p.Id).Update(p)
+	return err
+}
+
+// ProductList 所有商品, 按排序值和ID排序
+func ProductList() ([]model.Product, error) {
+	list := []model.Product{}
+	if err := database.Asc("sort", "id").Find(&list); err != nil {
+		logger.Error(err)
+		return nil, errutil.ErrDBOperation
+	}
+	return list, nil
+}
+
+// OnSaleProducts 渠道可以购买的商品, firstRecharge为true时包含首充商品
+func OnSaleProducts(channel string, firstRecharge bool) ([]model.Product, error) {
+	list := []model.Product{}
+	if err := database.Where("status=?", model.ProductStatusOnSale).Asc("sort", "id").Find(&list); err != nil {
+		logger.Error(err)
+		return nil, errutil.ErrDBOperation
+	}
+
+	ret := make([]model.Product, 0, len(list))
+	for i := range list {
+		if IsProductAvailable(&list[i], channel, firstRecharge) {
+			ret = append(ret, list[i])
+		}
+	}
+	return ret, nil
+}
+
+// IsProductAvailable 商品是否已上架, 并且对渠道和玩家可用
+func IsProductAvailable(p *model.Product, channel string, firstRecharge bool) bool {
+	if p.Status != model.ProductStatusOnSale {
+		return false
+	}
+	if p.FirstOnly == 1 && !firstRecharge {
+		return false
+	}
+	if p.Channels == "" {
+		return true
+	}
+	for _, c := range strings.Split(p.Channels, ",") {
+		if strings.TrimSpace(c) == channel {
+			return true
+		}
+	}
+	return false
+}
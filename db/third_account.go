@@ -19,6 +19,21 @@ func QueryThirdAccount(account, platform string) (*model.ThirdAccount, error) {
 	return t, nil
 }
 
+// QueryThirdAccountByUid 查询玩家绑定的三方账号, 游客没有三方账号
+func QueryThirdAccountByUid(uid int64) (*model.ThirdAccount, error) {
+	t := &model.ThirdAccount{Uid: uid}
+	has, err := database.Get(t)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, errutil.ErrThirdAccountNotFound
+	}
+
+	return t, nil
+}
+
 func InsertThirdAccount(account *model.ThirdAccount, u *model.User) error {
 	session := database.NewSession()
 	if err := session.Begin(); err != nil {
@@ -31,6 +46,11 @@ func InsertThirdAccount(account *model.ThirdAccount, u *model.User) error {
 		return err
 	}
 
+	if err := registerWallet(session, u); err != nil {
+		session.Rollback()
+		return err
+	}
+
 	// update uid
 	account.Uid = u.Id
 
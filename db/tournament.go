@@ -0,0 +1,157 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+// EncodePrizes 比赛奖励使用逗号隔开保存, 例如: 100,50,20
+func EncodePrizes(prizes []int64) string {
+	parts := make([]string, len(prizes))
+	for i, p := range prizes {
+		parts[i] = strconv.FormatInt(p, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+func DecodePrizes(s string) []int64 {
+	prizes := []int64{}
+	for _, part := range strings.Split(s, ",") {
+		p, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			continue
+		}
+		prizes = append(prizes, p)
+	}
+	return prizes
+}
+
+func InsertTournament(t *model.Tournament) error {
+	if t == nil {
+		return errutil.ErrInvalidParameter
+	}
+	_, err := database.Insert(t)
+	return err
+}
+
+func QueryTournament(id int64) (*model.Tournament, error) {
+	t := &model.Tournament{Id: id}
+	has, err := database.Get(t)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, errutil.ErrNotFound
+	}
+
+	return t, nil
+}
+
+func UpdateTournament(t *model.Tournament) error {
+	if t == nil {
+		return errutil.ErrInvalidParameter
+	}
+	_, err := database.Where("id=?", t.Id).AllCols().Update(t)
+	return err
+}
+
+// TournamentList 比赛列表, status为0时返回所有状态的比赛
+func TournamentList(status, offset, count int) ([]model.Tournament, int64, error) {
+	bean := &model.Tournament{Status: status}
+	total, err := database.Count(bean)
+	if err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+
+	result := make([]model.Tournament, 0)
+	if err := database.Limit(count, offset).Desc("start_at").Find(&result, bean); err != nil {
+		return nil, 0, errutil.ErrDBOperation
+	}
+	return result, total, nil
+}
+
+// ActiveTournaments 报名中和进行中的比赛, 服务器启动时加载
+func ActiveTournaments() ([]model.Tournament, error) {
+	result := make([]model.Tournament, 0)
+	err := database.In("status", model.TournamentStatusRegistering, model.TournamentStatusRunning).
+		Asc("start_at").Find(&result)
+	return result, err
+}
+
+func TournamentPlayers(id int64) ([]model.TournamentPlayer, error) {
+	result := make([]model.TournamentPlayer, 0)
+	err := database.Where("tournament_id=?", id).Asc("id").Find(&result)
+	return result, err
+}
+
+// TournamentPlayerCount 报名人数, 不包括退赛的玩家
+func TournamentPlayerCount(id int64) (int64, error) {
+	return database.Where("tournament_id=? AND status<>?", id, model.TournamentPlayerRefunded).
+		Count(&model.TournamentPlayer{})
+}
+
+func UpdateTournamentPlayer(tp *model.TournamentPlayer) error {
+	if tp == nil {
+		return errutil.ErrInvalidParameter
+	}
+	_, err := database.Where("id=?", tp.Id).AllCols().Update(tp)
+	return err
+}
+
+// 在同一个事务中修改玩家房卡和参赛记录, 返回修改后的房卡数量
+func tournamentCoinChange(tp *model.TournamentPlayer, coin int64, insert bool) (int64, error) {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return 0, err
+	}
+
+	balance, _, err := changeWallet(session, &WalletChange{
+		Uid:     tp.Uid,
+		Type:    model.WalletTournament,
+		Amount:  coin,
+		RefType: model.WalletRefTournament,
+		RefId:   strconv.FormatInt(tp.TournamentId, 10),
+	})
+	if err != nil {
+		session.Rollback()
+		return 0, err
+	}
+
+	if insert {
+		_, err = session.Insert(tp)
+	} else {
+		_, err = session.Where("id=?", tp.Id).AllCols().Update(tp)
+	}
+	if err != nil {
+		session.Rollback()
+		return 0, err
+	}
+
+	if err := session.Commit(); err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
+// RegisterTournament 报名比赛并扣除报名费
+func RegisterTournament(tp *model.TournamentPlayer, fee int64) (int64, error) {
+	return tournamentCoinChange(tp, -fee, true)
+}
+
+// RefundTournament 退赛或比赛取消, 退还报名费
+func RefundTournament(tp *model.TournamentPlayer, fee int64) (int64, error) {
+	tp.Status = model.TournamentPlayerRefunded
+	return tournamentCoinChange(tp, fee, false)
+}
+
+// TournamentPayout 保存最终名次并发放奖励
+func TournamentPayout(tp *model.TournamentPlayer) (int64, error) {
+	return tournamentCoinChange(tp, tp.Prize, false)
+}
@@ -6,56 +6,132 @@ import (
 	"github.com/lonng/nanoserver/pkg/errutil"
 )
 
-func InsertTrade(t *model.Trade) error {
+// InsertTrade 保存交易并给玩家发放房卡, 返回发放后的房卡余额, 同一笔交易的
+// 重复通知返回ErrTradeExisted, 订单已经使用其他交易支付时返回ErrOrderStatus
+func InsertTrade(t *model.Trade) (int64, error) {
 	logger.Info("insert trade, order id: " + t.OrderId)
 
+	sess := database.NewSession()
+	defer sess.Close()
+
+	// 开始事务
+	if err := sess.Begin(); err != nil {
+		return 0, err
+	}
+
+	// 锁定订单, 同一个订单的通知串行处理
+	order := &model.Order{OrderId: t.OrderId}
+	has, err := sess.ForUpdate().Get(order)
+	if err != nil {
+		sess.Rollback()
+		return 0, err
+	}
+	if !has {
+		sess.Rollback()
+		return 0, errutil.ErrOrderNotFound
+	}
+
 	trade := &model.Trade{OrderId: t.OrderId}
-	has, err := database.Get(trade)
+	has, err = sess.Get(trade)
 	if err != nil {
-		return err
+		sess.Rollback()
+		return 0, err
 	}
 	if has {
-		return errutil.ErrTradeExisted
+		sess.Rollback()
+		err := tradeConflict(trade, t)
+		if err == errutil.ErrOrderStatus {
+			logger.Errorf("订单已经使用其他交易支付: OrderId=%s, 交易号=%s, 新交易号=%s", t.OrderId, trade.PayOrderId, t.PayOrderId)
+		}
+		return 0, err
+	}
+
+	// 超时关闭的订单仍然可以接收支付成功的通知
+	if order.Status != OrderStatusCreated && order.Status != OrderStatusExpired {
+		sess.Rollback()
+		return 0, errutil.ErrOrderStatus
 	}
-	order, err := QueryOrder(t.OrderId)
+
+	// 同一笔支付不能用于多个订单
+	has, err = sess.Exist(&model.Trade{PayPlatform: t.PayPlatform, PayOrderId: t.PayOrderId})
 	if err != nil {
-		return err
+		sess.Rollback()
+		return 0, err
+	}
+	if has {
+		sess.Rollback()
+		return 0, errutil.ErrTradeUsed
 	}
+
 	if order.Type == OrderTypeBuyToken {
 		order.Status = OrderStatusNotified
 	} else {
 		order.Status = OrderStatusPayed
 	}
-	sess := database.NewSession()
 
-	// 开始事务
-	sess.Begin()
-	defer sess.Close()
-	if _, err := sess.Insert(t); err != nil {
-		println(err.Error())
+	// 锁定玩家, 创建订单时的首充状态可能已经被其他订单改变
+	u := &model.User{}
+	has, err = sess.Id(order.Uid).ForUpdate().Get(u)
+	if err != nil {
+		sess.Rollback()
+		return 0, err
+	}
+	if !has {
 		sess.Rollback()
-		return err
+		return 0, errutil.ErrUserNotFound
 	}
 
-	if _, err := sess.Where("order_id = ?", order.OrderId).Update(order); err != nil {
-		println(err.Error())
+	// 已经充值过的玩家不再赠送首充房卡, 首充专享商品已经支付, 只发放商品本身的房卡
+	if u.FirstRechargeAt != 0 && order.FirstBonus > 0 {
+		logger.Warnf("玩家已经充值过, 不再赠送首充房卡: OrderId=%s, Uid=%d, 首充赠送=%d", order.OrderId, order.Uid, order.FirstBonus)
+		order.ProductCount -= order.FirstBonus
+		order.FirstBonus = 0
+	}
+
+	if _, err := sess.Insert(t); err != nil {
 		sess.Rollback()
-		return err
+		return 0, err
 	}
 
-	u := &model.User{}
-	sess.Where("uid = ?", order.Uid).Get(u)
+	if _, err := sess.Cols("status", "product_count", "first_bonus").Where("order_id = ?", order.OrderId).Update(order); err != nil {
+		sess.Rollback()
+		return 0, err
+	}
 
 	//添加首充时间
 	if u.FirstRechargeAt == 0 {
 		u.FirstRechargeAt = order.CreatedAt
-		if _, err = sess.Id(u.Id).Update(u); err != nil {
+		if _, err = sess.Id(u.Id).Cols("first_recharge_at").Update(u); err != nil {
 			sess.Rollback()
-			return err
+			return 0, err
 		}
 	}
 
-	return sess.Commit()
+	coin, _, err := changeWallet(sess, &WalletChange{
+		Uid:     order.Uid,
+		Type:    model.WalletOrder,
+		Amount:  int64(order.ProductCount),
+		RefType: model.WalletRefOrder,
+		RefId:   order.OrderId,
+		Key:     orderWalletKey(order.OrderId),
+	})
+	if err != nil {
+		sess.Rollback()
+		return 0, err
+	}
+
+	if err := sess.Commit(); err != nil {
+		return 0, err
+	}
+	return coin, nil
+}
+
+// 订单已经有交易时: 同一笔交易的重复通知返回ErrTradeExisted, 其他交易返回ErrOrderStatus
+func tradeConflict(old, t *model.Trade) error {
+	if old.PayPlatform == t.PayPlatform && old.PayOrderId == t.PayOrderId {
+		return errutil.ErrTradeExisted
+	}
+	return errutil.ErrOrderStatus
 }
 
 func TradeList(appid, channelID, orderID string, start, end int64, offset, count int) ([]ViewTrade, int, error) {
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+func TestTradeConflict(t *testing.T) {
+	old := &model.Trade{OrderId: "o1", PayPlatform: "wechat", PayOrderId: "t1"}
+
+	cases := []struct {
+		name  string
+		trade model.Trade
+		err   error
+	}{
+		{"duplicate notify", model.Trade{OrderId: "o1", PayPlatform: "wechat", PayOrderId: "t1"}, errutil.ErrTradeExisted},
+		{"other trade", model.Trade{OrderId: "o1", PayPlatform: "wechat", PayOrderId: "t2"}, errutil.ErrOrderStatus},
+		{"other platform", model.Trade{OrderId: "o1", PayPlatform: "alipay", PayOrderId: "t1"}, errutil.ErrOrderStatus},
+	}
+
+	for _, c := range cases {
+		if err := tradeConflict(old, &c.trade); err != c.err {
+			t.Fatalf("%s: expect %v, got %v", c.name, c.err, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"time"
+
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+func InsertVerification(v *model.Verification) error {
+	if v == nil {
+		return errutil.ErrInvalidParameter
+	}
+	_, err := database.Insert(v)
+	return err
+}
+
+// VerificationWrongPassword 密码错误的记录保存在验证码表中, 用于限制密码错误的次数,
+// 不能用于验证, 也不计入验证码的发送次数
+const VerificationWrongPassword = "password"
+
+// VerificationLimit 验证码的频率限制, 从Since开始与Bean中的手机号或者IP相同的记录不能达到Max
+type VerificationLimit struct {
+	Bean  *model.Verification
+	Since int64
+	Max   int
+}
+
+// InsertVerificationLimited 在同一个事务中检查频率限制并保存验证码, 超过限制时返回ErrFrequencyLimited.
+// 使用锁定读取, 并发的请求需要等待之前的事务结束后才能检查
+func InsertVerificationLimited(v *model.Verification, limits []VerificationLimit) error {
+	if v == nil {
+		return errutil.ErrInvalidParameter
+	}
+
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	for _, l := range limits {
+		list := []model.Verification{}
+		err := session.Cols("id").Where("created_at>=? AND type<>?", l.Since, VerificationWrongPassword).
+			ForUpdate().Find(&list, l.Bean)
+		if err != nil {
+			session.Rollback()
+			return err
+		}
+		if len(list) >= l.Max {
+			session.Rollback()
+			return errutil.ErrFrequencyLimited
+		}
+	}
+
+	if _, err := session.Insert(v); err != nil {
+		session.Rollback()
+		return err
+	}
+	return session.Commit()
+}
+
+// VerificationCount 从since开始发送的验证码数量, 使用bean中的手机号或者IP过滤
+func VerificationCount(bean *model.Verification, since int64) (int64, error) {
+	count, err := database.Where("created_at>=?", since).Count(bean)
+	if err != nil {
+		logger.Error(err)
+		return 0, errutil.ErrDBOperation
+	}
+	return count, nil
+}
+
+// UseVerification 校验手机号最新的一条验证码, 成功后验证码失效,
+// 错误次数达到maxAttempts后验证码同样失效, 需要重新发送
+func UseVerification(phone, typ, code string, maxAttempts int) error {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	v := &model.Verification{}
+	has, err := session.Where("phone=? AND type=? AND used_at=0 AND expire_at>?", phone, typ, now).
+		Desc("id").ForUpdate().Get(v)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	if !has {
+		session.Rollback()
+		return errutil.ErrVerificationInvalid
+	}
+
+	var ret error
+	if v.Code == code {
+		v.UsedAt = now
+	} else {
+		v.Attempts++
+		if v.Attempts >= maxAttempts {
+			v.UsedAt = now
+		}
+		ret = errutil.ErrVerificationInvalid
+	}
+
+	if _, err := session.Cols("attempts", "used_at").Where("id=?", v.Id).Update(v); err != nil {
+		session.Rollback()
+		return err
+	}
+
+	if err := session.Commit(); err != nil {
+		return err
+	}
+	return ret
+}
+
+// InsertWrongPassword 记录一次密码错误
+func InsertWrongPassword(phone, ip string) error {
+	now := time.Now().Unix()
+	return InsertVerification(&model.Verification{
+		Phone:     phone,
+		Type:      VerificationWrongPassword,
+		Ip:        ip,
+		ExpireAt:  now,
+		UsedAt:    now,
+		CreatedAt: now,
+	})
+}
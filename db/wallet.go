@@ -0,0 +1,282 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-xorm/xorm"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/pborman/uuid"
+)
+
+// WalletChange 一次房卡变化, 扣除时Amount为负数
+type WalletChange struct {
+	Uid     int64
+	Type    int
+	Amount  int64
+	RefType int
+	RefId   string
+	Key     string // 幂等键, 为空时自动生成, 即不做幂等检查
+	Remark  string
+}
+
+// ChangeWallet 修改玩家房卡并写入流水, beans为需要在同一个事务中写入的业务数据,
+// 幂等键已经存在时不做任何修改, 返回变化后的房卡余额
+func ChangeWallet(c *WalletChange, beans ...interface{}) (int64, error) {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return 0, err
+	}
+
+	balance, dup, err := changeWallet(session, c)
+	if err != nil {
+		session.Rollback()
+		return 0, err
+	}
+
+	// 重复的请求不再写入业务数据
+	if !dup && len(beans) > 0 {
+		if _, err := session.Insert(beans...); err != nil {
+			session.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := session.Commit(); err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
+// 幂等键已经存在时, 同一个玩家同样数量的变化视为重复请求, 返回当时的余额
+func walletReplay(l *model.WalletLedger, c *WalletChange) (int64, error) {
+	if l.Uid != c.Uid || l.Amount != c.Amount {
+		return 0, errutil.ErrWalletKeyConflict
+	}
+	return l.Balance, nil
+}
+
+// 一次房卡变化需要写入的流水, opening为true时先补记变化前的余额作为期初余额
+func walletEntries(coin int64, opening bool, c *WalletChange, key string, now int64) []*model.WalletLedger {
+	entries := []*model.WalletLedger{}
+	if opening {
+		entries = append(entries, &model.WalletLedger{
+			Uid:       c.Uid,
+			Type:      model.WalletOpening,
+			Amount:    coin,
+			Balance:   coin,
+			IdemKey:   fmt.Sprintf("opening:%d", c.Uid),
+			CreatedAt: now,
+		})
+	}
+	return append(entries, &model.WalletLedger{
+		Uid:       c.Uid,
+		Type:      c.Type,
+		Amount:    c.Amount,
+		Balance:   coin + c.Amount,
+		RefType:   c.RefType,
+		RefId:     c.RefId,
+		IdemKey:   key,
+		Remark:    c.Remark,
+		CreatedAt: now,
+	})
+}
+
+// 在已经开始的事务中修改房卡, dup为true表示幂等键已经存在
+func changeWallet(session *xorm.Session, c *WalletChange) (balance int64, dup bool, err error) {
+	// 先锁定玩家再检查幂等键, 同一个玩家的房卡变化依次执行
+	u := &model.User{Id: c.Uid}
+	has, err := session.ForUpdate().Get(u)
+	if err != nil {
+		return 0, false, err
+	}
+	if !has {
+		return 0, false, errutil.ErrUserNotFound
+	}
+
+	key := c.Key
+	if key != "" {
+		l := &model.WalletLedger{IdemKey: key}
+		has, err := session.Get(l)
+		if err != nil {
+			return 0, false, err
+		}
+		if has {
+			balance, err := walletReplay(l, c)
+			return balance, err == nil, err
+		}
+	} else {
+		key = strings.Replace(uuid.New(), "-", "", -1)
+	}
+	if u.Coin+c.Amount < 0 {
+		return 0, false, errutil.ErrCoinNotEnough
+	}
+
+	// 免费的比赛等没有变化时不记录流水
+	if c.Amount == 0 {
+		return u.Coin, false, nil
+	}
+
+	// 启用流水之前注册的玩家没有任何记录, 第一次变化时补记期初余额
+	opening := false
+	if u.Coin != 0 {
+		has, err := session.Exist(&model.WalletLedger{Uid: c.Uid})
+		if err != nil {
+			return 0, false, err
+		}
+		opening = !has
+	}
+
+	entries := walletEntries(u.Coin, opening, c, key, time.Now().Unix())
+	u.Coin += c.Amount
+	if _, err := session.Cols("coin").Where("id=?", u.Id).Update(u); err != nil {
+		return 0, false, err
+	}
+
+	for _, l := range entries {
+		if _, err := session.Insert(l); err != nil {
+			return 0, false, err
+		}
+	}
+	return u.Coin, false, nil
+}
+
+// RefundDeskCoin 退还玩家幂等键为key的开房消耗, 没有扣除记录时不做任何修改并返回ErrNotFound,
+// consume不为空时同时记录一条负数的房卡消耗, 返回退还后的房卡余额
+func RefundDeskCoin(uid int64, key, refundKey string, consume *model.CardConsume) (int64, error) {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return 0, err
+	}
+
+	// 与扣除房卡一样先锁定玩家, 扣除和退还依次执行
+	u := &model.User{Id: uid}
+	has, err := session.ForUpdate().Get(u)
+	if err != nil {
+		session.Rollback()
+		return 0, err
+	}
+	if !has {
+		session.Rollback()
+		return 0, errutil.ErrUserNotFound
+	}
+
+	l := &model.WalletLedger{IdemKey: key}
+	has, err = session.Get(l)
+	if err != nil {
+		session.Rollback()
+		return 0, err
+	}
+	if !has {
+		session.Rollback()
+		return 0, errutil.ErrNotFound
+	}
+	if l.Uid != uid || l.Amount >= 0 {
+		session.Rollback()
+		return 0, errutil.ErrNotFound
+	}
+
+	balance, dup, err := changeWallet(session, &WalletChange{
+		Uid:     l.Uid,
+		Type:    model.WalletDeskRefund,
+		Amount:  -l.Amount,
+		RefType: l.RefType,
+		RefId:   l.RefId,
+		Key:     refundKey,
+	})
+	if err != nil {
+		session.Rollback()
+		return 0, err
+	}
+
+	if !dup && consume != nil {
+		consume.CardCount = int(l.Amount)
+		if _, err := session.Insert(consume); err != nil {
+			session.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := session.Commit(); err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
+// 新注册的玩家, 在插入玩家的事务中记录赠送的房卡
+func registerWallet(session *xorm.Session, u *model.User) error {
+	if u.Coin == 0 {
+		return nil
+	}
+
+	_, err := session.Insert(&model.WalletLedger{
+		Uid:       u.Id,
+		Type:      model.WalletRegister,
+		Amount:    u.Coin,
+		Balance:   u.Coin,
+		IdemKey:   fmt.Sprintf("opening:%d", u.Id),
+		CreatedAt: time.Now().Unix(),
+	})
+	return err
+}
+
+// WalletLedgers 玩家的房卡流水, 按时间倒序
+func WalletLedgers(uid int64, offset, count int) ([]model.WalletLedger, int64, error) {
+	bean := &model.WalletLedger{Uid: uid}
+	total, err := database.Count(bean)
+	if err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+
+	list := []model.WalletLedger{}
+	if err := database.Limit(count, offset).Desc("id").Find(&list, bean); err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+	return list, total, nil
+}
+
+// WalletMismatch 房卡余额与流水合计不一致的玩家
+type WalletMismatch struct {
+	Uid    int64
+	Coin   int64
+	Ledger int64
+}
+
+// ReconcileWallet 对账, 找出房卡余额与流水合计不一致的玩家, 没有任何流水的玩家不参与对账
+func ReconcileWallet(offset, count int) ([]WalletMismatch, int64, error) {
+	const mismatch = "SELECT u.id AS uid, u.coin AS coin, SUM(l.amount) AS ledger FROM `user` u " +
+		"INNER JOIN wallet_ledger l ON l.uid=u.id GROUP BY u.id, u.coin HAVING u.coin<>SUM(l.amount)"
+
+	result, err := database.Query("SELECT COUNT(*) AS total FROM (" + mismatch + ") t")
+	if err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+	var total int64
+	if len(result) > 0 {
+		total, _ = strconv.ParseInt(string(result[0]["total"]), 10, 64)
+	}
+
+	result, err = database.Query(mismatch+" ORDER BY u.id LIMIT ?, ?", offset, count)
+	if err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+
+	list := make([]WalletMismatch, len(result))
+	for i, row := range result {
+		list[i].Uid, _ = strconv.ParseInt(string(row["uid"]), 10, 64)
+		list[i].Coin, _ = strconv.ParseInt(string(row["coin"]), 10, 64)
+		list[i].Ledger, _ = strconv.ParseInt(string(row["ledger"]), 10, 64)
+	}
+	return list, total, nil
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+func TestWalletReplay(t *testing.T) {
+	ledger := &model.WalletLedger{Uid: 1, Amount: -10, Balance: 90, IdemKey: "desk:1:100"}
+
+	cases := []struct {
+		name    string
+		change  WalletChange
+		balance int64
+		err     error
+	}{
+		{"same change", WalletChange{Uid: 1, Amount: -10}, 90, nil},
+		{"other user", WalletChange{Uid: 2, Amount: -10}, 0, errutil.ErrWalletKeyConflict},
+		{"other amount", WalletChange{Uid: 1, Amount: -20}, 0, errutil.ErrWalletKeyConflict},
+		{"refund with debit key", WalletChange{Uid: 1, Amount: 10}, 0, errutil.ErrWalletKeyConflict},
+	}
+
+	for _, c := range cases {
+		balance, err := walletReplay(ledger, &c.change)
+		if balance != c.balance || err != c.err {
+			t.Fatalf("%s: expect (%d, %v), got (%d, %v)", c.name, c.balance, c.err, balance, err)
+		}
+	}
+}
+
+// 房主支付的房间解散后, 没有扣除房卡的玩家不会写入任何流水, 之后第一次变化时补记期初余额
+func TestWalletEntries(t *testing.T) {
+	cases := []struct {
+		name    string
+		coin    int64
+		opening bool
+		amount  int64
+		expect  []int64 // 每条流水的数量
+	}{
+		{"first change without ledger", 10, true, 5, []int64{10, 5}},
+		{"with ledger", 10, false, -3, []int64{-3}},
+	}
+
+	for _, c := range cases {
+		entries := walletEntries(c.coin, c.opening, &WalletChange{Uid: 1, Type: model.WalletOrder, Amount: c.amount}, "k", 0)
+		if len(entries) != len(c.expect) {
+			t.Fatalf("%s: expect %d entries, got %d", c.name, len(c.expect), len(entries))
+		}
+
+		// 流水合计等于变化后的余额, 对账不会报告不一致
+		sum := int64(0)
+		for i, l := range entries {
+			if l.Amount != c.expect[i] {
+				t.Fatalf("%s: entry %d expect %d, got %d", c.name, i, c.expect[i], l.Amount)
+			}
+			sum += l.Amount
+		}
+		last := entries[len(entries)-1]
+		if c.opening && (sum != last.Balance || last.Balance != c.coin+c.amount) {
+			t.Fatalf("%s: ledger sum %d, balance %d, expect %d", c.name, sum, last.Balance, c.coin+c.amount)
+		}
+	}
+}
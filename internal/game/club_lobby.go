@@ -0,0 +1,260 @@
+package game
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lonng/nano/scheduler"
+	"github.com/lonng/nano/session"
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/async"
+	"github.com/lonng/nanoserver/pkg/constant"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/pkg/room"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+const clubLobbyInterval = 30 * time.Second // 定时检查模板是否有空闲房间
+
+var clubLobbyNotMember = &protocol.ErrorResponse{Code: errorCode, Error: "俱乐部成员才可查看俱乐部房间"}
+
+// 俱乐部房间模板
+type clubTemplate struct {
+	id     int64
+	clubId int64
+	name   string
+	opts   *protocol.DeskOptions
+}
+
+func newClubTemplate(t *model.ClubTemplate) (*clubTemplate, error) {
+	opts := &protocol.DeskOptions{}
+	if err := json.Unmarshal([]byte(t.Options), opts); err != nil {
+		return nil, err
+	}
+	return &clubTemplate{id: t.Id, clubId: t.ClubId, name: t.Name, opts: opts}, nil
+}
+
+func (t *clubTemplate) info() protocol.ClubTemplate {
+	return protocol.ClubTemplate{Id: t.id, ClubId: t.clubId, Name: t.name, Options: *t.opts}
+}
+
+// 是否是模板的空闲房间: 还没有开始并且人数未满
+func (t *clubTemplate) isOpen(d *Desk) bool {
+	return d.template == t.id && !d.isDestroy() &&
+		d.status() == constant.DeskStatusCreate && len(d.players) < d.totalPlayerCount()
+}
+
+func (c *ClubManager) AfterInit() {
+	scheduler.NewTimer(clubLobbyInterval, func() {
+		for _, t := range c.templates {
+			c.refill(t)
+		}
+	})
+}
+
+// 模板没有空闲房间时创建一张新的房间, 房间没有房主, 由俱乐部支付房卡
+func (c *ClubManager) refill(t *clubTemplate) {
+	if isDraining() {
+		return
+	}
+
+	for _, d := range defaultDeskManager.desks {
+		if t.isOpen(d) {
+			return
+		}
+	}
+
+	opts := *t.opts
+	no := room.Next()
+	d := NewDesk(no, &opts, t.clubId)
+	d.template = t.id
+	d.createdAt = time.Now().Unix()
+	defaultDeskManager.setDesk(no, d)
+	d.logger.Infof("创建俱乐部模板房间: 俱乐部ID=%d, 模板=%s", t.clubId, t.name)
+}
+
+// 新增或者修改模板, 旧模板的空房间解散后按照新的选项重新创建
+func (c *ClubManager) setTemplate(t *clubTemplate) {
+	c.removeTemplate(t.id)
+	c.templates[t.id] = t
+	c.refill(t)
+}
+
+// 删除模板, 已经有玩家的房间保留
+func (c *ClubManager) removeTemplate(id int64) {
+	if _, ok := c.templates[id]; !ok {
+		return
+	}
+	delete(c.templates, id)
+
+	for _, d := range defaultDeskManager.desks {
+		if d.template == id && len(d.players) == 0 && !d.isDestroy() {
+			d.destroy()
+		}
+	}
+}
+
+// 有玩家加入模板房间后, 房间满员时补充新的空闲房间
+func (c *ClubManager) onDeskJoined(d *Desk) {
+	if d.template == 0 || len(d.players) < d.totalPlayerCount() {
+		return
+	}
+	if t, ok := c.templates[d.template]; ok {
+		c.refill(t)
+	}
+}
+
+// LoadClubTemplates 数据库启动后加载所有俱乐部的房间模板
+func LoadClubTemplates() {
+	async.Run(func() {
+		list, err := db.ClubTemplates(0)
+		if err != nil {
+			logger.Errorf("加载俱乐部房间模板失败, Error=%v", err)
+			return
+		}
+
+		for i := range list {
+			t, err := newClubTemplate(&list[i])
+			if err != nil {
+				logger.Errorf("解析俱乐部房间模板失败, ID=%d, Error=%v", list[i].Id, err)
+				continue
+			}
+			scheduler.PushTask(func() {
+				defaultClubManager.setTemplate(t)
+			})
+		}
+	})
+}
+
+// SaveClubTemplate 部长新增或者修改房间模板
+func SaveClubTemplate(operator int64, req *protocol.ClubTemplateRequest) (*protocol.ClubTemplate, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > 16 || !verifyOptions(req.Options) {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	// 四人模式默认可以平胡, 模板房间没有房主, 不能添加机器人
+	opts := *req.Options
+	if opts.Mode == ModeFours {
+		opts.Pinghu = true
+	}
+	opts.Robot = false
+
+	data, err := json.Marshal(&opts)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &model.ClubTemplate{Id: req.Id, ClubId: req.ClubId, Name: name, Options: string(data)}
+	if err := db.SaveClubTemplate(operator, m); err != nil {
+		return nil, err
+	}
+
+	t := &clubTemplate{id: m.Id, clubId: m.ClubId, name: m.Name, opts: &opts}
+	scheduler.PushTask(func() {
+		defaultClubManager.setTemplate(t)
+	})
+
+	info := t.info()
+	return &info, nil
+}
+
+// DeleteClubTemplate 部长删除房间模板
+func DeleteClubTemplate(operator, clubId, id int64) error {
+	if err := db.DeleteClubTemplate(operator, clubId, id); err != nil {
+		return err
+	}
+
+	scheduler.PushTask(func() {
+		defaultClubManager.removeTemplate(id)
+	})
+	return nil
+}
+
+// 俱乐部的房间模板列表
+func (c *ClubManager) ClubTemplates(s *session.Session, req *protocol.ClubRequest) error {
+	list := []protocol.ClubTemplate{}
+	for _, t := range c.templates {
+		if t.clubId == req.ClubId {
+			list = append(list, t.info())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Id < list[j].Id })
+	return s.Response(&protocol.ClubTemplateListResponse{Data: list})
+}
+
+func (c *ClubManager) SaveTemplate(s *session.Session, req *protocol.ClubTemplateRequest) error {
+	mid := s.LastMid()
+	async.Run(func() {
+		t, err := SaveClubTemplate(s.UID(), req)
+		if err != nil {
+			s.ResponseMID(mid, &protocol.ErrorResponse{Code: errorCode, Error: err.Error()})
+			return
+		}
+		s.ResponseMID(mid, &protocol.ClubTemplateResponse{Data: *t})
+	})
+	return nil
+}
+
+func (c *ClubManager) DeleteTemplate(s *session.Session, req *protocol.ClubTemplateRequest) error {
+	mid := s.LastMid()
+	async.Run(func() {
+		if err := DeleteClubTemplate(s.UID(), req.ClubId, req.Id); err != nil {
+			s.ResponseMID(mid, &protocol.ErrorResponse{Code: errorCode, Error: err.Error()})
+			return
+		}
+		s.ResponseMID(mid, &protocol.SuccessResponse)
+	})
+	return nil
+}
+
+// 俱乐部大厅: 所有未开始和进行中的俱乐部房间, 玩家通过Join加入
+func (c *ClubManager) ClubDesks(s *session.Session, req *protocol.ClubRequest) error {
+	if !db.IsClubMember(req.ClubId, s.UID()) {
+		return s.Response(clubLobbyNotMember)
+	}
+
+	list := []protocol.ClubDesk{}
+	for _, d := range defaultDeskManager.desks {
+		if d.clubId != req.ClubId || d.isDestroy() {
+			continue
+		}
+
+		cd := protocol.ClubDesk{
+			TableInfo: protocol.TableInfo{
+				DeskNo:    d.roomNo.String(),
+				CreatedAt: d.createdAt,
+				Creator:   d.creator,
+				Title:     d.title(),
+				Desc:      d.desc(true),
+				Status:    d.status(),
+				Round:     d.round,
+				Mode:      d.opts.Mode,
+			},
+			Template: d.template,
+			MaxRound: d.opts.MaxRound,
+			Players:  []protocol.ClubDeskPlayer{},
+		}
+		for _, p := range d.players {
+			cd.Players = append(cd.Players, protocol.ClubDeskPlayer{Uid: p.Uid(), Name: p.name, HeadUrl: p.head})
+		}
+		list = append(list, cd)
+	}
+
+	// 空闲房间排在前面, 人数多的优先
+	sort.SliceStable(list, func(i, j int) bool {
+		oi, oj := list[i].TableInfo.Status == constant.DeskStatusCreate, list[j].TableInfo.Status == constant.DeskStatusCreate
+		if oi != oj {
+			return oi
+		}
+		if len(list[i].Players) != len(list[j].Players) {
+			return len(list[i].Players) > len(list[j].Players)
+		}
+		return list[i].TableInfo.CreatedAt < list[j].TableInfo.CreatedAt
+	})
+	return s.Response(&protocol.ClubDeskListResponse{Data: list})
+}
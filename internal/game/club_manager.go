@@ -1,17 +1,34 @@
 package game
 
 import (
+	"fmt"
+
+	"github.com/lonng/nanoserver/db/model"
 	"github.com/lonng/nanoserver/protocol"
 
 	"github.com/lonng/nanoserver/db"
 	"github.com/lonng/nanoserver/pkg/async"
 
 	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/scheduler"
 	"github.com/lonng/nano/session"
 )
 
+const defaultClubLowBalance = 20 // 默认的俱乐部房卡不足提醒值
+
+var clubLowBalance int64 = defaultClubLowBalance
+
 type ClubManager struct {
 	component.Base
+	templates map[int64]*clubTemplate // 所有俱乐部的房间模板
+}
+
+var defaultClubManager = NewClubManager()
+
+func NewClubManager() *ClubManager {
+	return &ClubManager{
+		templates: map[int64]*clubTemplate{},
+	}
 }
 
 func (c *ClubManager) ApplyClub(s *session.Session, payload *protocol.ApplyClubRequest) error {
@@ -29,3 +46,161 @@ func (c *ClubManager) ApplyClub(s *session.Session, payload *protocol.ApplyClubR
 	})
 	return nil
 }
+
+func clubItem(c *model.Club) protocol.ClubItem {
+	return protocol.ClubItem{
+		Id:        c.ClubId,
+		Name:      c.Name,
+		Desc:      c.Desc,
+		Member:    c.Member,
+		MaxMember: c.MaxMember,
+		Balance:   c.Balance,
+	}
+}
+
+// NotifyClub 通知被审核/踢出/修改角色的玩家, 玩家不在线时忽略
+func NotifyClub(uid int64, typ int, c *model.Club, role int) {
+	notify := &protocol.ClubNotify{Type: typ, Club: clubItem(c), Role: role}
+	switch typ {
+	case protocol.ClubNotifyApproved:
+		notify.Message = fmt.Sprintf("你已加入俱乐部[%s]", c.Name)
+	case protocol.ClubNotifyRejected:
+		notify.Message = fmt.Sprintf("俱乐部[%s]拒绝了你的申请", c.Name)
+	case protocol.ClubNotifyKicked:
+		notify.Message = fmt.Sprintf("你已被移出俱乐部[%s]", c.Name)
+	case protocol.ClubNotifyRoleChanged:
+		notify.Message = fmt.Sprintf("你在俱乐部[%s]的角色已变更", c.Name)
+	}
+
+	scheduler.PushTask(func() {
+		p, ok := defaultManager.player(uid)
+		if !ok || p.session == nil {
+			return
+		}
+		p.session.Push(protocol.RouteClubNotify, notify)
+	})
+}
+
+// 俱乐部房卡余额低于提醒值时通知在线的部长和管理员, 在异步任务中调用
+func alertClubBalance(clubId int64) {
+	c, err := db.QueryClub(clubId)
+	if err != nil {
+		logger.Errorf("查询俱乐部失败, 俱乐部ID=%d, Error=%v", clubId, err)
+		return
+	}
+
+	uids, err := db.ClubAdmins(clubId)
+	if err != nil {
+		logger.Errorf("查询俱乐部管理员失败, 俱乐部ID=%d, Error=%v", clubId, err)
+		return
+	}
+
+	alert := &protocol.ClubBalanceAlert{
+		Club:      clubItem(c),
+		Threshold: clubLowBalance,
+		Message:   fmt.Sprintf("俱乐部[%s]房卡余额不足%d张, 请及时充值", c.Name, clubLowBalance),
+	}
+	logger.Infof("俱乐部房卡不足: 俱乐部ID=%d, 余额=%d", clubId, c.Balance)
+
+	scheduler.PushTask(func() {
+		for _, uid := range uids {
+			if p, ok := defaultManager.player(uid); ok && p.session != nil {
+				p.session.Push(protocol.RouteClubBalanceLow, alert)
+			}
+		}
+	})
+}
+
+// 异步执行俱乐部管理操作, 成功后通知被操作的玩家
+func (c *ClubManager) operate(s *session.Session, uid int64, typ, role int, fn func() (*model.Club, error)) {
+	mid := s.LastMid()
+	async.Run(func() {
+		club, err := fn()
+		if err != nil {
+			logger.Warnf("俱乐部管理操作失败, 操作者=%d, 玩家=%d, 类型=%d, Error=%v", s.UID(), uid, typ, err)
+			s.ResponseMID(mid, &protocol.ErrorResponse{Code: errorCode, Error: err.Error()})
+			return
+		}
+
+		logger.Infof("俱乐部管理操作, 俱乐部ID=%d, 操作者=%d, 玩家=%d, 类型=%d", club.ClubId, s.UID(), uid, typ)
+		s.ResponseMID(mid, &protocol.SuccessResponse)
+		NotifyClub(uid, typ, club, role)
+	})
+}
+
+// 成员列表或者申请列表, 申请列表只有部长和管理员可以查看
+func (c *ClubManager) members(s *session.Session, clubId int64, status int) {
+	mid, uid := s.LastMid(), s.UID()
+	async.Run(func() {
+		role := db.ClubRole(clubId, uid)
+		if role == 0 || (status == model.UserClubStatusApply && role < model.UserClubRoleManager) {
+			s.ResponseMID(mid, &protocol.ErrorResponse{Code: errorCode, Error: "没有权限"})
+			return
+		}
+
+		list, err := db.ClubMembers(clubId, status)
+		if err != nil {
+			s.ResponseMID(mid, &protocol.ErrorResponse{Code: errorCode, Error: err.Error()})
+			return
+		}
+		s.ResponseMID(mid, &protocol.ClubMemberListResponse{Data: list})
+	})
+}
+
+func (c *ClubManager) ClubApplications(s *session.Session, req *protocol.ClubRequest) error {
+	c.members(s, req.ClubId, model.UserClubStatusApply)
+	return nil
+}
+
+func (c *ClubManager) ClubMembers(s *session.Session, req *protocol.ClubRequest) error {
+	c.members(s, req.ClubId, model.UserClubStatusAgree)
+	return nil
+}
+
+func (c *ClubManager) ApproveClub(s *session.Session, req *protocol.ClubMemberRequest) error {
+	c.operate(s, req.Uid, protocol.ClubNotifyApproved, model.UserClubRoleMember, func() (*model.Club, error) {
+		return db.ApproveClubApply(s.UID(), req.ClubId, req.Uid)
+	})
+	return nil
+}
+
+func (c *ClubManager) RejectClub(s *session.Session, req *protocol.ClubMemberRequest) error {
+	c.operate(s, req.Uid, protocol.ClubNotifyRejected, 0, func() (*model.Club, error) {
+		return db.RejectClubApply(s.UID(), req.ClubId, req.Uid)
+	})
+	return nil
+}
+
+func (c *ClubManager) KickClubMember(s *session.Session, req *protocol.ClubMemberRequest) error {
+	c.operate(s, req.Uid, protocol.ClubNotifyKicked, 0, func() (*model.Club, error) {
+		return db.KickClubMember(s.UID(), req.ClubId, req.Uid)
+	})
+	return nil
+}
+
+func (c *ClubManager) TransferClub(s *session.Session, req *protocol.ClubMemberRequest) error {
+	c.operate(s, req.Uid, protocol.ClubNotifyRoleChanged, model.UserClubRoleOwner, func() (*model.Club, error) {
+		return db.TransferClub(s.UID(), req.ClubId, req.Uid)
+	})
+	return nil
+}
+
+func (c *ClubManager) SetClubRole(s *session.Session, req *protocol.ClubMemberRequest) error {
+	c.operate(s, req.Uid, protocol.ClubNotifyRoleChanged, req.Role, func() (*model.Club, error) {
+		return db.SetClubRole(s.UID(), req.ClubId, req.Uid, req.Role)
+	})
+	return nil
+}
+
+func (c *ClubManager) UpdateClub(s *session.Session, req *protocol.UpdateClubRequest) error {
+	mid := s.LastMid()
+	async.Run(func() {
+		club, err := db.UpdateClubInfo(s.UID(), req.ClubId, req.Name, req.Desc)
+		if err != nil {
+			s.ResponseMID(mid, &protocol.ErrorResponse{Code: errorCode, Error: err.Error()})
+			return
+		}
+		s.ResponseMID(mid, &protocol.ClubInfoResponse{Data: clubItem(club)})
+	})
+	return nil
+}
@@ -0,0 +1,308 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lonng/nano/scheduler"
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/async"
+	"github.com/lonng/nanoserver/pkg/constant"
+	"github.com/lonng/nanoserver/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCoinRake = 5  // 默认抽水比例(%)
+	robotCoinFactor = 10 // 机器人携带的金额为入场金额的倍数
+)
+
+// 经典场的场次设置
+type coinTier struct {
+	stake   int64 // 底分, 每1分对应的金额
+	minimum int64 // 入场金额, 低于此金额不能匹配, 每局结束后自动离桌
+}
+
+var (
+	coinRake  = defaultCoinRake
+	robotPays = false // 是否结算玩家与机器人之间的输赢, 机器人的余额由系统发放, 开启后经典场会产生新的金币/银币
+	coinTiers = map[int][]coinTier{
+		protocol.CoinTypeSliver: {{1, 20}, {5, 100}, {20, 400}, {50, 1000}, {100, 2000}},
+		protocol.CoinTypeGold:   {{10, 200}, {50, 1000}, {200, 4000}, {500, 10000}, {1000, 20000}},
+	}
+)
+
+// SetCoinRake 设置每局赢家的抽水比例(%)
+func SetCoinRake(rake int) {
+	if rake < 0 || rake >= 100 {
+		logger.Warnf("无效的抽水比例: %d", rake)
+		return
+	}
+	coinRake = rake
+}
+
+// SetRobotPays 设置是否结算玩家与机器人之间的输赢
+func SetRobotPays(pays bool) {
+	robotPays = pays
+	logger.Infof("经典场结算机器人输赢: %t", pays)
+}
+
+// SetCoinTiers 设置经典场的底分和入场金额, 格式: 底分/入场金额, 使用逗号隔开,
+// 依次为初级/中级/高级/精英/大师场
+func SetCoinTiers(coinType int, cfg string) {
+	tiers := []coinTier{}
+	for _, c := range strings.Split(cfg, ",") {
+		parts := strings.Split(c, "/")
+		if len(parts) < 2 {
+			logger.Warnf("无效的场次配置: %s", c)
+			return
+		}
+		stake, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+		if err != nil || stake <= 0 {
+			logger.Warnf("无效的场次配置: %s", c)
+			return
+		}
+		minimum, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil || minimum < stake {
+			logger.Warnf("无效的场次配置: %s", c)
+			return
+		}
+		tiers = append(tiers, coinTier{stake: stake, minimum: minimum})
+	}
+
+	if len(tiers) != protocol.ClassicLevelMaster+1 {
+		logger.Warnf("场次配置数量错误: %s", cfg)
+		return
+	}
+
+	coinTiers[coinType] = tiers
+	logger.Infof("当前经典场配置: 货币类型=%d, %+v", coinType, tiers)
+}
+
+func validCoinType(coinType int) bool {
+	return coinType == protocol.CoinTypeSliver || coinType == protocol.CoinTypeGold
+}
+
+// 经典场的场次设置, 其他房间返回false
+func (k matchKey) coinTier() (coinTier, bool) {
+	if k.Type != protocol.MatchTypeClassic {
+		return coinTier{}, false
+	}
+	tiers, ok := coinTiers[k.CoinType]
+	if !ok || k.Level < 0 || k.Level >= len(tiers) {
+		return coinTier{}, false
+	}
+	return tiers[k.Level], true
+}
+
+func (p *Player) coinBalance(coinType int) int64 {
+	if coinType == protocol.CoinTypeGold {
+		return p.gold
+	}
+	return p.silver
+}
+
+func (p *Player) setCoinBalance(coinType int, balance int64) {
+	if coinType == protocol.CoinTypeGold {
+		p.gold = balance
+	} else {
+		p.silver = balance
+	}
+}
+
+// 当前房间的场次设置
+func (d *Desk) coinTier() (coinTier, bool) {
+	if d.match == nil {
+		return coinTier{}, false
+	}
+	return d.match.coinTier()
+}
+
+// 打牌协程在本局结束后调用, 在逻辑线程中结算并等待完成, 玩家余额只在逻辑线程中读写
+func (d *Desk) settleCoinsOnScheduler() []*Player {
+	if _, ok := d.coinTier(); !ok || d.status() != constant.DeskStatusRoundOver {
+		return nil
+	}
+
+	var busted []*Player
+	done := make(chan struct{})
+	scheduler.PushTask(func() {
+		defer close(done)
+		busted = d.settleCoins()
+	})
+
+	select {
+	case <-done:
+		return busted
+	case <-d.die:
+		return nil
+	}
+}
+
+// 本局结束后按照胡牌和杠牌的积分变化结算金币/银币, 返回余额低于入场金额的玩家
+func (d *Desk) settleCoins() []*Player {
+	tier, ok := d.coinTier()
+	if !ok || d.status() != constant.DeskStatusRoundOver {
+		return nil
+	}
+
+	coinType := d.match.CoinType
+	seats := make([]coinSeat, len(d.players))
+	for i, p := range d.players {
+		seats[i] = coinSeat{
+			uid:     p.Uid(),
+			balance: p.coinBalance(coinType),
+			robot:   p.isRobot(),
+			changes: d.scoreChanges[p.Uid()],
+		}
+	}
+
+	settle := &protocol.CoinSettle{
+		CoinType: coinType,
+		Stake:    tier.stake,
+		Changes:  coinSettlement(tier, coinRake, robotPays, seats),
+	}
+	busted := []*Player{}
+	for i, p := range d.players {
+		c := settle.Changes[i]
+		p.setCoinBalance(coinType, c.Remain)
+		if c.Bust {
+			busted = append(busted, p)
+		}
+		if c.Change != 0 && !p.isRobot() {
+			p.saveCoinChange(coinType, c.Change, c.Rake, d.roomNo.String(), d.coinSettleKey(p.Uid()))
+		}
+	}
+
+	d.logger.Infof("金币结算: %+v", settle)
+	d.broadcast(protocol.RouteCoinSettle, settle)
+	return busted
+}
+
+// 金币结算的幂等键, 同一局每个玩家只结算一次
+func (d *Desk) coinSettleKey(uid int64) string {
+	return fmt.Sprintf("coin:%s:%d:%d:%d", d.roomNo, d.createdAt, d.round, uid)
+}
+
+// 参与结算的座位
+type coinSeat struct {
+	uid     int64
+	balance int64
+	robot   bool
+	changes []*scoreChangeInfo
+}
+
+// 按照座位顺序依次支付每一笔输分, 输家最多输光身上的余额, 赢家按比例抽水.
+// 机器人的余额由系统发放, 没有开启robotPays时玩家与机器人之间的输赢都按0结算,
+// 既不会凭空产生金币, 玩家输给机器人的金币也不会被系统回收
+func coinSettlement(tier coinTier, rake int, robotPays bool, seats []coinSeat) []protocol.CoinChange {
+	robots := map[int64]bool{}
+	for _, s := range seats {
+		robots[s.uid] = s.robot
+	}
+
+	won, lost := map[int64]int64{}, map[int64]int64{}
+	for _, s := range seats {
+		for _, c := range s.changes {
+			if c.score >= 0 {
+				continue
+			}
+			if (s.robot || robots[c.uid]) && !robotPays {
+				continue
+			}
+			amount := int64(-c.score) * tier.stake
+			if rest := s.balance - lost[s.uid]; amount > rest {
+				amount = rest
+			}
+			if amount <= 0 {
+				continue
+			}
+			lost[s.uid] += amount
+			won[c.uid] += amount
+		}
+	}
+
+	changes := make([]protocol.CoinChange, len(seats))
+	for i, s := range seats {
+		r := won[s.uid] * int64(rake) / 100
+		change := won[s.uid] - r - lost[s.uid]
+		remain := s.balance + change
+		changes[i] = protocol.CoinChange{
+			Uid:    s.uid,
+			Change: change,
+			Rake:   r,
+			Remain: remain,
+			Bust:   remain < tier.minimum,
+		}
+	}
+	return changes
+}
+
+// 异步保存玩家的输赢, key为本局结算的幂等键
+func (p *Player) saveCoinChange(coinType int, change, rake int64, deskNo, key string) {
+	c := &db.CoinChange{Uid: p.uid, CoinType: coinType, Amount: change, Rake: rake, DeskNo: deskNo, Key: key}
+	async.Run(func() {
+		remain, err := db.ChangeUserCoin(c)
+		if err != nil {
+			p.logger.Errorf("保存金币结算失败, 货币类型=%d, 输赢=%d, 抽水=%d, Error=%v", coinType, change, rake, err)
+			return
+		}
+		p.logger.Infof("金币结算: 货币类型=%d, 输赢=%d, 抽水=%d, 余额=%d", coinType, change, rake, remain)
+	})
+}
+
+// 余额不足的玩家离开房间, 真实玩家全部离开后解散房间
+func (d *Desk) removeBusted(busted []*Player) {
+	if len(busted) == 0 || d.isDestroy() {
+		return
+	}
+
+	for _, p := range busted {
+		pos := -1
+		for i, dp := range d.players {
+			if dp == p {
+				pos = i
+				break
+			}
+		}
+		if pos < 0 {
+			continue
+		}
+
+		d.broadcast("onPlayerExit", &protocol.ExitResponse{
+			AccountId: p.Uid(),
+			IsExit:    true,
+			ExitType:  protocol.ExitTypeClassicCoinNotEnough,
+			DeskPos:   pos,
+		})
+		if s := p.session; s != nil {
+			d.group.Leave(s)
+		}
+
+		d.players = append(d.players[:pos], d.players[pos+1:]...)
+		delete(d.roundStats, p.Uid())
+		p.reset()
+		p.desk = nil
+		p.score = 1000
+		p.turn = 0
+		p.logger.Info("余额不足, 自动离开房间")
+	}
+
+	for i, p := range d.players {
+		p.setDesk(d, i)
+	}
+
+	if d.refillMatched() {
+		return
+	}
+
+	d.logger.Info("房间内已经没有真实玩家, 解散房间")
+	d.destroy()
+	async.Run(func() {
+		if err := db.UpdateDesk(&model.Desk{Id: d.deskID, Round: 0}); err != nil {
+			log.Error(err)
+		}
+	})
+}
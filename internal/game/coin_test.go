@@ -0,0 +1,117 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/lonng/nanoserver/protocol"
+)
+
+func TestCoinSettlement(t *testing.T) {
+	tier := coinTier{stake: 10, minimum: 100}
+	lose := func(winner int64, score int) []*scoreChangeInfo {
+		return []*scoreChangeInfo{{uid: winner, score: -score}}
+	}
+
+	cases := []struct {
+		name      string
+		rake      int
+		robotPays bool
+		seats     []coinSeat
+		expect    []protocol.CoinChange
+	}{
+		{
+			name: "normal",
+			rake: 10,
+			seats: []coinSeat{
+				{uid: 1, balance: 500},
+				{uid: 2, balance: 500, changes: lose(1, 5)},
+			},
+			expect: []protocol.CoinChange{
+				{Uid: 1, Change: 45, Rake: 5, Remain: 545},
+				{Uid: 2, Change: -50, Remain: 450},
+			},
+		},
+		{
+			name: "loser pays at most balance",
+			seats: []coinSeat{
+				{uid: 1, balance: 500},
+				{uid: 2, balance: 120, changes: lose(1, 20)},
+			},
+			expect: []protocol.CoinChange{
+				{Uid: 1, Change: 120, Remain: 620},
+				{Uid: 2, Change: -120, Remain: 0, Bust: true},
+			},
+		},
+		{
+			name: "robot loss settles as zero",
+			seats: []coinSeat{
+				{uid: 1, balance: 500},
+				{uid: 2, balance: 1000, robot: true, changes: lose(1, 5)},
+			},
+			expect: []protocol.CoinChange{
+				{Uid: 1, Remain: 500},
+				{Uid: 2, Remain: 1000},
+			},
+		},
+		{
+			name: "loss to robot settles as zero",
+			seats: []coinSeat{
+				{uid: 1, balance: 500, changes: lose(2, 5)},
+				{uid: 2, balance: 1000, robot: true},
+			},
+			expect: []protocol.CoinChange{
+				{Uid: 1, Remain: 500},
+				{Uid: 2, Remain: 1000},
+			},
+		},
+		{
+			name: "humans still settle with robot seated",
+			seats: []coinSeat{
+				{uid: 1, balance: 500, changes: lose(2, 5)},
+				{uid: 2, balance: 500, changes: lose(3, 5)},
+				{uid: 3, balance: 1000, robot: true},
+			},
+			expect: []protocol.CoinChange{
+				{Uid: 1, Change: -50, Remain: 450},
+				{Uid: 2, Change: 50, Remain: 550},
+				{Uid: 3, Remain: 1000},
+			},
+		},
+		{
+			name:      "robot pays",
+			robotPays: true,
+			seats: []coinSeat{
+				{uid: 1, balance: 500},
+				{uid: 2, balance: 1000, robot: true, changes: lose(1, 5)},
+			},
+			expect: []protocol.CoinChange{
+				{Uid: 1, Change: 50, Remain: 550},
+				{Uid: 2, Change: -50, Remain: 950},
+			},
+		},
+		{
+			name:      "robot wins when robot pays",
+			robotPays: true,
+			seats: []coinSeat{
+				{uid: 1, balance: 500, changes: lose(2, 5)},
+				{uid: 2, balance: 1000, robot: true},
+			},
+			expect: []protocol.CoinChange{
+				{Uid: 1, Change: -50, Remain: 450},
+				{Uid: 2, Change: 50, Remain: 1050},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		changes := coinSettlement(tier, c.rake, c.robotPays, c.seats)
+		if len(changes) != len(c.expect) {
+			t.Fatalf("%s: expect %d changes, got %d", c.name, len(c.expect), len(changes))
+		}
+		for i := range changes {
+			if changes[i] != c.expect[i] {
+				t.Fatalf("%s: seat %d expect %+v, got %+v", c.name, i, c.expect[i], changes[i])
+			}
+		}
+	}
+}
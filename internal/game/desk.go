@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -40,17 +41,22 @@ const (
 )
 
 type Desk struct {
-	clubId    int64                 // 俱乐部ID
-	roomNo    room.Number           // 房间号
-	deskID    int64                 // desk表的pk
-	opts      *protocol.DeskOptions // 房间选项
-	state     constant.DeskStatus   // 状态
-	round     uint32                // 第n局
-	creator   int64                 // 创建玩家UID
-	createdAt int64                 // 创建时间
-	players   []*Player
-	group     *nano.Group // 组播通道
-	die       chan struct{}
+	clubId     int64                 // 俱乐部ID
+	match      *matchKey             // 公共房间的匹配分组, 私人房间为空
+	tournament *tournament           // 比赛房间所属的比赛
+	template   int64                 // 俱乐部房间模板ID, 由模板自动创建的房间不为0
+	roomNo     room.Number           // 房间号
+	deskID     int64                 // desk表的pk
+	opts       *protocol.DeskOptions // 房间选项
+	rules      Ruleset               // 玩法规则
+	state      constant.DeskStatus   // 状态
+	round      uint32                // 第n局
+	creator    int64                 // 创建玩家UID
+	createdAt  int64                 // 创建时间
+	players    []*Player
+	group      *nano.Group // 组播通道
+	spectators *nano.Group // 观战者, 只能收到公开消息
+	die        chan struct{}
 
 	allTiles      mahjong.Mahjong //所有麻将
 	bankerTurn    int             //庄家方位
@@ -74,6 +80,16 @@ type Desk struct {
 	prepare  *prepareContext  // 准备相关状态
 	dice     *dice            // 骰子
 
+	seed   int64        // 本局随机种子
+	seeder func() int64 // 种子生成器
+	rng    *rand.Rand   // 本局随机数生成器, 洗牌/骰子/定庄/机器人共用
+
+	resumeAt int // 从持久化数据恢复的牌局继续执行的位置
+
+	coinCharged bool           // 第一局开始时已经扣除开房消耗
+	coinPayers  []int64        // 扣除了房卡的玩家, 解散时只退还这些玩家
+	coinPending sync.WaitGroup // 还没有完成的房卡扣除, 退还前需要等待扣除完成
+
 	lastTileId    int   //最后一张出牌
 	lastChuPaiUid int64 //最后一个出牌的玩家
 	lastHintUid   int64 //最后一个接到提示的玩家
@@ -92,6 +108,8 @@ func NewDesk(roomNo room.Number, opts *protocol.DeskOptions, clubId int64) *Desk
 		group:   nano.NewGroup(uuid.New()),
 		die:     make(chan struct{}),
 
+		spectators: nano.NewGroup(uuid.New()),
+
 		wonPlayers:   map[int64]bool{},
 		isNewRound:   true,
 		isFirstRound: true,
@@ -104,15 +122,44 @@ func NewDesk(roomNo room.Number, opts *protocol.DeskOptions, clubId int64) *Desk
 
 		prepare: newPrepareContext(),
 		dice:    newDice(),
+		seeder:  deskSeeder(),
 
 		logger: log.WithField(fieldDesk, roomNo),
 	}
 
 	d.dissolve = newDissolveContext(d)
 
+	// 未知的玩法使用默认玩法
+	rules, ok := rulesetWithName(opts.Ruleset)
+	if !ok {
+		d.logger.Warnf("未知的玩法: %s, 使用默认玩法", opts.Ruleset)
+		rules, _ = rulesetWithName("")
+	}
+	d.rules = rules
+
 	return d
 }
 
+// 使用固定种子, 之后每一局的牌序和骰子都可以复现
+func (d *Desk) setFixedSeed(seed int64) {
+	d.seeder = fixedSeed(seed)
+}
+
+// 每局开始时重新生成随机种子
+func (d *Desk) reseed() {
+	d.seed = d.seeder()
+	d.rng = rand.New(rand.NewSource(d.seed))
+	d.logger.Infof("本局随机种子: %d", d.seed)
+}
+
+// 洗牌, 发牌并掷骰子, 种子相同时牌序, 手牌和骰子都相同
+func (d *Desk) shuffle() (mahjong.Tiles, []mahjong.Tiles, int) {
+	allTiles := d.rules.Tiles(d.opts.Mode, d.rng)
+	hands, nextIndex := d.rules.Deal(allTiles, d.totalPlayerCount(), d.bankerTurn)
+	d.dice.random(d.rng)
+	return allTiles, hands, nextIndex
+}
+
 // 玩家数量
 func (d *Desk) totalPlayerCount() int {
 	return d.opts.Mode
@@ -120,11 +167,7 @@ func (d *Desk) totalPlayerCount() int {
 
 // 麻将数量
 func (d *Desk) totalTileCount() int {
-	if d.opts.Mode == 4 {
-		return 108
-	} else {
-		return 72
-	}
+	return d.rules.TileCount(d.opts.Mode)
 }
 
 func (d *Desk) save() error {
@@ -196,6 +239,13 @@ func (d *Desk) playerJoin(s *session.Session, isReJoin bool) error {
 		}
 		if !exists {
 			p = s.Value(kCurPlayer).(*Player)
+			// 加入房间后不再观战和匹配
+			if p.watching != nil {
+				p.watching.removeSpectator(p)
+			}
+			if p.matching != nil {
+				defaultMatcher.leave(p)
+			}
 			d.players = append(d.players, p)
 			for i, p := range d.players {
 				p.setDesk(d, i)
@@ -207,6 +257,24 @@ func (d *Desk) playerJoin(s *session.Session, isReJoin bool) error {
 	return nil
 }
 
+// 使用机器人补齐空位, 机器人默认已准备
+func (d *Desk) fillRobots() {
+	for len(d.players) < d.totalPlayerCount() {
+		d.addRobot(newRobot(d.opts.RobotLevel))
+	}
+}
+
+func (d *Desk) addRobot(p *Player) {
+	d.players = append(d.players, p)
+	p.setDesk(d, len(d.players)-1)
+	d.roundStats[p.Uid()] = &history.Record{}
+	d.prepare.ready(p.Uid())
+	if tier, ok := d.coinTier(); ok {
+		p.setCoinBalance(d.match.CoinType, tier.minimum*robotCoinFactor)
+	}
+	d.logger.Infof("机器人加入房间: UID=%d", p.Uid())
+}
+
 func (d *Desk) syncDeskStatus() {
 	d.latestEnter = &protocol.PlayerEnterDesk{Data: []protocol.EnterDeskInfo{}}
 	for i, p := range d.players {
@@ -222,9 +290,86 @@ func (d *Desk) syncDeskStatus() {
 			Score:    p.score,
 			IP:       p.ip,
 			Offline:  !d.dissolve.isOnline(uid),
+			Trustee:  p.isTrustee(),
 		})
 	}
-	d.group.Broadcast("onPlayerEnter", d.latestEnter)
+	d.broadcast("onPlayerEnter", d.latestEnter)
+}
+
+// 断线重连或者观战时同步的牌桌数据, viewer为空表示观战者, 牌局进行中不能看到任何人的手牌
+func (d *Desk) syncData(viewer *Player) *protocol.SyncDesk {
+	data := &protocol.SyncDesk{
+		Status:    d.status(),
+		Players:   []protocol.DeskPlayerData{},
+		ScoreInfo: []protocol.ScoreInfo{},
+	}
+
+	hidden := false
+	if viewer == nil {
+		switch d.status() {
+		case constant.DeskStatusDuanPai, constant.DeskStatusQiPai, constant.DeskStatusPlaying:
+			hidden = true
+		}
+	}
+
+	markerUid := int64(0)
+	lastMoPaiUid := int64(0)
+	for i, player := range d.players {
+		uid := player.Uid()
+		if i == d.bankerTurn {
+			markerUid = uid
+		}
+		if i == d.curTurn {
+			lastMoPaiUid = uid
+		}
+		// 有可能已经有玩家和牌
+		stats := d.roundOverTilesForPlayer(player)
+		playerData := protocol.DeskPlayerData{
+			Uid:        uid,
+			HandTiles:  stats.Tiles,
+			PGTiles:    player.pgTiles().Ids(),
+			ChuTiles:   player.chuTiles().Ids(),
+			LatestTile: player.ctx.NewDrawingID,
+			HuPai:      player.ctx.WinningID,
+			HuType:     player.ctx.ResultType,
+			IsHu:       d.wonPlayers[uid],
+			Que:        player.ctx.Que,
+			Score:      player.score,
+		}
+
+		if hidden {
+			playerData.HandTiles = hiddenTiles(stats.Tiles)
+			playerData.LatestTile = illegalTile
+		}
+
+		// 如果自己断线重连，并且在定缺中，则发回提示，使用负数表示定缺建议选项
+		if viewer != nil && viewer.Uid() == uid && viewer.ctx.Que < 1 {
+			playerData.Que = -player.selectDefaultQue()
+		}
+
+		data.Players = append(data.Players, playerData)
+
+		score := protocol.ScoreInfo{
+			Uid:   uid,
+			Score: player.score,
+		}
+
+		data.ScoreInfo = append(data.ScoreInfo, score)
+	}
+	data.MarkerUid = markerUid
+	data.LastMoPaiUid = lastMoPaiUid
+	data.RestCount = d.remainTileCount()
+	data.Dice1 = d.dice.dice1
+	data.Dice2 = d.dice.dice2
+	if viewer != nil {
+		syncUid := viewer.Uid()
+		if lastMoPaiUid == syncUid || d.lastHintUid == syncUid {
+			data.Hint = viewer.ctx.LastHint
+		}
+	}
+	data.LastTileId = d.lastTileId
+	data.LastChuPaiUid = d.lastChuPaiUid
+	return data
 }
 
 func (d *Desk) checkStart() {
@@ -234,6 +379,11 @@ func (d *Desk) checkStart() {
 		return
 	}
 
+	if isDraining() {
+		d.logger.Info("服务器停服维护中，不能开始游戏")
+		return
+	}
+
 	if count, num := len(d.players), d.totalPlayerCount(); count < num {
 		d.logger.Infof("当前房间玩家数量不足，不能开始游戏，当前玩家=%d, 最低数量=%d", count, num)
 		return
@@ -324,6 +474,12 @@ func (d *Desk) desc(detail bool) string {
 		if opts.Yaojiu {
 			desc = append(desc, "全幺九")
 		}
+		switch d.payment() {
+		case protocol.PaymentAA:
+			desc = append(desc, "AA支付")
+		case protocol.PaymentWinner:
+			desc = append(desc, "大赢家支付")
+		}
 	}
 
 	return strings.Join(desc, " ")
@@ -333,6 +489,7 @@ func (d *Desk) desc(detail bool) string {
 func (d *Desk) start() {
 	d.round++
 	d.setStatus(constant.DeskStatusDuanPai)
+	d.reseed()
 
 	var (
 		totalPlayerCount = d.totalPlayerCount() // 玩家数量
@@ -342,13 +499,13 @@ func (d *Desk) start() {
 	//第一局,随机庄,以后每局的庄家是上一局第一个和牌者或者点双响炮者
 	if d.isFirstRound {
 		d.isFirstRound = false
-		d.loseCoin()
-		d.bankerTurn = rand.Intn(totalPlayerCount)
+		d.bankerTurn = d.rng.Intn(totalPlayerCount)
 
-		//只有第一局才创建桌子
+		//只有第一局才创建桌子, 创建后扣除房卡, 消耗记录需要房间ID
 		if err := d.save(); err != nil {
 			d.logger.Error(err)
 		}
+		d.loseCoin()
 	}
 	d.curTurn = d.bankerTurn
 	// 桌面基本信息
@@ -359,23 +516,18 @@ func (d *Desk) start() {
 		Mode:   d.opts.Mode,
 	}
 
-	d.group.Broadcast("onDeskBasicInfo", basic)
-	allTiles := mahjong.New(totalTileCount)
+	d.broadcast("onDeskBasicInfo", basic)
+	allTiles, hands, nextIndex := d.shuffle()
 	d.logger.Debugf("麻将数量=%d, 玩家数量=%d, 所有麻将=%v", totalTileCount, totalPlayerCount, allTiles)
 
 	info := make([]protocol.DuanPaiInfo, totalPlayerCount)
 	for i, p := range d.players {
 		info[i] = protocol.DuanPaiInfo{
 			Uid:    p.Uid(),
-			OnHand: make([]int, 13),
+			OnHand: hands[i],
 		}
-		nextIndex := (i + 1) * 13
-		copy(info[i].OnHand, allTiles[i*13:nextIndex])
-		d.nextTileIndex = nextIndex
 	}
-	//庄家多一张牌
-	info[d.bankerTurn].OnHand = append(info[d.bankerTurn].OnHand, allTiles[d.nextTileIndex])
-	d.nextTileIndex++
+	d.nextTileIndex = nextIndex
 
 	d.allTiles = make(mahjong.Mahjong, len(allTiles))
 	for i, id := range allTiles {
@@ -390,10 +542,12 @@ func (d *Desk) start() {
 
 	for turn, player := range d.players {
 		player.duanPai(info[turn].OnHand)
+		// 机器人和托管的玩家不需要齐牌
+		if player.isRobot() || player.isTrustee() {
+			d.prepare.sorted(player.Uid())
+		}
 	}
 
-	// 骰子
-	d.dice.random()
 	duan := &protocol.DuanPai{
 		MarkerID:    info[d.bankerTurn].Uid, //庄的账号ID
 		Dice1:       d.dice.dice1,
@@ -402,6 +556,14 @@ func (d *Desk) start() {
 	}
 	d.group.Broadcast("onDuanPai", duan)
 
+	// 观战者看不到手牌
+	hidden := *duan
+	hidden.AccountInfo = make([]protocol.DuanPaiInfo, len(info))
+	for i := range info {
+		hidden.AccountInfo[i] = protocol.DuanPaiInfo{Uid: info[i].Uid, OnHand: hiddenTiles(info[i].OnHand)}
+	}
+	d.broadcastSpectators("onDuanPai", &hidden)
+
 	//d.bankerTurn = turnUnknown //使用完毕,清空以便下一局使用
 	name4 := "/"
 	if len(d.players) > 3 {
@@ -417,7 +579,14 @@ func (d *Desk) start() {
 		basic,
 		d.latestEnter,
 		duan,
+		d.seed,
 	)
+
+	d.persistNow(resumeNone)
+
+	// 机器人和托管的玩家已经齐牌, 其他玩家超时后自动齐牌
+	d.phaseTimeout(constant.DeskStatusDuanPai)
+	d.checkQiPai()
 }
 
 func (d *Desk) qiPaiFinished(uid int64) error {
@@ -427,30 +596,58 @@ func (d *Desk) qiPaiFinished(uid int64) error {
 	}
 
 	d.prepare.sorted(uid)
+	d.checkQiPai()
+	return nil
+}
+
+// 所有人齐牌后进入定缺, 不需要定缺的玩法直接开始
+func (d *Desk) checkQiPai() {
+	if d.status() != constant.DeskStatusDuanPai {
+		return
+	}
 
 	// 等待所有人齐牌
 	for _, p := range d.players {
 		if !d.prepare.isSorted(p.Uid()) {
-			return nil
+			return
 		}
 	}
 
 	d.setStatus(constant.DeskStatusQiPai)
 
-	// 三人不需要定缺
-	if d.opts.Mode == ModeTrios {
+	// 不需要定缺的玩法直接开始
+	if !d.rules.DingQue(d.opts.Mode) {
+		d.setStatus(constant.DeskStatusPlaying)
 		go d.play()
 	} else {
 		for _, p := range d.players {
+			if p.isRobot() || p.isTrustee() {
+				continue
+			}
 			que := p.selectDefaultQue()
 			p.session.Push("onDingQueHint", protocol.DingQue{que})
 		}
+		d.phaseTimeout(constant.DeskStatusQiPai)
+
+		// 机器人直接定缺, 托管的玩家使用默认定缺
+		for _, p := range d.players {
+			if p.isRobot() {
+				d.dingQue(p, p.robot.que(p))
+			} else if p.isTrustee() {
+				d.dingQue(p, p.selectDefaultQue())
+			}
+		}
 	}
-	return nil
 }
 
 // 定缺
 func (d *Desk) dingQue(p *Player, que int) {
+	// 只能在齐牌后定缺一次, 避免重复开始游戏
+	if d.status() != constant.DeskStatusQiPai || p.ctx.Que > 0 {
+		p.logger.Debugf("忽略定缺, 牌桌状态: %s, 已定缺: %d", d.status().String(), p.ctx.Que)
+		return
+	}
+
 	p.ctx.Que = que
 	p.logger.Infof("玩家定缺，缺=%d", que)
 
@@ -467,8 +664,9 @@ func (d *Desk) dingQue(p *Player, que int) {
 		ques[i] = protocol.QueItem{Uid: p.Uid(), Que: p.ctx.Que}
 	}
 
-	d.group.Broadcast("onDingQue", ques)
+	d.broadcast("onDingQue", ques)
 
+	d.setStatus(constant.DeskStatusPlaying)
 	go d.play()
 }
 
@@ -500,6 +698,11 @@ func (d *Desk) isRoundOver() bool {
 		return true
 	}
 
+	// 胡牌后不继续的玩法, 有人胡牌即结束
+	if !d.rules.ContinueAfterWin() {
+		return len(d.wonPlayers) > 0
+	}
+
 	//只剩下一个人没有和牌结算
 	return len(d.wonPlayers) == d.totalPlayerCount()-1
 }
@@ -522,8 +725,28 @@ func (d *Desk) play() {
 
 	curPlayer := d.players[d.curTurn] //当前出牌玩家,初始为庄家
 
+	var action, tid int
+
+	// 从持久化数据恢复的牌局, 直接跳转到中断前的位置
+	resume := d.resumeAt
+	d.resumeAt = resumeNone
+
 MAIN_LOOP:
 	for !d.isRoundOver() {
+		switch resume {
+		case resumeMoPai:
+			resume = resumeNone
+			goto GANG
+		case resumeChuPai:
+			resume = resumeNone
+			goto PENG
+		case resumeChiPai:
+			resume = resumeNone
+			curPlayer = d.currentPlayer()
+			tid = d.lastTileId
+			goto CHI
+		}
+
 		// 切换到下一个玩家
 		if !d.isNewRound {
 			d.nextTurn()
@@ -541,6 +764,8 @@ MAIN_LOOP:
 		// 3. 玩家巴杠
 	GANG:
 		curPlayer = d.currentPlayer()
+		d.persist(resumeMoPai)
+
 		// 1. 如果不是首轮, 上一张牌, 首轮时, 庄家已有14张牌
 		if !d.isNewRound {
 			curPlayer.moPai()
@@ -549,7 +774,7 @@ MAIN_LOOP:
 		//===========================================================
 		// 2. 检查自己是否暗杠或者刮风/胡牌
 		//===========================================================
-		action, tid := curPlayer.doCheckHandTiles(d.isNewRound)
+		action, tid = curPlayer.doCheckHandTiles(d.isNewRound)
 		//  tid　< 0 标识房间解散, just break
 		if tid == deskDissolved {
 			break MAIN_LOOP
@@ -605,6 +830,8 @@ MAIN_LOOP:
 
 	PENG:
 		curPlayer = d.currentPlayer()
+		d.persist(resumeChuPai)
+
 		//===========================================================
 		// 检查有无其他玩家要当前玩家出的牌
 		//===========================================================
@@ -619,15 +846,17 @@ MAIN_LOOP:
 		d.lastChuPaiUid = curPlayer.Uid()
 		curPlayer.chupai = append(curPlayer.chupai, mahjong.TileFromID(tid))
 		curPlayer.ctx.LastDiscardId = tid
+		d.persist(resumeChiPai)
 
 		// 4. 检查是否有玩家要这张牌
+	CHI:
 		typ := d.chiPai(tid)
 		if typ == deskDissolved {
 			break MAIN_LOOP
 		}
 
 		// 记录出牌
-		if typ == protocol.OptypeGang || typ == protocol.OptypePeng || typ == protocol.OptypeHu {
+		if typ == protocol.OptypeGang || typ == protocol.OptypePeng || typ == protocol.OptypeChi || typ == protocol.OptypeHu {
 			curPlayer.chupai = curPlayer.chupai[:len(curPlayer.chupai)-1]
 		}
 
@@ -655,8 +884,8 @@ MAIN_LOOP:
 			goto GANG
 		}
 
-		// 碰牌
-		if typ == protocol.OptypePeng {
+		// 碰牌/吃牌
+		if typ == protocol.OptypePeng || typ == protocol.OptypeChi {
 			goto PENG
 		}
 	}
@@ -779,8 +1008,9 @@ func (d *Desk) chiPai(tileId int) int {
 
 	// 检查有没有玩家要碰、杠、胡
 	checkTurn := d.curTurn
-	winOps := map[int]bool{}                                // 某个方位是否可以胡这张牌
-	pgOps := turnOp{turn: illegalTurn, op: []protocol.Op{}} // 牌桌同时只可能有一个人能碰杠
+	winOps := map[int]bool{}                                 // 某个方位是否可以胡这张牌
+	pgOps := turnOp{turn: illegalTurn, op: []protocol.Op{}}  // 牌桌同时只可能有一个人能碰杠
+	chiOps := turnOp{turn: illegalTurn, op: []protocol.Op{}} // 牌桌同时只可能有一个人能吃
 	for {
 		// 从下家开始检查, 一直检查到自己
 		checkTurn++
@@ -797,6 +1027,11 @@ func (d *Desk) chiPai(tileId int) int {
 			continue
 		}
 
+		// 是否可以吃由玩法决定
+		if ops := d.rules.Chows(checkPlayer, tileId, chuPlayer); len(ops) > 0 {
+			chiOps = turnOp{turn: checkTurn, op: ops}
+		}
+
 		ops := checkPlayer.checkChi(tileId, chuPlayer)
 		if len(ops) == 0 {
 			continue
@@ -872,12 +1107,13 @@ func (d *Desk) chiPai(tileId int) int {
 
 	d.logger.Debugf("可以胡牌的玩家: %+v", winOps)
 	d.logger.Debugf("可以碰杠的玩家: %+v", pgOps)
+	d.logger.Debugf("可以吃的玩家: %+v", chiOps)
 
 	// 是否有人胡牌，一炮多响
 	paoCount := 0
 
 	// 先将提示发过去
-	// 如果胡牌的人同时可以碰杠, 将提示一起发送过去, 胡牌优先
+	// 如果胡牌的人同时可以碰杠吃, 将提示一起发送过去, 胡牌优先
 	for winTurn := range winOps {
 		player := d.players[winTurn]
 		hints := []protocol.Op{
@@ -887,6 +1123,9 @@ func (d *Desk) chiPai(tileId int) int {
 		if winTurn == pgOps.turn {
 			hints = append(hints, pgOps.op...)
 		}
+		if winTurn == chiOps.turn {
+			hints = append(hints, chiOps.op...)
+		}
 		player.hint(hints)
 	}
 
@@ -949,32 +1188,48 @@ func (d *Desk) chiPai(tileId int) int {
 		return protocol.OptypeHu
 	}
 
-	if pgOps.turn == illegalTurn {
-		return protocol.OptypePass
+	// 无人胡牌, 按照玩法的优先级依次通知可以碰杠和吃的玩家, 如果玩家可以碰杠胡, 前面已经发送了碰杠提示, 但是未选择胡
+	// 同一个玩家同时可以碰杠和吃时一起提示
+	stages := []turnOp{pgOps, chiOps}
+	if d.rules.ClaimPriority(protocol.OptypeChi) > d.rules.ClaimPriority(protocol.OptypePeng) {
+		stages[0], stages[1] = chiOps, pgOps
 	}
 
-	// 无人胡牌, 则通知可以碰杠的玩家, 如果玩家可以碰杠胡, 前面已经发送了碰杠提示, 但是未选择胡
-	player := d.players[pgOps.turn]
-	isPeng, isGang, isDissolve := player.pengOrGang(tileId, pgOps.op, winOps[pgOps.turn])
-	if isDissolve {
-		return deskDissolved
-	}
+	asked := map[int]bool{}
+	for _, stage := range stages {
+		if stage.turn == illegalTurn || asked[stage.turn] {
+			continue
+		}
+		asked[stage.turn] = true
 
-	d.logger.Debugf("玩家碰杠结果: 碰=%t 杠=%t", isPeng, isGang)
-	if !isPeng && !isGang {
-		return protocol.OptypePass
-	}
+		ops := []protocol.Op{}
+		for _, s := range stages {
+			if s.turn == stage.turn {
+				ops = append(ops, s.op...)
+			}
+		}
+
+		player := d.players[stage.turn]
+		typ := player.claim(tileId, ops, winOps[stage.turn])
+		d.logger.Debugf("玩家碰杠吃结果: %d", typ)
+		switch typ {
+		case deskDissolved:
+			return deskDissolved
 
-	d.curTurn = pgOps.turn
+		case protocol.OptypeGang:
+			d.curTurn = stage.turn
+			//点杠只可能是自己手中已有3张的(引风)下雨,即另一种明杠
+			// 客户端显示杠牌流水
+			d.scoreChangeForGang(player, []int64{chuPlayer.Uid()}, tileId, true)
+			return protocol.OptypeGang
 
-	//点杠只可能是自己手中已有3张的(引风)下雨,即另一种明杠
-	if isGang {
-		// 客户端显示杠牌流水
-		d.scoreChangeForGang(player, []int64{chuPlayer.Uid()}, tileId, true)
-		return protocol.OptypeGang
+		case protocol.OptypePeng, protocol.OptypeChi:
+			d.curTurn = stage.turn
+			return typ
+		}
 	}
 
-	return protocol.OptypePeng
+	return protocol.OptypePass
 }
 
 // 检查有没有玩家抢杠, 第二个参数表示房间是否解散
@@ -1239,14 +1494,22 @@ func (d *Desk) roundOver() {
 		d.matchStats.Push(d.roundStats)
 	}
 
+	// 经典场按本局输赢结算金币/银币
+	busted := d.settleCoinsOnScheduler()
+
 	//满场
 	isMaxRound := d.round >= uint32(d.opts.MaxRound) && status == constant.DeskStatusRoundOver
 
 	d.logger.Debugf("本轮游戏结束, 状态=%s 结算数据=%#v", status.String(), stats)
-	//round over
-	if status == constant.DeskStatusRoundOver && !isMaxRound {
-		d.group.Broadcast("onRoundEnd", stats)
+	//round over, 停服维护时本局结束后直接结算
+	if status == constant.DeskStatusRoundOver && !isMaxRound && !isDraining() {
+		d.broadcast("onRoundEnd", stats)
 		d.clean()
+
+		// 余额不足的玩家在逻辑线程中离开房间
+		if len(busted) > 0 {
+			scheduler.PushTask(func() { d.removeBusted(busted) })
+		}
 	} else {
 		//最后一局以及中断统计的GameEnd与场结算一起发送
 		d.finalSettlement(isMaxRound, stats)
@@ -1288,7 +1551,12 @@ func (d *Desk) clean() {
 	for _, p := range d.players {
 		d.roundStats[p.Uid()] = &history.Record{}
 		p.reset()
+		if p.isRobot() || p.isTrustee() {
+			d.prepare.ready(p.Uid())
+		}
 	}
+
+	d.persist(resumeNone)
 }
 
 func (d *Desk) finalSettlement(isNormalFinished bool, ge *protocol.RoundOverStats) {
@@ -1394,6 +1662,20 @@ func (d *Desk) finalSettlement(isNormalFinished bool, ge *protocol.RoundOverStat
 	}
 
 	mss := f()
+
+	// 第一局没有完成就解散时退还房卡, 否则大赢家支付的房间由大赢家支付
+	if d.matchStats.Round() == 0 {
+		d.refundCoin()
+	} else if !d.isFree() && d.payment() == protocol.PaymentWinner {
+		winners := []int64{}
+		for _, ms := range mss {
+			if ms.IsBigWinner {
+				winners = append(winners, ms.Uid)
+			}
+		}
+		d.winnerLoseCoin(winners)
+	}
+
 	ddr := &protocol.DestroyDeskResponse{
 		MatchStats:       mss,
 		Title:            d.title(),
@@ -1402,7 +1684,7 @@ func (d *Desk) finalSettlement(isNormalFinished bool, ge *protocol.RoundOverStat
 	}
 
 	//发送单场统计
-	err := d.group.Broadcast("onGameEnd", ddr)
+	err := d.broadcast("onGameEnd", ddr)
 	if err != nil {
 		log.Error(err)
 	}
@@ -1461,7 +1743,19 @@ func (d *Desk) destroy() {
 	// 标记为销毁
 	d.setStatus(constant.DeskStatusDestory)
 
+	// 比赛房间在清理完成后通知比赛
+	if t := d.tournament; t != nil {
+		players := append([]*Player{}, d.players...)
+		defer t.deskFinished(d, players, d.matchStats.Result())
+	}
+
 	d.logger.Info("销毁房间")
+
+	// 删除持久化数据
+	if store := defaultDeskManager.store; store != nil {
+		store.remove(d.roomNo)
+	}
+
 	for i := range d.players {
 		p := d.players[i]
 		d.logger.Debugf("销毁房间，清除玩家%d数据", p.Uid())
@@ -1475,6 +1769,7 @@ func (d *Desk) destroy() {
 
 	// 释放desk资源
 	d.group.Close()
+	d.clearSpectators()
 	d.prepare.reset()
 	d.dissolve.reset()
 	d.wonPlayers = nil
@@ -1513,10 +1808,9 @@ func (d *Desk) scoreChangeForGang(winner *Player, loserPlayers []int64, tileID i
 		IsXiaYu: isXiaYu,
 	}
 
-	score := 1
+	score := d.rules.GangScore(isXiaYu)
 	typ := ScoreChangeTypeBaGang
 	if isXiaYu {
-		score = score * 2
 		typ = ScoreChangeTypeAnGang
 	}
 
@@ -1541,7 +1835,7 @@ func (d *Desk) scoreChangeForGang(winner *Player, loserPlayers []int64, tileID i
 
 	}
 
-	d.group.Broadcast("onGangScoreChange", gsc)
+	d.broadcast("onGangScoreChange", gsc)
 	d.scoreChangeHelper(winner.Uid(), losers, typ, tileID)
 	d.snapshot.PushGangScoreChange(gsc)
 }
@@ -1562,7 +1856,7 @@ func (d *Desk) maxScoreCutter(point int) int {
 func (d *Desk) scoreChangeForHu(winner *Player, losers []Loser, tileID int, huType protocol.HuPaiType) {
 	for _, l := range losers {
 		d.logger.Debugf("scoreChangeForHu 赢家=%d 输家=%d 分值=%d 类型=%d 牌=%s",
-			winner.Uid(), l.uid, l.score, huType, mahjong.IndexFromID(tileID))
+			winner.Uid(), l.uid, l.score, huType, mahjong.TileFromID(tileID))
 	}
 
 	var winUid = winner.Uid()
@@ -1627,7 +1921,7 @@ func (d *Desk) scoreChangeForHu(winner *Player, losers []Loser, tileID int, huTy
 	d.scoreChangeHelper(winUid, losers, ScoreChangeTypeHu, tileID)
 
 	d.snapshot.PushHuScoreChange(hsc)
-	d.group.Broadcast("onHuScoreChange", hsc)
+	d.broadcast("onHuScoreChange", hsc)
 }
 
 //桌上的最后一张牌
@@ -1655,8 +1949,13 @@ func (d *Desk) onPlayerExit(s *session.Session, isDisconnect bool) {
 		d.players = restPlayers
 	}
 
+	// 公共房间没有房主, 有玩家退出时使用机器人补位, 真实玩家全部退出后解散
+	if d.match != nil && !isDisconnect && d.refillMatched() {
+		return
+	}
+
 	//如果桌上已无玩家, destroy it
-	if d.creator == uid && !isDisconnect {
+	if (d.creator == uid || d.match != nil) && !isDisconnect {
 		//if d.dissolve.offlineCount() == len(d.players) || (d.creator == uid && !isDisconnect) {
 		d.logger.Info("所有玩家下线或房主主动解散房间")
 		if d.dissolve.isDissolving() {
@@ -1714,11 +2013,24 @@ func (d *Desk) applyDissolve(uid int64) {
 	d.dissolve.reset()
 	d.dissolve.setUidStatus(uid, true, ApplyDissolve)
 
+	// 机器人总是同意解散
+	for _, p := range d.players {
+		if p.isRobot() {
+			d.dissolve.setUidStatus(p.Uid(), true, AgreeRequest)
+		}
+	}
+
 	d.group.Broadcast("onDissolveAgreement", &protocol.DissolveResponse{
 		DissolveUid:    uid,
 		DissolveStatus: d.collectDissolveStatus(),
 		RestTime:       applyDissolveRestTime,
 	})
+
+	if d.dissolve.agreeCount() >= d.totalPlayerCount() {
+		d.logger.Debug("所有玩家同意解散, 即将解散")
+		d.dissolve.stop()
+		d.doDissolve()
+	}
 }
 
 // 收集本桌玩家的解散状态
@@ -1774,6 +2086,7 @@ func (d *Desk) onPlayerReJoin(s *session.Session) error {
 			Score:    p.score,
 			IP:       p.ip,
 			Offline:  !d.dissolve.isOnline(uid),
+			Trustee:  p.isTrustee(),
 		})
 	}
 	if err := s.Push("onPlayerEnter", enter); err != nil {
@@ -1843,7 +2156,7 @@ func (d *Desk) doDissolve() {
 	log.Debugf("房间: %s解散倒计时结束, 房间解散开始", d.roomNo)
 	//如果不是在桌子刚创建时解散,需要进行退出处理
 	if status := d.status(); status == constant.DeskStatusCreate {
-		d.group.Broadcast("onDissolve", &protocol.ExitResponse{
+		d.broadcast("onDissolve", &protocol.ExitResponse{
 			IsExit:   true,
 			ExitType: protocol.ExitTypeDissolve,
 		})
@@ -1855,28 +2168,158 @@ func (d *Desk) doDissolve() {
 	d.logger.Debug("房间解散倒计时结束, 房间解散完成")
 }
 
-func (d *Desk) loseCoin() {
-	cardCount := requireCardCount(d.opts.MaxRound)
-	consume := &model.CardConsume{
-		UserId:    d.creator,
-		CardCount: cardCount,
+// 公共房间和比赛房间不消耗房卡
+func (d *Desk) isFree() bool {
+	return d.match != nil || d.tournament != nil
+}
+
+// 房卡支付方式, 俱乐部房间由俱乐部支付, 按房主支付处理
+func (d *Desk) payment() int {
+	if d.clubId > 0 {
+		return protocol.PaymentHost
+	}
+	return d.opts.Payment
+}
+
+// 玩家加入房间时至少需要的房卡
+func (d *Desk) requireCoin(uid int64) int64 {
+	if d.isFree() || d.clubId > 0 {
+		return 0
+	}
+	return int64(deskCardCount(d.opts, uid == d.creator))
+}
+
+// 扣除房卡的幂等键, 同一个房间每个玩家只扣除一次
+func (d *Desk) coinKey(uid int64) string {
+	return fmt.Sprintf("desk:%s:%d:%d", d.roomNo, d.createdAt, uid)
+}
+
+// 俱乐部开房消耗的幂等键, 退还时使用相同的键
+func (d *Desk) clubCoinKey() string {
+	return fmt.Sprintf("club:%d:%s:%d", d.clubId, d.roomNo, d.createdAt)
+}
+
+func (d *Desk) consume(uid int64, count int) *model.CardConsume {
+	return &model.CardConsume{
+		UserId:    uid,
+		CardCount: count,
 		DeskId:    d.deskID,
 		ClubId:    d.clubId,
 		DeskNo:    d.roomNo.String(),
 		ConsumeAt: time.Now().Unix(),
 	}
+}
 
-	// 俱乐部房间
+// 第一局开始时扣除房卡, 大赢家支付的房间在房间结束时扣除
+func (d *Desk) loseCoin() {
+	if d.isFree() {
+		return
+	}
+
+	cardCount := requireCardCount(d.opts.MaxRound)
+	d.coinCharged = true
+
+	// 俱乐部房间, 余额低于提醒值时通知部长和管理员
 	if d.clubId > 0 {
+		clubId, count, consume, key := d.clubId, int64(cardCount), d.consume(d.creator, cardCount), d.clubCoinKey()
+		d.coinPending.Add(1)
 		async.Run(func() {
-			db.ClubLoseBalance(d.clubId, int64(cardCount), consume)
+			defer d.coinPending.Done()
+			balance, err := db.ClubLoseBalance(clubId, count, consume, key)
+			if err != nil {
+				d.logger.Errorf("扣除俱乐部房卡错误, 俱乐部ID=%d, Error=%v", clubId, err)
+				return
+			}
+			if balance < clubLowBalance && balance+count >= clubLowBalance {
+				alertClubBalance(clubId)
+			}
 		})
-	} else {
+		return
+	}
+
+	humans := []int64{}
+	for _, p := range d.players {
+		if !p.isRobot() {
+			humans = append(humans, p.Uid())
+		}
+	}
+
+	count := cardCount
+	if d.payment() == protocol.PaymentAA {
+		count = requireAACardCount(d.opts.MaxRound, d.totalPlayerCount())
+	}
+	for _, uid := range coinPayers(d.payment(), d.creator, humans) {
+		p, err := d.playerWithId(uid)
+		if err != nil {
+			d.logger.Errorf("扣除玩家房卡错误，没有找到玩家，UID=%d", uid)
+			continue
+		}
+		d.coinPayers = append(d.coinPayers, uid)
+		p.loseCoin(int64(count), d.consume(uid, count), d.coinKey(uid), &d.coinPending)
+	}
+}
+
+// 第一局开始时需要扣除房卡的玩家: 房主支付时只有房主, AA支付时所有真人玩家, 大赢家支付时房间结束时再扣除
+func coinPayers(payment int, creator int64, humans []int64) []int64 {
+	switch payment {
+	case protocol.PaymentHost:
+		return []int64{creator}
+	case protocol.PaymentAA:
+		return humans
+	}
+	return nil
+}
+
+// 大赢家支付房卡, 多个大赢家时平摊
+func (d *Desk) winnerLoseCoin(winners []int64) {
+	payers := []*Player{}
+	for _, uid := range winners {
+		if p, err := d.playerWithId(uid); err == nil && !p.isRobot() {
+			payers = append(payers, p)
+		}
+	}
+
+	// 没有大赢家时由房主支付
+	if len(payers) == 0 {
 		p, err := d.playerWithId(d.creator)
 		if err != nil {
 			d.logger.Errorf("扣除玩家房卡错误，没有找到玩家，CreatorID=%d", d.creator)
 			return
 		}
-		p.loseCoin(int64(cardCount), consume)
+		payers = append(payers, p)
+	}
+
+	count := requireAACardCount(d.opts.MaxRound, len(payers))
+	for _, p := range payers {
+		p.loseCoin(int64(count), d.consume(p.Uid(), count), d.coinKey(p.Uid()), nil)
+	}
+}
+
+// 第一局没有完成就解散, 等待扣除完成后退还已经扣除的房卡, 只退还实际扣除了房卡的俱乐部或者玩家
+func (d *Desk) refundCoin() {
+	if d.isFree() || !d.coinCharged {
+		return
+	}
+
+	if d.clubId > 0 {
+		clubId, consume, key, pending := d.clubId, d.consume(d.creator, 0), d.clubCoinKey(), &d.coinPending
+		async.Run(func() {
+			pending.Wait()
+			_, err := db.ClubRefundBalance(clubId, key, key+":refund", consume)
+			if err != nil && err != errutil.ErrNotFound {
+				d.logger.Errorf("退还俱乐部房卡错误, 俱乐部ID=%d, Error=%v", clubId, err)
+			}
+		})
+		return
+	}
+
+	for _, uid := range d.coinPayers {
+		p, err := d.playerWithId(uid)
+		if err != nil {
+			d.logger.Errorf("退还玩家房卡错误，没有找到玩家，UID=%d", uid)
+			continue
+		}
+		key := d.coinKey(uid)
+		p.refundCoin(key, key+":refund", d.consume(uid, 0), &d.coinPending)
 	}
 }
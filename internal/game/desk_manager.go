@@ -11,6 +11,7 @@ import (
 	"github.com/lonng/nanoserver/pkg/constant"
 	"github.com/lonng/nanoserver/pkg/errutil"
 	"github.com/lonng/nanoserver/pkg/room"
+	"github.com/lonng/nanoserver/pkg/token"
 	"github.com/lonng/nanoserver/protocol"
 
 	"github.com/lonng/nano/component"
@@ -42,6 +43,9 @@ const (
 	versionExpireMessage       = "你当前的游戏版本过老，请更新客户端，地址: http://fir.im/tand"
 	deskCardNotEnoughMessage   = "房卡不足"
 	clubCardNotEnoughMessage   = "俱乐部房卡不足"
+	robotDisabledMessage       = "当前房间未开启机器人"
+	robotNotCreatorMessage     = "只有房主才能添加机器人"
+	drainingMessage            = "服务器即将停机维护, 暂时不能创建或加入房间"
 )
 
 var ErrModeCannotQue = errors.New("当前不为4人模式，不能定缺")
@@ -54,6 +58,10 @@ var (
 	createVersionExpire  = &protocol.CreateDeskResponse{Code: 30001, Error: versionExpireMessage}
 	deskCardNotEnough    = &protocol.CreateDeskResponse{Code: 30002, Error: deskCardNotEnoughMessage}
 	clubCardNotEnough    = &protocol.CreateDeskResponse{Code: 30002, Error: clubCardNotEnoughMessage}
+	robotDisabled        = &protocol.ErrorResponse{Code: errorCode, Error: robotDisabledMessage}
+	robotNotCreator      = &protocol.ErrorResponse{Code: errorCode, Error: robotNotCreatorMessage}
+	createDraining       = &protocol.CreateDeskResponse{Code: 30004, Error: drainingMessage}
+	joinDraining         = &protocol.JoinDeskResponse{Code: 30004, Error: drainingMessage}
 )
 
 type (
@@ -61,6 +69,7 @@ type (
 		component.Base
 		//桌子数据
 		desks map[room.Number]*Desk // 所有桌子
+		store *deskStore            // 未完成房间存储, 为空时不保存
 	}
 )
 
@@ -73,11 +82,14 @@ func NewDeskManager() *DeskManager {
 }
 
 func (manager *DeskManager) AfterInit() {
+	// 恢复服务器重启前未完成的房间
+	manager.restoreDesks()
+
 	session.Lifetime.OnClosed(func(s *session.Session) {
 		// Fixed: 玩家WIFI切换到4G网络不断开, 重连时，将UID设置为illegalSessionUid
 		if s.UID() > 0 {
 			if err := manager.onPlayerDisconnect(s); err != nil {
-				logger.Errorf("玩家退出: UID=%d, Error=%s", s.UID, err.Error())
+				logger.Errorf("玩家退出: UID=%d, Error=%s", s.UID(), err.Error())
 			}
 		}
 	})
@@ -128,6 +140,14 @@ func (manager *DeskManager) onPlayerDisconnect(s *session.Session) error {
 	}
 	p.logger.Debug("DeskManager.onPlayerDisconnect: 玩家网络断开")
 
+	// 退出观战和匹配
+	if p.watching != nil {
+		p.watching.removeSpectator(p)
+	}
+	if p.matching != nil {
+		defaultMatcher.leave(p)
+	}
+
 	// 移除session
 	p.removeSession()
 
@@ -151,6 +171,7 @@ func (manager *DeskManager) desk(number room.Number) (*Desk, bool) {
 func (manager *DeskManager) setDesk(number room.Number, desk *Desk) {
 	if desk == nil {
 		delete(manager.desks, number)
+		room.Release(number)
 		logger.WithField(fieldDesk, number).Debugf("清除房间: 剩余: %d", len(manager.desks))
 	} else {
 		manager.desks[number] = desk
@@ -174,6 +195,7 @@ func (manager *DeskManager) UnCompleteDesk(s *session.Session, _ []byte) error {
 	d := p.desk
 	if d.isDestroy() {
 		delete(manager.desks, d.roomNo)
+		room.Release(d.roomNo)
 		p.desk = nil
 		p.logger.Debug("DeskManager.UnCompleteDesk: 房间已销毁")
 		return s.Response(resp)
@@ -196,7 +218,15 @@ func (manager *DeskManager) UnCompleteDesk(s *session.Session, _ []byte) error {
 
 // 网络断开后, 重新连接网络
 func (manager *DeskManager) ReConnect(s *session.Session, req *protocol.ReConnect) error {
-	uid := req.Uid
+	claims, err := token.Parse(req.Token)
+	if err == nil && req.Uid != claims.Uid {
+		err = errutil.ErrTokenMismatchUser
+	}
+	if err != nil {
+		logger.Warnf("玩家重新连接服务器失败: UID=%d, Error=%v", req.Uid, err)
+		return err
+	}
+	uid := claims.Uid
 
 	// 绑定UID
 	if err := s.Bind(uid); err != nil {
@@ -363,7 +393,7 @@ func (manager *DeskManager) DingQue(s *session.Session, msg *protocol.DingQue) e
 		return nil
 	}
 
-	if d.opts.Mode != ModeFours {
+	if !d.rules.DingQue(d.opts.Mode) {
 		return ErrModeCannotQue
 	}
 
@@ -386,11 +416,17 @@ func (manager *DeskManager) Exit(s *session.Session, msg *protocol.ExitRequest)
 		return s.Push("onDissolveSuccess", protocol.EmptyMessage)
 	}
 
-	if d.status() != constant.DeskStatusCreate {
+	// 公共房间每局结束后可以离开
+	if d.status() != constant.DeskStatusCreate && (d.match == nil || d.status() != constant.DeskStatusCleaned) {
 		p.logger.Debug("房间已经开始，中途不能退出")
 		return nil
 	}
 
+	if d.tournament != nil {
+		p.logger.Debug("比赛房间不能退出")
+		return nil
+	}
+
 	deskPos := -1
 	for i, p := range d.players {
 		if p.Uid() == uid {
@@ -421,7 +457,7 @@ func (manager *DeskManager) Exit(s *session.Session, msg *protocol.ExitRequest)
 	if msg.IsDestroy {
 		route = "onDissolve"
 	}
-	d.group.Broadcast(route, res)
+	d.broadcast(route, res)
 
 	p.logger.Info("DeskManager.Exit: 退出房间")
 	d.onPlayerExit(s, false)
@@ -436,9 +472,11 @@ func (manager *DeskManager) OpChoose(s *session.Session, msg *protocol.OpChooseR
 	}
 
 	p.logger.Debugf("玩家选择: MSG=%+v", msg)
-	p.chOperation <- &protocol.OpChoosed{
-		Type:   msg.OpType,
-		TileID: msg.Index,
+	// 不能阻塞逻辑线程, 打牌goroutine保存牌桌状态时需要等待逻辑线程
+	select {
+	case p.chOperation <- &protocol.OpChoosed{Type: msg.OpType, TileID: msg.Index}:
+	default:
+		p.logger.Warnf("玩家操作队列已满, 丢弃操作=%+v", msg)
 	}
 	return nil
 }
@@ -500,6 +538,9 @@ func (manager *DeskManager) CreateDesk(s *session.Session, data *protocol.Create
 	if forceUpdate && data.Version != version {
 		return s.Response(createVersionExpire)
 	}
+	if isDraining() {
+		return s.Response(createDraining)
+	}
 
 	logger.Infof("牌桌选项: %#v", data.DeskOpts)
 
@@ -517,7 +558,7 @@ func (manager *DeskManager) CreateDesk(s *session.Session, data *protocol.Create
 
 	// 非俱乐部模式房卡数判定
 	if data.ClubId < 0 {
-		count := requireCardCount(data.DeskOpts.MaxRound)
+		count := deskCardCount(data.DeskOpts, true)
 		if p.coin < int64(count) {
 			return s.Response(deskCardNotEnough)
 		}
@@ -561,6 +602,9 @@ func (manager *DeskManager) Join(s *session.Session, data *protocol.JoinDeskRequ
 	if forceUpdate && data.Version != version {
 		return s.Response(joinVersionExpire)
 	}
+	if isDraining() {
+		return s.Response(joinDraining)
+	}
 
 	dn := room.Number(data.DeskNo)
 	d, ok := manager.desk(dn)
@@ -581,11 +625,28 @@ func (manager *DeskManager) Join(s *session.Session, data *protocol.JoinDeskRequ
 				Error: fmt.Sprintf("当前房间是俱乐部[%d]专属房间，俱乐部成员才可加入", d.clubId),
 			})
 		}
+
+		// 模板房间没有房主, 由俱乐部支付房卡
+		if d.template > 0 && db.IsBalanceEnough(d.clubId) == false {
+			return s.Response(clubCardNotEnough)
+		}
+	}
+
+	// AA和大赢家支付的房间, 加入时检查玩家的房卡
+	if count := d.requireCoin(s.UID()); count > 0 {
+		p, err := playerWithSession(s)
+		if err != nil {
+			return err
+		}
+		if p.coin < count {
+			return s.Response(deskCardNotEnough)
+		}
 	}
 
 	if err := d.playerJoin(s, false); err != nil {
 		d.logger.Errorf("玩家加入房间失败，UID=%d, Error=%s", s.UID(), err.Error())
 	}
+	defaultClubManager.onDeskJoined(d)
 
 	return s.Response(&protocol.JoinDeskResponse{
 		TableInfo: protocol.TableInfo{
@@ -601,6 +662,40 @@ func (manager *DeskManager) Join(s *session.Session, data *protocol.JoinDeskRequ
 	})
 }
 
+// 房主使用机器人补齐空位, 人数补齐后如果所有人已准备则直接开局
+func (manager *DeskManager) AddRobot(s *session.Session, _ []byte) error {
+	p, err := playerWithSession(s)
+	if err != nil {
+		return err
+	}
+
+	d := p.desk
+	if d == nil || d.isDestroy() {
+		p.logger.Debug("玩家不在房间内")
+		return nil
+	}
+
+	if !d.opts.Robot {
+		return s.Response(robotDisabled)
+	}
+
+	if d.creator != s.UID() {
+		return s.Response(robotNotCreator)
+	}
+
+	if d.status() != constant.DeskStatusCreate {
+		p.logger.Debugf("房间已经开始，不能添加机器人，当前状态=%s", d.status().String())
+		return nil
+	}
+
+	d.fillRobots()
+	d.syncDeskStatus()
+
+	// 必须在广播消息以后调用checkStart
+	d.checkStart()
+	return s.Response(protocol.SuccessResponse)
+}
+
 // 有玩家请求解散房间
 func (manager *DeskManager) Dissolve(s *session.Session, msg []byte) error {
 	p, err := playerWithSession(s)
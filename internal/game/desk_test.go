@@ -0,0 +1,29 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lonng/nanoserver/protocol"
+)
+
+func TestCoinPayers(t *testing.T) {
+	humans := []int64{1, 2, 3}
+
+	cases := []struct {
+		name    string
+		payment int
+		expect  []int64
+	}{
+		{"host pays", protocol.PaymentHost, []int64{1}},
+		{"aa", protocol.PaymentAA, []int64{1, 2, 3}},
+		{"winner pays at the end", protocol.PaymentWinner, nil},
+	}
+
+	for _, c := range cases {
+		// 只有扣除了房卡的玩家在解散时退还, 房主支付时其他玩家不会产生任何流水
+		if payers := coinPayers(c.payment, 1, humans); !reflect.DeepEqual(payers, c.expect) {
+			t.Fatalf("%s: expect %v, got %v", c.name, c.expect, payers)
+		}
+	}
+}
@@ -11,6 +11,6 @@ func newDice() *dice {
 	return &dice{}
 }
 
-func (d *dice) random() {
-	d.dice1, d.dice2 = rand.Intn(6)+1, rand.Intn(6)+1
+func (d *dice) random(r *rand.Rand) {
+	d.dice1, d.dice2 = r.Intn(6)+1, r.Intn(6)+1
 }
@@ -78,7 +78,7 @@ func (d *dissolveContext) updateOnlineStatus(uid int64, online bool) {
 	}
 
 	d.desk.logger.Debugf("玩家在线状态: %+v", d.pause)
-	d.desk.group.Broadcast("onPlayerOfflineStatus", &protocol.PlayerOfflineStatus{Uid: uid, Offline: !online})
+	d.desk.broadcast("onPlayerOfflineStatus", &protocol.PlayerOfflineStatus{Uid: uid, Offline: !online})
 }
 
 func (d *dissolveContext) setUidStatus(uid int64, agree bool, desc string) {
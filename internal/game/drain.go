@@ -0,0 +1,109 @@
+package game
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lonng/nano"
+	"github.com/lonng/nano/scheduler"
+	"github.com/lonng/nanoserver/pkg/constant"
+)
+
+const (
+	defaultDrainCountdown = 300 // 默认停服倒计时(秒)
+	drainNotifyInterval   = 60  // 停服倒计时中, 每隔多少秒广播一次
+)
+
+var (
+	draining     int32 // 是否处于停服维护状态
+	stopped      = make(chan struct{})
+	shutdownOnce sync.Once
+)
+
+func isDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// Drain 进入停服维护状态: 禁止创建/加入房间, 广播停服倒计时, 进行中的房间打完当前局后直接结算,
+// 所有房间结算完成或倒计时结束后关闭游戏服, 倒计时结束时仍未结束的房间强制解散
+func Drain(countdown int) {
+	if !atomic.CompareAndSwapInt32(&draining, 0, 1) {
+		logger.Info("游戏服已经处于停服维护状态")
+		return
+	}
+
+	if countdown <= 0 {
+		countdown = defaultDrainCountdown
+	}
+
+	scheduler.PushTask(func() {
+		logger.Infof("开始停服维护, 倒计时: %d秒, 剩余房间数量: %d", countdown, len(defaultDeskManager.desks))
+		defaultDeskManager.drain()
+		defaultMatcher.cancelAll(matchDrainCancel)
+
+		rest := countdown
+		broadcastCountdown(rest)
+
+		var timer *scheduler.Timer
+		timer = scheduler.NewTimer(time.Second, func() {
+			rest--
+			if len(defaultDeskManager.desks) == 0 {
+				timer.Stop()
+				logger.Info("所有房间已经结算, 关闭游戏服")
+				Shutdown()
+				return
+			}
+
+			if rest <= 0 {
+				timer.Stop()
+				logger.Warnf("停服倒计时结束, 强制解散剩余房间: %d", len(defaultDeskManager.desks))
+				defaultDeskManager.dissolveAll()
+				// 等待解散消息发送完成
+				scheduler.NewAfterTimer(time.Second, Shutdown)
+				return
+			}
+
+			if rest%drainNotifyInterval == 0 || rest == 30 || rest == 10 {
+				broadcastCountdown(rest)
+			}
+		})
+	})
+}
+
+func broadcastCountdown(rest int) {
+	BroadcastSystemMessage(fmt.Sprintf("服务器将在%d秒后停机维护, 进行中的房间将在本局结束后结算", rest))
+}
+
+// Shutdown 关闭游戏服
+func Shutdown() {
+	shutdownOnce.Do(nano.Shutdown)
+}
+
+// Stopped 游戏服关闭后返回的channel会被关闭
+func Stopped() <-chan struct{} {
+	return stopped
+}
+
+// 停服维护: 未开局的房间直接解散, 局间的房间直接结算, 进行中的房间等待本局结束
+func (manager *DeskManager) drain() {
+	for _, d := range manager.desks {
+		switch d.status() {
+		case constant.DeskStatusCreate:
+			d.doDissolve()
+		case constant.DeskStatusCleaned:
+			d.finalSettlement(false, d.roundOverHelper())
+		}
+	}
+}
+
+// 强制解散所有房间
+func (manager *DeskManager) dissolveAll() {
+	for _, d := range manager.desks {
+		if d.dissolve.isDissolving() {
+			d.dissolve.stop()
+		}
+		d.doDissolve()
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/lonng/nano/component"
 	"github.com/lonng/nano/pipeline"
 	"github.com/lonng/nano/serialize/json"
+	"github.com/lonng/nanoserver/protocol"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
@@ -47,6 +48,8 @@ func SetCardConsume(cfg string) {
 
 // Startup 初始化游戏服务器
 func Startup() {
+	defer close(stopped)
+
 	rand.Seed(time.Now().Unix())
 	version = viper.GetString("update.version")
 
@@ -60,6 +63,53 @@ func Startup() {
 	SetCardConsume(csm)
 	forceUpdate = viper.GetBool("update.force")
 
+	// 每个房间的观战人数上限
+	if viper.IsSet("game-server.spectators") {
+		spectatorLimit = viper.GetInt("game-server.spectators")
+	}
+
+	// 公共房间匹配的排队超时时间以及超时后是否使用机器人补位
+	if viper.IsSet("game-server.match-timeout") {
+		matchTimeout = viper.GetInt("game-server.match-timeout")
+	}
+	if viper.IsSet("game-server.match-robot") {
+		matchRobot = viper.GetBool("game-server.match-robot")
+	}
+
+	// 经典场抽水比例以及各场次的底分和入场金额
+	if viper.IsSet("coin.rake") {
+		SetCoinRake(viper.GetInt("coin.rake"))
+	}
+	if viper.IsSet("coin.robot-pays") {
+		SetRobotPays(viper.GetBool("coin.robot-pays"))
+	}
+	if cfg := viper.GetString("coin.silver"); cfg != "" {
+		SetCoinTiers(protocol.CoinTypeSliver, cfg)
+	}
+	if cfg := viper.GetString("coin.gold"); cfg != "" {
+		SetCoinTiers(protocol.CoinTypeGold, cfg)
+	}
+
+	// 固定的随机种子只能在调试模式下使用, 所有牌桌的牌序都相同
+	if viper.GetBool("core.debug") {
+		debugSeed = viper.GetInt64("game-server.fixed-seed")
+	}
+
+	// 俱乐部房卡不足提醒值
+	if viper.IsSet("club.low-balance") {
+		clubLowBalance = viper.GetInt64("club.low-balance")
+	}
+
+	// 未完成房间的保存目录, 为空时不保存
+	if dir := viper.GetString("game-server.store"); dir != "" {
+		store, err := newDeskStore(dir)
+		if err != nil {
+			logger.Errorf("初始化房间存储失败, Error=%v", err)
+		} else {
+			defaultDeskManager.store = store
+		}
+	}
+
 	logger.Infof("当前游戏服务器版本: %s, 是否强制更新: %t, 当前心跳时间间隔: %d秒", version, forceUpdate, heartbeat)
 	logger.Info("game service starup")
 
@@ -67,7 +117,9 @@ func Startup() {
 	comps := &component.Components{}
 	comps.Register(defaultManager)
 	comps.Register(defaultDeskManager)
-	comps.Register(new(ClubManager))
+	comps.Register(defaultClubManager)
+	comps.Register(defaultMatcher)
+	comps.Register(defaultTournamentManager)
 
 	// 加密管道
 	c := newCrypto()
@@ -28,6 +28,23 @@ func verifyOptions(opts *protocol.DeskOptions) bool {
 		return false
 	}
 
+	if _, ok := rulesetWithName(opts.Ruleset); !ok {
+		return false
+	}
+
+	if opts.Timeout < 0 || opts.Timeout > maxOperationTimeout {
+		return false
+	}
+
+	if opts.Payment < protocol.PaymentHost || opts.Payment > protocol.PaymentWinner {
+		return false
+	}
+
+	// 机器人难度, 0表示使用默认难度
+	if opts.RobotLevel < 0 || opts.RobotLevel > protocol.RobotLevelHard {
+		return false
+	}
+
 	return true
 }
 
@@ -47,6 +64,26 @@ func requireCardCount(round int) int {
 	return c
 }
 
+// AA支付时每个玩家需要的房卡, 不能整除时向上取整
+func requireAACardCount(round, players int) int {
+	return (requireCardCount(round) + players - 1) / players
+}
+
+// 根据支付方式计算玩家需要的房卡, 大赢家支付时每个玩家都可能需要支付全部房卡
+func deskCardCount(opts *protocol.DeskOptions, isCreator bool) int {
+	switch opts.Payment {
+	case protocol.PaymentAA:
+		return requireAACardCount(opts.MaxRound, opts.Mode)
+	case protocol.PaymentWinner:
+		return requireCardCount(opts.MaxRound)
+	default:
+		if isCreator {
+			return requireCardCount(opts.MaxRound)
+		}
+		return 0
+	}
+}
+
 func playerWithSession(s *session.Session) (*Player, error) {
 	p, ok := s.Value(kCurPlayer).(*Player)
 	if !ok {
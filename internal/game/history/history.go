@@ -15,6 +15,7 @@ type SnapShot struct {
 	BasicInfo *protocol.DeskBasicInfo   `json:"basicInfo"`
 	DuanPai   *protocol.DuanPai         `json:"duanPai"`
 	End       *protocol.RoundOverStats  `json:"end"`
+	Seed      int64                     `json:"seed"` // 本局随机种子, 用于复现牌局
 
 	// 如果在此遇到了gang操作就去GangScoreChanges中按序拿数据,
 	// 如果遇到了hu就去HuScoreChanges中拿数据,
@@ -42,7 +43,7 @@ type History struct {
 	SnapShot
 }
 
-func New(deskID int64, mode int, name0, name1, name2, name3 string, basic *protocol.DeskBasicInfo, enter *protocol.PlayerEnterDesk, duan *protocol.DuanPai) *History {
+func New(deskID int64, mode int, name0, name1, name2, name3 string, basic *protocol.DeskBasicInfo, enter *protocol.PlayerEnterDesk, duan *protocol.DuanPai, seed int64) *History {
 	return &History{
 		beginAt:     time.Now().Unix(),
 		deskID:      deskID,
@@ -55,10 +56,46 @@ func New(deskID int64, mode int, name0, name1, name2, name3 string, basic *proto
 			BasicInfo: basic,
 			DuanPai:   duan,
 			Enter:     enter,
+			Seed:      seed,
 		},
 	}
 }
 
+// 未完成牌局的快照, 服务器重启后用于恢复
+type historyState struct {
+	Mode        int       `json:"mode"`
+	BeginAt     int64     `json:"beginAt"`
+	DeskID      int64     `json:"deskId"`
+	PlayerNames [4]string `json:"playerNames"`
+	SnapShot    *SnapShot `json:"snapshot"`
+}
+
+func (h *History) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&historyState{
+		Mode:        h.mode,
+		BeginAt:     h.beginAt,
+		DeskID:      h.deskID,
+		PlayerNames: [4]string{h.playerName0, h.playerName1, h.playerName2, h.playerName3},
+		SnapShot:    &h.SnapShot,
+	})
+}
+
+func (h *History) UnmarshalJSON(data []byte) error {
+	state := &historyState{SnapShot: &h.SnapShot}
+	if err := json.Unmarshal(data, state); err != nil {
+		return err
+	}
+
+	h.mode = state.Mode
+	h.beginAt = state.BeginAt
+	h.deskID = state.DeskID
+	h.playerName0 = state.PlayerNames[0]
+	h.playerName1 = state.PlayerNames[1]
+	h.playerName2 = state.PlayerNames[2]
+	h.playerName3 = state.PlayerNames[3]
+	return nil
+}
+
 func (h *History) PushAction(op *protocol.OpTypeDo) {
 	h.Do = append(h.Do, op)
 }
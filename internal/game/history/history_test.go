@@ -0,0 +1,30 @@
+package history
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/lonng/nanoserver/protocol"
+)
+
+func TestHistoryMarshal(t *testing.T) {
+	h := New(10, 3, "a", "b", "c", "/", &protocol.DeskBasicInfo{DeskID: "123456"}, nil, nil, 42)
+	h.PushAction(do(1, protocol.OptypeChu, 0))
+
+	data, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &History{}
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.deskID != 10 || restored.mode != 3 || restored.playerName2 != "c" || restored.beginAt != h.beginAt {
+		t.Fatalf("unexpected history meta: %+v", restored)
+	}
+	if restored.Seed != 42 || len(restored.Do) != 1 || restored.BasicInfo.DeskID != "123456" {
+		t.Fatalf("unexpected snapshot: %+v", restored.SnapShot)
+	}
+}
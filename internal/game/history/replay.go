@@ -0,0 +1,594 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/lonng/nanoserver/internal/game/mahjong"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+// 回放中的分值变化类型, 与牌桌中的流水类型一致
+const (
+	scoreTypeAnGang = iota // 下雨(暗杠/点杠)
+	scoreTypeBaGang        // 刮风(巴杠)
+	scoreTypeHu            // 胡牌
+)
+
+// 回放中的玩家状态
+type replayPlayer struct {
+	uid      int64
+	name     string
+	onHand   []int // 手牌
+	chupai   []int // 出牌
+	pongKong []int // 碰杠牌
+	isHu     bool
+	huTile   int
+	isGang   bool // 杠牌后尚未出牌, 此时出牌被胡为杠上炮
+}
+
+// 一条分值变化: winner从loser赢得score分
+type replayScore struct {
+	winner int64
+	loser  int64
+	score  int
+	typ    int
+	tileID int
+}
+
+// 等待确认的巴杠, 有人抢杠则不算杠
+type replayBaGang struct {
+	uid    int64
+	tileID int
+	robbed bool
+}
+
+// Replayer 根据快照逐步重建牌桌状态
+type Replayer struct {
+	snapshot *SnapShot
+	step     int
+
+	players []*replayPlayer
+	scores  []*replayScore
+
+	gangCursor int // 已经处理的杠牌分值变化
+	huCursor   int // 已经处理的胡牌分值变化
+
+	lastChuUid  int64 // 最后一个出牌的玩家
+	lastChuTile int   // 最后一张出牌
+	lastChuGang bool  // 最后一张出牌是否是杠后出牌
+
+	baGang  *replayBaGang
+	settled bool
+	errors  []string
+}
+
+// ParseSnapShot 从数据库保存的快照数据解析
+func ParseSnapShot(data string) (*SnapShot, error) {
+	s := &SnapShot{}
+	if err := json.Unmarshal([]byte(data), s); err != nil {
+		return nil, err
+	}
+	if s.DuanPai == nil || len(s.DuanPai.AccountInfo) == 0 {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	// 损坏或者旧版本的快照中可能有非法的牌, 回放时计算牌的index会panic
+	for _, info := range s.DuanPai.AccountInfo {
+		if !validTiles(info.OnHand) {
+			return nil, errutil.ErrInvalidParameter
+		}
+	}
+	for _, op := range s.Do {
+		if op == nil || !validTiles(op.TileIDs) {
+			return nil, errutil.ErrInvalidParameter
+		}
+	}
+	return s, nil
+}
+
+func validTiles(ids []int) bool {
+	for _, id := range ids {
+		if id < 0 || id > mahjong.MaxTileID {
+			return false
+		}
+	}
+	return true
+}
+
+func NewReplayer(s *SnapShot) *Replayer {
+	r := &Replayer{snapshot: s}
+	r.reset()
+	return r
+}
+
+// Steps 所有操作步数
+func (r *Replayer) Steps() int {
+	return len(r.snapshot.Do)
+}
+
+func (r *Replayer) reset() {
+	names := map[int64]string{}
+	if enter := r.snapshot.Enter; enter != nil {
+		for _, e := range enter.Data {
+			names[e.Uid] = e.Nickname
+		}
+	}
+
+	r.players = nil
+	for _, info := range r.snapshot.DuanPai.AccountInfo {
+		p := &replayPlayer{
+			uid:    info.Uid,
+			name:   names[info.Uid],
+			onHand: append([]int{}, info.OnHand...),
+			huTile: -1,
+		}
+		r.players = append(r.players, p)
+	}
+
+	r.step = 0
+	r.scores = nil
+	r.gangCursor = 0
+	r.huCursor = 0
+	r.lastChuUid = 0
+	r.lastChuTile = -1
+	r.lastChuGang = false
+	r.baGang = nil
+	r.settled = false
+	r.errors = nil
+}
+
+// Seek 重建执行完前n步操作后的牌桌状态, n等于总步数时包含本局结算
+func (r *Replayer) Seek(n int) (*protocol.ReplayState, error) {
+	if n < 0 || n > r.Steps() {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	if n < r.step {
+		r.reset()
+	}
+
+	for r.step < n {
+		r.next()
+	}
+
+	if r.step == r.Steps() {
+		r.settle()
+	}
+
+	return r.state(), nil
+}
+
+// Verify 回放整局, 并与快照中的结算数据比较, 返回所有不一致的地方
+func (r *Replayer) Verify() []string {
+	r.Seek(r.Steps())
+
+	mismatches := append([]string{}, r.errors...)
+	end := r.snapshot.End
+	if end == nil {
+		return append(mismatches, "快照中没有结算数据")
+	}
+
+	for _, info := range end.HandTiles {
+		p := r.player(info.Uid)
+		if p == nil {
+			mismatches = append(mismatches, fmt.Sprintf("结算玩家不存在: UID=%d", info.Uid))
+			continue
+		}
+		if p.huTile != info.HuPai {
+			mismatches = append(mismatches, fmt.Sprintf("胡牌不一致: UID=%d 回放=%d 结算=%d", p.uid, p.huTile, info.HuPai))
+		}
+		if hand := p.handWithoutHu(); !sameTiles(hand, info.Tiles) {
+			mismatches = append(mismatches, fmt.Sprintf("手牌不一致: UID=%d 回放=%v 结算=%v", p.uid, hand, info.Tiles))
+		}
+	}
+
+	for _, sc := range end.ScoreChange {
+		p := r.player(sc.Uid)
+		if p == nil {
+			mismatches = append(mismatches, fmt.Sprintf("结算玩家不存在: UID=%d", sc.Uid))
+			continue
+		}
+		if score := r.score(p.uid); score != sc.Score {
+			mismatches = append(mismatches, fmt.Sprintf("分数不一致: UID=%d 回放=%d 结算=%d", p.uid, score, sc.Score))
+		}
+	}
+
+	return mismatches
+}
+
+func (r *Replayer) player(uid int64) *replayPlayer {
+	for _, p := range r.players {
+		if p.uid == uid {
+			return p
+		}
+	}
+	return nil
+}
+
+func (r *Replayer) fail(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf("第%d步: ", r.step+1)+fmt.Sprintf(format, args...))
+}
+
+// 执行下一步操作
+func (r *Replayer) next() {
+	op := r.snapshot.Do[r.step]
+	defer func() { r.step++ }()
+
+	if len(op.Uid) == 0 || len(op.TileIDs) == 0 {
+		r.fail("操作数据不完整: %+v", op)
+		return
+	}
+
+	p := r.player(op.Uid[0])
+	if p == nil {
+		r.fail("玩家不存在: UID=%d", op.Uid[0])
+		return
+	}
+
+	tile := op.TileIDs[0]
+
+	// 巴杠后的第一个非抢杠操作, 确认巴杠
+	if r.baGang != nil && (op.OpType != protocol.OptypeHu || tile != r.baGang.tileID) {
+		r.confirmBaGang()
+	}
+
+	switch op.OpType {
+	case protocol.OptyMoPai:
+		p.onHand = append(p.onHand, tile)
+
+	case protocol.OptypeChu:
+		if !removeTile(&p.onHand, tile) {
+			r.fail("出牌不在手牌中: UID=%d 牌=%d", p.uid, tile)
+		}
+		p.chupai = append(p.chupai, tile)
+		r.lastChuUid, r.lastChuTile, r.lastChuGang = p.uid, tile, p.isGang
+		p.isGang = false
+
+	case protocol.OptypePeng:
+		index := mahjong.IndexFromID(tile)
+		moved := removeIndex(&p.onHand, index, 2)
+		if len(moved) != 2 {
+			r.fail("碰牌数量错误: UID=%d 牌=%d", p.uid, tile)
+		}
+		p.pongKong = append(p.pongKong, moved...)
+		p.pongKong = append(p.pongKong, tile)
+		r.claimDiscard(tile)
+
+	case protocol.OptypeChi:
+		// 第一张为上家打出的牌, 后两张为手牌
+		if len(op.TileIDs) != 3 {
+			r.fail("吃牌数量错误: UID=%d 牌=%v", p.uid, op.TileIDs)
+			return
+		}
+		for _, id := range op.TileIDs[1:] {
+			if !removeTile(&p.onHand, id) {
+				r.fail("吃牌不在手牌中: UID=%d 牌=%d", p.uid, id)
+			}
+		}
+		chow := append([]int{}, op.TileIDs...)
+		sort.Ints(chow)
+		p.pongKong = append(p.pongKong, chow...)
+		r.claimDiscard(tile)
+
+	case protocol.OptypeGang:
+		index := mahjong.IndexFromID(tile)
+		switch countIndex(p.onHand, index) {
+		case 4: // 暗杠
+			p.pongKong = append(p.pongKong, removeIndex(&p.onHand, index, 4)...)
+			r.applyGang(p, tile)
+		case 3: // 点杠
+			p.pongKong = append(p.pongKong, removeIndex(&p.onHand, index, 3)...)
+			p.pongKong = append(p.pongKong, tile)
+			r.claimDiscard(tile)
+			r.applyGang(p, tile)
+		case 1: // 巴杠, 需要等待抢杠结果
+			r.baGang = &replayBaGang{uid: p.uid, tileID: tile}
+		default:
+			r.fail("杠牌数量错误: UID=%d 牌=%d", p.uid, tile)
+		}
+
+	case protocol.OptypeHu:
+		switch {
+		case r.baGang != nil && tile == r.baGang.tileID:
+			// 抢杠胡, 一炮多响时只移除一次
+			if !r.baGang.robbed {
+				r.baGang.robbed = true
+				if gp := r.player(r.baGang.uid); gp != nil {
+					removeTile(&gp.onHand, tile)
+				}
+			}
+			p.onHand = append(p.onHand, tile)
+
+		case containsTile(p.onHand, tile):
+			// 自摸, 胡的牌已经在手牌中
+
+		default:
+			// 点炮
+			p.onHand = append(p.onHand, tile)
+			r.claimDiscard(tile)
+			if r.lastChuGang {
+				r.zhuanYu(p.uid, r.lastChuUid)
+			}
+		}
+
+		p.isHu = true
+		p.huTile = tile
+		r.applyHu(p)
+
+	default:
+		r.fail("未知操作: %+v", op)
+	}
+}
+
+// 出的牌被碰/杠/胡, 从出牌玩家的出牌中移除
+func (r *Replayer) claimDiscard(tile int) {
+	if tile != r.lastChuTile {
+		r.fail("操作的牌不是最后一张出牌: 牌=%d 最后出牌=%d", tile, r.lastChuTile)
+		return
+	}
+
+	cp := r.player(r.lastChuUid)
+	if cp == nil || len(cp.chupai) == 0 {
+		return
+	}
+	if last := len(cp.chupai) - 1; cp.chupai[last] == tile {
+		cp.chupai = cp.chupai[:last]
+	}
+}
+
+func (r *Replayer) confirmBaGang() {
+	bg := r.baGang
+	r.baGang = nil
+	if bg.robbed {
+		return
+	}
+
+	p := r.player(bg.uid)
+	removeTile(&p.onHand, bg.tileID)
+	p.pongKong = append(p.pongKong, bg.tileID)
+	r.applyGang(p, bg.tileID)
+}
+
+func (r *Replayer) applyGang(p *replayPlayer, tile int) {
+	p.isGang = true
+	if r.gangCursor >= len(r.snapshot.GangScoreChanges) {
+		r.fail("缺少杠牌分值变化: UID=%d 牌=%d", p.uid, tile)
+		return
+	}
+
+	gsc := r.snapshot.GangScoreChanges[r.gangCursor]
+	r.gangCursor++
+
+	typ := scoreTypeBaGang
+	if gsc.IsXiaYu {
+		typ = scoreTypeAnGang
+	}
+	if len(gsc.Changes) == 0 || gsc.Changes[0].Uid != p.uid {
+		r.fail("杠牌分值变化与操作不一致: UID=%d 变化=%+v", p.uid, gsc.Changes)
+		return
+	}
+	for _, c := range gsc.Changes[1:] {
+		r.scores = append(r.scores, &replayScore{winner: p.uid, loser: c.Uid, score: -c.Score, typ: typ, tileID: tile})
+	}
+}
+
+func (r *Replayer) applyHu(p *replayPlayer) {
+	if r.huCursor >= len(r.snapshot.HuScoreChanges) {
+		r.fail("缺少胡牌分值变化: UID=%d", p.uid)
+		return
+	}
+
+	hsc := r.snapshot.HuScoreChanges[r.huCursor]
+	r.huCursor++
+	if hsc.Uid != p.uid {
+		r.fail("胡牌分值变化与操作不一致: UID=%d 变化=%d", p.uid, hsc.Uid)
+		return
+	}
+	r.applyHuInfo(hsc, p.huTile)
+}
+
+func (r *Replayer) applyHuInfo(hsc *protocol.HuInfo, tile int) {
+	for _, c := range hsc.ScoreChange {
+		r.scores = append(r.scores, &replayScore{winner: hsc.Uid, loser: c.Uid, score: -c.Score, typ: scoreTypeHu, tileID: tile})
+	}
+}
+
+// 杠上炮转雨, 与牌桌的转雨规则一致
+func (r *Replayer) zhuanYu(huUid, chuUid int64) {
+	lastTile := -1
+	for i := len(r.scores) - 1; i >= 0; i-- {
+		s := r.scores[i]
+		if s.typ != scoreTypeHu && (s.winner == chuUid || s.loser == chuUid) {
+			lastTile = s.tileID
+			break
+		}
+	}
+	if lastTile < 0 {
+		r.fail("杠上炮但是没有杠牌记录: UID=%d", chuUid)
+		return
+	}
+
+	for _, s := range r.scores {
+		if s.winner != chuUid || s.tileID != lastTile || s.typ == scoreTypeHu {
+			continue
+		}
+		s.score = 0
+
+		// 不需要转雨给自己
+		if s.loser == huUid {
+			continue
+		}
+
+		score := 1
+		if s.typ == scoreTypeAnGang {
+			score = 2
+		}
+		r.scores = append(r.scores, &replayScore{winner: huUid, loser: s.loser, score: score, typ: s.typ, tileID: lastTile})
+	}
+}
+
+// 本局结算: 查叫, 无叫玩家的刮风下雨清零, 有叫玩家按最大番数赔叫
+func (r *Replayer) settle() {
+	if r.settled {
+		return
+	}
+	r.settled = true
+
+	if r.baGang != nil {
+		r.confirmBaGang()
+	}
+
+	won := 0
+	for _, p := range r.players {
+		if p.isHu {
+			won++
+		}
+	}
+
+	// 只剩一个人没有和牌, 不查叫
+	if won != len(r.players)-1 {
+		pei := map[int64]bool{}
+		for _, p := range r.players {
+			if !p.isHu && !mahjong.IsTing(indexes(p.onHand)) {
+				pei[p.uid] = true
+			}
+		}
+
+		for _, s := range r.scores {
+			if s.typ != scoreTypeHu && pei[s.winner] {
+				s.score = 0
+			}
+		}
+	}
+
+	// 剩下的胡牌分值变化都是赔叫
+	for ; r.huCursor < len(r.snapshot.HuScoreChanges); r.huCursor++ {
+		hsc := r.snapshot.HuScoreChanges[r.huCursor]
+		if hsc.HuPaiType != protocol.HuTypePei {
+			r.fail("多余的胡牌分值变化: %+v", hsc)
+			continue
+		}
+		r.applyHuInfo(hsc, -1)
+	}
+
+	if r.gangCursor != len(r.snapshot.GangScoreChanges) {
+		r.fail("多余的杠牌分值变化: 已处理=%d 总数=%d", r.gangCursor, len(r.snapshot.GangScoreChanges))
+	}
+}
+
+func (r *Replayer) score(uid int64) int {
+	score := 0
+	for _, s := range r.scores {
+		if s.winner == uid {
+			score += s.score
+		}
+		if s.loser == uid {
+			score -= s.score
+		}
+	}
+	return score
+}
+
+func (r *Replayer) state() *protocol.ReplayState {
+	state := &protocol.ReplayState{
+		Step:    r.step,
+		Total:   r.Steps(),
+		Players: []protocol.ReplayPlayer{},
+	}
+	if r.step > 0 {
+		state.Op = r.snapshot.Do[r.step-1]
+	}
+
+	for _, p := range r.players {
+		state.Players = append(state.Players, protocol.ReplayPlayer{
+			Uid:       p.uid,
+			Name:      p.name,
+			HandTiles: append([]int{}, p.onHand...),
+			ChuTiles:  append([]int{}, p.chupai...),
+			PGTiles:   append([]int{}, p.pongKong...),
+			IsHu:      p.isHu,
+			HuPai:     p.huTile,
+			Score:     r.score(p.uid),
+		})
+	}
+	return state
+}
+
+// 结算时手牌不包含胡的牌
+func (p *replayPlayer) handWithoutHu() []int {
+	hand := append([]int{}, p.onHand...)
+	if p.isHu {
+		removeTile(&hand, p.huTile)
+	}
+	return hand
+}
+
+func indexes(ids []int) mahjong.Indexes {
+	idx := make(mahjong.Indexes, len(ids))
+	for i, id := range ids {
+		idx[i] = mahjong.IndexFromID(id)
+	}
+	return idx
+}
+
+func containsTile(ids []int, id int) bool {
+	for _, t := range ids {
+		if t == id {
+			return true
+		}
+	}
+	return false
+}
+
+func removeTile(ids *[]int, id int) bool {
+	for i, t := range *ids {
+		if t == id {
+			*ids = append((*ids)[:i], (*ids)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func countIndex(ids []int, index int) int {
+	count := 0
+	for _, id := range ids {
+		if mahjong.IndexFromID(id) == index {
+			count++
+		}
+	}
+	return count
+}
+
+// 从手牌中移除最多count张同一index的牌, 返回移除的牌
+func removeIndex(ids *[]int, index, count int) []int {
+	var removed, rest []int
+	for _, id := range *ids {
+		if len(removed) < count && mahjong.IndexFromID(id) == index {
+			removed = append(removed, id)
+			continue
+		}
+		rest = append(rest, id)
+	}
+	*ids = rest
+	return removed
+}
+
+func sameTiles(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]int{}, a...)
+	y := append([]int{}, b...)
+	sort.Ints(x)
+	sort.Ints(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
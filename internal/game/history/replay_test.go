@@ -0,0 +1,152 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+func do(uid int64, op int, tiles ...int) *protocol.OpTypeDo {
+	return &protocol.OpTypeDo{Uid: []int64{uid}, OpType: op, TileIDs: tiles}
+}
+
+func TestReplayPengAndDianPao(t *testing.T) {
+	s := &SnapShot{
+		DuanPai: &protocol.DuanPai{AccountInfo: []protocol.DuanPaiInfo{
+			{Uid: 1, OnHand: []int{0, 4, 8, 12, 16, 20, 24, 28, 32, 36, 40, 44, 48, 52}},
+			{Uid: 2, OnHand: []int{1, 2, 5, 9, 13, 17, 21, 25, 29, 33, 37, 41, 45}},
+			{Uid: 3, OnHand: []int{3, 6, 10, 14, 18, 22, 26, 30, 34, 38, 42, 46, 49}},
+		}},
+		Do: []*protocol.OpTypeDo{
+			do(1, protocol.OptypeChu, 0),
+			do(2, protocol.OptypePeng, 0, 1, 2),
+			do(2, protocol.OptypeChu, 5),
+			do(3, protocol.OptypeHu, 5),
+		},
+		HuScoreChanges: []*protocol.HuInfo{
+			{Uid: 3, HuPaiType: protocol.HuTypeDianPao, ScoreChange: []protocol.ScoreInfo{{Uid: 2, Score: -2}}},
+		},
+		End: &protocol.RoundOverStats{
+			HandTiles: []*protocol.HandTilesInfo{
+				{Uid: 1, Tiles: []int{4, 8, 12, 16, 20, 24, 28, 32, 36, 40, 44, 48, 52}, HuPai: -1},
+				{Uid: 2, Tiles: []int{9, 13, 17, 21, 25, 29, 33, 37, 41, 45}, HuPai: -1},
+				{Uid: 3, Tiles: []int{3, 6, 10, 14, 18, 22, 26, 30, 34, 38, 42, 46, 49}, HuPai: 5},
+			},
+			ScoreChange: []protocol.GameEndScoreChange{{Uid: 1}, {Uid: 2, Score: -2}, {Uid: 3, Score: 2}},
+		},
+	}
+
+	r := NewReplayer(s)
+	state, err := r.Seek(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pg := state.Players[1].PGTiles; len(pg) != 3 {
+		t.Fatalf("expect 3 peng tiles, got %v", pg)
+	}
+	if chu := state.Players[0].ChuTiles; len(chu) != 0 {
+		t.Fatalf("claimed tile should be removed from discards, got %v", chu)
+	}
+
+	if _, err := r.Seek(5); err == nil {
+		t.Fatal("expect error when step out of range")
+	}
+
+	if m := NewReplayer(s).Verify(); len(m) > 0 {
+		t.Fatalf("unexpected mismatches: %v", m)
+	}
+}
+
+func TestReplayGangShangPao(t *testing.T) {
+	s := &SnapShot{
+		DuanPai: &protocol.DuanPai{AccountInfo: []protocol.DuanPaiInfo{
+			{Uid: 1, OnHand: []int{0, 1, 2, 3, 4, 8, 12, 16, 20, 24, 28, 32, 36, 40}},
+			{Uid: 2, OnHand: []int{5, 9, 13, 17, 21, 25, 29, 33, 37, 41, 45, 49, 53}},
+			{Uid: 3, OnHand: []int{6, 10, 14, 18, 22, 26, 30, 34, 38, 42, 46, 50, 54}},
+		}},
+		Do: []*protocol.OpTypeDo{
+			do(1, protocol.OptypeGang, 0, 1, 2, 3),
+			do(1, protocol.OptyMoPai, 44),
+			do(1, protocol.OptypeChu, 44),
+			do(2, protocol.OptypeHu, 44),
+		},
+		GangScoreChanges: []*protocol.GangPaiScoreChange{
+			{IsXiaYu: true, Changes: []protocol.ScoreInfo{{Uid: 1, Score: 4}, {Uid: 2, Score: -2}, {Uid: 3, Score: -2}}},
+		},
+		HuScoreChanges: []*protocol.HuInfo{
+			{Uid: 2, HuPaiType: protocol.HuTypeDianPao, ScoreChange: []protocol.ScoreInfo{{Uid: 1, Score: -4}}},
+		},
+	}
+
+	r := NewReplayer(s)
+	state, err := r.Seek(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Players[0].Score != 4 {
+		t.Fatalf("expect 4 after gang, got %d", state.Players[0].Score)
+	}
+
+	// 杠上炮, 杠牌的分转给胡牌的玩家
+	state, err = r.Seek(r.Steps())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []int{-4, 6, -2}
+	for i, p := range state.Players {
+		if p.Score != expect[i] {
+			t.Fatalf("player %d expect score %d, got %d", p.Uid, expect[i], p.Score)
+		}
+	}
+}
+
+func TestReplayChi(t *testing.T) {
+	s := &SnapShot{
+		DuanPai: &protocol.DuanPai{AccountInfo: []protocol.DuanPaiInfo{
+			{Uid: 1, OnHand: []int{0, 12, 16, 20, 24, 28, 32, 36, 40, 44, 48, 52, 56, 60}},
+			{Uid: 2, OnHand: []int{4, 8, 13, 17, 21, 25, 29, 33, 37, 41, 45, 49, 53}},
+		}},
+		Do: []*protocol.OpTypeDo{
+			do(1, protocol.OptypeChu, 0),
+			do(2, protocol.OptypeChi, 0, 4, 8),
+			do(2, protocol.OptypeChu, 13),
+		},
+	}
+
+	state, err := NewReplayer(s).Seek(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pg := state.Players[1].PGTiles; !sameTiles(pg, []int{0, 4, 8}) {
+		t.Fatalf("expect chow 0 4 8, got %v", pg)
+	}
+	if n := len(state.Players[1].HandTiles); n != 11 {
+		t.Fatalf("expect 11 tiles on hand, got %d", n)
+	}
+	if chu := state.Players[0].ChuTiles; len(chu) != 0 {
+		t.Fatalf("claimed tile should be removed from discards, got %v", chu)
+	}
+}
+
+func TestParseSnapShotInvalidTiles(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+	}{
+		{"hand tile out of range", `{"duanPai":{"accountInfo":[{"acId":1,"mjs":[0,144]}]}}`},
+		{"negative hand tile", `{"duanPai":{"accountInfo":[{"acId":1,"mjs":[-1]}]}}`},
+		{"op tile out of range", `{"duanPai":{"accountInfo":[{"acId":1,"mjs":[0]}]},"do":[{"uid":[1],"optype":1,"mjs":[200]}]}`},
+		{"empty op", `{"duanPai":{"accountInfo":[{"acId":1,"mjs":[0]}]},"do":[null]}`},
+	}
+
+	for _, c := range cases {
+		if _, err := ParseSnapShot(c.data); err != errutil.ErrInvalidParameter {
+			t.Fatalf("%s: expect %v, got %v", c.name, errutil.ErrInvalidParameter, err)
+		}
+	}
+
+	if _, err := ParseSnapShot(`{"duanPai":{"accountInfo":[{"acId":1,"mjs":[0,143]}]}}`); err != nil {
+		t.Fatalf("valid snapshot: %v", err)
+	}
+}
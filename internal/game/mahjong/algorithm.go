@@ -9,7 +9,7 @@ func isLegal(indexes Indexes) bool {
 
 	sequence, sequenceCount := indexes.UnmarkedSequence() // 顺子
 	if sequenceCount == 3 {
-		if sequence[0].Index > 30 {
+		if sequence[0].Index > MaxSuitIndex {
 			return false // 字牌不能组合成顺子
 		}
 		indexes.Mark(int(sequence[0].I), int(sequence[1].I), int(sequence[2].I))
@@ -22,7 +22,15 @@ func CheckWin(indexes Indexes) bool {
 	indexes.Sort()
 	stats := Stats{}
 	stats.FromIndex(indexes)
-	if isQiDui(&stats) {
+
+	// 花牌不能组成手牌
+	for i := SpringIndex; i <= MaxFlowerIndex; i++ {
+		if stats[i] > 0 {
+			return false
+		}
+	}
+
+	if isQiDui(&stats) || isShiSanYao(&stats) {
 		return true
 	}
 
@@ -38,8 +38,9 @@ var descriptions = [...]string{
 	HaoHuaLongQiDui: "豪华龙七对",
 }
 
-// 返回番数
-func Multiple(ctx *Context, onHand, pongKong Indexes) int {
+// 返回番数, pongKong只包含碰杠的刻子, 吃牌的顺子单独放在chows中,
+// 顺子只参与花色(清一色/中张)和门清的判断, 不参与刻子/对子/根的统计
+func Multiple(ctx *Context, onHand, pongKong, chows Indexes) int {
 	if len(onHand)%3 != 2 {
 		panic("error tile count")
 	}
@@ -50,11 +51,12 @@ func Multiple(ctx *Context, onHand, pongKong Indexes) int {
 	opts := ctx.Opts
 
 	ms := NewStats(onHand, pongKong)
+	all := NewStats(onHand, pongKong, chows)
 	// 番数
 	multiple := 0
 
 	// 检测清一色
-	isQYS := isQingYiSe(ms)
+	isQYS := isQingYiSe(all)
 	if isQYS {
 		point := points[QYS]
 		multiple += point
@@ -68,13 +70,13 @@ func Multiple(ctx *Context, onHand, pongKong Indexes) int {
 
 	if opts.Menqing {
 		// 中张
-		if isZhongzhang(ms) {
+		if isZhongzhang(all) {
 			println("===>", "中张", "+1")
 			ctx.Desc = append(ctx.Desc, "中张")
 			multiple++
 		}
 		// 门清
-		if len(pongKong) == 0 {
+		if len(pongKong) == 0 && len(chows) == 0 {
 			println("===>", "门清", "+1")
 			ctx.Desc = append(ctx.Desc, "门清")
 			multiple++
@@ -150,7 +152,7 @@ func Multiple(ctx *Context, onHand, pongKong Indexes) int {
 			ctx.Desc = append(ctx.Desc, "夹心五")
 		}
 
-		if opts.Yaojiu && isYJ(onHand, pongKong) {
+		if opts.Yaojiu && isYJ(onHand, pongKong) && isYJChows(chows) {
 			println("===>", "幺九", "+3")
 			multiple += 3
 			ctx.Desc = append(ctx.Desc, "全幺九")
@@ -167,7 +169,7 @@ func Multiple(ctx *Context, onHand, pongKong Indexes) int {
 }
 
 // 返回听牌最大番数
-func MaxMultiple(opts *protocol.DeskOptions, onHand, pongKong Indexes) (multiple int, index int) {
+func MaxMultiple(opts *protocol.DeskOptions, onHand, pongKong, chows Indexes) (multiple int, index int) {
 	tings := TingTiles(onHand)
 	index = IllegalIndex
 	multiple = -1
@@ -178,7 +180,7 @@ func MaxMultiple(opts *protocol.DeskOptions, onHand, pongKong Indexes) (multiple
 
 		ctx := &Context{NewOtherDiscardID: idx, Opts: opts}
 
-		if m := Multiple(ctx, handTiles, pongKong); m > multiple {
+		if m := Multiple(ctx, handTiles, pongKong, chows); m > multiple {
 			index = idx
 			multiple = m
 		}
@@ -186,3 +188,13 @@ func MaxMultiple(opts *protocol.DeskOptions, onHand, pongKong Indexes) (multiple
 
 	return
 }
+
+// 吃牌的顺子是否都带幺九, chows按顺子排好序, 每3张为一组
+func isYJChows(chows Indexes) bool {
+	for i := 0; i+2 < len(chows); i += 3 {
+		if chows[i]%10 != 1 && chows[i+2]%10 != 9 {
+			return false
+		}
+	}
+	return true
+}
@@ -10,7 +10,7 @@ func _TestBase_CanWinBySelfDrawing(t *testing.T) {
 	t.SkipNow()
 	tables := []int{4, 6, 15, 15, 7, 4, 7, 6, 17, 17, 18, 18, 16, 16}
 
-	if CanZimo(tables) != true {
+	if CheckWin(tables) != true {
 		t.FailNow()
 	}
 }
@@ -88,7 +88,7 @@ func TestIsTing(t *testing.T) {
 
 	//2条 4条 2筒 9条 5筒 1条 1筒 5筒 9条 6条 3筒 5条 3条
 	onHand := Indexes{2, 4, 12, 9, 15, 1, 11, 15, 9, 6, 13, 5, 3, 9}
-	Multiple(ctx, onHand, Indexes{})
+	Multiple(ctx, onHand, Indexes{}, Indexes{})
 }
 
 func TestBase_IsYJ(t *testing.T) {
@@ -144,3 +144,27 @@ func TestBase_IsYJ(t *testing.T) {
 		}
 	}
 }
+
+func TestMultipleChows(t *testing.T) {
+	tests := []struct {
+		desc                   string
+		opts                   protocol.DeskOptions
+		onHand, pongKong, chow Indexes
+		multiple               int
+	}{
+		{"顺子不算碰碰胡", protocol.DeskOptions{}, Indexes{4, 4, 5, 5, 6, 6, 8, 8}, Indexes{}, Indexes{4, 5, 6}, 2},
+		{"顺子不算根", protocol.DeskOptions{}, Indexes{4, 4, 4, 17, 18, 19, 22, 22}, Indexes{}, Indexes{4, 5, 6}, 0},
+		{"碰牌算碰碰胡", protocol.DeskOptions{}, Indexes{4, 4, 4, 5, 5, 5, 7, 7, 7, 8, 8}, Indexes{6, 6, 6}, Indexes{}, 3},
+		{"顺子没有幺九", protocol.DeskOptions{Yaojiu: true}, Indexes{1, 2, 3, 7, 8, 9, 11, 11}, Indexes{}, Indexes{4, 5, 6}, 0},
+		{"顺子带幺九", protocol.DeskOptions{Yaojiu: true}, Indexes{1, 2, 3, 7, 8, 9, 11, 11}, Indexes{}, Indexes{7, 8, 9}, 3},
+		{"吃牌不算门清", protocol.DeskOptions{Menqing: true}, Indexes{12, 13, 14, 25, 25, 25, 27, 27}, Indexes{}, Indexes{2, 3, 4}, 1},
+	}
+
+	for _, c := range tests {
+		opts := c.opts
+		ctx := &Context{Opts: &opts}
+		if m := Multiple(ctx, c.onHand, c.pongKong, c.chow); m != c.multiple {
+			t.Fatalf("%s: expect %d, got %d, desc=%v", c.desc, c.multiple, m, ctx.Desc)
+		}
+	}
+}
@@ -19,7 +19,9 @@ func isQingYiSe(ms *Stats) bool {
 			continue
 		}
 
-		if i > 20 {
+		if i > MaxSuitIndex {
+			flag |= 1 << 3
+		} else if i > 20 {
 			flag |= 1 << 2
 		} else if i > 10 {
 			flag |= 1 << 1
@@ -32,6 +34,32 @@ func isQingYiSe(ms *Stats) bool {
 	return flag == 4 || flag == 2 || flag == 1
 }
 
+// 十三幺: 条筒万的幺九牌和七种字牌各一张, 其中一张成对
+func isShiSanYao(ms *Stats) bool {
+	pair := false
+	for _, index := range shiSanYaoIndexes {
+		switch ms[index] {
+		case 1:
+		case 2:
+			if pair {
+				return false
+			}
+			pair = true
+		default:
+			return false
+		}
+	}
+
+	// 不能有其他牌
+	count := 0
+	for _, v := range ms {
+		count += int(v)
+	}
+	return pair && count == len(shiSanYaoIndexes)+1
+}
+
+var shiSanYaoIndexes = []int{1, 9, 11, 19, 21, 29, 31, 32, 33, 34, 35, 36, 37}
+
 //7对, 返回是否是七对, 以及包含杠的个数
 func isQiDui(ms *Stats) bool {
 	pairCount := 0
@@ -84,6 +112,10 @@ func is258(ms *Stats) bool {
 			continue
 		}
 
+		if index > MaxSuitIndex {
+			return false
+		}
+
 		switch mod := index % 10; mod {
 		case 2, 5, 8:
 			continue
@@ -101,6 +133,11 @@ func isZhongzhang(ms *Stats) bool {
 			continue
 		}
 
+		// 字牌不是中张
+		if index > MaxSuitIndex {
+			return false
+		}
+
 		if mod := index % 10; mod == 1 || mod == 9 {
 			return false
 		}
@@ -272,7 +309,7 @@ func CanHu(onHand Indexes, discard int) bool {
 func IsTing(onHand Indexes) bool {
 	clone := make(Indexes, len(onHand)+1)
 	for i := 0; i <= MaxTileIndex; i++ {
-		if i%10 == 0 {
+		if !IsValidIndex(i) {
 			continue
 		}
 		copy(clone, onHand)
@@ -289,7 +326,7 @@ func TingTiles(onHand Indexes) Indexes {
 	clone := make(Indexes, len(onHand)+1)
 	rts := make(Indexes, 0)
 	for i := 0; i <= MaxTileIndex; i++ {
-		if i%10 == 0 {
+		if !IsValidIndex(i) {
 			continue
 		}
 		copy(clone, onHand)
@@ -160,3 +160,15 @@ func (indexes Indexes) Reset() {
 		indexes[i] &^= 0x80
 	}
 }
+
+// 分离花牌, 花牌不参与胡牌判定
+func (indexes Indexes) SplitFlowers() (tiles Indexes, flowers Indexes) {
+	for _, index := range indexes {
+		if IsFlowerIndex(index) {
+			flowers = append(flowers, index)
+		} else {
+			tiles = append(tiles, index)
+		}
+	}
+	return tiles, flowers
+}
@@ -4,14 +4,22 @@ import (
 	"math/rand"
 	"sort"
 	"strings"
-	"time"
 )
 
 //每种花色(条,筒)最多9种牌型,但牌是没有0点的共计 9+9
 // 1-9: 条
 // 11-19: 筒
 // 21-29: 万
-const MaxTileIndex = 29
+// 31-37: 东南西北中发白
+// 41-48: 春夏秋冬梅兰竹菊, 花牌不能组成手牌
+const (
+	MaxSuitIndex   = 29 // 序数牌的最大索引
+	EastIndex      = 31 // 东风
+	RedIndex       = 35 // 红中
+	MaxTileIndex   = 37 // 手牌的最大索引
+	SpringIndex    = 41 // 春
+	MaxFlowerIndex = 48 // 花牌的最大索引
+)
 
 type Mahjong []*Tile
 
@@ -35,12 +43,9 @@ func (m Mahjong) String() string {
 	return strings.Join(res, " ")
 }
 
-func (m Mahjong) Shuffle() {
-	s := rand.New(rand.NewSource(time.Now().Unix()))
-	for i := range m {
-		j := s.Intn(len(m))
-		m[i], m[j] = m[j], m[i]
-	}
+// 使用指定的随机数生成器洗牌, 相同的种子得到相同的牌序
+func (m Mahjong) Shuffle(r *rand.Rand) {
+	r.Shuffle(len(m), m.Swap)
 }
 
 func (m Mahjong) Sort() {
@@ -88,7 +93,3 @@ func FromID(ids []int) Mahjong {
 	}
 	return mj
 }
-
-func init() {
-	rand.Seed(time.Now().Unix())
-}
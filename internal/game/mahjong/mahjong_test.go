@@ -1,17 +1,109 @@
 package mahjong
 
 import (
+	"math/rand"
 	"testing"
 )
 
 func TestNew(t *testing.T) {
 	for i := 0; i < 72; i++ {
 		mj := TileFromID(i)
-		if Suit > 1 {
+		if mj.Suit > 1 {
 			t.Fail()
 		}
-		if Rank > 9 {
+		if mj.Rank > 9 {
 			t.Fail()
 		}
 	}
 }
+
+func TestNewWithSeed(t *testing.T) {
+	a := New(108, rand.New(rand.NewSource(20181001)))
+	b := New(108, rand.New(rand.NewSource(20181001)))
+	c := New(108, rand.New(rand.NewSource(20181002)))
+
+	same := func(x, y Tiles) bool {
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	if !same(a, b) {
+		t.Fatalf("same seed, different tiles: %v %v", a, b)
+	}
+	if same(a, c) {
+		t.Fatalf("different seed, same tiles: %v", a)
+	}
+
+	// 洗牌后牌的数量不变
+	stats := map[int]int{}
+	for _, id := range a {
+		stats[id]++
+	}
+	if len(stats) != 108 {
+		t.Fatalf("expect 108 tiles, got %d", len(stats))
+	}
+}
+
+func TestHonorAndFlowerTiles(t *testing.T) {
+	stats := map[int]int{}
+	for _, id := range New(144, rand.New(rand.NewSource(1))) {
+		tile := TileFromID(id)
+		if !IsValidIndex(tile.Index) || IndexFromID(id) != tile.Index {
+			t.Fatalf("illegal tile: id=%d tile=%+v", id, tile)
+		}
+		stats[tile.Index]++
+	}
+
+	if len(stats) != 27+7+8 {
+		t.Fatalf("expect 42 kinds of tiles, got %d", len(stats))
+	}
+	for index, count := range stats {
+		expect := 4
+		if IsFlowerIndex(index) {
+			expect = 1
+		}
+		if count != expect {
+			t.Fatalf("%s: expect %d, got %d", TileFromIndex(index), expect, count)
+		}
+	}
+
+	if s := TileFromID(108).String(); s != "东" {
+		t.Fatalf("expect 东, got %s", s)
+	}
+	if s := TileFromID(143).String(); s != "菊" {
+		t.Fatalf("expect 菊, got %s", s)
+	}
+}
+
+func TestCheckWinWithHonors(t *testing.T) {
+	cases := []struct {
+		indexes Indexes
+		win     bool
+	}{
+		// 字牌刻子
+		{Indexes{1, 2, 3, 11, 12, 13, 31, 31, 31, 35, 35, 35, 37, 37}, true},
+		// 字牌不能组成顺子
+		{Indexes{1, 2, 3, 11, 12, 13, 21, 22, 23, 31, 32, 33, 37, 37}, false},
+		// 十三幺
+		{Indexes{1, 9, 11, 19, 21, 29, 31, 32, 33, 34, 35, 36, 37, 37}, true},
+		{Indexes{1, 9, 11, 19, 21, 29, 31, 32, 33, 34, 35, 36, 36, 37}, true},
+		{Indexes{1, 9, 11, 19, 21, 28, 31, 32, 33, 34, 35, 36, 37, 37}, false},
+		// 花牌不能胡
+		{Indexes{1, 2, 3, 11, 12, 13, 21, 22, 23, 31, 31, 31, 41, 41}, false},
+	}
+
+	for i, c := range cases {
+		if win := CheckWin(c.indexes); win != c.win {
+			t.Fatalf("case %d: expect %t, got %t", i, c.win, win)
+		}
+	}
+
+	ting := TingTiles(Indexes{1, 9, 11, 19, 21, 29, 31, 32, 33, 34, 35, 36, 37})
+	if len(ting) != 13 {
+		t.Fatalf("expect 13 tiles, got %v", ting)
+	}
+}
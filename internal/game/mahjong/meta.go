@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"fmt"
 	"math/rand"
-	"time"
 
 	"github.com/lonng/nanoserver/protocol"
 )
@@ -16,26 +15,26 @@ const (
 
 type Tiles []int //麻将内部表示(即72张牌的id号列表)
 
-func (m Tiles) Shuffle() {
-	s := rand.New(rand.NewSource(time.Now().Unix()))
-	for i := range m {
-		j := s.Intn(len(m))
+// 使用指定的随机数生成器洗牌, 相同的种子得到相同的牌序
+func (m Tiles) Shuffle(r *rand.Rand) {
+	r.Shuffle(len(m), func(i, j int) {
 		m[i], m[j] = m[j], m[i]
-	}
+	})
 }
 
-func New(count int) Tiles {
+// 创建并洗好一副麻将, count为72(条筒), 108(条筒万), 136(加字牌)或144(加花牌)
+func New(count int, r *rand.Rand) Tiles {
 	tiles := make(Tiles, count)
 
 	for i := range tiles {
 		tiles[i] = i
 	}
 
-	tiles.Shuffle()
+	tiles.Shuffle(r)
 	return tiles
 }
 
-type Stats [MaxTileIndex + 1]byte
+type Stats [MaxFlowerIndex + 1]byte
 
 func (ms *Stats) String() string {
 	buf := &bytes.Buffer{}
@@ -62,7 +61,7 @@ func (ms *Stats) From(mjs ...Mahjong) {
 func (ms *Stats) FromIndex(tiles ...Indexes) {
 	for _, tile := range tiles {
 		for _, idx := range tile {
-			if idx >= 0 && idx <= MaxTileIndex {
+			if IsValidIndex(idx) {
 				ms[idx] = ms[idx] + 1
 			}
 		}
@@ -70,7 +69,7 @@ func (ms *Stats) FromIndex(tiles ...Indexes) {
 }
 
 func (ms *Stats) CountWithIndex(idx int) int {
-	if idx < 0 || idx%10 == 0 || idx > MaxTileIndex {
+	if !IsValidIndex(idx) {
 		return IllegalIndex
 	}
 	fmt.Println("CountWithIndex", idx, ms)
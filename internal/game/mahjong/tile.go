@@ -4,25 +4,87 @@ import (
 	"fmt"
 )
 
-var tileNames = []string{"条", "筒", "万"}
+// 花色
+const (
+	SuitTiao   = iota // 条
+	SuitTong          // 筒
+	SuitWan           // 万
+	SuitHonor         // 字牌(东南西北中发白)
+	SuitFlower        // 花牌(春夏秋冬梅兰竹菊)
+)
+
+// 牌的id范围: 0~107为条筒万, 108~135为字牌, 136~143为花牌
+const (
+	suitTileCount   = 108
+	honorTileCount  = 28
+	flowerTileCount = 8
+
+	honorBaseID  = suitTileCount
+	flowerBaseID = honorBaseID + honorTileCount
+	MaxTileID    = flowerBaseID + flowerTileCount - 1
+)
+
+var (
+	tileNames   = []string{"条", "筒", "万"}
+	honorNames  = []string{"东", "南", "西", "北", "中", "发", "白"}
+	flowerNames = []string{"春", "夏", "秋", "冬", "梅", "兰", "竹", "菊"}
+)
 
 type Tile struct {
 	Id    int
 	Suit  int //花色
-	Rank  int //点数
-	Index int //索引(1~9, 11~19)
+	Rank  int //点数, 字牌和花牌为序号(从1开始)
+	Index int //索引(1~9, 11~19, 21~29, 31~37, 41~48)
 }
 
 func (t *Tile) String() string {
-	return fmt.Sprintf("%d%s", t.Rank, tileNames[t.Suit])
+	switch t.Suit {
+	case SuitHonor:
+		return honorNames[t.Rank-1]
+	case SuitFlower:
+		return flowerNames[t.Rank-1]
+	default:
+		return fmt.Sprintf("%d%s", t.Rank, tileNames[t.Suit])
+	}
 }
 
 func (t *Tile) Equals(other *Tile) bool {
 	return t.Index == other.Index
 }
 
+// 是否是字牌
+func (t *Tile) IsHonor() bool {
+	return t.Suit == SuitHonor
+}
+
+// 是否是花牌
+func (t *Tile) IsFlower() bool {
+	return t.Suit == SuitFlower
+}
+
+// 是否是合法的牌索引
+func IsValidIndex(idx int) bool {
+	switch {
+	case idx <= 0:
+		return false
+	case idx <= MaxSuitIndex:
+		return idx%10 != 0
+	case IsHonorIndex(idx), IsFlowerIndex(idx):
+		return true
+	}
+	return false
+}
+
+func IsHonorIndex(idx int) bool {
+	return idx >= EastIndex && idx <= MaxTileIndex
+}
+
+func IsFlowerIndex(idx int) bool {
+	return idx >= SpringIndex && idx <= MaxFlowerIndex
+}
+
 func TileFromIndex(idx int) *Tile {
-	if idx < 0 || idx > MaxTileIndex || idx%10 == 0 {
+	if !IsValidIndex(idx) {
 		return nil
 	}
 
@@ -34,32 +96,31 @@ func TileFromIndex(idx int) *Tile {
 }
 
 func IndexFromID(id int) int {
-	if id < 0 {
+	if id < 0 || id > MaxTileID {
 		panic(fmt.Errorf("ilegal tile id: %d", id))
 	}
-	var (
-		tmp = id / 4
-		h   = tmp / 9
-		v   = tmp%9 + 1
-		i   = h*10 + v
-	)
-
-	return i
+	return TileFromID(id).Index
 }
 
 //id: 0~3 -> 1条  4~7 -> 2条 ...
-//0~35 =>条 36~71 =>筒
+//0~35 =>条 36~71 =>筒 72~107 =>万
+//108~135 =>东南西北中发白各4张 136~143 =>春夏秋冬梅兰竹菊各1张
 func TileFromID(id int) *Tile {
-	if id < 0 {
+	if id < 0 || id > MaxTileID {
 		panic("illegal tile id")
 	}
 
-	var (
-		tmp = id / 4
-		h   = tmp / 9
-		v   = tmp%9 + 1
-		i   = h*10 + v
-	)
+	var h, v int
+	if id < flowerBaseID {
+		tmp := id / 4
+		h = tmp / 9
+		v = tmp%9 + 1
+		if id >= honorBaseID {
+			h, v = SuitHonor, (id-honorBaseID)/4+1
+		}
+	} else {
+		h, v = SuitFlower, id-flowerBaseID+1
+	}
 
-	return &Tile{Suit: h, Rank: v, Index: i, Id: id}
+	return &Tile{Suit: h, Rank: v, Index: h*10 + v, Id: id}
 }
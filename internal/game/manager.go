@@ -2,6 +2,10 @@ package game
 
 import (
 	"github.com/lonng/nano/scheduler"
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/pkg/async"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/pkg/token"
 	"github.com/lonng/nanoserver/protocol"
 
 	"time"
@@ -74,8 +78,12 @@ func (m *Manager) AfterInit() {
 
 			case ri := <-m.chRecharge:
 				player, ok := m.player(ri.Uid)
+				if !ok {
+					break
+				}
+				player.coin = ri.Coin
 				// 如果玩家在线
-				if s := player.session; ok && s != nil {
+				if s := player.session; s != nil {
 					s.Push("onCoinChange", &protocol.CoinChangeInformation{Coin: ri.Coin})
 				}
 
@@ -86,14 +94,69 @@ func (m *Manager) AfterInit() {
 	})
 }
 
+// 玩家资料, 以数据库为准, 不信任客户端上传的数据
+type profile struct {
+	name string
+	head string
+	sex  int
+	coin int64
+
+	gold   int64
+	silver int64
+}
+
+func loadProfile(uid int64) (*profile, error) {
+	u, err := db.QueryUser(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	third, err := db.QueryThirdAccountByUid(uid)
+	if err == errutil.ErrThirdAccountNotFound {
+		// 游客
+		return &profile{name: protocol.GuestName(uid), head: protocol.GuestHeadUrl, sex: 1, coin: u.Coin, gold: u.Gold, silver: u.Silver}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &profile{name: third.ThirdName, head: third.HeadUrl, sex: third.Sex, coin: u.Coin, gold: u.Gold, silver: u.Silver}, nil
+}
+
 func (m *Manager) Login(s *session.Session, req *protocol.LoginToGameServerRequest) error {
-	uid := req.Uid
+	claims, err := token.Parse(req.Token)
+	if err == nil && req.Uid > 0 && req.Uid != claims.Uid {
+		err = errutil.ErrTokenMismatchUser
+	}
+	if err != nil {
+		log.Warnf("玩家登录失败, UID=%d, Error=%v", req.Uid, err)
+		return s.Response(&protocol.LoginToGameServerResponse{Code: errorCode, Error: err.Error()})
+	}
+
+	uid, mid := claims.Uid, s.LastMid()
+	async.Run(func() {
+		pf, err := loadProfile(uid)
+		scheduler.PushTask(func() {
+			if err != nil {
+				log.Errorf("玩家: %d登录, 查询玩家资料失败, Error=%v", uid, err)
+				s.ResponseMID(mid, &protocol.LoginToGameServerResponse{Code: errorCode, Error: err.Error()})
+				return
+			}
+			m.login(s, mid, uid, req.IP, pf)
+		})
+	})
+	return nil
+}
+
+func (m *Manager) login(s *session.Session, mid uint64, uid int64, ip string, pf *profile) {
 	s.Bind(uid)
 
-	log.Infof("玩家: %d登录: %+v", uid, req)
+	log.Infof("玩家: %d登录: %+v", uid, pf)
 	if p, ok := m.player(uid); !ok {
 		log.Infof("玩家: %d不在线，创建新的玩家", uid)
-		p = newPlayer(s, uid, req.Name, req.HeadUrl, req.IP, req.Sex)
+		p = newPlayer(s, uid, pf.name, pf.head, ip, pf.sex)
+		p.coin = pf.coin
+		p.gold, p.silver = pf.gold, pf.silver
 		m.setPlayer(uid, p)
 	} else {
 		log.Infof("玩家: %d已经在线", uid)
@@ -113,6 +176,9 @@ func (m *Manager) Login(s *session.Session, req *protocol.LoginToGameServerReque
 
 		// 绑定新session
 		p.bindSession(s)
+		p.name, p.head, p.sex = pf.name, pf.head, pf.sex
+		p.coin = pf.coin
+		p.gold, p.silver = pf.gold, pf.silver
 	}
 
 	// 添加到广播频道
@@ -120,13 +186,15 @@ func (m *Manager) Login(s *session.Session, req *protocol.LoginToGameServerReque
 
 	res := &protocol.LoginToGameServerResponse{
 		Uid:      s.UID(),
-		Nickname: req.Name,
-		Sex:      req.Sex,
-		HeadUrl:  req.HeadUrl,
-		FangKa:   req.FangKa,
+		Nickname: pf.name,
+		Sex:      pf.sex,
+		HeadUrl:  pf.head,
+		FangKa:   int(pf.coin),
+		Gold:     pf.gold,
+		Silver:   pf.silver,
 	}
 
-	return s.Response(res)
+	s.ResponseMID(mid, res)
 }
 
 func (m *Manager) player(uid int64) (*Player, bool) {
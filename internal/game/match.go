@@ -0,0 +1,388 @@
+package game
+
+import (
+	"time"
+
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/scheduler"
+	"github.com/lonng/nano/session"
+	"github.com/lonng/nanoserver/pkg/room"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+const (
+	defaultMatchTimeout = 15 // 默认排队超时时间(秒)
+	matchOperationTime  = 15 // 公共房间的操作时间(秒)
+)
+
+var (
+	matchTimeout = defaultMatchTimeout // 排队超时后使用机器人补位, 不允许补位时取消匹配
+	matchRobot   = true                // 排队超时后是否使用机器人补位
+)
+
+var (
+	matchInvalid       = &protocol.MatchResponse{Code: errorCode, Error: "匹配参数错误"}
+	matchInDesk        = &protocol.MatchResponse{Code: errorCode, Error: "你当前正在房间中, 不能匹配"}
+	matchVersionExpire = &protocol.MatchResponse{Code: 30001, Error: versionExpireMessage}
+	matchDraining      = &protocol.MatchResponse{Code: 30004, Error: drainingMessage}
+	matchCoinNotEnough = &protocol.MatchResponse{Code: errorCode, Error: "余额不足, 请选择其他场次"}
+	matchTimeoutCancel = &protocol.MatchCanceled{Reason: "当前匹配人数不足, 请稍后再试"}
+	matchDrainCancel   = &protocol.MatchCanceled{Reason: drainingMessage}
+)
+
+// 匹配分组, 类型/人数/等级/货币类型都相同的玩家才会匹配到一起
+type matchKey struct {
+	Type     int `json:"type"`
+	Mode     int `json:"mode"`
+	Level    int `json:"level"`
+	CoinType int `json:"coinType"` // 只有经典场使用
+}
+
+func (k matchKey) valid() bool {
+	if k.Mode != ModeTrios && k.Mode != ModeFours {
+		return false
+	}
+
+	switch k.Type {
+	case protocol.MatchTypeClassic:
+		return k.Level >= protocol.ClassicLevelJunior && k.Level <= protocol.ClassicLevelMaster && validCoinType(k.CoinType)
+	case protocol.MatchTypeDaily:
+		return k.Level >= protocol.DailyMatchLevelJunior && k.Level <= protocol.DailyMatchLevelMaster && k.CoinType == 0
+	}
+	return false
+}
+
+func (k matchKey) roomType() int {
+	if k.Type == protocol.MatchTypeDaily {
+		return protocol.RoomTypeDailyMatch
+	}
+	return protocol.RoomTypeClassic
+}
+
+// 公共房间的牌桌选项: 经典场最多8局, 每局结算金币/银币, 每日匹配打满4局, 等级越高机器人越强
+func (k matchKey) deskOptions() *protocol.DeskOptions {
+	opts := &protocol.DeskOptions{
+		Mode:       k.Mode,
+		MaxRound:   8,
+		MaxFan:     3,
+		Zimo:       "fan",
+		Ruleset:    protocol.RulesetXueZhan,
+		Pinghu:     k.Mode == ModeFours,
+		Timeout:    matchOperationTime,
+		Robot:      true,
+		RobotLevel: k.Level + 1,
+	}
+	if k.Type == protocol.MatchTypeDaily {
+		opts.MaxRound = 4
+	}
+	if opts.RobotLevel > protocol.RobotLevelHard {
+		opts.RobotLevel = protocol.RobotLevelHard
+	}
+	return opts
+}
+
+type matchEntry struct {
+	player   *Player
+	joinedAt time.Time
+}
+
+// 同一分组的排队玩家, 先到先得
+type matchQueue struct {
+	key     matchKey
+	entries []*matchEntry
+}
+
+func (q *matchQueue) status(i int) *protocol.MatchStatus {
+	return &protocol.MatchStatus{
+		Position: i + 1,
+		Count:    len(q.entries),
+		Wait:     int(time.Since(q.entries[i].joinedAt) / time.Second),
+	}
+}
+
+// 推送最新的排队位置
+func (q *matchQueue) notify() {
+	for i, e := range q.entries {
+		if s := e.player.session; s != nil {
+			s.Push(protocol.RouteMatchStatus, q.status(i))
+		}
+	}
+}
+
+func (q *matchQueue) remove(p *Player) bool {
+	for i, e := range q.entries {
+		if e.player == p {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// 取出队首的n个玩家
+func (q *matchQueue) pop(n int) []*Player {
+	if n > len(q.entries) {
+		n = len(q.entries)
+	}
+
+	players := make([]*Player, n)
+	for i := range players {
+		players[i] = q.entries[i].player
+		players[i].matching = nil
+	}
+	q.entries = q.entries[n:]
+	return players
+}
+
+// Matcher 公共房间自动匹配, 凑齐一桌后自动创建房间并推送onMatched
+type Matcher struct {
+	component.Base
+	queues map[matchKey]*matchQueue
+
+	// 排队超时后补齐空位, 返回补位的玩家, 返回空表示不补位, 排队的玩家会被取消匹配
+	backfill func(key matchKey, count int) []*Player
+}
+
+var defaultMatcher = NewMatcher()
+
+func NewMatcher() *Matcher {
+	return &Matcher{
+		queues:   map[matchKey]*matchQueue{},
+		backfill: robotBackfill,
+	}
+}
+
+// 默认使用机器人补位
+func robotBackfill(key matchKey, count int) []*Player {
+	if !matchRobot {
+		return nil
+	}
+
+	level := key.deskOptions().RobotLevel
+	robots := make([]*Player, count)
+	for i := range robots {
+		robots[i] = newRobot(level)
+	}
+	return robots
+}
+
+func (m *Matcher) AfterInit() {
+	// 每秒检查一次排队超时
+	scheduler.NewTimer(time.Second, m.checkTimeout)
+}
+
+func (m *Matcher) queue(key matchKey) *matchQueue {
+	q, ok := m.queues[key]
+	if !ok {
+		q = &matchQueue{key: key}
+		m.queues[key] = q
+	}
+	return q
+}
+
+// 玩家离开匹配队列
+func (m *Matcher) leave(p *Player) {
+	q := p.matching
+	if q == nil {
+		return
+	}
+
+	p.matching = nil
+	if !q.remove(p) {
+		return
+	}
+	p.logger.Infof("玩家取消匹配: %+v, 剩余排队人数=%d", q.key, len(q.entries))
+
+	if len(q.entries) == 0 {
+		delete(m.queues, q.key)
+		return
+	}
+	q.notify()
+}
+
+// 人数足够时创建房间
+func (m *Matcher) tryMatch(q *matchQueue) {
+	for len(q.entries) >= q.key.Mode {
+		m.createDesk(q.key, q.pop(q.key.Mode), nil)
+	}
+
+	if len(q.entries) == 0 {
+		delete(m.queues, q.key)
+		return
+	}
+	q.notify()
+}
+
+func (m *Matcher) checkTimeout() {
+	if len(m.queues) == 0 {
+		return
+	}
+
+	deadline := time.Now().Add(-time.Duration(matchTimeout) * time.Second)
+	for key, q := range m.queues {
+		if len(q.entries) == 0 || q.entries[0].joinedAt.After(deadline) {
+			continue
+		}
+
+		players := q.pop(key.Mode)
+		if robots := m.backfill(key, key.Mode-len(players)); len(robots) > 0 {
+			m.createDesk(key, players, robots)
+		} else {
+			for _, p := range players {
+				p.logger.Infof("玩家排队超时, 取消匹配: %+v", key)
+				if s := p.session; s != nil {
+					s.Push(protocol.RouteMatchCanceled, matchTimeoutCancel)
+				}
+			}
+		}
+
+		if len(q.entries) == 0 {
+			delete(m.queues, key)
+			continue
+		}
+		q.notify()
+	}
+}
+
+// 停服维护时取消所有匹配
+func (m *Matcher) cancelAll(reason *protocol.MatchCanceled) {
+	for key, q := range m.queues {
+		for _, p := range q.pop(len(q.entries)) {
+			if s := p.session; s != nil {
+				s.Push(protocol.RouteMatchCanceled, reason)
+			}
+		}
+		delete(m.queues, key)
+	}
+}
+
+// 使用匹配成功的玩家创建房间, 公共房间不消耗房卡
+func (m *Matcher) createDesk(key matchKey, players, robots []*Player) {
+	no := room.Next()
+	d := NewDesk(no, key.deskOptions(), -1)
+	d.match = &key
+	d.createdAt = time.Now().Unix()
+	d.creator = players[0].Uid()
+
+	for _, p := range players {
+		if err := d.playerJoin(p.session, false); err != nil {
+			d.logger.Errorf("匹配玩家加入房间失败, UID=%d, Error=%s", p.Uid(), err.Error())
+		}
+	}
+	for _, r := range robots {
+		d.addRobot(r)
+	}
+
+	defaultDeskManager.setDesk(no, d)
+	d.logger.Infof("匹配成功: %+v, 玩家数量=%d, 机器人数量=%d", key, len(players), len(robots))
+
+	matched := &protocol.Matched{
+		RoomType: key.roomType(),
+		Level:    key.Level,
+		TableInfo: protocol.TableInfo{
+			DeskNo:    d.roomNo.String(),
+			CreatedAt: d.createdAt,
+			Creator:   d.creator,
+			Title:     d.title(),
+			Desc:      d.desc(true),
+			Status:    d.status(),
+			Round:     d.round,
+			Mode:      d.opts.Mode,
+		},
+	}
+	for _, p := range players {
+		if s := p.session; s != nil {
+			s.Push(protocol.RouteMatched, matched)
+		}
+	}
+}
+
+// 公共房间开局前有玩家退出, 返回false表示房间内已经没有真实玩家
+func (d *Desk) refillMatched() bool {
+	for _, p := range d.players {
+		if p.isRobot() {
+			continue
+		}
+
+		if matchRobot {
+			d.fillRobots()
+			d.syncDeskStatus()
+			d.checkStart()
+		}
+		return true
+	}
+	return false
+}
+
+// 开始匹配, 已经在其他队列中时切换到新的队列
+func (m *Matcher) Match(s *session.Session, req *protocol.MatchRequest) error {
+	p, err := playerWithSession(s)
+	if err != nil {
+		return err
+	}
+
+	if forceUpdate && req.Version != version {
+		return s.Response(matchVersionExpire)
+	}
+	if isDraining() {
+		return s.Response(matchDraining)
+	}
+	if p.desk != nil {
+		return s.Response(matchInDesk)
+	}
+
+	key := matchKey{Type: req.Type, Mode: req.Mode, Level: req.Level}
+	if req.Type == protocol.MatchTypeClassic {
+		key.CoinType = req.CoinType
+	}
+	if !key.valid() {
+		return s.Response(matchInvalid)
+	}
+	if tier, ok := key.coinTier(); ok && p.coinBalance(key.CoinType) < tier.minimum {
+		return s.Response(matchCoinNotEnough)
+	}
+
+	if q := p.matching; q != nil && q.key != key {
+		m.leave(p)
+	}
+
+	// 匹配时不再观战
+	if p.watching != nil {
+		p.watching.removeSpectator(p)
+	}
+
+	q := m.queue(key)
+	if p.matching == nil {
+		q.entries = append(q.entries, &matchEntry{player: p, joinedAt: time.Now()})
+		p.matching = q
+		p.logger.Infof("玩家开始匹配: %+v, 排队人数=%d", key, len(q.entries))
+	}
+
+	pos := 0
+	for i, e := range q.entries {
+		if e.player == p {
+			pos = i + 1
+			break
+		}
+	}
+
+	err = s.Response(&protocol.MatchResponse{
+		Position: pos,
+		Count:    len(q.entries),
+		Timeout:  matchTimeout,
+	})
+
+	m.tryMatch(q)
+	return err
+}
+
+// 取消匹配
+func (m *Matcher) Cancel(s *session.Session, _ []byte) error {
+	p, err := playerWithSession(s)
+	if err != nil {
+		return err
+	}
+
+	m.leave(p)
+	return s.Response(protocol.SuccessResponse)
+}
@@ -0,0 +1,394 @@
+package game
+
+import (
+	"encoding/json"
+	"math/rand"
+	"time"
+
+	"github.com/lonng/nano/scheduler"
+	"github.com/lonng/nanoserver/internal/game/history"
+	"github.com/lonng/nanoserver/internal/game/mahjong"
+	"github.com/lonng/nanoserver/pkg/constant"
+	"github.com/lonng/nanoserver/pkg/room"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+// 牌局恢复后继续执行的位置
+const (
+	resumeNone   = iota // 不在打牌过程中
+	resumeMoPai         // 当前玩家摸牌, 首轮庄家不摸牌
+	resumeChuPai        // 当前玩家出牌
+	resumeChiPai        // 当前玩家已经出牌, 等待其他玩家碰/杠/吃/胡
+)
+
+type playerState struct {
+	Uid      int64            `json:"uid"`
+	Head     string           `json:"head"`
+	Name     string           `json:"name"`
+	IP       string           `json:"ip"`
+	Sex      int              `json:"sex"`
+	Coin     int64            `json:"coin"`
+	Gold     int64            `json:"gold"`
+	Silver   int64            `json:"silver"`
+	Score    int              `json:"score"`
+	Robot    int              `json:"robot"` // 机器人难度, 0表示真实玩家
+	Trustee  bool             `json:"trustee"`
+	OnHand   []int            `json:"onHand"`
+	PongKong []int            `json:"pongKong"`
+	Chows    []int            `json:"chows"`
+	Chupai   []int            `json:"chupai"`
+	Ctx      *mahjong.Context `json:"ctx"`
+}
+
+type scoreChangeState struct {
+	Uid    int64           `json:"uid"`
+	Score  int             `json:"score"`
+	TileID int             `json:"tileId"`
+	Typ    ScoreChangeType `json:"typ"`
+}
+
+type dissolveState struct {
+	Status   map[int64]bool   `json:"status"`
+	Desc     map[int64]string `json:"desc"`
+	RestTime int32            `json:"restTime"`
+}
+
+// 牌桌的持久化数据
+type deskState struct {
+	RoomNo    room.Number           `json:"roomNo"`
+	DeskID    int64                 `json:"deskId"`
+	ClubId    int64                 `json:"clubId"`
+	Template  int64                 `json:"template"`
+	Match     *matchKey             `json:"match"`
+	Opts      *protocol.DeskOptions `json:"opts"`
+	State     constant.DeskStatus   `json:"state"`
+	Round     uint32                `json:"round"`
+	Creator   int64                 `json:"creator"`
+	CreatedAt int64                 `json:"createdAt"`
+	Players   []*playerState        `json:"players"`
+
+	AllTiles      []int       `json:"allTiles"`
+	BankerTurn    int         `json:"bankerTurn"`
+	CurTurn       int         `json:"curTurn"`
+	NextTileIndex int         `json:"nextTileIndex"`
+	IsNewRound    bool        `json:"isNewRound"`
+	IsFirstRound  bool        `json:"isFirstRound"`
+	KnownTiles    map[int]int `json:"knownTiles"`
+
+	ScoreChanges map[int64][]*scoreChangeState `json:"scoreChanges"`
+	Snapshot     *history.History              `json:"snapshot"`
+	RoundStats   history.RoundStats            `json:"roundStats"`
+	MatchStats   history.MatchStats            `json:"matchStats"`
+
+	WonPlayers map[int64]bool `json:"wonPlayers"`
+	PaoPlayer  int64          `json:"paoPlayer"`
+	IsMakerSet bool           `json:"isMakerSet"`
+
+	Dissolve *dissolveState `json:"dissolve"` // 正在申请解散时不为空
+	Dice1    int            `json:"dice1"`
+	Dice2    int            `json:"dice2"`
+	Seed     int64          `json:"seed"`
+
+	LastTileId    int   `json:"lastTileId"`
+	LastChuPaiUid int64 `json:"lastChuPaiUid"`
+	LastHintUid   int64 `json:"lastHintUid"`
+
+	Resume int `json:"resume"`
+}
+
+func (p *Player) dump() *playerState {
+	ps := &playerState{
+		Uid:      p.uid,
+		Head:     p.head,
+		Name:     p.name,
+		IP:       p.ip,
+		Sex:      p.sex,
+		Coin:     p.coin,
+		Gold:     p.gold,
+		Silver:   p.silver,
+		Score:    p.score,
+		Trustee:  p.isTrustee(),
+		OnHand:   p.onHand.Ids(),
+		PongKong: p.pongKong.Ids(),
+		Chows:    p.chows.Ids(),
+		Chupai:   p.chupai.Ids(),
+		Ctx:      p.ctx,
+	}
+	if p.isRobot() {
+		ps.Robot = p.robot.level
+	}
+	return ps
+}
+
+func restorePlayer(ps *playerState) *Player {
+	p := &Player{
+		uid:      ps.Uid,
+		head:     ps.Head,
+		name:     ps.Name,
+		ip:       ps.IP,
+		sex:      ps.Sex,
+		coin:     ps.Coin,
+		gold:     ps.Gold,
+		silver:   ps.Silver,
+		score:    ps.Score,
+		onHand:   mahjong.FromID(ps.OnHand),
+		pongKong: mahjong.FromID(ps.PongKong),
+		chows:    mahjong.FromID(ps.Chows),
+		chupai:   mahjong.FromID(ps.Chupai),
+		ctx:      ps.Ctx,
+
+		chOperation: make(chan *protocol.OpChoosed, 1),
+	}
+
+	if ps.Trustee {
+		p.trustee = 1
+	}
+
+	if p.ctx == nil {
+		p.ctx = &mahjong.Context{Uid: p.uid}
+		p.ctx.Reset()
+	}
+
+	if ps.Robot > 0 {
+		p.robot = &robot{level: ps.Robot}
+		// 新的机器人UID不能与恢复的机器人冲突
+		if p.uid < robotUid {
+			robotUid = p.uid
+		}
+	}
+
+	return p
+}
+
+func (d *Desk) dump(resume int) *deskState {
+	state := &deskState{
+		RoomNo:        d.roomNo,
+		DeskID:        d.deskID,
+		ClubId:        d.clubId,
+		Template:      d.template,
+		Match:         d.match,
+		Opts:          d.opts,
+		State:         d.status(),
+		Round:         d.round,
+		Creator:       d.creator,
+		CreatedAt:     d.createdAt,
+		AllTiles:      d.allTiles.Ids(),
+		BankerTurn:    d.bankerTurn,
+		CurTurn:       d.curTurn,
+		NextTileIndex: d.nextTileIndex,
+		IsNewRound:    d.isNewRound,
+		IsFirstRound:  d.isFirstRound,
+		KnownTiles:    d.knownTiles,
+		ScoreChanges:  map[int64][]*scoreChangeState{},
+		Snapshot:      d.snapshot,
+		RoundStats:    d.roundStats,
+		MatchStats:    d.matchStats,
+		WonPlayers:    d.wonPlayers,
+		PaoPlayer:     d.paoPlayer,
+		IsMakerSet:    d.isMakerSet,
+		Dice1:         d.dice.dice1,
+		Dice2:         d.dice.dice2,
+		Seed:          d.seed,
+		LastTileId:    d.lastTileId,
+		LastChuPaiUid: d.lastChuPaiUid,
+		LastHintUid:   d.lastHintUid,
+		Resume:        resume,
+	}
+
+	for _, p := range d.players {
+		state.Players = append(state.Players, p.dump())
+	}
+
+	for uid, changes := range d.scoreChanges {
+		for _, c := range changes {
+			state.ScoreChanges[uid] = append(state.ScoreChanges[uid], &scoreChangeState{
+				Uid:    c.uid,
+				Score:  c.score,
+				TileID: c.tileID,
+				Typ:    c.typ,
+			})
+		}
+	}
+
+	if d.dissolve.isDissolving() {
+		state.Dissolve = &dissolveState{
+			Status:   d.dissolve.status,
+			Desc:     d.dissolve.desc,
+			RestTime: d.dissolve.restTime,
+		}
+	}
+
+	return state
+}
+
+// 在打牌goroutine中保存牌桌状态, 每局结束以及打牌过程中每次等待玩家操作前调用,
+// 逻辑线程中的消息处理也会修改牌桌数据, 序列化在逻辑线程中执行, 完成之前打牌goroutine等待
+func (d *Desk) persist(resume int) {
+	if !d.persistent() {
+		return
+	}
+
+	done := make(chan struct{})
+	scheduler.PushTask(func() {
+		defer close(done)
+		d.persistNow(resume)
+	})
+
+	select {
+	case <-done:
+	case <-d.die:
+	}
+}
+
+// 比赛房间不保存, 重启后比赛取消
+func (d *Desk) persistent() bool {
+	return defaultDeskManager.store != nil && !d.isDestroy() && d.tournament == nil
+}
+
+// 在逻辑线程中保存牌桌状态, 文件写入异步执行
+func (d *Desk) persistNow(resume int) {
+	store := defaultDeskManager.store
+	if !d.persistent() {
+		return
+	}
+
+	data, err := json.Marshal(d.dump(resume))
+	if err != nil {
+		d.logger.Errorf("序列化房间数据失败, Error=%v", err)
+		return
+	}
+
+	store.save(d.roomNo, data)
+}
+
+func restoreDesk(state *deskState) *Desk {
+	d := NewDesk(state.RoomNo, state.Opts, state.ClubId)
+	d.deskID = state.DeskID
+	d.match = state.Match
+	d.template = state.Template
+	d.round = state.Round
+	d.creator = state.Creator
+	d.createdAt = state.CreatedAt
+	d.setStatus(state.State)
+
+	d.allTiles = mahjong.FromID(state.AllTiles)
+	d.bankerTurn = state.BankerTurn
+	d.curTurn = state.CurTurn
+	d.nextTileIndex = state.NextTileIndex
+	d.isNewRound = state.IsNewRound
+	d.isFirstRound = state.IsFirstRound
+	d.snapshot = state.Snapshot
+	d.paoPlayer = state.PaoPlayer
+	d.isMakerSet = state.IsMakerSet
+	d.dice.dice1, d.dice.dice2 = state.Dice1, state.Dice2
+	d.lastTileId = state.LastTileId
+	d.lastChuPaiUid = state.LastChuPaiUid
+	d.lastHintUid = state.LastHintUid
+
+	// 恢复的牌局无法还原随机数生成器的状态, 只能使用本局种子重新生成
+	d.seed = state.Seed
+	d.rng = rand.New(rand.NewSource(d.seed))
+
+	if state.KnownTiles != nil {
+		d.knownTiles = state.KnownTiles
+	}
+	if state.RoundStats != nil {
+		d.roundStats = state.RoundStats
+	}
+	if state.MatchStats != nil {
+		d.matchStats = state.MatchStats
+	}
+	if state.WonPlayers != nil {
+		d.wonPlayers = state.WonPlayers
+	}
+
+	for uid, changes := range state.ScoreChanges {
+		for _, c := range changes {
+			d.scoreChangeForUid(uid, &scoreChangeInfo{
+				uid:    c.Uid,
+				score:  c.Score,
+				tileID: c.TileID,
+				typ:    c.Typ,
+			})
+		}
+	}
+
+	for i, ps := range state.Players {
+		p := restorePlayer(ps)
+		d.players = append(d.players, p)
+		p.setDesk(d, i)
+		if _, ok := d.roundStats[p.uid]; !ok {
+			d.roundStats[p.uid] = &history.Record{}
+		}
+
+		if p.isRobot() {
+			d.prepare.ready(p.uid)
+			d.prepare.sorted(p.uid)
+			continue
+		}
+
+		// 服务器重启后所有真实玩家都处于离线状态, 等待玩家重连
+		d.dissolve.pause[p.uid] = true
+		if _, ok := defaultManager.player(p.uid); !ok {
+			defaultManager.setPlayer(p.uid, p)
+		}
+	}
+
+	if ds := state.Dissolve; ds != nil {
+		d.dissolve.start(ds.RestTime)
+		d.dissolve.status = ds.Status
+		d.dissolve.desc = ds.Desc
+	}
+
+	return d
+}
+
+// 继续中断的牌局
+func (d *Desk) resume(resume int) {
+	switch d.status() {
+	case constant.DeskStatusDuanPai, constant.DeskStatusQiPai:
+		// 重启前还没有开始打牌, 未定缺的玩家使用默认定缺
+		if d.rules.DingQue(d.opts.Mode) {
+			for _, p := range d.players {
+				if p.ctx.Que < 1 {
+					p.ctx.Que = p.selectDefaultQue()
+				}
+			}
+		}
+		d.resumeAt = resumeMoPai
+		go d.play()
+
+	case constant.DeskStatusPlaying:
+		d.resumeAt = resume
+		go d.play()
+	}
+}
+
+// 恢复服务器重启前未完成的房间, 玩家通过ReConnect/ReJoin重新进入
+func (manager *DeskManager) restoreDesks() {
+	if manager.store == nil {
+		return
+	}
+
+	deadline := time.Now().Add(-24 * time.Hour).Unix()
+	for no, data := range manager.store.loadAll() {
+		state := &deskState{}
+		if err := json.Unmarshal(data, state); err != nil {
+			logger.Errorf("解析房间数据失败, 房号=%s, Error=%v", no, err)
+			manager.store.remove(no)
+			continue
+		}
+
+		// 超过24小时的房间直接丢弃
+		if state.Opts == nil || state.CreatedAt < deadline || len(state.Players) != state.Opts.Mode {
+			manager.store.remove(no)
+			continue
+		}
+
+		d := restoreDesk(state)
+		room.Reserve(no)
+		manager.desks[no] = d
+		d.logger.Infof("恢复房间: 状态=%s 局数=%d/%d", d.status().String(), d.round, d.opts.MaxRound)
+		d.resume(state.Resume)
+	}
+}
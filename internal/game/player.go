@@ -2,12 +2,16 @@ package game
 
 import (
 	"fmt"
+	"sort"
+	"sync"
 
+	"github.com/lonng/nano/scheduler"
 	"github.com/lonng/nano/session"
 	"github.com/lonng/nanoserver/db"
 	"github.com/lonng/nanoserver/db/model"
 	"github.com/lonng/nanoserver/internal/game/mahjong"
 	"github.com/lonng/nanoserver/pkg/async"
+	"github.com/lonng/nanoserver/pkg/errutil"
 	"github.com/lonng/nanoserver/protocol"
 	log "github.com/sirupsen/logrus"
 )
@@ -25,20 +29,30 @@ type Player struct {
 	sex  int    // 性别
 	coin int64  // 房卡数量
 
+	gold   int64 // 金币余额
+	silver int64 // 银币余额
+
 	// 玩家数据
 	session *session.Session
+	robot   *robot // 机器人AI, 真实玩家为nil
 
 	// 游戏相关字段
 	onHand   mahjong.Mahjong
 	pongKong mahjong.Mahjong
+	chows    mahjong.Mahjong // 吃牌的顺子, 不参与刻子相关的番型计算
 	chupai   mahjong.Mahjong
 	ctx      *mahjong.Context
 
 	chOperation chan *protocol.OpChoosed
+	choice      *protocol.OpChoosed // 最后一次选择的操作, 同时提示胡和碰杠吃时使用
+	trustee     int32               // 是否托管
+	waiting     int32               // 是否正在等待玩家操作
 
-	desk  *Desk //当前桌
-	turn  int   //当前玩家在桌上的方位
-	score int   //经过n局后,当前玩家余下的分值数,默认为1000
+	desk     *Desk       //当前桌
+	watching *Desk       //正在观战的房间
+	matching *matchQueue //正在排队的匹配队列
+	turn     int         //当前玩家在桌上的方位
+	score    int         //经过n局后,当前玩家余下的分值数,默认为1000
 
 	logger *log.Entry // 日志
 }
@@ -75,40 +89,65 @@ func (p *Player) syncCoinFromDB() {
 		}
 
 		p.coin = u.Coin
+		p.gold, p.silver = u.Gold, u.Silver
 		if s := p.session; s != nil {
 			s.Push("onCoinChange", &protocol.CoinChangeInformation{p.coin})
 		}
 	})
 }
 
-// 异步扣除玩家房卡
-func (p *Player) loseCoin(count int64, consume *model.CardConsume) {
+// 异步扣除玩家房卡, 扣除成功后再同步到内存并通知客户端, pending不为空时扣除完成后标记完成
+func (p *Player) loseCoin(count int64, consume *model.CardConsume, key string, pending *sync.WaitGroup) {
+	uid := p.uid
+	if pending != nil {
+		pending.Add(1)
+	}
 	async.Run(func() {
-		u, err := db.QueryUser(p.uid)
+		if pending != nil {
+			defer pending.Done()
+		}
+		coin, err := db.ChangeWallet(&db.WalletChange{
+			Uid:     uid,
+			Type:    model.WalletDesk,
+			Amount:  -count,
+			RefType: model.WalletRefDesk,
+			RefId:   consume.DeskNo,
+			Key:     key,
+		}, consume)
 		if err != nil {
-			p.logger.Errorf("扣除房卡，查询玩家错误, Error=%v", err)
+			p.logger.Errorf("扣除房卡错误, 数量=%d, Error=%v Payload=%+v", count, err, consume)
 			return
 		}
 
-		// 即使数据库不成功，玩家房卡数量依然扣除
-		p.coin -= count
-		u.Coin = p.coin
-		if err := db.UpdateUser(u); err != nil {
-			p.logger.Errorf("扣除房卡，更新房卡数量错误, Error=%v", err)
-			return
-		}
+		scheduler.PushTask(func() {
+			p.coin = coin
+			if s := p.session; s != nil {
+				s.Push("onCoinChange", &protocol.CoinChangeInformation{p.coin})
+			}
+		})
+	})
+}
 
-		if u.Coin != p.coin {
-			p.logger.Errorf("玩家扣除房卡，同步到数据库后，发现房卡数量不一致，玩家数量=%d，数据库数量=%d", p.coin, u.Coin)
+// 异步退还开房消耗的房卡, 等待pending中的扣除完成后再退还, 没有扣除记录时不退还
+func (p *Player) refundCoin(key, refundKey string, consume *model.CardConsume, pending *sync.WaitGroup) {
+	uid := p.uid
+	async.Run(func() {
+		pending.Wait()
+		coin, err := db.RefundDeskCoin(uid, key, refundKey, consume)
+		if err == errutil.ErrNotFound {
+			return
 		}
-
-		if err := db.Insert(consume); err != nil {
-			p.logger.Errorf("新增消费数据错误，Error=%v Payload=%+v", err, consume)
+		if err != nil {
+			p.logger.Errorf("退还房卡错误, Key=%s, Error=%v", key, err)
+			return
 		}
 
-		if s := p.session; s != nil {
-			s.Push("onCoinChange", &protocol.CoinChangeInformation{p.coin})
-		}
+		scheduler.PushTask(func() {
+			p.coin = coin
+			if s := p.session; s != nil {
+				s.Push("onCoinChange", &protocol.CoinChangeInformation{p.coin})
+			}
+		})
 	})
 }
 
@@ -147,6 +186,10 @@ func (p *Player) Uid() int64 {
 	return p.uid
 }
 
+func (p *Player) isRobot() bool {
+	return p.robot != nil
+}
+
 func (p *Player) duanPai(ids mahjong.Tiles) {
 	p.onHand = mahjong.FromID(ids)
 	p.logger.Debugf("游戏开局, 手牌数量=%d 手牌: %v", len(p.handTiles()), p.handTiles())
@@ -160,24 +203,19 @@ func (p *Player) chuPai() int {
 
 ctrl:
 	p.hint([]protocol.Op{{Type: protocol.OptypeChu}}, p.tingTiles())
-	select {
-	case op, ok := <-p.chOperation:
-		if !ok {
-			return deskDissolved
-		}
-
-		if op.Type != protocol.OptypeChu {
-			p.logger.Errorf("玩家操作异常，期待操作出牌，获取操作=%+v", op)
-			goto ctrl
-		}
+	op, ok := p.waitOperation()
+	if !ok {
+		return deskDissolved
+	}
 
-		tid = op.TileID
-		if tid < 0 {
-			p.logger.Debugf("玩家读取到一个非法的麻将ID: ID=%+v", op)
-		}
+	if op.Type != protocol.OptypeChu {
+		p.logger.Errorf("玩家操作异常，期待操作出牌，获取操作=%+v", op)
+		goto ctrl
+	}
 
-	case <-p.desk.die:
-		return deskDissolved
+	tid = op.TileID
+	if tid < 0 {
+		p.logger.Debugf("玩家读取到一个非法的麻将ID: ID=%+v", op)
 	}
 
 	// 删掉已经出过的牌
@@ -211,77 +249,79 @@ func (p *Player) hu(tileID int, hasHint bool) int {
 			{Type: protocol.OptypePass},
 		})
 	}
-	select {
-	case op, ok := <-p.chOperation:
-		if !ok {
-			return deskDissolved
-		}
-
-		p.ctx.SetPrevOp(op.Type)
-		return op.Type
-
-	case <-p.desk.die:
+	op, ok := p.waitOperation()
+	if !ok {
 		return deskDissolved
 	}
 
-	p.logger.Debugf("玩家胡牌: 麻将=%d", tileID)
-	return protocol.OptypeHu
+	p.logger.Debugf("玩家选择: 麻将=%d 操作=%d", tileID, op.Type)
+	p.choice = op
+	p.ctx.SetPrevOp(op.Type)
+	return op.Type
 }
 
-// 让玩家选择碰杠
-// @param: hasHint 之前是否已经发送了碰杠牌的提示, 这种情况出现在玩家同时可以碰杠胡的情况
-func (p *Player) pengOrGang(tileID int, ops []protocol.Op, hasHint bool) (isPeng, isGang, isDissolve bool) {
-	isPeng = false
-	isGang = false
-	isDissolve = false
-
+// 让玩家选择碰/杠/吃, 返回玩家选择的操作
+// @param: hasHint 之前是否已经发送了提示, 这种情况出现在玩家同时可以碰杠吃胡的情况
+func (p *Player) claim(tileID int, ops []protocol.Op, hasHint bool) int {
 	var (
 		opType = p.ctx.PrevOp
+		chosen = tileID
 		mjs    mahjong.Tiles
 	)
 
+	if hasHint && p.choice != nil {
+		chosen = p.choice.TileID
+	}
+
 	// 之前没有发送了提示
 	if !hasHint {
 		hints := []protocol.Op{{Type: protocol.OptypePass}}
 		for _, op := range ops {
-			opInfo := protocol.Op{Type: op.Type, TileIDs: []int{tileID}}
-			hints = append(hints, opInfo)
+			// 吃牌提示包含手牌中用来吃的两张牌
+			if op.Type != protocol.OptypeChi {
+				op = protocol.Op{Type: op.Type, TileIDs: []int{tileID}}
+			}
+			hints = append(hints, op)
 		}
-		//碰、杠、过
+		//碰、杠、吃、过
 		p.hint(hints)
 
-		select {
-		case op, ok := <-p.chOperation:
-			if !ok {
-				isDissolve = true
-				return
-			}
-
-			tileID = op.TileID
-			opType = op.Type
-
-		case <-p.desk.die:
-			isDissolve = true
-			return
+		op, ok := p.waitOperation()
+		if !ok {
+			return deskDissolved
 		}
+
+		chosen = op.TileID
+		opType = op.Type
 	}
 
 	switch opType {
 	case protocol.OptypeGang:
 		mjs = p.brotherTiles(tileID, 4)
 		p.gang(tileID)
-		isGang = true
 	case protocol.OptypePeng:
 		mjs = p.brotherTiles(tileID, 3)
 		p.peng(tileID)
-		isPeng = true
-	case protocol.OptypePass:
+	case protocol.OptypeChi:
+		// 客户端选择吃牌时发送手牌中用来吃的第一张牌
+		for _, op := range ops {
+			if op.Type == protocol.OptypeChi && op.TileIDs[1] == chosen {
+				mjs = op.TileIDs
+				break
+			}
+		}
+		if mjs == nil {
+			p.logger.Errorf("玩家选择的吃牌不合法: 麻将=%d 可选=%+v", chosen, ops)
+			return protocol.OptypePass
+		}
+		p.chi(mjs)
+	default:
 		p.logger.Debugf("玩家选择过, 麻将: %d", tileID)
-		return
+		return protocol.OptypePass
 	}
 
 	p.action(opType, mjs)
-	return isPeng, isGang, isDissolve
+	return opType
 }
 
 func (p *Player) moPai() {
@@ -307,6 +347,7 @@ func (p *Player) moPai() {
 	if err := p.desk.group.Broadcast("onMoPai", mo); err != nil {
 		log.Error(err)
 	}
+	p.desk.broadcastSpectators("onMoPai", &protocol.MoPai{AccountID: p.Uid(), TileIDs: []int{illegalTile}})
 
 	// TODO: 确认海底捞是否是最后一个摸牌的, 其他人摸最后一张牌, 点炮是否算海底捞
 	p.ctx.IsLastTile = p.desk.noMoreTile()
@@ -325,7 +366,7 @@ func (p *Player) chuTiles() mahjong.Mahjong {
 
 // 检查是否有叫
 func (p *Player) isTing() bool {
-	return mahjong.IsTing(p.handTiles().Indexes())
+	return len(p.desk.rules.Ting(p.handTiles().Indexes())) > 0
 }
 
 func (p *Player) tileIDWithIndex(index int) int {
@@ -349,32 +390,16 @@ func (p *Player) allTileIDWithIndex(index int) mahjong.Tiles {
 	return ids
 }
 
-// 碰杠牌
+// 碰杠牌, 包括吃牌的顺子, 用于展示
 func (p *Player) pgTiles() mahjong.Mahjong {
-	return p.pongKong
+	if len(p.chows) == 0 {
+		return p.pongKong
+	}
+	return append(p.pongKong[:len(p.pongKong):len(p.pongKong)], p.chows...)
 }
 
 func (p *Player) canWin() bool {
-	newTile := mahjong.TileFromID(p.ctx.NewDrawingID)
-	que := p.ctx.Que
-	// 打缺的牌不能胡
-	if que == newTile.Suit+1 {
-		return false
-	}
-
-	// 还没有打缺不能胡
-	for _, t := range p.onHand {
-		if que == t.Suit+1 {
-			return false
-		}
-	}
-
-	canWin := mahjong.CheckWin(p.handTiles().Indexes())
-
-	p.logger.Infof("玩家计算是否可以胡牌: 手牌=%+v, 新上手=%v, 是否可以胡=%t",
-		p.handTiles(), newTile, canWin)
-
-	return canWin
+	return p.desk.rules.CanZiMo(p)
 }
 
 func (p *Player) allGang() []protocol.Op {
@@ -382,7 +407,7 @@ func (p *Player) allGang() []protocol.Op {
 	ops := []protocol.Op{}
 
 	handTiles := p.handTiles()
-	pgTiles := p.pgTiles()
+	pgTiles := p.pongKong // 顺子不能巴杠
 
 	for _, t := range handTiles {
 		tileGroup[t.Index] = append(tileGroup[t.Index], t)
@@ -470,7 +495,7 @@ func (p *Player) tingTiles() protocol.Tings {
 	for index := range distinct {
 		rest := exclude(index)
 		//log.Debugf("去除：%v，剩余：%+v", index, rest)
-		if ting := mahjong.TingTiles(rest); len(ting) > 0 {
+		if ting := p.desk.rules.Ting(rest); len(ting) > 0 {
 			tings = append(tings, protocol.Ting{Index: index, Hu: ting})
 		}
 	}
@@ -566,50 +591,43 @@ func (p *Player) doCheckHandTiles(isNewRound bool) (int, int) {
 
 	p.hint(ops)
 
-	select {
-	case op, ok := <-p.chOperation:
-		if !ok {
-			return protocol.OptypePass, deskDissolved
-		}
-
-		var mjs mahjong.Tiles
-		switch op.Type {
-		case protocol.OptypePass:
-			return op.Type, p.ctx.NewDrawingID
-
-		case protocol.OptypeGang:
+	op, ok := p.waitOperation()
+	if !ok {
+		return protocol.OptypePass, deskDissolved
+	}
 
-			//刮风的牌,是onHand里只可能有一张,而其他3张在"pongKong"里
-			mjs = p.allTileIDWithIndex(mahjong.TileFromID(op.TileID).Index)
-			//巴杠,抢杠
-			if len(mjs) == 1 {
-				// fixed: 巴杠也需要通知客户端
-				p.action(op.Type, mjs)
-				return protocol.OptypeBaGang, op.TileID //可能杠的并不是最后摸的那一张牌，即n把后才杠
-			}
+	var mjs mahjong.Tiles
+	switch op.Type {
+	case protocol.OptypeGang:
 
-		case protocol.OptypeHu:
-			mjs = []int{op.TileID}
+		//刮风的牌,是onHand里只可能有一张,而其他3张在"pongKong"里
+		mjs = p.allTileIDWithIndex(mahjong.TileFromID(op.TileID).Index)
+		//巴杠,抢杠
+		if len(mjs) == 1 {
+			// fixed: 巴杠也需要通知客户端
+			p.action(op.Type, mjs)
+			return protocol.OptypeBaGang, op.TileID //可能杠的并不是最后摸的那一张牌，即n把后才杠
 		}
 
-		return fn(p, op, mjs)
+	case protocol.OptypeHu:
+		mjs = []int{op.TileID}
 
-	case <-p.desk.die:
-		return protocol.OptypePass, deskDissolved
+	default:
+		return protocol.OptypePass, p.ctx.NewDrawingID
 	}
 
-	return protocol.OptypePass, p.ctx.NewDrawingID
+	return fn(p, op, mjs)
 }
 
 // 计算番数
 func (p *Player) scoring() int {
-	m := mahjong.Multiple(p.ctx, p.handTiles().Indexes(), p.pgTiles().Indexes())
+	m := p.desk.rules.Fan(p.ctx, p.handTiles().Indexes(), p.pongKong.Indexes(), p.chows.Indexes())
 	p.ctx.Fan = m
 	return 1 << uint(m)
 }
 
 func (p *Player) maxTingScore() (int, int) {
-	m, idx := mahjong.MaxMultiple(p.desk.opts, p.handTiles().Indexes(), p.pgTiles().Indexes())
+	m, idx := p.desk.rules.MaxFan(p.desk.opts, p.handTiles().Indexes(), p.pongKong.Indexes(), p.chows.Indexes())
 	p.ctx.Fan = m
 	return 1 << uint(m), idx
 }
@@ -617,81 +635,12 @@ func (p *Player) maxTingScore() (int, int) {
 // 检查吃牌
 // 是否碰(pong)/杠(kong)/胡(win)其他人的牌
 func (p *Player) checkChi(tid int, chuPlayer *Player) []protocol.Op {
-	tile := mahjong.TileFromID(tid)
-	ret := []protocol.Op{}
-
-	// 不能碰杠缺的牌
-	if tile.Suit+1 == p.ctx.Que {
-		return ret
-	}
-
-	// 检查胡牌
-	if p.checkHu(tid, chuPlayer.ctx.PrevOp == protocol.OptypeGang) {
-		ret = append(ret, protocol.Op{Type: protocol.OptypeHu, TileIDs: []int{tile.Id}})
-	}
-
-	sameTiles := mahjong.Mahjong{}
-	tiles := p.handTiles()
-	for _, sp := range tiles {
-		if sp.Index == tile.Index {
-			sameTiles = append(sameTiles, sp)
-		}
-	}
-
-	p.logger.Debugf("其他人打牌, 检查玩家是否可以杠, 手牌=%+v 检查是否能吃的牌=%s, 相同麻将=%+v",
-		tiles, tile.String(), sameTiles)
-	// 明牌玩家直接检查扣牌是否可以杠
-
-	//检查碰、杠
-	if len(sameTiles) == 3 && !p.desk.noMoreTile() {
-		ret = append(ret, protocol.Op{Type: protocol.OptypeGang, TileIDs: mahjong.Tiles{sameTiles[0].Id}})
-	}
-	if len(sameTiles) == 2 {
-		ret = append(ret, protocol.Op{Type: protocol.OptypePeng, TileIDs: mahjong.Tiles{sameTiles[0].Id}})
-	}
-
-	p.logger.Debugf("计算杠牌完毕, 所有可用操作: %+v", ret)
-	return ret
+	return p.desk.rules.Claims(p, tid, chuPlayer)
 }
 
 // 是否胡牌, plus表示是不是额外有番(比如抢杠，别人杠上炮)
 func (p *Player) checkHu(tid int, plus bool) bool {
-	index := mahjong.IndexFromID(tid)
-	tiles := p.handTiles()
-	que := p.ctx.Que
-
-	// 不能胡缺牌
-	tile := mahjong.TileFromID(tid)
-	if tile.Suit+1 == que {
-		return false
-	}
-	// 还没有打缺不能胡
-	for _, t := range tiles {
-		if que == t.Suit+1 {
-			return false
-		}
-	}
-
-	// 检查胡牌
-	canHu := mahjong.CanHu(tiles.Indexes(), index)
-	if !canHu {
-		return false
-	}
-
-	// 如果可以平胡
-	if p.desk.opts.Pinghu {
-		return true
-	}
-
-	// 如果不能点炮平胡
-	onHand := append(p.handTiles().Indexes(), index)
-	old := p.ctx.NewOtherDiscardID
-	p.ctx.NewOtherDiscardID = tid
-	m := mahjong.Multiple(p.ctx, onHand, p.pgTiles().Indexes())
-	p.ctx.NewOtherDiscardID = old
-
-	// 有番才能胡
-	return m > 0 || plus
+	return p.desk.rules.CanHu(p, tid, plus)
 }
 
 func (p *Player) brotherTiles(id, count int) mahjong.Tiles {
@@ -754,6 +703,28 @@ func (p *Player) peng(id int) {
 	p.ctx.SetPrevOp(protocol.OptypePeng)
 }
 
+// 吃牌, tiles第一张为上家打出的牌, 后两张为手牌
+func (p *Player) chi(tiles mahjong.Tiles) {
+	chow := mahjong.Mahjong{mahjong.TileFromID(tiles[0])}
+	for _, id := range tiles[1:] {
+		for i, m := range p.onHand {
+			if m.Id == id {
+				chow = append(chow, m)
+				p.onHand = append(p.onHand[:i:i], p.onHand[i+1:]...)
+				break
+			}
+		}
+	}
+
+	// 按顺子的顺序放入吃牌, 不和碰杠的刻子混在一起计算番数
+	sort.Slice(chow, func(i, j int) bool { return chow[i].Index < chow[j].Index })
+	p.chows = append(p.chows, chow...)
+
+	p.logger.Debugf("玩家吃牌, 麻将=%v 手牌=%+v 碰杠=%+v", chow, p.handTiles(), p.pgTiles())
+
+	p.ctx.SetPrevOp(protocol.OptypeChi)
+}
+
 // 玩家操作
 func (p *Player) action(opType int, tiles mahjong.Tiles) {
 	p.logger.Debugf("玩家选择: OpType=%d Tiles=%+v", opType, tiles)
@@ -762,7 +733,7 @@ func (p *Player) action(opType int, tiles mahjong.Tiles) {
 		OpType:  opType,
 		TileIDs: tiles,
 	}
-	if err := p.desk.group.Broadcast(protocol.RouteTypeDo, do); err != nil {
+	if err := p.desk.broadcast(protocol.RouteTypeDo, do); err != nil {
 		log.Error(err)
 	}
 
@@ -797,6 +768,12 @@ func (p *Player) hint(ops []protocol.Op, args ...protocol.Tings) {
 	p.ctx.LastHint = hint
 	p.desk.lastHintUid = p.Uid()
 
+	// 机器人直接根据提示做出选择
+	if p.isRobot() {
+		p.robot.onHint(p, hint)
+		return
+	}
+
 	if p.session == nil {
 		p.logger.Warnf("玩家网络已经断开，不能通知出牌")
 		return
@@ -825,74 +802,23 @@ func (p *Player) selectDefaultQue() int {
 func (p *Player) reset() {
 	p.onHand = mahjong.Mahjong{}
 	p.pongKong = mahjong.Mahjong{}
+	p.chows = mahjong.Mahjong{}
 	p.chupai = mahjong.Mahjong{}
 
-	// 重置channel
+	// 重置channel, 机器人还没有写入的操作需要先取消
+	if p.robot != nil {
+		p.robot.cancelPending()
+	}
 	close(p.chOperation)
 	p.chOperation = make(chan *protocol.OpChoosed, 1)
+	p.choice = nil
 	p.ctx.Reset()
 }
 
 // 断线重连后，同步牌桌数据
 // TODO: 断线重连，已和牌玩家显示不正常
 func (p *Player) syncDeskData() error {
-	desk := p.desk
-	data := &protocol.SyncDesk{
-		Status:    desk.status(),
-		Players:   []protocol.DeskPlayerData{},
-		ScoreInfo: []protocol.ScoreInfo{},
-	}
-
-	markerUid := int64(0)
-	lastMoPaiUid := int64(0)
-	for i, player := range desk.players {
-		uid := player.Uid()
-		if i == desk.bankerTurn {
-			markerUid = uid
-		}
-		if i == desk.curTurn {
-			lastMoPaiUid = uid
-		}
-		// 有可能已经有玩家和牌
-		stats := desk.roundOverTilesForPlayer(player)
-		playerData := protocol.DeskPlayerData{
-			Uid:        uid,
-			HandTiles:  stats.Tiles,
-			PGTiles:    player.pgTiles().Ids(),
-			ChuTiles:   player.chuTiles().Ids(),
-			LatestTile: player.ctx.NewDrawingID,
-			HuPai:      player.ctx.WinningID,
-			HuType:     player.ctx.ResultType,
-			IsHu:       desk.wonPlayers[uid],
-			Que:        player.ctx.Que,
-			Score:      player.score,
-		}
-
-		// 如果自己断线重连，并且在定缺中，则发回提示，使用负数表示定缺建议选项
-		if p.Uid() == uid && p.ctx.Que < 1 {
-			playerData.Que = -player.selectDefaultQue()
-		}
-
-		data.Players = append(data.Players, playerData)
-
-		score := protocol.ScoreInfo{
-			Uid:   uid,
-			Score: player.score,
-		}
-
-		data.ScoreInfo = append(data.ScoreInfo, score)
-	}
-	data.MarkerUid = markerUid
-	data.LastMoPaiUid = lastMoPaiUid
-	data.RestCount = desk.remainTileCount()
-	data.Dice1 = desk.dice.dice1
-	data.Dice2 = desk.dice.dice2
-	syncUid := p.Uid()
-	if lastMoPaiUid == syncUid || p.desk.lastHintUid == syncUid {
-		data.Hint = p.ctx.LastHint
-	}
-	data.LastTileId = p.desk.lastTileId
-	data.LastChuPaiUid = p.desk.lastChuPaiUid
+	data := p.desk.syncData(p)
 	p.logger.Debugf("同步房间数据: %+v", data)
 	return p.session.Push("onSyncDesk", data)
 }
@@ -0,0 +1,266 @@
+package game
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lonng/nanoserver/internal/game/mahjong"
+	"github.com/lonng/nanoserver/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// 机器人UID从-1开始递减, 避免与真实玩家冲突
+var robotUid int64
+
+// 机器人思考时间
+var robotThinkTime = map[int]time.Duration{
+	protocol.RobotLevelEasy:   1500 * time.Millisecond,
+	protocol.RobotLevelNormal: 1000 * time.Millisecond,
+	protocol.RobotLevelHard:   500 * time.Millisecond,
+}
+
+// 机器人操作的超时时间, 超时后自动操作, 防止机器人的操作丢失导致牌桌卡住
+const robotMaxWait = 10 * time.Second
+
+// 机器人, 没有session, 收到提示后思考一段时间再向chOperation写入操作
+type robot struct {
+	level int // 难度
+
+	sync.Mutex
+	cancel chan struct{} // 取消还没有写入的操作
+}
+
+func newRobot(level int) *Player {
+	// 未指定难度时使用普通难度
+	if level < protocol.RobotLevelEasy || level > protocol.RobotLevelHard {
+		level = protocol.RobotLevelNormal
+	}
+
+	uid := atomic.AddInt64(&robotUid, -1)
+	p := &Player{
+		uid:   uid,
+		name:  fmt.Sprintf("机器人%d", -uid),
+		ctx:   &mahjong.Context{Uid: uid},
+		sex:   protocol.SexTypeMale,
+		score: 1000,
+		robot: &robot{level: level},
+
+		logger: log.WithField(fieldPlayer, uid),
+
+		chOperation: make(chan *protocol.OpChoosed, 1),
+	}
+
+	p.ctx.Reset()
+
+	return p
+}
+
+// 收到提示后立即做出选择, 思考时间在定时器中等待, 不阻塞牌桌的其他提示
+func (r *robot) onHint(p *Player, hint *protocol.Hint) {
+	op := r.decide(p, hint)
+	ch, die := p.chOperation, p.desk.die
+
+	r.Lock()
+	r.stop()
+	// 丢弃之前的提示中没有被读取的操作
+	for drained := false; !drained; {
+		select {
+		case _, ok := <-ch:
+			drained = !ok
+		default:
+			drained = true
+		}
+	}
+	cancel := make(chan struct{})
+	r.cancel = cancel
+	r.Unlock()
+
+	time.AfterFunc(robotThinkTime[r.level], func() {
+		r.Lock()
+		defer r.Unlock()
+
+		select {
+		case <-cancel:
+			return
+		default:
+		}
+
+		p.logger.Debugf("机器人选择: Hint=%s 操作=%+v", hint.String(), op)
+		select {
+		case ch <- op:
+		case <-die:
+		}
+	})
+}
+
+// 取消还没有写入的操作, 调用时需要持有锁
+func (r *robot) stop() {
+	if r.cancel != nil {
+		close(r.cancel)
+		r.cancel = nil
+	}
+}
+
+// 重置玩家的操作队列之前调用, 之后不会再向旧的队列写入
+func (r *robot) cancelPending() {
+	r.Lock()
+	defer r.Unlock()
+	r.stop()
+}
+
+func (r *robot) decide(p *Player, hint *protocol.Hint) *protocol.OpChoosed {
+	ops := map[int]protocol.Op{}
+	for _, op := range hint.Ops {
+		if _, ok := ops[op.Type]; !ok {
+			ops[op.Type] = op
+		}
+	}
+
+	if _, ok := ops[protocol.OptypeChu]; ok {
+		return &protocol.OpChoosed{Type: protocol.OptypeChu, TileID: r.discard(p, hint.Tings)}
+	}
+
+	// 能胡就胡
+	if op, ok := ops[protocol.OptypeHu]; ok {
+		return &protocol.OpChoosed{Type: protocol.OptypeHu, TileID: op.TileIDs[0]}
+	}
+
+	if op, ok := ops[protocol.OptypeGang]; ok && r.claim(p, protocol.OptypeGang) {
+		return &protocol.OpChoosed{Type: protocol.OptypeGang, TileID: op.TileIDs[0]}
+	}
+
+	if op, ok := ops[protocol.OptypePeng]; ok && r.claim(p, protocol.OptypePeng) {
+		return &protocol.OpChoosed{Type: protocol.OptypePeng, TileID: op.TileIDs[0]}
+	}
+
+	// 吃牌时选择手牌中的第一张
+	if op, ok := ops[protocol.OptypeChi]; ok && r.claim(p, protocol.OptypeChi) {
+		return &protocol.OpChoosed{Type: protocol.OptypeChi, TileID: op.TileIDs[1]}
+	}
+
+	return &protocol.OpChoosed{Type: protocol.OptypePass, TileID: p.ctx.NewDrawingID}
+}
+
+// 是否碰/杠/吃
+func (r *robot) claim(p *Player, typ int) bool {
+	switch r.level {
+	case protocol.RobotLevelEasy:
+		return p.desk.rng.Intn(2) == 0
+	case protocol.RobotLevelHard:
+		// 已经有叫, 不碰牌破坏牌型
+		return typ == protocol.OptypeGang || !p.isTing()
+	default:
+		return true
+	}
+}
+
+// 选择要打出的牌
+func (r *robot) discard(p *Player, tings protocol.Tings) int {
+	hand := p.handTiles()
+
+	// 优先打缺
+	if que := p.ctx.Que; que > 0 {
+		for _, t := range hand {
+			if t.Suit+1 == que {
+				return t.Id
+			}
+		}
+	}
+
+	// 打出后可以听牌, 选择胡牌张数最多的打法
+	if r.level != protocol.RobotLevelEasy && len(tings) > 0 {
+		best, max := tings[0].Index, -1
+		for _, t := range tings {
+			count := len(t.Hu)
+			if r.level == protocol.RobotLevelHard {
+				count = r.restCount(p, t.Hu)
+			}
+			if count > max {
+				best, max = t.Index, count
+			}
+		}
+		return p.tileIDWithIndex(best)
+	}
+
+	return p.tileIDWithIndex(r.isolated(p))
+}
+
+// 胡牌剩余张数(除去自己手牌和桌面上已经可见的牌)
+func (r *robot) restCount(p *Player, hu []int) int {
+	stats := &mahjong.Stats{}
+	stats.From(p.handTiles())
+	for _, other := range p.desk.players {
+		stats.From(other.chuTiles(), other.pgTiles())
+	}
+
+	count := 0
+	for _, index := range hu {
+		if rest := 4 - int(stats[index]); rest > 0 {
+			count += rest
+		}
+	}
+	return count
+}
+
+// 找出手牌中最孤立的牌
+func (r *robot) isolated(p *Player) int {
+	stats := map[int]int{}
+	for _, t := range p.handTiles() {
+		stats[t.Index]++
+	}
+
+	// 相同的牌和相邻的牌越多, 这张牌越有用
+	weight := func(index int) int {
+		w := (stats[index] - 1) * 4
+		for _, delta := range []int{-2, -1, 1, 2} {
+			near := index + delta
+			if near/10 != index/10 || stats[near] == 0 {
+				continue
+			}
+			if delta == -1 || delta == 1 {
+				w += 2
+			} else {
+				w++
+			}
+		}
+		// 幺九牌更难成顺子
+		if rank := index % 10; rank == 1 || rank == 9 {
+			w--
+		}
+		return w
+	}
+
+	candidates := []int{}
+	min := 0
+	for index := range stats {
+		w := weight(index)
+		if len(candidates) == 0 || w < min {
+			candidates = []int{index}
+			min = w
+		} else if w == min {
+			candidates = append(candidates, index)
+		}
+	}
+
+	return candidates[p.desk.rng.Intn(len(candidates))]
+}
+
+// 选择手牌最少的花色定缺, 字牌和花牌不参与定缺
+func (r *robot) que(p *Player) int {
+	stats := [mahjong.SuitWan + 1]int{}
+	for _, t := range p.onHand {
+		if t.Suit <= mahjong.SuitWan {
+			stats[t.Suit]++
+		}
+	}
+
+	q := 0
+	for suit, count := range stats {
+		if count < stats[q] {
+			q = suit
+		}
+	}
+	return q + 1
+}
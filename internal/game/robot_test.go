@@ -0,0 +1,29 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/lonng/nanoserver/internal/game/mahjong"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+func TestRobotQue(t *testing.T) {
+	// 条: 0~35, 筒: 36~71, 万: 72~107, 字牌: 108~135, 花牌: 136~143
+	cases := []struct {
+		name   string
+		ids    []int
+		expect int
+	}{
+		{"fewest wan", []int{0, 4, 8, 36, 40, 44, 72}, mahjong.SuitWan + 1},
+		{"fewest tong", []int{0, 4, 8, 36, 72, 76}, mahjong.SuitTong + 1},
+		{"honors and flowers ignored", []int{0, 36, 40, 72, 76, 108, 112, 116, 120, 136, 140}, mahjong.SuitTiao + 1},
+	}
+
+	for _, c := range cases {
+		p := newRobot(protocol.RobotLevelNormal)
+		p.onHand = mahjong.FromID(c.ids)
+		if que := p.robot.que(p); que != c.expect {
+			t.Fatalf("%s: expect que %d, got %d", c.name, c.expect, que)
+		}
+	}
+}
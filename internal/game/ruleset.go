@@ -0,0 +1,101 @@
+package game
+
+import (
+	"math/rand"
+
+	"github.com/lonng/nanoserver/internal/game/mahjong"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+// Ruleset 玩法规则, 负责牌组, 发牌, 碰杠胡是否合法, 胡牌判定以及番数计算,
+// 牌桌根据DeskOptions.Ruleset选择, 新增玩法时实现此接口并注册即可, 不需要修改牌桌流程
+type Ruleset interface {
+	// 玩法名字
+	Name() string
+
+	// 麻将数量
+	TileCount(mode int) int
+
+	// 洗好的整副麻将
+	Tiles(mode int, r *rand.Rand) mahjong.Tiles
+
+	// 发牌, 返回每个玩家的起手牌(庄家多一张)和下一张牌在整副麻将中的索引
+	Deal(tiles mahjong.Tiles, playerCount, banker int) ([]mahjong.Tiles, int)
+
+	// 齐牌以后是否需要定缺
+	DingQue(mode int) bool
+
+	// 其他玩家出牌后, 当前玩家可以进行的碰/杠/胡
+	Claims(p *Player, tileID int, chu *Player) []protocol.Op
+
+	// 其他玩家出牌后, 当前玩家可以吃的所有组合, 包括是否开启吃牌以及哪些座位可以吃
+	Chows(p *Player, tileID int, chu *Player) []protocol.Op
+
+	// 碰杠吃的优先级, 数值大的玩家先选择, 胡牌总是最优先
+	ClaimPriority(opType int) int
+
+	// 是否可以自摸, 新上手的牌已经放入手牌
+	CanZiMo(p *Player) bool
+
+	// 是否可以胡别人打出的牌, plus表示是不是额外有番(比如抢杠，别人杠上炮)
+	CanHu(p *Player, tileID int, plus bool) bool
+
+	// 听牌列表, 手牌为3n+1张
+	Ting(onHand mahjong.Indexes) mahjong.Indexes
+
+	// 番数, 手牌为3n+2张, pongKong为碰杠的牌, chows为吃牌的顺子
+	Fan(ctx *mahjong.Context, onHand, pongKong, chows mahjong.Indexes) int
+
+	// 听牌的最大番数以及对应的牌, 用于查叫
+	MaxFan(opts *protocol.DeskOptions, onHand, pongKong, chows mahjong.Indexes) (int, int)
+
+	// 杠牌时每个输家的分数, 暗杠/点杠为下雨, 巴杠为刮风
+	GangScore(anGang bool) int
+
+	// 有人胡牌后是否继续游戏
+	ContinueAfterWin() bool
+}
+
+// 手牌中可以与tileID组成顺子的所有组合, 字牌和花牌不能吃
+func chowOps(p *Player, tileID int) []protocol.Op {
+	tile := mahjong.TileFromID(tileID)
+	ret := []protocol.Op{}
+	if tile.Index > mahjong.MaxSuitIndex {
+		return ret
+	}
+
+	for _, delta := range [][2]int{{-2, -1}, {-1, 1}, {1, 2}} {
+		first, second := tile.Index+delta[0], tile.Index+delta[1]
+		// 不能跨花色
+		if first <= tile.Suit*10 || second > tile.Suit*10+9 {
+			continue
+		}
+
+		id1, id2 := p.tileIDWithIndex(first), p.tileIDWithIndex(second)
+		if id1 < 0 || id2 < 0 {
+			continue
+		}
+		ret = append(ret, protocol.Op{Type: protocol.OptypeChi, TileIDs: []int{tileID, id1, id2}})
+	}
+
+	return ret
+}
+
+// 所有已经注册的玩法
+var rulesets = map[string]Ruleset{}
+
+func registerRuleset(r Ruleset) {
+	if _, ok := rulesets[r.Name()]; ok {
+		panic("duplicate ruleset: " + r.Name())
+	}
+	rulesets[r.Name()] = r
+}
+
+// 根据名字查找玩法, 名字为空时使用血战到底
+func rulesetWithName(name string) (Ruleset, bool) {
+	if name == "" {
+		name = protocol.RulesetXueZhan
+	}
+	r, ok := rulesets[name]
+	return r, ok
+}
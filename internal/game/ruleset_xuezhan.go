@@ -0,0 +1,199 @@
+package game
+
+import (
+	"math/rand"
+
+	"github.com/lonng/nanoserver/internal/game/mahjong"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+func init() {
+	registerRuleset(xueZhan{})
+}
+
+// 四川血战到底: 条筒万三种花色, 四人需要定缺, 默认不能吃牌, 杠牌刮风下雨, 胡牌后其他玩家继续
+type xueZhan struct{}
+
+func (xueZhan) Name() string {
+	return protocol.RulesetXueZhan
+}
+
+// 四人108张, 三人只有条和筒72张
+func (xueZhan) TileCount(mode int) int {
+	if mode == ModeFours {
+		return 108
+	}
+	return 72
+}
+
+func (r xueZhan) Tiles(mode int, rnd *rand.Rand) mahjong.Tiles {
+	return mahjong.New(r.TileCount(mode), rnd)
+}
+
+func (xueZhan) Deal(tiles mahjong.Tiles, playerCount, banker int) ([]mahjong.Tiles, int) {
+	hands := make([]mahjong.Tiles, playerCount)
+	next := 0
+	for i := range hands {
+		hands[i] = make(mahjong.Tiles, 13)
+		copy(hands[i], tiles[next:next+13])
+		next += 13
+	}
+
+	//庄家多一张牌
+	hands[banker] = append(hands[banker], tiles[next])
+	next++
+
+	return hands, next
+}
+
+// 三人不需要定缺
+func (xueZhan) DingQue(mode int) bool {
+	return mode == ModeFours
+}
+
+func (r xueZhan) Claims(p *Player, tileID int, chu *Player) []protocol.Op {
+	tile := mahjong.TileFromID(tileID)
+	ret := []protocol.Op{}
+
+	// 不能碰杠缺的牌
+	if tile.Suit+1 == p.ctx.Que {
+		return ret
+	}
+
+	// 检查胡牌
+	if r.CanHu(p, tileID, chu.ctx.PrevOp == protocol.OptypeGang) {
+		ret = append(ret, protocol.Op{Type: protocol.OptypeHu, TileIDs: []int{tile.Id}})
+	}
+
+	sameTiles := mahjong.Mahjong{}
+	tiles := p.handTiles()
+	for _, sp := range tiles {
+		if sp.Index == tile.Index {
+			sameTiles = append(sameTiles, sp)
+		}
+	}
+
+	p.logger.Debugf("其他人打牌, 检查玩家是否可以杠, 手牌=%+v 检查是否能吃的牌=%s, 相同麻将=%+v",
+		tiles, tile.String(), sameTiles)
+
+	//检查碰、杠
+	if len(sameTiles) == 3 && !p.desk.noMoreTile() {
+		ret = append(ret, protocol.Op{Type: protocol.OptypeGang, TileIDs: mahjong.Tiles{sameTiles[0].Id}})
+	}
+	if len(sameTiles) == 2 {
+		ret = append(ret, protocol.Op{Type: protocol.OptypePeng, TileIDs: mahjong.Tiles{sameTiles[0].Id}})
+	}
+
+	p.logger.Debugf("计算杠牌完毕, 所有可用操作: %+v", ret)
+	return ret
+}
+
+// 开启吃牌时只有下家可以吃, 不能吃缺的牌
+func (xueZhan) Chows(p *Player, tileID int, chu *Player) []protocol.Op {
+	if !p.desk.opts.Chi || p.turn != (chu.turn+1)%p.desk.totalPlayerCount() {
+		return []protocol.Op{}
+	}
+	if mahjong.TileFromID(tileID).Suit+1 == p.ctx.Que {
+		return []protocol.Op{}
+	}
+	return chowOps(p, tileID)
+}
+
+// 碰杠优先于吃
+func (xueZhan) ClaimPriority(opType int) int {
+	switch opType {
+	case protocol.OptypeGang, protocol.OptypePeng:
+		return 2
+	case protocol.OptypeChi:
+		return 1
+	}
+	return 0
+}
+
+// 是否打完缺
+func (xueZhan) hasQue(p *Player) bool {
+	que := p.ctx.Que
+	for _, t := range p.handTiles() {
+		if que == t.Suit+1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r xueZhan) CanZiMo(p *Player) bool {
+	newTile := mahjong.TileFromID(p.ctx.NewDrawingID)
+	// 打缺的牌不能胡
+	if p.ctx.Que == newTile.Suit+1 {
+		return false
+	}
+
+	// 还没有打缺不能胡
+	if r.hasQue(p) {
+		return false
+	}
+
+	canWin := mahjong.CheckWin(p.handTiles().Indexes())
+
+	p.logger.Infof("玩家计算是否可以胡牌: 手牌=%+v, 新上手=%v, 是否可以胡=%t",
+		p.handTiles(), newTile, canWin)
+
+	return canWin
+}
+
+func (r xueZhan) CanHu(p *Player, tileID int, plus bool) bool {
+	// 不能胡缺牌
+	tile := mahjong.TileFromID(tileID)
+	if tile.Suit+1 == p.ctx.Que {
+		return false
+	}
+
+	// 还没有打缺不能胡
+	if r.hasQue(p) {
+		return false
+	}
+
+	// 检查胡牌
+	if !mahjong.CanHu(p.handTiles().Indexes(), tile.Index) {
+		return false
+	}
+
+	// 如果可以平胡
+	if p.desk.opts.Pinghu {
+		return true
+	}
+
+	// 如果不能点炮平胡
+	onHand := append(p.handTiles().Indexes(), tile.Index)
+	old := p.ctx.NewOtherDiscardID
+	p.ctx.NewOtherDiscardID = tileID
+	m := r.Fan(p.ctx, onHand, p.pongKong.Indexes(), p.chows.Indexes())
+	p.ctx.NewOtherDiscardID = old
+
+	// 有番才能胡
+	return m > 0 || plus
+}
+
+func (xueZhan) Ting(onHand mahjong.Indexes) mahjong.Indexes {
+	return mahjong.TingTiles(onHand)
+}
+
+func (xueZhan) Fan(ctx *mahjong.Context, onHand, pongKong, chows mahjong.Indexes) int {
+	return mahjong.Multiple(ctx, onHand, pongKong, chows)
+}
+
+func (xueZhan) MaxFan(opts *protocol.DeskOptions, onHand, pongKong, chows mahjong.Indexes) (int, int) {
+	return mahjong.MaxMultiple(opts, onHand, pongKong, chows)
+}
+
+// 下雨每家2分, 刮风每家1分
+func (xueZhan) GangScore(anGang bool) int {
+	if anGang {
+		return 2
+	}
+	return 1
+}
+
+func (xueZhan) ContinueAfterWin() bool {
+	return true
+}
@@ -0,0 +1,34 @@
+package game
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+// 生成每局的随机种子, 默认使用crypto/rand, 保证同一时间开局的牌桌牌序不同
+func cryptoSeed() int64 {
+	var buf [8]byte
+	if _, err := crand.Read(buf[:]); err != nil {
+		logger.Errorf("生成随机种子错误, 使用时间作为种子, Error=%v", err)
+		return time.Now().UnixNano()
+	}
+	return int64(binary.LittleEndian.Uint64(buf[:]))
+}
+
+// 调试模式下配置的固定种子, 为0时每局使用随机种子
+var debugSeed int64
+
+func deskSeeder() func() int64 {
+	if debugSeed != 0 {
+		return fixedSeed(debugSeed)
+	}
+	return cryptoSeed
+}
+
+// 固定种子, 用于测试和复现牌局
+func fixedSeed(seed int64) func() int64 {
+	return func() int64 {
+		return seed
+	}
+}
@@ -0,0 +1,27 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lonng/nanoserver/protocol"
+)
+
+func TestFixedSeedDeal(t *testing.T) {
+	deal := func(seed int64) []interface{} {
+		d := NewDesk("123456", &protocol.DeskOptions{Mode: 4, MaxRound: 8}, 0)
+		d.setFixedSeed(seed)
+		d.reseed()
+		d.bankerTurn = d.rng.Intn(d.totalPlayerCount())
+		allTiles, hands, nextIndex := d.shuffle()
+		return []interface{}{d.bankerTurn, allTiles, hands, nextIndex, *d.dice}
+	}
+
+	a, b, c := deal(20181001), deal(20181001), deal(20181002)
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("same seed, different deal: %v %v", a, b)
+	}
+	if reflect.DeepEqual(a[1], c[1]) {
+		t.Fatalf("different seed, same tiles: %v", a[1])
+	}
+}
@@ -0,0 +1,167 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/lonng/nano/session"
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/pkg/constant"
+	"github.com/lonng/nanoserver/pkg/room"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+const defaultSpectatorLimit = 10
+
+// 每个房间的观战人数上限, 0表示关闭观战
+var spectatorLimit = defaultSpectatorLimit
+
+var (
+	watchDisabled = &protocol.JoinDeskResponse{Code: errorCode, Error: "观战功能未开启"}
+	watchFull     = &protocol.JoinDeskResponse{Code: errorCode, Error: "当前房间观战人数已满"}
+	watchInDesk   = &protocol.JoinDeskResponse{Code: errorCode, Error: "你当前正在房间中, 不能观战"}
+)
+
+// 观战者是否可以看到当前牌局, 开启隐藏时只能在每局结束后查看
+func (d *Desk) spectatorVisible() bool {
+	if !d.opts.HideSpectator {
+		return true
+	}
+
+	switch d.status() {
+	case constant.DeskStatusDuanPai, constant.DeskStatusQiPai, constant.DeskStatusPlaying:
+		return false
+	}
+	return true
+}
+
+// 广播公开消息, 玩家和观战者都可以收到
+func (d *Desk) broadcast(route string, v interface{}) error {
+	err := d.group.Broadcast(route, v)
+	if d.spectators.Count() > 0 && d.spectatorVisible() {
+		d.spectators.Broadcast(route, v)
+	}
+	return err
+}
+
+// 只发给观战者的消息, 用于发送隐藏了手牌的开局/摸牌消息
+func (d *Desk) broadcastSpectators(route string, v interface{}) {
+	if d.spectators.Count() > 0 && d.spectatorVisible() {
+		d.spectators.Broadcast(route, v)
+	}
+}
+
+// 隐藏手牌, 只保留数量
+func hiddenTiles(ids []int) []int {
+	hidden := make([]int, len(ids))
+	for i := range hidden {
+		hidden[i] = illegalTile
+	}
+	return hidden
+}
+
+func (d *Desk) addSpectator(p *Player) {
+	if p.watching != nil {
+		p.watching.removeSpectator(p)
+	}
+
+	d.spectators.Add(p.session)
+	p.watching = d
+	d.logger.Infof("玩家开始观战: UID=%d 观战人数=%d", p.uid, d.spectators.Count())
+}
+
+func (d *Desk) removeSpectator(p *Player) {
+	if p.session != nil {
+		d.spectators.Leave(p.session)
+	}
+	p.watching = nil
+	d.logger.Infof("玩家退出观战: UID=%d 观战人数=%d", p.uid, d.spectators.Count())
+}
+
+// 房间销毁时清除所有观战者
+func (d *Desk) clearSpectators() {
+	for _, uid := range d.spectators.Members() {
+		if p, ok := defaultManager.player(uid); ok && p.watching == d {
+			p.watching = nil
+		}
+	}
+	d.spectators.Close()
+}
+
+// 同步牌桌数据给观战者
+func (d *Desk) syncSpectator(s *session.Session) error {
+	if d.latestEnter != nil {
+		s.Push("onPlayerEnter", d.latestEnter)
+	}
+
+	if !d.spectatorVisible() {
+		return nil
+	}
+	return s.Push("onSyncDesk", d.syncData(nil))
+}
+
+// 观战房间
+func (manager *DeskManager) Watch(s *session.Session, data *protocol.JoinDeskRequest) error {
+	p, err := playerWithSession(s)
+	if err != nil {
+		return err
+	}
+
+	if spectatorLimit <= 0 {
+		return s.Response(watchDisabled)
+	}
+
+	if p.desk != nil {
+		return s.Response(watchInDesk)
+	}
+
+	d, ok := manager.desk(room.Number(data.DeskNo))
+	if !ok || d.isDestroy() {
+		return s.Response(deskNotFoundResponse)
+	}
+
+	// 俱乐部房间只有俱乐部成员可以观战
+	if d.clubId > 0 && !db.IsClubMember(d.clubId, s.UID()) {
+		return s.Response(&protocol.JoinDeskResponse{
+			Code:  errorCode,
+			Error: fmt.Sprintf("当前房间是俱乐部[%d]专属房间，俱乐部成员才可观战", d.clubId),
+		})
+	}
+
+	if p.watching != d {
+		if d.spectators.Count() >= spectatorLimit {
+			return s.Response(watchFull)
+		}
+		d.addSpectator(p)
+	}
+
+	err = s.Response(&protocol.JoinDeskResponse{
+		TableInfo: protocol.TableInfo{
+			DeskNo:    d.roomNo.String(),
+			CreatedAt: d.createdAt,
+			Creator:   d.creator,
+			Title:     d.title(),
+			Desc:      d.desc(true),
+			Status:    d.status(),
+			Round:     d.round,
+			Mode:      d.opts.Mode,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.syncSpectator(s)
+}
+
+// 退出观战
+func (manager *DeskManager) Unwatch(s *session.Session, _ []byte) error {
+	p, err := playerWithSession(s)
+	if err != nil {
+		return err
+	}
+
+	if p.watching != nil {
+		p.watching.removeSpectator(p)
+	}
+	return nil
+}
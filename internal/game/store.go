@@ -0,0 +1,100 @@
+package game
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lonng/nanoserver/pkg/room"
+)
+
+const (
+	storeBacklog = 256
+	storeExt     = ".json"
+)
+
+// 写入任务, data为nil表示删除
+type storeTask struct {
+	no   room.Number
+	data []byte
+}
+
+// 未完成房间的本地文件存储, 每个房间一个文件, 所有写操作在同一个goroutine中顺序执行,
+// 保证后保存的状态不会被之前的状态覆盖
+type deskStore struct {
+	dir    string
+	chTask chan storeTask
+}
+
+func newDeskStore(dir string) (*deskStore, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	s := &deskStore{
+		dir:    dir,
+		chTask: make(chan storeTask, storeBacklog),
+	}
+	go s.run()
+
+	return s, nil
+}
+
+func (s *deskStore) path(no room.Number) string {
+	return filepath.Join(s.dir, no.String()+storeExt)
+}
+
+func (s *deskStore) run() {
+	for t := range s.chTask {
+		path := s.path(t.no)
+		if t.data == nil {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				logger.Errorf("删除房间数据失败, 房号=%s, Error=%v", t.no, err)
+			}
+			continue
+		}
+
+		// 先写临时文件再重命名, 避免写到一半进程退出导致文件损坏
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, t.data, 0644); err != nil {
+			logger.Errorf("保存房间数据失败, 房号=%s, Error=%v", t.no, err)
+			continue
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			logger.Errorf("保存房间数据失败, 房号=%s, Error=%v", t.no, err)
+		}
+	}
+}
+
+func (s *deskStore) save(no room.Number, data []byte) {
+	s.chTask <- storeTask{no: no, data: data}
+}
+
+func (s *deskStore) remove(no room.Number) {
+	s.chTask <- storeTask{no: no}
+}
+
+// 读取所有保存的房间数据
+func (s *deskStore) loadAll() map[room.Number][]byte {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		logger.Errorf("读取房间数据目录失败, Error=%v", err)
+		return nil
+	}
+
+	result := map[room.Number][]byte{}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, storeExt) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			logger.Errorf("读取房间数据失败, 文件=%s, Error=%v", name, err)
+			continue
+		}
+		result[room.Number(strings.TrimSuffix(name, storeExt))] = data
+	}
+	return result
+}
@@ -0,0 +1,530 @@
+package game
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/scheduler"
+	"github.com/lonng/nano/session"
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/internal/game/history"
+	"github.com/lonng/nanoserver/pkg/async"
+	"github.com/lonng/nanoserver/pkg/room"
+	"github.com/lonng/nanoserver/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// 弃权玩家的阶段分数, 排在所有人后面
+const forfeitScore = math.MinInt32
+
+var (
+	tournamentNotFound      = &protocol.TournamentResponse{Code: errorCode, Error: "比赛不存在"}
+	tournamentClosed        = &protocol.TournamentResponse{Code: errorCode, Error: "当前不在报名时间内"}
+	tournamentFull          = &protocol.TournamentResponse{Code: errorCode, Error: "报名人数已满"}
+	tournamentRegistered    = &protocol.TournamentResponse{Code: errorCode, Error: "你已经报名该比赛"}
+	tournamentNotRegistered = &protocol.TournamentResponse{Code: errorCode, Error: "你没有报名该比赛"}
+	tournamentCardNotEnough = &protocol.TournamentResponse{Code: 30002, Error: deskCardNotEnoughMessage}
+	tournamentDraining      = &protocol.TournamentResponse{Code: 30004, Error: drainingMessage}
+)
+
+// 进行中的比赛, 所有字段只在逻辑线程中修改
+type tournament struct {
+	*model.Tournament
+	prizes  []int64
+	players []*model.TournamentPlayer // 按报名顺序
+
+	advance int                   // 本阶段晋级人数, 0表示决赛
+	desks   map[room.Number]*Desk // 本阶段还没有结束的牌桌
+	scores  map[int64]int         // 本阶段的分数
+
+	logger *log.Entry
+}
+
+func newTournament(t *model.Tournament, players []model.TournamentPlayer) *tournament {
+	ret := &tournament{
+		Tournament: t,
+		prizes:     db.DecodePrizes(t.Prizes),
+		desks:      map[room.Number]*Desk{},
+		scores:     map[int64]int{},
+		logger:     log.WithField("tournament", t.Id),
+	}
+	for i := range players {
+		ret.players = append(ret.players, &players[i])
+	}
+	return ret
+}
+
+func (t *tournament) player(uid int64) *model.TournamentPlayer {
+	for _, tp := range t.players {
+		if tp.Uid == uid && tp.Status != model.TournamentPlayerRefunded {
+			return tp
+		}
+	}
+	return nil
+}
+
+// 还没有被淘汰的玩家
+func (t *tournament) alive() []*model.TournamentPlayer {
+	ret := []*model.TournamentPlayer{}
+	for _, tp := range t.players {
+		if tp.Status == model.TournamentPlayerRegistered {
+			ret = append(ret, tp)
+		}
+	}
+	return ret
+}
+
+func (t *tournament) prize(rank int) int64 {
+	if rank < 1 || rank > len(t.prizes) {
+		return 0
+	}
+	return t.prizes[rank-1]
+}
+
+// 比赛的牌桌选项, 每个阶段打Round局, 按分数决定晋级
+func (t *tournament) deskOptions() *protocol.DeskOptions {
+	opts := &protocol.DeskOptions{
+		Mode:       t.Mode,
+		MaxRound:   t.Round,
+		MaxFan:     3,
+		Zimo:       "fan",
+		Ruleset:    protocol.RulesetXueZhan,
+		Pinghu:     t.Mode == ModeFours,
+		Timeout:    matchOperationTime,
+		Robot:      true,
+		RobotLevel: t.Level + 1,
+	}
+	if opts.RobotLevel > protocol.RobotLevelHard {
+		opts.RobotLevel = protocol.RobotLevelHard
+	}
+	return opts
+}
+
+func (t *tournament) save() {
+	data := *t.Tournament
+	async.Run(func() {
+		if err := db.UpdateTournament(&data); err != nil {
+			t.logger.Errorf("保存比赛状态失败, Error=%v", err)
+		}
+	})
+}
+
+func (t *tournament) push(uid int64, route string, v interface{}) {
+	if p, ok := defaultManager.player(uid); ok && p.session != nil {
+		p.session.Push(route, v)
+	}
+}
+
+// 开始新的阶段, 离线或者正在其他房间中的玩家视为本阶段弃权
+func (t *tournament) startStage() {
+	alive := t.alive()
+	t.Stage++
+	t.desks = map[room.Number]*Desk{}
+	t.scores = map[int64]int{}
+
+	// 每个阶段淘汰一半, 剩余人数不超过一桌时为决赛
+	t.advance = 0
+	if len(alive) > t.Mode {
+		t.advance = len(alive) / 2
+		if t.advance < t.Mode {
+			t.advance = t.Mode
+		}
+	}
+
+	seats := []*Player{}
+	for _, tp := range alive {
+		tp.Stage = t.Stage
+		p, ok := defaultManager.player(tp.Uid)
+		if !ok || p.session == nil || p.desk != nil {
+			t.scores[tp.Uid] = forfeitScore
+			t.logger.Infof("玩家弃权: UID=%d, 阶段=%d", tp.Uid, t.Stage)
+			continue
+		}
+		seats = append(seats, p)
+	}
+
+	rand.Shuffle(len(seats), func(i, j int) { seats[i], seats[j] = seats[j], seats[i] })
+	for len(seats) > 0 {
+		n := t.Mode
+		if n > len(seats) {
+			n = len(seats)
+		}
+		t.createDesk(seats[:n], len(alive))
+		seats = seats[n:]
+	}
+
+	t.logger.Infof("比赛第%d阶段开始, 人数=%d, 晋级人数=%d, 牌桌数=%d", t.Stage, len(alive), t.advance, len(t.desks))
+	t.save()
+
+	// 所有人都弃权
+	if len(t.desks) == 0 {
+		t.finishStage()
+	}
+}
+
+func (t *tournament) createDesk(players []*Player, total int) {
+	no := room.Next()
+	d := NewDesk(no, t.deskOptions(), -1)
+	d.tournament = t
+	d.createdAt = time.Now().Unix()
+	d.creator = players[0].Uid()
+
+	for _, p := range players {
+		if err := d.playerJoin(p.session, false); err != nil {
+			d.logger.Errorf("比赛玩家加入房间失败, UID=%d, Error=%s", p.Uid(), err.Error())
+		}
+	}
+	for len(d.players) < d.totalPlayerCount() {
+		d.addRobot(newRobot(d.opts.RobotLevel))
+	}
+
+	defaultDeskManager.setDesk(no, d)
+	t.desks[no] = d
+
+	stage := &protocol.TournamentStage{
+		Id:        t.Id,
+		Name:      t.Name,
+		Stage:     t.Stage,
+		Players:   total,
+		Advance:   t.advance,
+		RestDesks: len(t.desks),
+		TableInfo: &protocol.TableInfo{
+			DeskNo:    d.roomNo.String(),
+			CreatedAt: d.createdAt,
+			Creator:   d.creator,
+			Title:     d.title(),
+			Desc:      d.desc(true),
+			Status:    d.status(),
+			Round:     d.round,
+			Mode:      d.opts.Mode,
+		},
+	}
+	for _, p := range players {
+		if s := p.session; s != nil {
+			s.Push(protocol.RouteTournamentStage, stage)
+		}
+	}
+}
+
+// 牌桌结束, 在房间销毁时调用, 所有牌桌结束后进入下一阶段
+func (t *tournament) deskFinished(d *Desk, players []*Player, stats map[int64]*history.Record) {
+	if t.desks[d.roomNo] != d {
+		return
+	}
+	delete(t.desks, d.roomNo)
+
+	waiting := &protocol.TournamentStage{
+		Id:        t.Id,
+		Name:      t.Name,
+		Stage:     t.Stage,
+		Players:   len(t.alive()),
+		Advance:   t.advance,
+		RestDesks: len(t.desks),
+	}
+	for _, p := range players {
+		tp := t.player(p.Uid())
+		if tp == nil {
+			continue
+		}
+
+		score := 0
+		if r, ok := stats[tp.Uid]; ok {
+			score = r.TotalScore
+		}
+		t.scores[tp.Uid] = score
+		tp.Score += score
+		t.push(tp.Uid, protocol.RouteTournamentStage, waiting)
+	}
+
+	d.logger.Infof("比赛牌桌结束, 比赛=%d, 阶段=%d, 剩余牌桌=%d", t.Id, t.Stage, len(t.desks))
+	if len(t.desks) == 0 {
+		// 等待房间销毁完成后再开始下一阶段
+		scheduler.PushTask(t.finishStage)
+	}
+}
+
+// 本阶段所有牌桌结束, 按本阶段分数排名, 淘汰的玩家按名次发放奖励
+func (t *tournament) finishStage() {
+	if t.Status != model.TournamentStatusRunning {
+		return
+	}
+
+	if isDraining() {
+		t.cancel()
+		return
+	}
+
+	alive := t.alive()
+	sort.SliceStable(alive, func(i, j int) bool {
+		si, sj := t.scores[alive[i].Uid], t.scores[alive[j].Uid]
+		if si != sj {
+			return si > sj
+		}
+		return alive[i].Score > alive[j].Score
+	})
+
+	for i, tp := range alive {
+		if t.advance > 0 && i < t.advance {
+			continue
+		}
+
+		tp.Rank = i + 1
+		tp.Prize = t.prize(tp.Rank)
+		tp.Status = model.TournamentPlayerEliminated
+		if t.advance == 0 {
+			tp.Status = model.TournamentPlayerFinished
+		}
+		t.payout(tp)
+	}
+
+	if t.advance > 0 {
+		t.startStage()
+		return
+	}
+
+	t.Status = model.TournamentStatusFinished
+	t.FinishedAt = time.Now().Unix()
+	t.save()
+	delete(defaultTournamentManager.tournaments, t.Id)
+	t.logger.Infof("比赛结束, 共%d个阶段", t.Stage)
+}
+
+func (t *tournament) payout(tp *model.TournamentPlayer) {
+	data := *tp
+	result := &protocol.TournamentResult{Id: t.Id, Name: t.Name, Rank: tp.Rank, Prize: tp.Prize}
+	t.logger.Infof("玩家比赛结束: UID=%d, 名次=%d, 奖励=%d", tp.Uid, tp.Rank, tp.Prize)
+
+	async.Run(func() {
+		var (
+			coin int64
+			err  error
+		)
+		if data.Prize > 0 {
+			coin, err = db.TournamentPayout(&data)
+		} else {
+			err = db.UpdateTournamentPlayer(&data)
+		}
+		if err != nil {
+			t.logger.Errorf("保存比赛名次失败, UID=%d, Error=%v", data.Uid, err)
+		}
+
+		scheduler.PushTask(func() {
+			if p, ok := defaultManager.player(data.Uid); ok && data.Prize > 0 && err == nil {
+				p.coin = coin
+				if s := p.session; s != nil {
+					s.Push("onCoinChange", &protocol.CoinChangeInformation{Coin: coin})
+				}
+			}
+			t.push(data.Uid, protocol.RouteTournamentResult, result)
+		})
+	})
+}
+
+// 取消比赛, 没有拿到名次的玩家全部退还报名费
+func (t *tournament) cancel() {
+	t.logger.Infof("取消比赛, 状态=%d, 阶段=%d", t.Status, t.Stage)
+	t.Status = model.TournamentStatusCanceled
+	t.FinishedAt = time.Now().Unix()
+	t.save()
+	delete(defaultTournamentManager.tournaments, t.Id)
+
+	for _, tp := range t.players {
+		if tp.Status == model.TournamentPlayerRefunded || tp.Rank > 0 {
+			continue
+		}
+		t.refund(tp, &protocol.TournamentResult{Id: t.Id, Name: t.Name, Canceled: true})
+	}
+}
+
+// 退还报名费, 完成后通知玩家
+func (t *tournament) refund(tp *model.TournamentPlayer, v interface{}) {
+	tp.Status = model.TournamentPlayerRefunded
+	data, fee := *tp, t.EntryFee
+	async.Run(func() {
+		coin, err := db.RefundTournament(&data, fee)
+		if err != nil {
+			t.logger.Errorf("退还报名费失败, UID=%d, Error=%v", data.Uid, err)
+		}
+
+		scheduler.PushTask(func() {
+			p, ok := defaultManager.player(data.Uid)
+			if ok && err == nil {
+				p.coin = coin
+			}
+			if v != nil {
+				t.push(data.Uid, protocol.RouteTournamentResult, v)
+			}
+		})
+	})
+}
+
+// TournamentManager 比赛报名以及赛程推进
+type TournamentManager struct {
+	component.Base
+	tournaments map[int64]*tournament
+}
+
+var defaultTournamentManager = NewTournamentManager()
+
+func NewTournamentManager() *TournamentManager {
+	return &TournamentManager{tournaments: map[int64]*tournament{}}
+}
+
+func (m *TournamentManager) AfterInit() {
+	// 每秒检查一次是否到了开赛时间
+	scheduler.NewTimer(time.Second, m.tick)
+}
+
+func (m *TournamentManager) tick() {
+	now := time.Now().Unix()
+	for _, t := range m.tournaments {
+		if t.Status != model.TournamentStatusRegistering || now < t.StartAt {
+			continue
+		}
+
+		count := len(t.alive())
+		if count < t.MinPlayers || count < 1 || isDraining() {
+			t.logger.Infof("报名人数不足, 取消比赛: 报名人数=%d, 最少人数=%d", count, t.MinPlayers)
+			t.cancel()
+			continue
+		}
+
+		t.Status = model.TournamentStatusRunning
+		t.startStage()
+	}
+}
+
+func (m *TournamentManager) add(t *tournament) {
+	// 服务器重启前进行中的比赛无法恢复
+	if t.Status == model.TournamentStatusRunning {
+		t.cancel()
+		return
+	}
+	m.tournaments[t.Id] = t
+	t.logger.Infof("加载比赛: %s, 开赛时间=%s", t.Name, time.Unix(t.StartAt, 0).Format("2006-01-02 15:04:05"))
+}
+
+// AddTournament 添加新创建的比赛, 由web服务调用
+func AddTournament(t *model.Tournament) {
+	data := *t
+	scheduler.PushTask(func() {
+		defaultTournamentManager.add(newTournament(&data, nil))
+	})
+}
+
+// LoadTournaments 数据库启动后加载报名中的比赛, 进行中的比赛取消并退还报名费
+func LoadTournaments() {
+	async.Run(func() {
+		list, err := db.ActiveTournaments()
+		if err != nil {
+			logger.Errorf("加载比赛失败, Error=%v", err)
+			return
+		}
+
+		for i := range list {
+			t := &list[i]
+			players, err := db.TournamentPlayers(t.Id)
+			if err != nil {
+				logger.Errorf("加载比赛玩家失败, 比赛=%d, Error=%v", t.Id, err)
+				continue
+			}
+			scheduler.PushTask(func() {
+				defaultTournamentManager.add(newTournament(t, players))
+			})
+		}
+	})
+}
+
+// 报名比赛, 报名费使用房卡支付
+func (m *TournamentManager) Register(s *session.Session, req *protocol.TournamentRequest) error {
+	p, err := playerWithSession(s)
+	if err != nil {
+		return err
+	}
+
+	if isDraining() {
+		return s.Response(tournamentDraining)
+	}
+
+	t, ok := m.tournaments[req.Id]
+	if !ok {
+		return s.Response(tournamentNotFound)
+	}
+
+	now := time.Now().Unix()
+	if t.Status != model.TournamentStatusRegistering || now < t.RegisterAt || now >= t.StartAt {
+		return s.Response(tournamentClosed)
+	}
+	if t.player(p.uid) != nil {
+		return s.Response(tournamentRegistered)
+	}
+	if t.MaxPlayers > 0 && len(t.alive()) >= t.MaxPlayers {
+		return s.Response(tournamentFull)
+	}
+	if p.coin < t.EntryFee {
+		return s.Response(tournamentCardNotEnough)
+	}
+
+	// 先占用名额, 数据库失败时再移除
+	tp := &model.TournamentPlayer{
+		TournamentId: t.Id,
+		Uid:          p.uid,
+		Name:         p.name,
+		Status:       model.TournamentPlayerRegistered,
+		RegisterAt:   now,
+	}
+	t.players = append(t.players, tp)
+
+	mid, data, fee := s.LastMid(), *tp, t.EntryFee
+	async.Run(func() {
+		coin, err := db.RegisterTournament(&data, fee)
+		scheduler.PushTask(func() {
+			if err != nil {
+				p.logger.Errorf("报名比赛失败, 比赛=%d, Error=%v", t.Id, err)
+				for i := range t.players {
+					if t.players[i] == tp {
+						t.players = append(t.players[:i], t.players[i+1:]...)
+						break
+					}
+				}
+				s.ResponseMID(mid, &protocol.TournamentResponse{Code: errorCode, Error: err.Error()})
+				return
+			}
+
+			tp.Id = data.Id
+			p.coin = coin
+			p.logger.Infof("报名比赛: %d, 报名人数=%d", t.Id, len(t.alive()))
+			s.ResponseMID(mid, &protocol.TournamentResponse{Coin: coin})
+		})
+	})
+	return nil
+}
+
+// 开赛前退赛, 退还报名费
+func (m *TournamentManager) Unregister(s *session.Session, req *protocol.TournamentRequest) error {
+	p, err := playerWithSession(s)
+	if err != nil {
+		return err
+	}
+
+	t, ok := m.tournaments[req.Id]
+	if !ok {
+		return s.Response(tournamentNotFound)
+	}
+	if t.Status != model.TournamentStatusRegistering {
+		return s.Response(tournamentClosed)
+	}
+
+	tp := t.player(p.uid)
+	if tp == nil || tp.Id == 0 {
+		return s.Response(tournamentNotRegistered)
+	}
+
+	p.logger.Infof("退出比赛: %d", t.Id)
+	t.refund(tp, nil)
+	return s.Response(protocol.SuccessResponse)
+}
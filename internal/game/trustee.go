@@ -0,0 +1,176 @@
+package game
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/lonng/nano/scheduler"
+	"github.com/lonng/nano/session"
+	"github.com/lonng/nanoserver/pkg/constant"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+const (
+	maxOperationTimeout = 300 // 操作超时时间的上限(秒)
+	defaultPhaseTimeout = 30  // 牌桌没有设置操作时间时, 齐牌/定缺的最长等待时间(秒)
+
+	// 内部使用的操作类型, 通知正在等待的玩家立即自动操作
+	optypeAuto = -1
+)
+
+func (p *Player) isTrustee() bool {
+	return atomic.LoadInt32(&p.trustee) == 1
+}
+
+// 开启/取消托管, 状态变化时通知牌桌上的所有玩家
+func (p *Player) setTrustee(trustee bool) {
+	var v int32
+	if trustee {
+		v = 1
+	}
+	if atomic.SwapInt32(&p.trustee, v) == v {
+		return
+	}
+
+	p.logger.Infof("玩家托管状态变化: 托管=%t", trustee)
+	if p.desk == nil {
+		return
+	}
+	p.desk.broadcast(protocol.RouteTrustee, &protocol.Trustee{Uid: p.uid, Trustee: trustee})
+}
+
+// 齐牌/定缺阶段超时后, 未完成的玩家自动齐牌或使用默认定缺, 在逻辑线程执行
+func (d *Desk) phaseTimeout(status constant.DeskStatus) {
+	t := d.opts.Timeout
+	if t <= 0 {
+		t = defaultPhaseTimeout
+	}
+
+	round := d.round
+	scheduler.NewAfterTimer(time.Duration(t)*time.Second, func() {
+		// 已经进入下一阶段或者下一局
+		if d.round != round || d.status() != status {
+			return
+		}
+
+		switch status {
+		case constant.DeskStatusDuanPai:
+			for _, p := range d.players {
+				if !d.prepare.isSorted(p.Uid()) {
+					p.logger.Infof("玩家齐牌超时, 自动齐牌")
+					d.prepare.sorted(p.Uid())
+				}
+			}
+			d.checkQiPai()
+
+		case constant.DeskStatusQiPai:
+			for _, p := range d.players {
+				if p.ctx.Que < 1 {
+					p.logger.Infof("玩家定缺超时, 使用默认定缺")
+					d.dingQue(p, p.selectDefaultQue())
+				}
+			}
+		}
+	})
+}
+
+// 等待玩家操作, 返回false表示房间已经解散
+// 托管中的玩家直接自动操作, 超过牌桌设置的操作时间后自动操作并进入托管
+func (p *Player) waitOperation() (*protocol.OpChoosed, bool) {
+	if p.isTrustee() {
+		return p.autoChoice(), true
+	}
+
+	var timeout <-chan time.Time
+	if t := p.desk.opts.Timeout; t > 0 && !p.isRobot() {
+		timer := time.NewTimer(time.Duration(t) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	} else if p.isRobot() {
+		timer := time.NewTimer(robotMaxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	atomic.StoreInt32(&p.waiting, 1)
+	defer atomic.StoreInt32(&p.waiting, 0)
+
+	select {
+	case op, ok := <-p.chOperation:
+		if !ok {
+			return nil, false
+		}
+		if op.Type == optypeAuto {
+			return p.autoChoice(), true
+		}
+		return op, true
+
+	case <-p.desk.die:
+		return nil, false
+
+	case <-timeout:
+		if p.isRobot() {
+			p.logger.Warnf("机器人操作超时, 自动操作")
+			return p.autoChoice(), true
+		}
+		p.logger.Infof("玩家操作超时, 自动操作并进入托管")
+		p.setTrustee(true)
+		return p.autoChoice(), true
+	}
+}
+
+// 根据最后一次提示自动操作: 需要出牌时打出新摸的牌, 碰/杠/吃/胡全部选择过
+func (p *Player) autoChoice() *protocol.OpChoosed {
+	if hint := p.ctx.LastHint; hint != nil {
+		for _, op := range hint.Ops {
+			if op.Type == protocol.OptypeChu {
+				return &protocol.OpChoosed{Type: protocol.OptypeChu, TileID: p.autoDiscard()}
+			}
+		}
+	}
+	return &protocol.OpChoosed{Type: protocol.OptypePass, TileID: p.ctx.NewDrawingID}
+}
+
+// 自动出牌: 优先打缺, 其次打出新摸的牌, 碰/吃之后打出最后一张手牌
+func (p *Player) autoDiscard() int {
+	hand := p.handTiles()
+	if que := p.ctx.Que; que > 0 {
+		for _, t := range hand {
+			if t.Suit+1 == que {
+				return t.Id
+			}
+		}
+	}
+
+	for _, t := range hand {
+		if t.Id == p.ctx.NewDrawingID {
+			return t.Id
+		}
+	}
+
+	return hand[len(hand)-1].Id
+}
+
+// 玩家开启/取消托管
+func (manager *DeskManager) Trustee(s *session.Session, msg *protocol.TrusteeRequest) error {
+	p, err := playerWithSession(s)
+	if err != nil {
+		return err
+	}
+
+	if p.desk == nil {
+		return errutil.ErrIllegalDeskStatus
+	}
+
+	p.setTrustee(msg.Trustee)
+
+	// 正在等待该玩家操作, 立即自动操作
+	if msg.Trustee && atomic.LoadInt32(&p.waiting) == 1 {
+		select {
+		case p.chOperation <- &protocol.OpChoosed{Type: optypeAuto}:
+		default:
+		}
+	}
+	return nil
+}
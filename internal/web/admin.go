@@ -0,0 +1,396 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/algoutil"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/pkg/token"
+	"github.com/lonng/nanoserver/protocol"
+	"github.com/lonng/nex"
+	"github.com/spf13/viper"
+)
+
+// 后台权限, 每个路由需要其中一种权限
+const (
+	permView     = iota + 1 // 查看在线, 统计和玩家信息
+	permOperate             // 踢人, 广播, 重置玩家, 停服维护和修改房卡消耗
+	permRecharge            // 给玩家充值
+	permAdmin               // 管理后台账号, 查看操作日志
+)
+
+// 每个角色拥有的权限
+var rolePerms = map[int][]int{
+	model.AdminRoleViewer:   {permView},
+	model.AdminRoleOperator: {permView, permOperate},
+	model.AdminRoleFinance:  {permView, permRecharge},
+	model.AdminRoleSuper:    {permView, permOperate, permRecharge, permAdmin},
+}
+
+// 操作日志类型
+const (
+	auditLogin       = "login"
+	auditKick        = "kick"
+	auditRecharge    = "recharge"
+	auditBroadcast   = "broadcast"
+	auditReset       = "reset"
+	auditDrain       = "drain"
+	auditConsume     = "consume"
+	auditAdminCreate = "admin.create"
+	auditAdminUpdate = "admin.update"
+	auditApiKey      = "admin.apikey"
+	auditProduct     = "product.save"
+	auditClubOwner   = "club.owner"
+	auditClubCharge  = "club.recharge"
+	auditAgentCreate = "agent.create"
+	auditAgentCard   = "agent.card"
+	auditAgentLevel  = "agent.level"
+	auditOrderRefund = "order.refund"
+)
+
+const maxAuditDetail = 255
+
+type adminKey struct{}
+
+// 当前请求的管理员
+type adminSession struct {
+	admin  *model.Admin
+	remote string
+}
+
+func currentAdmin(ctx context.Context) *adminSession {
+	s, _ := ctx.Value(adminKey{}).(*adminSession)
+	return s
+}
+
+func hasPerm(role, perm int) bool {
+	for _, p := range rolePerms[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func apiKeyDigest(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// 请求头X-Api-Key携带API Key, 或者请求头X-Token/参数token携带登录后获取的token
+func authenticate(r *http.Request) (*model.Admin, error) {
+	var (
+		a   *model.Admin
+		err error
+	)
+
+	if key := r.Header.Get("X-Api-Key"); key != "" {
+		a, err = db.QueryAdminByApiKey(apiKeyDigest(key))
+	} else {
+		t := r.Header.Get("X-Token")
+		if t == "" {
+			t = r.URL.Query().Get("token")
+		}
+		if t == "" {
+			return nil, errutil.ErrTokenNotFound
+		}
+
+		var claims *token.Claims
+		if claims, err = token.ParseScope(t, token.ScopeAdmin); err != nil {
+			return nil, err
+		}
+		a, err = db.QueryAdmin(claims.Uid)
+	}
+
+	if err != nil {
+		if err == errutil.ErrAdminNotFound {
+			return nil, errutil.ErrPermissionDenied
+		}
+		return nil, err
+	}
+	if a.Status != db.StatusNormal {
+		return nil, errutil.ErrPermissionDenied
+	}
+	return a, nil
+}
+
+// 校验管理员身份以及是否拥有路由需要的权限
+func authorize(perm int) nex.BeforeFunc {
+	return func(ctx context.Context, r *http.Request) (context.Context, error) {
+		a, err := authenticate(r)
+		if err != nil {
+			logger.Warnf("后台认证失败, RemoteAddr=%s, URL=%s, Error=%v", r.RemoteAddr, r.RequestURI, err)
+			return ctx, err
+		}
+
+		if !hasPerm(a.Role, perm) {
+			logger.Warnf("后台权限不足, 管理员=%s, 角色=%d, URL=%s", a.Account, a.Role, r.RequestURI)
+			return ctx, errutil.ErrPermissionDenied
+		}
+
+		return context.WithValue(ctx, adminKey{}, &adminSession{admin: a, remote: r.RemoteAddr}), nil
+	}
+}
+
+// 记录后台操作日志, target为被操作的玩家或者管理员
+func audit(ctx context.Context, action string, target int64, format string, args ...interface{}) {
+	s := currentAdmin(ctx)
+	if s == nil {
+		return
+	}
+
+	detail := fmt.Sprintf(format, args...)
+	if utf8.RuneCountInString(detail) > maxAuditDetail {
+		detail = string([]rune(detail)[:maxAuditDetail])
+	}
+
+	logger.Infof("后台操作: 管理员=%s, 操作=%s, 目标=%d, %s", s.admin.Account, action, target, detail)
+	db.InsertAdminAudit(&model.AdminAudit{
+		AdminId:    s.admin.Id,
+		Account:    s.admin.Account,
+		Action:     action,
+		Target:     target,
+		Detail:     detail,
+		RemoteAddr: s.remote,
+		CreatedAt:  time.Now().Unix(),
+	})
+}
+
+// 还没有任何管理员账号时使用配置创建超级管理员, 没有配置密码时随机生成
+func setupAdmin() {
+	n, err := db.AdminCount()
+	if err != nil {
+		logger.Errorf("查询管理员数量失败, Error=%v", err)
+		return
+	}
+	if n > 0 {
+		return
+	}
+
+	account := viper.GetString("admin.account")
+	if account == "" {
+		account = "admin"
+	}
+	password := viper.GetString("admin.password")
+	if password == "" {
+		key, err := randomKey()
+		if err != nil {
+			logger.Errorf("生成管理员密码失败, Error=%v", err)
+			return
+		}
+		password = key[:12]
+		logger.Warnf("未配置超级管理员密码, 自动生成的密码: %s, 请登录后立即修改", password)
+	}
+
+	hash, salt := algoutil.PasswordHash(password)
+	a := &model.Admin{
+		Account:   account,
+		Name:      account,
+		Password:  hash,
+		Salt:      salt,
+		Role:      model.AdminRoleSuper,
+		Status:    db.StatusNormal,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := db.InsertAdmin(a); err != nil {
+		logger.Errorf("创建超级管理员失败, Error=%v", err)
+		return
+	}
+	logger.Infof("创建超级管理员: %s", account)
+}
+
+func adminDetail(a *model.Admin) protocol.AdminDetail {
+	return protocol.AdminDetail{
+		Id:        a.Id,
+		Account:   a.Account,
+		Name:      a.Name,
+		Role:      a.Role,
+		Status:    a.Status,
+		CreatedAt: a.CreatedAt,
+	}
+}
+
+func adminLogin(r *http.Request, data *protocol.AdminLoginRequest) (*protocol.AdminLoginResponse, error) {
+	if data.Account == "" || data.Password == "" {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	a, err := db.QueryAdminByAccount(data.Account)
+	if err != nil {
+		if err == errutil.ErrAdminNotFound {
+			return nil, errutil.ErrUserNameNotFound
+		}
+		return nil, err
+	}
+
+	if !algoutil.VerifyPassword(data.Password, a.Salt, a.Password) {
+		logger.Warnf("管理员登录密码错误, 账号=%s, RemoteAddr=%s", data.Account, r.RemoteAddr)
+		return nil, errutil.ErrWrongPassword
+	}
+	if a.Status != db.StatusNormal {
+		return nil, errutil.ErrPermissionDenied
+	}
+
+	t, exp, err := token.NewScope(a.Id, token.ScopeAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.WithValue(context.Background(), adminKey{}, &adminSession{admin: a, remote: r.RemoteAddr})
+	audit(ctx, auditLogin, a.Id, "管理员登录")
+	return &protocol.AdminLoginResponse{Token: t, Expires: exp, Detail: adminDetail(a)}, nil
+}
+
+func adminInfo(ctx context.Context) (*protocol.AdminDetailResponse, error) {
+	return &protocol.AdminDetailResponse{Detail: adminDetail(currentAdmin(ctx).admin)}, nil
+}
+
+func validAdminRole(role int) bool {
+	return role >= model.AdminRoleViewer && role <= model.AdminRoleSuper
+}
+
+func createAdmin(ctx context.Context, data *protocol.CreateAdminRequest) (*protocol.AdminDetailResponse, error) {
+	data.Account = strings.TrimSpace(data.Account)
+	if data.Account == "" || len(data.Account) > 32 || len(data.Password) < 6 || !validAdminRole(data.Role) {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	hash, salt := algoutil.PasswordHash(data.Password)
+	a := &model.Admin{
+		Account:   data.Account,
+		Name:      data.Name,
+		Password:  hash,
+		Salt:      salt,
+		Role:      data.Role,
+		Status:    db.StatusNormal,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := db.InsertAdmin(a); err != nil {
+		return nil, err
+	}
+
+	audit(ctx, auditAdminCreate, a.Id, "新增管理员: 账号=%s, 角色=%d", a.Account, a.Role)
+	return &protocol.AdminDetailResponse{Detail: adminDetail(a)}, nil
+}
+
+// 修改管理员的角色, 状态或者密码, 不能修改自己的角色和状态
+func updateAdmin(ctx context.Context, data *protocol.UpdateAdminRequest) (*protocol.AdminDetailResponse, error) {
+	if !validAdminRole(data.Role) || (data.Status != db.StatusNormal && data.Status != db.StatusFreezed) ||
+		(data.Password != "" && len(data.Password) < 6) {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	a, err := db.QueryAdmin(data.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	self := currentAdmin(ctx).admin
+	if a.Id == self.Id && (a.Role != data.Role || a.Status != data.Status) {
+		return nil, errutil.ErrPermissionDenied
+	}
+
+	a.Role, a.Status = data.Role, data.Status
+	cols := []string{"role", "status"}
+	if data.Password != "" {
+		a.Password, a.Salt = algoutil.PasswordHash(data.Password)
+		cols = append(cols, "password", "salt")
+	}
+	if err := db.UpdateAdmin(a, cols...); err != nil {
+		return nil, err
+	}
+
+	// 冻结或者修改密码后之前签发的token全部失效
+	if a.Status != db.StatusNormal || data.Password != "" {
+		token.RevokeScope(a.Id, token.ScopeAdmin)
+	}
+
+	audit(ctx, auditAdminUpdate, a.Id, "修改管理员: 账号=%s, 角色=%d, 状态=%d, 修改密码=%t",
+		a.Account, a.Role, a.Status, data.Password != "")
+	return &protocol.AdminDetailResponse{Detail: adminDetail(a)}, nil
+}
+
+// 重新生成当前管理员的API Key, 旧的API Key立即失效
+func resetApiKey(ctx context.Context) (*protocol.AdminApiKeyResponse, error) {
+	a := currentAdmin(ctx).admin
+
+	key, err := randomKey()
+	if err != nil {
+		return nil, err
+	}
+
+	a.ApiKey = apiKeyDigest(key)
+	if err := db.UpdateAdmin(a, "api_key"); err != nil {
+		return nil, err
+	}
+
+	audit(ctx, auditApiKey, a.Id, "重新生成API Key")
+	return &protocol.AdminApiKeyResponse{ApiKey: key}, nil
+}
+
+func adminList(form *nex.Form) (*protocol.AdminListResponse, error) {
+	offset := form.IntOrDefault("offset", 0)
+	count := form.IntOrDefault("count", 20)
+	if offset < 0 || count <= 0 || count > 100 {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	list, total, err := db.AdminList(offset, count)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]protocol.AdminDetail, len(list))
+	for i := range list {
+		data[i] = adminDetail(&list[i])
+	}
+	return &protocol.AdminListResponse{Data: data, Total: total}, nil
+}
+
+func adminAudits(form *nex.Form) (*protocol.AdminAuditResponse, error) {
+	adminId := form.Int64OrDefault("admin", 0)
+	action := form.Get("action")
+	offset := form.IntOrDefault("offset", 0)
+	count := form.IntOrDefault("count", 20)
+	if offset < 0 || count <= 0 || count > 100 {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	list, total, err := db.AdminAudits(adminId, action, offset, count)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]protocol.AdminAudit, len(list))
+	for i, l := range list {
+		data[i] = protocol.AdminAudit{
+			Id:         l.Id,
+			AdminId:    l.AdminId,
+			Account:    l.Account,
+			Action:     l.Action,
+			Target:     l.Target,
+			Detail:     l.Detail,
+			RemoteAddr: l.RemoteAddr,
+			CreatedAt:  l.CreatedAt,
+		}
+	}
+	return &protocol.AdminAuditResponse{Data: data, Total: total}, nil
+}
@@ -0,0 +1,96 @@
+package web
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/internal/web/api"
+	"github.com/lonng/nanoserver/pkg/algoutil"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
+	"github.com/lonng/nex"
+)
+
+// 新增代理
+func registerAgentHandler(ctx context.Context, data *protocol.RegisterAgentRequest) (*protocol.AgentDetailResponse, error) {
+	data.Account = strings.TrimSpace(data.Account)
+	if data.Account == "" || len(data.Account) > 32 || len(data.Password) < 6 ||
+		data.Level < 0 || data.Discount < 0 || data.Discount > 100 {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	hash, salt := algoutil.PasswordHash(data.Password)
+	a := &model.Agent{
+		Name:          data.Name,
+		Account:       data.Account,
+		Password:      hash,
+		Salt:          salt,
+		Status:        db.StatusNormal,
+		Extra:         data.Extra,
+		Level:         data.Level,
+		Discount:      data.Discount,
+		CreateAt:      time.Now().Unix(),
+		CreateAccount: currentAdmin(ctx).admin.Account,
+	}
+	if err := db.InsertAgent(a); err != nil {
+		return nil, err
+	}
+
+	audit(ctx, auditAgentCreate, a.Id, "新增代理: 账号=%s, 等级=%d, 佣金比例=%d", a.Account, a.Level, a.Discount)
+	return &protocol.AgentDetailResponse{Detail: api.AgentDetail(a)}, nil
+}
+
+func agentListHandler(form *nex.Form) (*protocol.AgentListResponse, error) {
+	offset := form.IntOrDefault("offset", 0)
+	count := form.IntOrDefault("count", 20)
+	if offset < 0 || count <= 0 || count > 100 {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	list, total, err := db.AgentList(offset, count)
+	if err != nil {
+		return nil, err
+	}
+
+	agents := make([]protocol.AgentDetail, len(list))
+	for i := range list {
+		agents[i] = api.AgentDetail(&list[i])
+	}
+	return &protocol.AgentListResponse{Agents: agents, Total: total}, nil
+}
+
+// 增加代理库存, 操作者为当前登录的管理员
+func addAgentCardHandler(ctx context.Context, data *protocol.AgentCardRequest) (*protocol.AgentRechargeResponse, error) {
+	s := currentAdmin(ctx)
+	remain, err := db.AgentAddCard(&model.AdminRecharge{
+		AgentId:      data.AgentId,
+		AdminId:      strconv.FormatInt(s.admin.Id, 10),
+		AdminName:    s.admin.Name,
+		AdminAccount: s.admin.Account,
+		CardCount:    data.CardCount,
+		Extra:        data.Extra,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	audit(ctx, auditAgentCard, data.AgentId, "增加代理库存: 数量=%d, 剩余库存=%d, 备注=%s", data.CardCount, remain, data.Extra)
+	return &protocol.AgentRechargeResponse{CardCount: remain}, nil
+}
+
+func setAgentLevelHandler(ctx context.Context, data *protocol.AgentLevelRequest) (protocol.StringResponse, error) {
+	if data.Level < 0 || data.Discount < 0 || data.Discount > 100 {
+		return protocol.StringResponse{}, errutil.ErrInvalidParameter
+	}
+
+	if err := db.UpdateAgentLevel(data.AgentId, data.Level, data.Discount); err != nil {
+		return protocol.StringResponse{}, err
+	}
+
+	audit(ctx, auditAgentLevel, data.AgentId, "修改代理等级: 等级=%d, 佣金比例=%d", data.Level, data.Discount)
+	return protocol.SuccessResponse, nil
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/internal/game"
+	"github.com/lonng/nanoserver/pkg/algoutil"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/pkg/token"
+	"github.com/lonng/nanoserver/protocol"
+	"github.com/lonng/nex"
+	"github.com/spf13/viper"
+)
+
+// 代理佣金等级
+type commissionTier struct {
+	level int
+	rate  int // 佣金比例(%)
+}
+
+var commissionTiers = []commissionTier{{0, 5}, {1, 10}, {2, 15}, {3, 20}}
+
+func MakeAgentService() http.Handler {
+	if cfg := viper.GetString("agent.commission"); cfg != "" {
+		setCommissionTiers(cfg)
+	}
+
+	router := mux.NewRouter()
+	router.Handle("/v1/agent/login", nex.Handler(agentLogin)).Methods("POST")          //代理登录
+	router.Handle("/v1/agent/info", nex.Handler(agentInfo)).Methods("GET")             //代理信息, 参数token
+	router.Handle("/v1/agent/recharge", nex.Handler(agentRecharge)).Methods("POST")    //给玩家充值房卡
+	router.Handle("/v1/agent/club", nex.Handler(agentRechargeClub)).Methods("POST")    //给俱乐部充值房卡
+	router.Handle("/v1/agent/recharges", nex.Handler(agentRecharges)).Methods("GET")   //充值记录, 参数token, offset, count
+	router.Handle("/v1/agent/commission", nex.Handler(agentCommission)).Methods("GET") //佣金汇总, 参数token, from, to
+	return router
+}
+
+// 设置代理佣金等级, 格式: 等级/佣金比例, 使用逗号隔开, 例如: 0/5,1/10,2/15
+func setCommissionTiers(cfg string) {
+	tiers := []commissionTier{}
+	for _, c := range strings.Split(cfg, ",") {
+		parts := strings.Split(c, "/")
+		if len(parts) < 2 {
+			logger.Warnf("无效的佣金配置: %s", c)
+			return
+		}
+		level, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil || level < 0 {
+			logger.Warnf("无效的佣金配置: %s", c)
+			return
+		}
+		rate, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || rate < 0 || rate > 100 {
+			logger.Warnf("无效的佣金配置: %s", c)
+			return
+		}
+		tiers = append(tiers, commissionTier{level: level, rate: rate})
+	}
+
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].level < tiers[j].level })
+	commissionTiers = tiers
+	logger.Infof("当前代理佣金配置: %+v", tiers)
+}
+
+// 代理的佣金比例: 单独设置了比例的以设置为准, 否则取不高于代理等级的最高一档
+func commissionRate(a *model.Agent) int {
+	if a.Discount > 0 {
+		return a.Discount
+	}
+
+	rate := 0
+	for _, t := range commissionTiers {
+		if t.level > a.Level {
+			break
+		}
+		rate = t.rate
+	}
+	return rate
+}
+
+// AgentDetail 代理信息, 包括当前的佣金比例
+func AgentDetail(a *model.Agent) protocol.AgentDetail {
+	return protocol.AgentDetail{
+		Id:        a.Id,
+		Name:      a.Name,
+		Account:   a.Account,
+		CardCount: a.CardCount,
+		CreateAt:  a.CreateAt,
+		Level:     a.Level,
+		Discount:  a.Discount,
+		Rate:      commissionRate(a),
+	}
+}
+
+// 通过token查询当前登录的代理
+func agentByToken(t string) (*model.Agent, error) {
+	claims, err := token.ParseScope(t, token.ScopeAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := db.QueryAgent(claims.Uid)
+	if err != nil {
+		return nil, err
+	}
+	if a.Status != db.StatusNormal {
+		return nil, errutil.ErrAgentDisabled
+	}
+	return a, nil
+}
+
+func agentLogin(data *protocol.AgentLoginRequest) (*protocol.AgentLoginResponse, error) {
+	if data.Username == "" || data.Password == "" {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	a, err := db.QueryAgentByAccount(data.Username)
+	if err != nil {
+		if err == errutil.ErrAgentNotFound {
+			return nil, errutil.ErrUserNameNotFound
+		}
+		return nil, err
+	}
+
+	if !algoutil.VerifyPassword(data.Password, a.Salt, a.Password) {
+		logger.Warnf("代理登录密码错误, 账号=%s", data.Username)
+		return nil, errutil.ErrWrongPassword
+	}
+	if a.Status != db.StatusNormal {
+		return nil, errutil.ErrAgentDisabled
+	}
+
+	t, _, err := token.NewScope(a.Id, token.ScopeAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Infof("代理登录, ID=%d, 账号=%s", a.Id, a.Account)
+	return &protocol.AgentLoginResponse{Token: t, Detail: AgentDetail(a)}, nil
+}
+
+func agentInfo(form *nex.Form) (*protocol.AgentDetailResponse, error) {
+	a, err := agentByToken(form.Get("token"))
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.AgentDetailResponse{Detail: AgentDetail(a)}, nil
+}
+
+// 代理使用自己的库存给玩家充值, 按照当前的佣金比例计算佣金
+func agentRecharge(data *protocol.AgentRechargeRequest) (*protocol.AgentRechargeResponse, error) {
+	if data.PlayerId <= 0 || data.CardCount <= 0 {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	a, err := agentByToken(data.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	commission := data.CardCount * cardPrice * int64(commissionRate(a)) / 100
+	coin, remain, err := db.AgentRechargePlayer(a.Id, data.PlayerId, data.CardCount, commission, data.Extra)
+	if err != nil {
+		return nil, err
+	}
+
+	// 通知客户端
+	game.Recharge(data.PlayerId, coin)
+
+	logger.Infof("代理给玩家充值: 代理ID=%d, Uid=%d, 数量=%d, 佣金=%d, 剩余库存=%d",
+		a.Id, data.PlayerId, data.CardCount, commission, remain)
+	return &protocol.AgentRechargeResponse{CardCount: remain, Commission: commission}, nil
+}
+
+// 代理使用自己的库存给俱乐部充值, 不计算佣金
+func agentRechargeClub(data *protocol.ClubRechargeRequest) (*protocol.AgentRechargeResponse, error) {
+	if data.ClubId <= 0 || data.Amount <= 0 {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	a, err := agentByToken(data.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, remain, err := db.AgentRechargeClub(a.Id, data.ClubId, data.Amount, data.Remark)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Infof("代理给俱乐部充值: 代理ID=%d, 俱乐部ID=%d, 数量=%d, 俱乐部余额=%d, 剩余库存=%d",
+		a.Id, data.ClubId, data.Amount, balance, remain)
+	return &protocol.AgentRechargeResponse{CardCount: remain}, nil
+}
+
+func agentRecharges(form *nex.Form) (*protocol.RechargeListResponse, error) {
+	a, err := agentByToken(form.Get("token"))
+	if err != nil {
+		return nil, err
+	}
+
+	offset := form.IntOrDefault("offset", 0)
+	count := form.IntOrDefault("count", 20)
+	if offset < 0 || count <= 0 || count > 100 {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	list, total, err := db.AgentRecharges(a.Id, offset, count)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]protocol.RechargeDetail, len(list))
+	for i, r := range list {
+		data[i] = protocol.RechargeDetail{
+			PlayerId:   r.PlayerId,
+			Extra:      r.Extra,
+			CreateAt:   r.CreateAt,
+			CardCount:  r.CardCount,
+			Commission: r.Commission,
+		}
+	}
+	return &protocol.RechargeListResponse{Recharges: data, Total: total}, nil
+}
+
+func agentCommission(form *nex.Form) (*protocol.AgentCommissionResponse, error) {
+	a, err := agentByToken(form.Get("token"))
+	if err != nil {
+		return nil, err
+	}
+
+	// 默认最近30天
+	to := form.Int64OrDefault("to", time.Now().Unix())
+	from := form.Int64OrDefault("from", to-30*24*3600)
+	if from > to {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	cards, commission, err := db.AgentCommission(a.Id, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.AgentCommissionResponse{CardCount: cards, Commission: commission, Rate: commissionRate(a)}, nil
+}
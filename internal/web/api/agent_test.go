@@ -0,0 +1,35 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/lonng/nanoserver/db/model"
+)
+
+func TestCommissionRate(t *testing.T) {
+	defer func(tiers []commissionTier) { commissionTiers = tiers }(commissionTiers)
+
+	cases := []struct {
+		name   string
+		cfg    string
+		agent  model.Agent
+		expect int
+	}{
+		{"default lowest", "", model.Agent{Level: 0}, 5},
+		{"default highest", "", model.Agent{Level: 9}, 20},
+		{"discount first", "", model.Agent{Level: 3, Discount: 30}, 30},
+		{"unsorted config", "2/12, 0/3", model.Agent{Level: 1}, 3},
+		{"below lowest tier", "1/8,2/12", model.Agent{Level: 0}, 0},
+		{"invalid config ignored", "0/5,1/200", model.Agent{Level: 1}, 10},
+	}
+
+	for _, c := range cases {
+		commissionTiers = []commissionTier{{0, 5}, {1, 10}, {2, 15}, {3, 20}}
+		if c.cfg != "" {
+			setCommissionTiers(c.cfg)
+		}
+		if rate := commissionRate(&c.agent); rate != c.expect {
+			t.Fatalf("%s: expect %d, got %d", c.name, c.expect, rate)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/internal/game"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/pkg/token"
+	"github.com/lonng/nanoserver/protocol"
+	"github.com/lonng/nex"
+)
+
+func MakeClubService() http.Handler {
+	router := mux.NewRouter()
+	router.Handle("/v1/club/{id}/applications", nex.Handler(clubApplications)).Methods("GET")  //待审核的申请, 参数token
+	router.Handle("/v1/club/{id}/members", nex.Handler(clubMembers)).Methods("GET")            //成员列表, 参数token
+	router.Handle("/v1/club/approve", nex.Handler(approveClubApply)).Methods("POST")           //同意申请
+	router.Handle("/v1/club/reject", nex.Handler(rejectClubApply)).Methods("POST")             //拒绝申请
+	router.Handle("/v1/club/kick", nex.Handler(kickClubMember)).Methods("POST")                //踢出成员
+	router.Handle("/v1/club/transfer", nex.Handler(transferClub)).Methods("POST")              //转让部长
+	router.Handle("/v1/club/role", nex.Handler(setClubRole)).Methods("POST")                   //任命或者取消管理员
+	router.Handle("/v1/club/update", nex.Handler(updateClub)).Methods("POST")                  //修改名字和简介
+	router.Handle("/v1/club/{id}/templates", nex.Handler(clubTemplates)).Methods("GET")        //房间模板列表
+	router.Handle("/v1/club/template/save", nex.Handler(saveClubTemplate)).Methods("POST")     //新增或者修改房间模板
+	router.Handle("/v1/club/template/delete", nex.Handler(deleteClubTemplate)).Methods("POST") //删除房间模板
+	router.Handle("/v1/club/recharge", nex.Handler(rechargeClub)).Methods("POST")              //充值房卡
+	router.Handle("/v1/club/{id}/ledger", nex.Handler(clubLedger)).Methods("GET")              //房卡流水, 参数token, offset, count
+	router.Handle("/v1/club/{id}/report", nex.Handler(clubReport)).Methods("GET")              //每日汇总, 参数token, from, to, offset, count
+	return router
+}
+
+func clubItem(c *model.Club) protocol.ClubItem {
+	return protocol.ClubItem{
+		Id:        c.ClubId,
+		Name:      c.Name,
+		Desc:      c.Desc,
+		Member:    c.Member,
+		MaxMember: c.MaxMember,
+		Balance:   c.Balance,
+	}
+}
+
+// 通过token确定操作者, 系统操作只能通过后台进行
+func clubOperator(t string) (int64, error) {
+	claims, err := token.Parse(t)
+	if err != nil {
+		return 0, err
+	}
+	return claims.Uid, nil
+}
+
+func clubMemberList(r *http.Request, form *nex.Form, status int) (*protocol.ClubMemberListResponse, error) {
+	clubId, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	uid, err := clubOperator(form.Get("token"))
+	if err != nil {
+		return nil, err
+	}
+
+	role := db.ClubRole(clubId, uid)
+	if role == 0 || (status == model.UserClubStatusApply && role < model.UserClubRoleManager) {
+		return nil, errutil.ErrPermissionDenied
+	}
+
+	list, err := db.ClubMembers(clubId, status)
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.ClubMemberListResponse{Data: list}, nil
+}
+
+func clubApplications(r *http.Request, form *nex.Form) (*protocol.ClubMemberListResponse, error) {
+	return clubMemberList(r, form, model.UserClubStatusApply)
+}
+
+func clubMembers(r *http.Request, form *nex.Form) (*protocol.ClubMemberListResponse, error) {
+	return clubMemberList(r, form, model.UserClubStatusAgree)
+}
+
+// 执行俱乐部管理操作, 成功后通知被操作的玩家
+func clubOperate(r *http.Request, data *protocol.ClubMemberRequest, typ, role int,
+	fn func(operator, clubId, uid int64) (*model.Club, error)) (protocol.StringResponse, error) {
+	operator, err := clubOperator(data.Token)
+	if err != nil {
+		return protocol.StringResponse{}, err
+	}
+
+	c, err := fn(operator, data.ClubId, data.Uid)
+	if err != nil {
+		return protocol.StringResponse{}, err
+	}
+
+	logger.Infof("俱乐部管理操作, 俱乐部ID=%d, 操作者=%d, 玩家=%d, 类型=%d", data.ClubId, operator, data.Uid, typ)
+	game.NotifyClub(data.Uid, typ, c, role)
+	return protocol.SuccessResponse, nil
+}
+
+func approveClubApply(r *http.Request, data *protocol.ClubMemberRequest) (protocol.StringResponse, error) {
+	return clubOperate(r, data, protocol.ClubNotifyApproved, model.UserClubRoleMember, db.ApproveClubApply)
+}
+
+func rejectClubApply(r *http.Request, data *protocol.ClubMemberRequest) (protocol.StringResponse, error) {
+	return clubOperate(r, data, protocol.ClubNotifyRejected, 0, db.RejectClubApply)
+}
+
+func kickClubMember(r *http.Request, data *protocol.ClubMemberRequest) (protocol.StringResponse, error) {
+	return clubOperate(r, data, protocol.ClubNotifyKicked, 0, db.KickClubMember)
+}
+
+func transferClub(r *http.Request, data *protocol.ClubMemberRequest) (protocol.StringResponse, error) {
+	return clubOperate(r, data, protocol.ClubNotifyRoleChanged, model.UserClubRoleOwner, db.TransferClub)
+}
+
+func setClubRole(r *http.Request, data *protocol.ClubMemberRequest) (protocol.StringResponse, error) {
+	return clubOperate(r, data, protocol.ClubNotifyRoleChanged, data.Role, func(operator, clubId, uid int64) (*model.Club, error) {
+		return db.SetClubRole(operator, clubId, uid, data.Role)
+	})
+}
+
+func updateClub(r *http.Request, data *protocol.UpdateClubRequest) (*protocol.ClubInfoResponse, error) {
+	operator, err := clubOperator(data.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := db.UpdateClubInfo(operator, data.ClubId, data.Name, data.Desc)
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.ClubInfoResponse{Data: clubItem(c)}, nil
+}
+
+func clubTemplates(r *http.Request) (*protocol.ClubTemplateListResponse, error) {
+	clubId, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	list, err := db.ClubTemplates(clubId)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]protocol.ClubTemplate, 0, len(list))
+	for _, t := range list {
+		info := protocol.ClubTemplate{Id: t.Id, ClubId: t.ClubId, Name: t.Name}
+		if err := json.Unmarshal([]byte(t.Options), &info.Options); err != nil {
+			logger.Errorf("解析俱乐部房间模板失败, ID=%d, Error=%v", t.Id, err)
+			continue
+		}
+		data = append(data, info)
+	}
+	return &protocol.ClubTemplateListResponse{Data: data}, nil
+}
+
+func saveClubTemplate(r *http.Request, data *protocol.ClubTemplateRequest) (*protocol.ClubTemplateResponse, error) {
+	operator, err := clubOperator(data.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := game.SaveClubTemplate(operator, data)
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.ClubTemplateResponse{Data: *t}, nil
+}
+
+func deleteClubTemplate(r *http.Request, data *protocol.ClubTemplateRequest) (protocol.StringResponse, error) {
+	operator, err := clubOperator(data.Token)
+	if err != nil {
+		return protocol.StringResponse{}, err
+	}
+
+	if err := game.DeleteClubTemplate(operator, data.ClubId, data.Id); err != nil {
+		return protocol.StringResponse{}, err
+	}
+	return protocol.SuccessResponse, nil
+}
+
+// 部长使用自己的房卡给俱乐部充值
+func rechargeClub(r *http.Request, data *protocol.ClubRechargeRequest) (*protocol.ClubRechargeResponse, error) {
+	operator, err := clubOperator(data.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := db.ClubRecharge(operator, data.ClubId, data.Amount, data.Remark)
+	if err != nil {
+		return nil, err
+	}
+
+	if u, err := db.QueryUser(operator); err == nil {
+		game.Recharge(u.Id, u.Coin)
+	}
+
+	logger.Infof("俱乐部充值: 俱乐部ID=%d, 操作者=%d, 数量=%d, 余额=%d", data.ClubId, operator, data.Amount, balance)
+	return &protocol.ClubRechargeResponse{Balance: balance}, nil
+}
+
+// 房卡流水和每日汇总只有部长和管理员可以查看
+func clubAdminId(r *http.Request, form *nex.Form) (int64, error) {
+	clubId, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return 0, errutil.ErrInvalidParameter
+	}
+
+	uid, err := clubOperator(form.Get("token"))
+	if err != nil {
+		return 0, err
+	}
+
+	if db.ClubRole(clubId, uid) < model.UserClubRoleManager {
+		return 0, errutil.ErrPermissionDenied
+	}
+	return clubId, nil
+}
+
+func clubLedger(r *http.Request, form *nex.Form) (*protocol.ClubLedgerResponse, error) {
+	clubId, err := clubAdminId(r, form)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := form.IntOrDefault("offset", 0)
+	count := form.IntOrDefault("count", 20)
+	if offset < 0 || count <= 0 || count > 100 {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	list, total, err := db.ClubBalanceLogs(clubId, offset, count)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]protocol.ClubBalanceLog, len(list))
+	for i, l := range list {
+		data[i] = protocol.ClubBalanceLog{
+			Id:        l.Id,
+			Type:      l.Type,
+			Amount:    l.Amount,
+			Balance:   l.Balance,
+			DeskId:    l.DeskId,
+			DeskNo:    l.DeskNo,
+			Operator:  l.Operator,
+			Remark:    l.Remark,
+			CreatedAt: l.CreatedAt,
+		}
+	}
+	return &protocol.ClubLedgerResponse{Data: data, Total: total}, nil
+}
+
+func clubReport(r *http.Request, form *nex.Form) (*protocol.ClubReportResponse, error) {
+	clubId, err := clubAdminId(r, form)
+	if err != nil {
+		return nil, err
+	}
+
+	// 默认最近30天
+	to := form.Int64OrDefault("to", time.Now().Unix())
+	from := form.Int64OrDefault("from", to-30*24*3600)
+	offset := form.IntOrDefault("offset", 0)
+	count := form.IntOrDefault("count", 7)
+	if from > to || offset < 0 || count <= 0 || count > 31 {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	data, total, err := db.ClubDailyReport(clubId, from, to, offset, count)
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.ClubReportResponse{Data: data, Total: total}, nil
+}
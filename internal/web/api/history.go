@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/internal/game/history"
 	"github.com/lonng/nanoserver/pkg/whitelist"
 	"github.com/lonng/nex"
 
@@ -158,3 +159,32 @@ func historyByID(r *http.Request) (interface{}, error) {
 	}
 	return protocol.HistoryByIDResponse{Data: h}, nil
 }
+
+// HistoryReplay 回放历史记录到第step步, step小于0时回放到最后一步, 同时校验回放结果与快照中的结算是否一致
+func HistoryReplay(id int64, step int) (*protocol.HistoryReplayResponse, error) {
+	h, err := db.QueryHistory(id)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := history.ParseSnapShot(h.Snapshot)
+	if err != nil {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	replayer := history.NewReplayer(snapshot)
+	if step < 0 {
+		step = replayer.Steps()
+	}
+	state, err := replayer.Seek(step)
+	if err != nil {
+		return nil, err
+	}
+
+	mismatches := history.NewReplayer(snapshot).Verify()
+	return &protocol.HistoryReplayResponse{
+		Data:       state,
+		Verified:   len(mismatches) == 0,
+		Mismatches: mismatches,
+	}, nil
+}
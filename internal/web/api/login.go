@@ -2,13 +2,13 @@ package api
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
 	"strings"
 	"unicode/utf8"
 
 	"github.com/lonng/nanoserver/db"
 	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/pkg/token"
 	"github.com/lonng/nanoserver/protocol"
 
 	"github.com/gorilla/mux"
@@ -76,15 +76,23 @@ func MakeLoginService() http.Handler {
 	logger.Debugf("version infomation: %+v", config)
 	logger.Debugf("广播消息: %v", messages)
 
+	setupPhone()
+
 	fu := viper.GetBool("update.force")
 	logger.Infof("是否强制更新: %t", fu)
 	config.ForceUpdate = fu
 
 	router := mux.NewRouter()
-	router.Handle("/v1/user/login/query", nex.Handler(queryHandler)).Methods("POST")        //三方登录
-	router.Handle("/v1/user/login/3rd", nex.Handler(thirdUserLoginHandler)).Methods("POST") //三方登录
-	router.Handle("/v1/user/login/guest", nex.Handler(guestLoginHandler)).Methods("POST")   //三方登录
-	router.Handle("/v1/user/club", nex.Handler(clubListHandler)).Methods("GET")             // 获取俱乐部列表
+	router.Handle("/v1/user/login/query", nex.Handler(queryHandler)).Methods("POST")            //三方登录
+	router.Handle("/v1/user/login/3rd", nex.Handler(thirdUserLoginHandler)).Methods("POST")     //三方登录
+	router.Handle("/v1/user/login/guest", nex.Handler(guestLoginHandler)).Methods("POST")       //三方登录
+	router.Handle("/v1/user/club", nex.Handler(clubListHandler)).Methods("GET")                 // 获取俱乐部列表
+	router.Handle("/v1/user/token/refresh", nex.Handler(refreshTokenHandler)).Methods("POST")   // 刷新token
+	router.Handle("/v1/user/token/revoke", nex.Handler(revokeTokenHandler)).Methods("POST")     // 注销token
+	router.Handle("/v1/user/verification", nex.Handler(verificationHandler)).Methods("POST")    // 发送短信验证码
+	router.Handle("/v1/user/register/phone", nex.Handler(phoneRegisterHandler)).Methods("POST") // 手机号注册
+	router.Handle("/v1/user/login/phone", nex.Handler(phoneLoginHandler)).Methods("POST")       // 手机号登录
+	router.Handle("/v1/user/password/reset", nex.Handler(resetPasswordHandler)).Methods("POST") // 重置密码
 	return router
 }
 
@@ -130,13 +138,7 @@ func clubs(uid int64) []protocol.ClubItem {
 
 	ret := make([]protocol.ClubItem, len(list))
 	for i := range list {
-		ret[i] = protocol.ClubItem{
-			Id:        list[i].ClubId,
-			Name:      list[i].Name,
-			Desc:      list[i].Desc,
-			Member:    list[i].Member,
-			MaxMember: list[i].MaxMember,
-		}
+		ret[i] = clubItem(&list[i])
 	}
 	return ret
 }
@@ -204,7 +206,15 @@ func thirdUserLoginHandler(r *http.Request, data *protocol.ThirdUserLoginRequest
 
 	checkSession(u.Id)
 
+	t, expires, err := token.New(u.Id)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
 	resp := &protocol.LoginResponse{
+		Token:    t,
+		Expires:  expires,
 		Name:     thirdUser.ThirdName,
 		Uid:      u.Id, //注意此处是id而非uid
 		HeadUrl:  thirdUser.HeadUrl,
@@ -254,9 +264,18 @@ func guestLoginHandler(r *http.Request, data *protocol.LoginRequest) (*protocol.
 
 	checkSession(user.Id)
 
+	t, expires, err := token.New(user.Id)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
 	resp := &protocol.LoginResponse{
+		Token:    t,
+		Expires:  expires,
 		Uid:      user.Id,
-		HeadUrl:  "http://wx.qlogo.cn/mmopen/s962LEwpLxhQSOnarDnceXjSxVGaibMRsvRM4EIWic0U6fQdkpqz4Vr8XS8D81QKfyYuwjwm2M2ibsFY8mia8ic51ww/0",
+		Name:     protocol.GuestName(user.Id),
+		HeadUrl:  protocol.GuestHeadUrl,
 		Sex:      1,
 		IP:       host,
 		Port:     port,
@@ -267,7 +286,6 @@ func guestLoginHandler(r *http.Request, data *protocol.LoginRequest) (*protocol.
 		ClubList: clubs(user.Id),
 		Debug:    0, //user.Debug,
 	}
-	resp.Name = fmt.Sprintf("G%d", resp.Uid)
 
 	// 插入登陆记录
 	device := protocol.Device{
@@ -279,6 +297,26 @@ func guestLoginHandler(r *http.Request, data *protocol.LoginRequest) (*protocol.
 	return resp, nil
 }
 
+// 使用未过期的token换取新的token, 旧的token立即失效
+func refreshTokenHandler(data *protocol.TokenRequest) (*protocol.TokenResponse, error) {
+	t, expires, err := token.Refresh(data.Token)
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.TokenResponse{Token: t, Expires: expires}, nil
+}
+
+// 注销登录, 玩家之前获得的所有token全部失效
+func revokeTokenHandler(data *protocol.TokenRequest) (protocol.StringResponse, error) {
+	claims, err := token.Parse(data.Token)
+	if err != nil {
+		return protocol.StringResponse{}, err
+	}
+
+	token.Revoke(claims.Uid)
+	return protocol.SuccessResponse, nil
+}
+
 // 查询是否使用游客登陆
 type (
 	queryRequest struct {
@@ -1,8 +1,6 @@
 package api
 
 import (
-	"encoding/xml"
-	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,34 +9,84 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/lonng/nanoserver/db"
 	"github.com/lonng/nanoserver/db/model"
-	provider2 "github.com/lonng/nanoserver/internal/web/api/provider"
+	"github.com/lonng/nanoserver/internal/game"
+	"github.com/lonng/nanoserver/internal/web/api/provider"
 	"github.com/lonng/nex"
 	"github.com/pborman/uuid"
-	"golang.org/x/net/context"
+	"github.com/spf13/viper"
 
 	"github.com/lonng/nanoserver/pkg/errutil"
-	"github.com/lonng/nanoserver/pkg/whitelist"
 	"github.com/lonng/nanoserver/protocol"
 )
 
+const (
+	defaultCardPrice     = 100  // 默认的房卡单价(分)
+	maxTradeRaw          = 2048 // 交易原始数据的最大长度
+	defaultOrderExpire   = 7200 // 默认的订单超时时间(秒)
+	defaultCheckInterval = 60   // 默认的未支付订单检查间隔(秒)
+	checkOrderLimit      = 100  // 每次检查的订单数量
+)
+
+var (
+	cardPrice   int64 = defaultCardPrice
+	orderExpire int64 = defaultOrderExpire
+)
+
 func MakeOrderService() http.Handler {
+	if viper.IsSet("pay.card-price") {
+		cardPrice = viper.GetInt64("pay.card-price")
+	}
+	if viper.IsSet("pay.order-expire") {
+		orderExpire = viper.GetInt64("pay.order-expire")
+	}
+	provider.Setup()
+
+	interval := defaultCheckInterval
+	if viper.IsSet("pay.check-interval") {
+		interval = viper.GetInt("pay.check-interval")
+	}
+	go checkOrders(time.Duration(interval) * time.Second)
+
 	router := mux.NewRouter()
-	router.Handle("/v1/order/console/", nex.Handler(orderList)).Methods("GET")            //订单列表
-	router.Handle("/v1/order/", nex.Handler(createOrder)).Methods("GET")                  //创建订单
-	router.Handle("/v1/order/notify/wechat", nex.Handler(wechatCallback)).Methods("POST") //微信订单回调
+	router.Handle("/v1/order/products", nex.Handler(shopProducts)).Methods("GET")             //商城商品
+	router.Handle("/v1/order/", nex.Handler(createOrder)).Methods("GET")                      //创建订单
+	router.Handle("/v1/order/notify/{platform}", http.HandlerFunc(payNotify)).Methods("POST") //支付平台回调, 苹果为客户端上报收据
 	return router
 }
 
 func CreateOrder(r *protocol.CreateOrderRequest) (interface{}, error) {
+	p, err := provider.Lookup(r.Platform)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := db.QueryUser(r.Uid)
+	if err != nil {
+		return nil, err
+	}
+
+	// 价格和房卡数量以服务端的商品为准
+	product, err := db.QueryProductBySku(r.Sku)
+	if err != nil {
+		return nil, err
+	}
+	firstRecharge := u.FirstRechargeAt == 0
+	if !db.IsProductAvailable(product, r.ChannelID, firstRecharge) {
+		return nil, errutil.ErrProductUnavailable
+	}
+
 	order := &model.Order{
 		OrderId:      strings.Replace(uuid.New(), "-", "", -1),
 		AppId:        r.AppID,
 		Uid:          r.Uid,
 		ChannelId:    r.ChannelID,
-		PayPlatform:  r.Platform,
+		PayPlatform:  p.Name(),
 		Extra:        r.Extra,
-		ProductName:  r.ProductionName,
-		ProductCount: r.ProductCount,
+		Money:        product.Price,
+		ProductId:    product.Sku,
+		ProductName:  product.Name,
+		ProductCount: productCardCount(product, firstRecharge),
+		FirstBonus:   firstBonus(product, firstRecharge),
 		CreatedAt:    time.Now().Unix(),
 		Status:       db.OrderStatusCreated,
 		Remote:       r.Device.Remote,
@@ -48,7 +96,7 @@ func CreateOrder(r *protocol.CreateOrderRequest) (interface{}, error) {
 		Os:           r.Device.OS,
 	}
 
-	resp, err := provider2.Wechat.CreateOrderResponse(order)
+	resp, err := p.CreateOrder(order)
 	if err != nil {
 		logger.Error(err.Error())
 		return nil, err
@@ -66,10 +114,6 @@ func createOrder(r *http.Request) (interface{}, error) {
 	if err := r.ParseForm(); err != nil {
 		return nil, err
 	}
-	count, err := strconv.Atoi(strings.TrimSpace(r.Form.Get("count")))
-	if err != nil {
-		return nil, err
-	}
 	uid, err := strconv.ParseInt(strings.TrimSpace(r.Form.Get("uid")), 10, 64)
 	if err != nil {
 		return nil, err
@@ -78,20 +122,19 @@ func createOrder(r *http.Request) (interface{}, error) {
 	channelId := strings.TrimSpace(r.Form.Get("channelId"))
 	platform := strings.TrimSpace(r.Form.Get("platform"))
 	extra := strings.TrimSpace(r.Form.Get("extra"))
-	name := strings.TrimSpace(r.Form.Get("name"))
-	if appId == "" || channelId == "" || platform == "" || count == 0 || name == "" {
+	sku := strings.TrimSpace(r.Form.Get("sku"))
+	if appId == "" || channelId == "" || platform == "" || sku == "" {
 		return nil, errutil.ErrIllegalParameter
 	}
 
 	request := &protocol.CreateOrderRequest{
-		AppID:          appId,
-		ChannelID:      channelId,
-		Platform:       platform,
-		ProductionName: name,
-		ProductCount:   count,
-		Extra:          extra,
-		Uid:            uid,
-		Device:         protocol.Device{Remote: r.RemoteAddr},
+		AppID:     appId,
+		ChannelID: channelId,
+		Platform:  platform,
+		Sku:       sku,
+		Extra:     extra,
+		Uid:       uid,
+		Device:    protocol.Device{Remote: r.RemoteAddr},
 	}
 
 	return CreateOrder(request)
@@ -187,77 +230,250 @@ func OrderList(r *protocol.OrderListRequest) ([]protocol.OrderInfo, int, error)
 	return result, total, nil
 }
 
-//订单列表
-func orderList(r *http.Request, form *nex.Form) (*protocol.OrderListResponse, error) {
-	if !whitelist.VerifyIP(r.RemoteAddr) {
-		return nil, errutil.ErrPermissionDenied
+// 购买商品获得的房卡, 首充时额外赠送
+func productCardCount(p *model.Product, firstRecharge bool) int {
+	count := p.CardCount + p.BonusCount
+	if firstRecharge {
+		count += p.FirstBonus
+	}
+	return count
+}
+
+// 首充赠送的房卡, 支付时玩家已经充值过则不再赠送
+func firstBonus(p *model.Product, firstRecharge bool) int {
+	if !firstRecharge {
+		return 0
+	}
+	return p.FirstBonus
+}
+
+//商城商品, 首充优惠根据玩家是否充值过计算
+func shopProducts(form *nex.Form) (*protocol.ShopProductResponse, error) {
+	uid := form.Int64OrDefault("uid", 0)
+	channelId := strings.TrimSpace(form.Get("channelId"))
+	if uid <= 0 || channelId == "" {
+		return nil, errutil.ErrIllegalParameter
 	}
 
-	request := &protocol.OrderListRequest{}
-	err := r.ParseForm()
+	u, err := db.QueryUser(uid)
 	if err != nil {
 		return nil, err
 	}
 
-	request.Offset = form.IntOrDefault("offset", 0)
-	request.Count = form.IntOrDefault("count", -1)
-	request.PayBy = strings.ToLower(form.Get("pay_by"))
-	request.Status = uint8(form.IntOrDefault(form.Get("status"), 0))
-	request.AppID = form.Get("appid")
-	request.ChannelID = form.Get("channel_id")
-	request.Start = form.Int64OrDefault(form.Get("start"), -1)
-	request.End = form.Int64OrDefault(form.Get("end"), -1)
-	request.Uid = form.Get("uid")
-	request.OrderID = form.Get("order_id")
-
-	list, total, err := OrderList(request)
+	firstRecharge := u.FirstRechargeAt == 0
+	list, err := db.OnSaleProducts(channelId, firstRecharge)
 	if err != nil {
 		return nil, err
 	}
-	return &protocol.OrderListResponse{Data: list, Total: total}, nil
+
+	data := make([]protocol.ShopProduct, len(list))
+	for i := range list {
+		p := &list[i]
+		data[i] = protocol.ShopProduct{
+			Sku:        p.Sku,
+			Name:       p.Name,
+			Price:      p.Price,
+			CardCount:  p.CardCount,
+			BonusCount: p.BonusCount,
+			Total:      productCardCount(p, firstRecharge),
+		}
+		if firstRecharge {
+			data[i].FirstBonus = p.FirstBonus
+		}
+	}
+	return &protocol.ShopProductResponse{Data: data}, nil
 }
 
-func WechatNotify(r *protocol.WechatOrderCallbackRequest) (resp interface{}, err error) {
-	var trade *model.Trade
-	var order *model.Order
-	if trade, resp, err = provider2.Wechat.Notify(r); err != nil {
-		logger.Error(err.Error())
-		return nil, err
+// 校验交易的支付平台和金额是否与订单一致, 支付平台没有返回金额时同样校验失败
+func verifyTrade(platform string, order *model.Order, trade *model.Trade) error {
+	if order.PayPlatform != platform {
+		return errutil.ErrInvalidPayPlatform
+	}
+	if trade.Money != order.Money {
+		logger.Warnf("支付金额与订单不一致: OrderId=%s, 订单金额=%d, 支付金额=%d", order.OrderId, order.Money, trade.Money)
+		return errutil.ErrVerifyFailed
 	}
+	return nil
+}
 
-	if order, err = db.QueryOrder(trade.OrderId); err != nil {
-		logger.Error(err.Error())
-		return nil, err
+// 处理支付成功的交易, 重复的通知直接返回成功
+func processTrade(p provider.PaymentProvider, trade *model.Trade) error {
+	order, err := db.QueryOrder(trade.OrderId)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyTrade(p.Name(), order, trade); err != nil {
+		return err
 	}
 
-	if err := db.InsertTrade(trade); err != nil {
-		//如果是重复通知,直接忽略之
+	if len(trade.Raw) > maxTradeRaw {
+		trade.Raw = trade.Raw[:maxTradeRaw]
+	}
+
+	// 订单和交易号相同的重复通知直接返回成功
+	coin, err := db.InsertTrade(trade)
+	if err != nil {
 		if err == errutil.ErrTradeExisted {
-			return resp, nil
+			logger.Infof("重复的支付通知: OrderId=%s, 交易号=%s", trade.OrderId, trade.PayOrderId)
+			return nil
 		}
+		return err
+	}
 
-		logger.Error(err.Error())
+	// 通知客户端
+	game.Recharge(order.Uid, coin)
+
+	logger.Infof("订单支付成功: OrderId=%s, 平台=%s, Uid=%d, 金额=%d, 房卡=%d",
+		order.OrderId, p.Name(), order.Uid, order.Money, order.ProductCount)
+	return nil
+}
+
+func payNotify(w http.ResponseWriter, r *http.Request) {
+	p, err := provider.Lookup(mux.Vars(r)["platform"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	trade, err := p.Notify(r)
+	if err == nil {
+		err = processTrade(p, trade)
+	}
+	if err != nil {
+		logger.Errorf("支付回调处理失败: 平台=%s, Error=%v", p.Name(), err)
+	}
+	p.Reply(w, err)
+}
+
+// 定时检查未支付的订单, 向支付平台查询支付结果, 超时未支付的订单关闭
+func checkOrders(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		checkPendingOrders()
+	}
+}
+
+func checkPendingOrders() {
+	now := time.Now().Unix()
+
+	// 刚创建的订单用户可能还在支付
+	list, err := db.PendingOrders(now-60, checkOrderLimit)
+	if err != nil {
+		return
+	}
+
+	for i := range list {
+		order := &list[i]
+		expired := order.CreatedAt < now-orderExpire
+
+		p, err := provider.Lookup(order.PayPlatform)
+		if err == nil {
+			trade, err := p.Query(order)
+			if err != nil {
+				logger.Warnf("查询订单支付状态失败: OrderId=%s, 平台=%s, Error=%v", order.OrderId, order.PayPlatform, err)
+			} else if trade != nil {
+				if err := processTrade(p, trade); err != nil {
+					logger.Errorf("补单失败: OrderId=%s, Error=%v", order.OrderId, err)
+				}
+				continue
+			}
+		}
+
+		// 关闭后仍然可以接收支付成功的通知
+		if expired {
+			if err := db.ExpireOrder(order.OrderId); err == nil {
+				logger.Infof("订单超时关闭: OrderId=%s", order.OrderId)
+			}
+		}
+	}
+}
+
+// RefundOrder 订单退款, 先扣回房卡并标记订单为退款中, 然后在事务外向支付平台退款, 成功后标记为已退款.
+// 支付平台退款失败时订单保持退款中, 可以重试, 退款单号使用订单号, 重试时支付平台不会重复退款
+func RefundOrder(orderId, reason string) (*protocol.RefundOrderResponse, error) {
+	order, err := db.QueryOrder(orderId)
+	if err != nil {
 		return nil, err
 	}
 
-	if err := db.UserAddCoin(order.Uid, int64(10)); err != nil {
-		logger.Error(err.Error())
+	p, err := provider.Lookup(order.PayPlatform)
+	if err != nil {
 		return nil, err
 	}
-	return resp, nil
-}
 
-func wechatCallback(_ context.Context, r *http.Request) (interface{}, error) {
-	request := &protocol.WechatOrderCallbackRequest{}
+	// 苹果的退款由用户向苹果申请, 不能扣回房卡
+	if p.Name() == provider.PlatformApple {
+		return nil, errutil.ErrNotImplemented
+	}
 
-	data, err := ioutil.ReadAll(r.Body)
+	order, coin, err := db.BeginRefund(order.OrderId, reason)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := xml.Unmarshal(data, request); err != nil {
+	// 通知客户端
+	game.Recharge(order.Uid, coin)
+
+	if err := p.Refund(order, reason); err != nil {
+		logger.Errorf("支付平台退款失败, 订单保持退款中等待重试: OrderId=%s, Error=%v", order.OrderId, err)
+		return nil, err
+	}
+
+	if err := db.FinishRefund(order.OrderId); err != nil {
+		return nil, err
+	}
+
+	logger.Infof("订单退款成功: OrderId=%s, Uid=%d, 金额=%d, 房卡=%d", order.OrderId, order.Uid, order.Money, order.ProductCount)
+	return &protocol.RefundOrderResponse{Coin: coin}, nil
+}
+
+func orderProblem(m *db.OrderMismatch) string {
+	refund := m.Status == db.OrderStatusRefunded || m.Status == db.OrderStatusRefunding
+	paid := m.Status == db.OrderStatusPayed || m.Status == db.OrderStatusNotified || refund
+	switch {
+	case paid && m.PayOrderId == "":
+		return "已支付但是没有交易记录"
+	case paid && m.Credited != int64(m.ProductCount):
+		return "已支付但是发放的房卡不一致"
+	case !paid && m.PayOrderId != "":
+		return "有交易记录但是订单未支付"
+	case !paid && m.Credited != 0:
+		return "订单未支付但是发放了房卡"
+	case m.PayOrderId != "" && m.TradeMoney != m.Money:
+		return "支付金额与订单金额不一致"
+	case refund && m.Refunded != -int64(m.ProductCount):
+		return "已退款但是没有扣回房卡"
+	case m.Status == db.OrderStatusRefunding:
+		return "支付平台退款没有完成"
+	}
+	return ""
+}
+
+// ReconcileOrders 订单对账, 列出订单, 交易和房卡流水不一致的订单
+func ReconcileOrders(start, end int64, offset, count int) (*protocol.OrderReconcileResponse, error) {
+	list, total, err := db.OrderMismatches(start, end, offset, count)
+	if err != nil {
 		return nil, err
 	}
 
-	return WechatNotify(request)
+	data := make([]protocol.OrderMismatch, len(list))
+	for i := range list {
+		m := &list[i]
+		data[i] = protocol.OrderMismatch{
+			OrderId:      m.OrderId,
+			Uid:          m.Uid,
+			Status:       m.Status,
+			Money:        m.Money,
+			ProductCount: m.ProductCount,
+			PayOrderId:   m.PayOrderId,
+			TradeMoney:   m.TradeMoney,
+			Credited:     m.Credited,
+			Refunded:     m.Refunded,
+			Problem:      orderProblem(m),
+		}
+	}
+	return &protocol.OrderReconcileResponse{Data: data, Total: total}, nil
 }
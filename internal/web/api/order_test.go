@@ -0,0 +1,75 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+func TestVerifyTrade(t *testing.T) {
+	order := &model.Order{OrderId: "o1", PayPlatform: "wechat", Money: 600}
+
+	cases := []struct {
+		name     string
+		platform string
+		money    int
+		err      error
+	}{
+		{"match", "wechat", 600, nil},
+		{"no money", "wechat", 0, errutil.ErrVerifyFailed},
+		{"other platform", "alipay", 600, errutil.ErrInvalidPayPlatform},
+		{"money mismatch", "wechat", 1, errutil.ErrVerifyFailed},
+	}
+
+	for _, c := range cases {
+		trade := &model.Trade{OrderId: order.OrderId, PayPlatform: c.platform, Money: c.money}
+		if err := verifyTrade(c.platform, order, trade); err != c.err {
+			t.Fatalf("%s: expect %v, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestOrderProblem(t *testing.T) {
+	cases := []struct {
+		name     string
+		mismatch db.OrderMismatch
+		expect   string
+	}{
+		{"paid ok", db.OrderMismatch{Status: db.OrderStatusPayed, Money: 600, ProductCount: 10, PayOrderId: "t1", TradeMoney: 600, Credited: 10}, ""},
+		{"paid no trade", db.OrderMismatch{Status: db.OrderStatusPayed, ProductCount: 10, Credited: 10}, "已支付但是没有交易记录"},
+		{"paid not credited", db.OrderMismatch{Status: db.OrderStatusNotified, ProductCount: 10, PayOrderId: "t1"}, "已支付但是发放的房卡不一致"},
+		{"trade not paid", db.OrderMismatch{Status: db.OrderStatusCreated, PayOrderId: "t1"}, "有交易记录但是订单未支付"},
+		{"credited not paid", db.OrderMismatch{Status: db.OrderStatusExpired, Credited: 10}, "订单未支付但是发放了房卡"},
+		{"money mismatch", db.OrderMismatch{Status: db.OrderStatusPayed, Money: 600, ProductCount: 10, PayOrderId: "t1", TradeMoney: 1, Credited: 10}, "支付金额与订单金额不一致"},
+		{"trade without money", db.OrderMismatch{Status: db.OrderStatusPayed, Money: 600, ProductCount: 10, PayOrderId: "t1", Credited: 10}, "支付金额与订单金额不一致"},
+		{"refund not clawed back", db.OrderMismatch{Status: db.OrderStatusRefunded, ProductCount: 10, PayOrderId: "t1", Credited: 10}, "已退款但是没有扣回房卡"},
+		{"refunding", db.OrderMismatch{Status: db.OrderStatusRefunding, ProductCount: 10, PayOrderId: "t1", Credited: 10, Refunded: -10}, "支付平台退款没有完成"},
+		{"refunding not clawed back", db.OrderMismatch{Status: db.OrderStatusRefunding, ProductCount: 10, PayOrderId: "t1", Credited: 10}, "已退款但是没有扣回房卡"},
+		{"refunded ok", db.OrderMismatch{Status: db.OrderStatusRefunded, ProductCount: 10, PayOrderId: "t1", Credited: 10, Refunded: -10}, ""},
+	}
+
+	for _, c := range cases {
+		if problem := orderProblem(&c.mismatch); problem != c.expect {
+			t.Fatalf("%s: expect %q, got %q", c.name, c.expect, problem)
+		}
+	}
+}
+
+func TestProductCardCount(t *testing.T) {
+	p := &model.Product{CardCount: 10, BonusCount: 2, FirstBonus: 5}
+
+	if n := productCardCount(p, true); n != 17 {
+		t.Fatalf("first recharge: expect 17, got %d", n)
+	}
+	if n := productCardCount(p, false); n != 12 {
+		t.Fatalf("expect 12, got %d", n)
+	}
+	if n := firstBonus(p, true); n != 5 {
+		t.Fatalf("first bonus: expect 5, got %d", n)
+	}
+	if n := firstBonus(p, false); n != 0 {
+		t.Fatalf("first bonus: expect 0, got %d", n)
+	}
+}
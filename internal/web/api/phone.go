@@ -0,0 +1,324 @@
+package api
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/internal/web/api/sms"
+	"github.com/lonng/nanoserver/pkg/algoutil"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/pkg/security"
+	"github.com/lonng/nanoserver/pkg/token"
+	"github.com/lonng/nanoserver/protocol"
+	"github.com/spf13/viper"
+)
+
+// 手机号账号保存在三方账号中, 三方账号为手机号
+const phonePlatform = "phone"
+
+// 密码使用algoutil.PasswordHash, 保存在User.Algo中, 以后更换算法时用于区分
+const passwordAlgo = "sha1"
+
+// 验证码错误次数达到该值后失效
+const maxVerifyAttempts = 5
+
+var (
+	loginFailureWindow = 900 // 密码错误次数的统计时间(秒)
+	phoneLoginFailures = 5   // 同一手机号在统计时间内最多密码错误的次数
+	ipLoginFailures    = 20  // 同一IP在统计时间内最多密码错误的次数
+)
+
+var (
+	verifyExpire   = 300 // 验证码有效期(秒)
+	verifyInterval = 60  // 同一手机号发送的间隔(秒)
+	phoneDailyMax  = 10  // 同一手机号每天最多发送的数量
+	ipHourlyMax    = 20  // 同一IP每小时最多发送的数量
+)
+
+func setupPhone() {
+	sms.Setup()
+
+	if v := viper.GetInt("sms.expire"); v > 0 {
+		verifyExpire = v
+	}
+	if v := viper.GetInt("sms.interval"); v > 0 {
+		verifyInterval = v
+	}
+	if v := viper.GetInt("sms.phone-daily"); v > 0 {
+		phoneDailyMax = v
+	}
+	if v := viper.GetInt("sms.ip-hourly"); v > 0 {
+		ipHourlyMax = v
+	}
+	if v := viper.GetInt("sms.login-window"); v > 0 {
+		loginFailureWindow = v
+	}
+	if v := viper.GetInt("sms.phone-failures"); v > 0 {
+		phoneLoginFailures = v
+	}
+	if v := viper.GetInt("sms.ip-failures"); v > 0 {
+		ipLoginFailures = v
+	}
+	logger.Infof("短信验证码有效期: %ds, 发送间隔: %ds, 手机号每天: %d, IP每小时: %d",
+		verifyExpire, verifyInterval, phoneDailyMax, ipHourlyMax)
+}
+
+// 6位数字验证码
+func verificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func validatePassword(password string) bool {
+	return len(password) >= 6 && len(password) <= 32
+}
+
+// 手机号对应的账号和玩家, 没有注册时返回ErrThirdAccountNotFound
+func phoneAccount(phone string) (*model.ThirdAccount, *model.User, error) {
+	account, err := db.QueryThirdAccount(phone, phonePlatform)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err := db.QueryUser(account.Uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	return account, u, nil
+}
+
+// 发送短信验证码, 注册时手机号不能已经注册, 找回密码和验证码登录时必须已经注册
+func verificationHandler(r *http.Request, data *protocol.VerificationRequest) (*protocol.VerificationResponse, error) {
+	if !security.ValidatePhone(data.Phone) {
+		return nil, errutil.ErrWrongPhoneNumber
+	}
+
+	now := time.Now().Unix()
+	addr := ip(r.RemoteAddr)
+
+	_, err := db.QueryThirdAccount(data.Phone, phonePlatform)
+	if err != nil && err != errutil.ErrThirdAccountNotFound {
+		return nil, err
+	}
+	switch data.Type {
+	case protocol.VerificationTypeRegister:
+		if err == nil {
+			return nil, errutil.ErrAccountExists
+		}
+	case protocol.VerificationTypeFindPW, protocol.VerificationTypeLogin:
+		if err != nil {
+			return nil, errutil.ErrUserNotFound
+		}
+	default:
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	code, err := verificationCode()
+	if err != nil {
+		return nil, err
+	}
+
+	// 频率限制, 与保存验证码在同一个事务中检查
+	limits := []db.VerificationLimit{
+		{Bean: &model.Verification{Phone: data.Phone}, Since: now - int64(verifyInterval), Max: 1},
+		{Bean: &model.Verification{Phone: data.Phone}, Since: now - 24*3600, Max: phoneDailyMax},
+		{Bean: &model.Verification{Ip: addr}, Since: now - 3600, Max: ipHourlyMax},
+	}
+	v := &model.Verification{
+		Phone:     data.Phone,
+		Type:      data.Type,
+		Code:      code,
+		Ip:        addr,
+		ExpireAt:  now + int64(verifyExpire),
+		CreatedAt: now,
+	}
+	if err := db.InsertVerificationLimited(v, limits); err != nil {
+		if err == errutil.ErrFrequencyLimited {
+			return nil, err
+		}
+		logger.Error(err)
+		return nil, errutil.ErrDBOperation
+	}
+
+	if err := sms.Send(data.Phone, data.Type, code); err != nil {
+		logger.Errorf("发送短信验证码失败, Phone=%s, Error=%v", data.Phone, err)
+		return nil, errutil.ErrRequestFailed
+	}
+
+	return &protocol.VerificationResponse{Expires: verifyExpire, Interval: verifyInterval}, nil
+}
+
+func phoneRegisterHandler(r *http.Request, data *protocol.PhoneRegisterRequest) (*protocol.LoginResponse, error) {
+	logger.Infof("手机号注册: %s", data.Phone)
+	if !security.ValidatePhone(data.Phone) {
+		return nil, errutil.ErrWrongPhoneNumber
+	}
+	if !validatePassword(data.Password) {
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	if err := db.UseVerification(data.Phone, protocol.VerificationTypeRegister, data.VerifyNo, maxVerifyAttempts); err != nil {
+		return nil, err
+	}
+
+	_, err := db.QueryThirdAccount(data.Phone, phonePlatform)
+	if err == nil {
+		return nil, errutil.ErrAccountExists
+	}
+	if err != errutil.ErrThirdAccountNotFound {
+		return nil, err
+	}
+
+	mask, err := algoutil.MaskPhone(data.Phone)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, salt := algoutil.PasswordHash(data.Password)
+	u := &model.User{
+		Algo:     passwordAlgo,
+		Hash:     hash,
+		Salt:     salt,
+		Status:   db.StatusNormal,
+		IsOnline: db.UserOffline,
+		Role:     db.RoleTypeThird,
+		Coin:     defaultCoin,
+	}
+	account := &model.ThirdAccount{
+		ThirdAccount: data.Phone,
+		ThirdName:    mask,
+		Platform:     phonePlatform,
+		HeadUrl:      protocol.GuestHeadUrl,
+	}
+	if err := db.InsertThirdAccount(account, u); err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	db.RegisterUserLog(u, data.Device, data.AppID, data.ChannelID, protocol.RegTypePhone) //注册记录
+
+	return phoneLoginResponse(r, account, u, data.Device, data.AppID, data.ChannelID)
+}
+
+func phoneLoginHandler(r *http.Request, data *protocol.PhoneLoginRequest) (*protocol.LoginResponse, error) {
+	logger.Infof("手机号登录: %s", data.Phone)
+	if !security.ValidatePhone(data.Phone) {
+		return nil, errutil.ErrWrongPhoneNumber
+	}
+
+	if data.VerifyNo != "" {
+		if err := db.UseVerification(data.Phone, protocol.VerificationTypeLogin, data.VerifyNo, maxVerifyAttempts); err != nil {
+			return nil, err
+		}
+		account, u, err := phoneAccount(data.Phone)
+		if err != nil {
+			return nil, err
+		}
+		return phoneLoginResponse(r, account, u, data.Device, data.AppID, data.ChannelID)
+	}
+
+	// 密码错误次数限制
+	addr := ip(r.RemoteAddr)
+	since := time.Now().Unix() - int64(loginFailureWindow)
+	limits := []struct {
+		bean *model.Verification
+		max  int
+	}{
+		{&model.Verification{Phone: data.Phone, Type: db.VerificationWrongPassword}, phoneLoginFailures},
+		{&model.Verification{Ip: addr, Type: db.VerificationWrongPassword}, ipLoginFailures},
+	}
+	for _, l := range limits {
+		count, err := db.VerificationCount(l.bean, since)
+		if err != nil {
+			return nil, err
+		}
+		if count >= int64(l.max) {
+			logger.Warnf("手机号密码错误次数过多: %s, IP=%s", data.Phone, addr)
+			return nil, errutil.ErrFrequencyLimited
+		}
+	}
+
+	// 手机号没有注册和密码错误返回相同的错误
+	account, u, err := phoneAccount(data.Phone)
+	if err != nil && err != errutil.ErrThirdAccountNotFound {
+		return nil, err
+	}
+	if err == errutil.ErrThirdAccountNotFound || u.Algo != passwordAlgo ||
+		!algoutil.VerifyPassword(data.Password, u.Salt, u.Hash) {
+		if err := db.InsertWrongPassword(data.Phone, addr); err != nil {
+			logger.Error(err)
+		}
+		return nil, errutil.ErrWrongPassword
+	}
+	return phoneLoginResponse(r, account, u, data.Device, data.AppID, data.ChannelID)
+}
+
+// 使用找回密码的验证码重置密码, 之前签发的token全部失效
+func resetPasswordHandler(data *protocol.ResetPasswordRequest) (protocol.StringResponse, error) {
+	if !security.ValidatePhone(data.Phone) {
+		return protocol.StringResponse{}, errutil.ErrWrongPhoneNumber
+	}
+	if !validatePassword(data.Password) {
+		return protocol.StringResponse{}, errutil.ErrIllegalParameter
+	}
+
+	if err := db.UseVerification(data.Phone, protocol.VerificationTypeFindPW, data.VerifyNo, maxVerifyAttempts); err != nil {
+		return protocol.StringResponse{}, err
+	}
+
+	_, u, err := phoneAccount(data.Phone)
+	if err != nil {
+		return protocol.StringResponse{}, err
+	}
+
+	u.Algo = passwordAlgo
+	u.Hash, u.Salt = algoutil.PasswordHash(data.Password)
+	if err := db.UpdateUserPassword(u); err != nil {
+		logger.Error(err)
+		return protocol.StringResponse{}, errutil.ErrDBOperation
+	}
+
+	token.Revoke(u.Id)
+	logger.Infof("手机号重置密码: %s, Uid=%d", data.Phone, u.Id)
+	return protocol.SuccessResponse, nil
+}
+
+func phoneLoginResponse(r *http.Request, account *model.ThirdAccount, u *model.User, device protocol.Device, appId, channelId string) (*protocol.LoginResponse, error) {
+	checkSession(u.Id)
+
+	t, expires, err := token.New(u.Id)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	resp := &protocol.LoginResponse{
+		Token:    t,
+		Expires:  expires,
+		Name:     account.ThirdName,
+		Uid:      u.Id,
+		HeadUrl:  account.HeadUrl,
+		Sex:      account.Sex,
+		IP:       host,
+		Port:     port,
+		FangKa:   u.Coin,
+		PlayerIP: ip(r.RemoteAddr),
+		Config:   config,
+		Messages: messages,
+		ClubList: clubs(u.Id),
+	}
+
+	// 插入登陆记录
+	device.IP = ip(r.RemoteAddr)
+	device.Remote = r.RemoteAddr
+	db.InsertLoginLog(u.Id, device, appId, channelId)
+
+	return resp, nil
+}
@@ -0,0 +1,391 @@
+package provider
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultAlipayGateway = "https://openapi.alipay.com/gateway.do"
+	alipayTimeFormat     = "2006-01-02 15:04:05"
+	alipaySuccessCode    = "10000"
+)
+
+type alipay struct {
+	appId       string
+	gateway     string
+	callbackURL string
+	privateKey  *rsa.PrivateKey // 应用私钥
+	publicKey   *rsa.PublicKey  // 支付宝公钥
+}
+
+var Alipay = &alipay{}
+
+func (ap *alipay) Name() string {
+	return PlatformAlipay
+}
+
+// 金额单位为分, 支付宝使用元, 保留两位小数
+func formatYuan(fen int) string {
+	return fmt.Sprintf("%d.%02d", fen/100, fen%100)
+}
+
+func parseYuan(s string) (int, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), ".", 2)
+	yuan, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, err
+	}
+
+	fen := 0
+	if len(parts) == 2 {
+		cents := (parts[1] + "00")[:2]
+		if fen, err = strconv.Atoi(cents); err != nil {
+			return 0, err
+		}
+	}
+	return yuan*100 + fen, nil
+}
+
+// 待签名字符串: 除sign和sign_type以外的非空参数按照参数名排序后使用&连接
+func alipaySignContent(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k == "sign" || k == "sign_type" || params.Get(k) == "" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + params.Get(k)
+	}
+	return strings.Join(parts, "&")
+}
+
+// RSA2签名
+func (ap *alipay) sign(content string) (string, error) {
+	hashed := sha256.Sum256([]byte(content))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, ap.privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+func (ap *alipay) verify(content, sign string) bool {
+	sig, err := base64.StdEncoding.DecodeString(sign)
+	if err != nil {
+		return false
+	}
+	hashed := sha256.Sum256([]byte(content))
+	return rsa.VerifyPKCS1v15(ap.publicKey, crypto.SHA256, hashed[:], sig) == nil
+}
+
+// 公共请求参数, 已经签名
+func (ap *alipay) params(method string, biz interface{}) (url.Values, error) {
+	content, err := json.Marshal(biz)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("app_id", ap.appId)
+	params.Set("method", method)
+	params.Set("charset", "utf-8")
+	params.Set("sign_type", "RSA2")
+	params.Set("timestamp", time.Now().Format(alipayTimeFormat))
+	params.Set("version", "1.0")
+	params.Set("biz_content", string(content))
+	if method == "alipay.trade.app.pay" {
+		params.Set("notify_url", ap.callbackURL)
+	}
+
+	sign, err := ap.sign(alipaySignContent(params))
+	if err != nil {
+		return nil, err
+	}
+	params.Set("sign", sign)
+	return params, nil
+}
+
+// 调用支付宝网关, 校验应答的签名后返回业务数据
+func (ap *alipay) request(method string, biz interface{}, result interface{}) error {
+	params, err := ap.params(method, biz)
+	if err != nil {
+		return err
+	}
+
+	response, err := http.PostForm(ap.gateway, params)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	// 应答格式: {"alipay_trade_query_response":{...},"sign":"..."}, 签名内容为业务数据的原始JSON
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	var sign string
+	if err := json.Unmarshal(raw["sign"], &sign); err != nil {
+		return errutil.ErrVerifyFailed
+	}
+	content := raw[strings.Replace(method, ".", "_", -1)+"_response"]
+	if !ap.verify(string(content), sign) {
+		return errutil.ErrVerifyFailed
+	}
+
+	log.Debugf("alipay response: %s", content)
+	return json.Unmarshal(content, result)
+}
+
+func (ap *alipay) CreateOrder(order *model.Order) (interface{}, error) {
+	params, err := ap.params("alipay.trade.app.pay", map[string]string{
+		"out_trade_no":    order.OrderId,
+		"total_amount":    formatYuan(order.Money),
+		"subject":         order.ProductName,
+		"product_code":    "QUICK_MSECURITY_PAY",
+		"timeout_express": "30m",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return protocol.CreateOrderAlipayResponse{
+		OrderId:     order.OrderId,
+		OrderString: params.Encode(),
+		Extra:       order.Extra,
+	}, nil
+}
+
+func (ap *alipay) Notify(r *http.Request) (*model.Trade, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	form := r.PostForm
+	if !ap.verify(alipaySignContent(form), form.Get("sign")) {
+		return nil, errutil.ErrVerifyFailed
+	}
+	if form.Get("app_id") != ap.appId {
+		return nil, errutil.ErrVerifyFailed
+	}
+
+	status := form.Get("trade_status")
+	if status != "TRADE_SUCCESS" && status != "TRADE_FINISHED" {
+		return nil, fmt.Errorf("alipay trade status: %s", status)
+	}
+
+	money, err := parseYuan(form.Get("total_amount"))
+	if err != nil {
+		return nil, err
+	}
+
+	trade := &model.Trade{
+		OrderId:     form.Get("out_trade_no"),
+		PayOrderId:  form.Get("trade_no"),
+		PayPlatform: PlatformAlipay,
+		ComsumerId:  form.Get("buyer_id"),
+		MerchantId:  form.Get("seller_id"),
+		Money:       money,
+		Raw:         form.Encode(),
+	}
+	trade.PayCreateAt = parseAlipayTime(form.Get("gmt_create"))
+	trade.PayAt = parseAlipayTime(form.Get("gmt_payment"))
+	return trade, nil
+}
+
+func parseAlipayTime(s string) int64 {
+	t, err := time.ParseInLocation(alipayTimeFormat, s, time.Local)
+	if err != nil {
+		return time.Now().Unix()
+	}
+	return t.Unix()
+}
+
+// 支付宝要求处理成功后返回success, 否则会重复通知
+func (ap *alipay) Reply(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain;charset=utf-8")
+	if err != nil {
+		w.Write([]byte("failure"))
+		return
+	}
+	w.Write([]byte("success"))
+}
+
+func (ap *alipay) Query(order *model.Order) (*model.Trade, error) {
+	result := struct {
+		Code        string `json:"code"`
+		SubMsg      string `json:"sub_msg"`
+		TradeNo     string `json:"trade_no"`
+		TradeStatus string `json:"trade_status"`
+		TotalAmount string `json:"total_amount"`
+		BuyerUserId string `json:"buyer_user_id"`
+		SendPayDate string `json:"send_pay_date"`
+	}{}
+	if err := ap.request("alipay.trade.query", map[string]string{"out_trade_no": order.OrderId}, &result); err != nil {
+		return nil, err
+	}
+
+	if result.Code != alipaySuccessCode {
+		// 用户还没有打开收银台时交易不存在
+		if strings.Contains(result.SubMsg, "不存在") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("alipay query failed: %s", result.SubMsg)
+	}
+	if result.TradeStatus != "TRADE_SUCCESS" && result.TradeStatus != "TRADE_FINISHED" {
+		return nil, nil
+	}
+
+	money, err := parseYuan(result.TotalAmount)
+	if err != nil {
+		return nil, err
+	}
+	payAt := parseAlipayTime(result.SendPayDate)
+	return &model.Trade{
+		OrderId:     order.OrderId,
+		PayOrderId:  result.TradeNo,
+		PayPlatform: PlatformAlipay,
+		PayAt:       payAt,
+		PayCreateAt: payAt,
+		ComsumerId:  result.BuyerUserId,
+		Money:       money,
+	}, nil
+}
+
+func (ap *alipay) Refund(order *model.Order, reason string) error {
+	result := struct {
+		Code   string `json:"code"`
+		SubMsg string `json:"sub_msg"`
+	}{}
+	err := ap.request("alipay.trade.refund", map[string]string{
+		"out_trade_no":   order.OrderId,
+		"refund_amount":  formatYuan(order.Money),
+		"refund_reason":  reason,
+		"out_request_no": order.OrderId,
+	}, &result)
+	if err != nil {
+		return err
+	}
+
+	if result.Code != alipaySuccessCode {
+		return fmt.Errorf("alipay refund failed: %s", result.SubMsg)
+	}
+	return nil
+}
+
+// 支付宝开放平台下载的密钥没有PEM头, 需要补充
+func decodeKey(key string) ([]byte, error) {
+	key = strings.TrimSpace(key)
+	if !strings.HasPrefix(key, "-----BEGIN") {
+		return base64.StdEncoding.DecodeString(key)
+	}
+
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		return nil, errors.New("invalid pem key")
+	}
+	return block.Bytes, nil
+}
+
+func parsePrivateKey(key string) (*rsa.PrivateKey, error) {
+	der, err := decodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if k, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errutil.ErrNotRSAPrivateKey
+	}
+	return priv, nil
+}
+
+func parsePublicKey(key string) (*rsa.PublicKey, error) {
+	der, err := decodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	k, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := k.(*rsa.PublicKey)
+	if !ok {
+		return nil, errutil.ErrNotRSAPublicKey
+	}
+	return pub, nil
+}
+
+func (ap *alipay) Setup() error {
+	log.Info("pay_provider: alipay setup")
+
+	var (
+		appId       = viper.GetString("alipay.appid")
+		gateway     = viper.GetString("alipay.gateway")
+		callbackURL = viper.GetString("alipay.callback_url")
+		privateKey  = viper.GetString("alipay.private_key")
+		publicKey   = viper.GetString("alipay.public_key")
+	)
+	if appId == "" || callbackURL == "" || privateKey == "" || publicKey == "" {
+		return errors.New("the alipay's config is invalid")
+	}
+
+	priv, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	pub, err := parsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	if gateway == "" {
+		gateway = defaultAlipayGateway
+	}
+	ap.appId = appId
+	ap.gateway = gateway
+	ap.callbackURL = callbackURL
+	ap.privateKey = priv
+	ap.publicKey = pub
+	return nil
+}
@@ -0,0 +1,192 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	appleProductionURL = "https://buy.itunes.apple.com/verifyReceipt"
+	appleSandboxURL    = "https://sandbox.itunes.apple.com/verifyReceipt"
+
+	appleStatusSandbox = 21007 // 沙盒环境的收据发送到了正式环境
+)
+
+// 苹果内购没有服务端下单和支付通知, 客户端支付完成后上报收据, 服务端向苹果校验收据
+type apple struct {
+	bundleId string
+	password string // 自动续期订阅的共享密钥, 消耗型商品可以为空
+	sandbox  bool   // 是否接受沙盒环境的收据
+}
+
+var Apple = &apple{}
+
+type appleInApp struct {
+	ProductId             string `json:"product_id"`
+	TransactionId         string `json:"transaction_id"`
+	OriginalTransactionId string `json:"original_transaction_id"`
+	PurchaseDateMs        string `json:"purchase_date_ms"`
+}
+
+type appleReceiptResponse struct {
+	Status  int `json:"status"`
+	Receipt struct {
+		BundleId string       `json:"bundle_id"`
+		InApp    []appleInApp `json:"in_app"`
+	} `json:"receipt"`
+}
+
+func (ap *apple) Name() string {
+	return PlatformApple
+}
+
+func (ap *apple) CreateOrder(order *model.Order) (interface{}, error) {
+	return protocol.CreateOrderAppleResponse{
+		OrderId:   order.OrderId,
+		ProductId: order.ProductId,
+		Extra:     order.Extra,
+	}, nil
+}
+
+func (ap *apple) verifyReceipt(url, receipt string) (*appleReceiptResponse, error) {
+	body, err := json.Marshal(map[string]string{
+		"receipt-data": receipt,
+		"password":     ap.password,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	result := &appleReceiptResponse{}
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Notify 校验客户端上报的收据, 收据中商品ID与订单一致的最新一笔交易作为订单的交易
+func (ap *apple) Notify(r *http.Request) (*model.Trade, error) {
+	req := &protocol.AppleReceiptRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return nil, err
+	}
+	if req.OrderId == "" || req.Receipt == "" {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	// 商品以服务端创建的订单为准, 防止使用低价商品的收据支付
+	order, err := db.QueryOrder(req.OrderId)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := ap.verifyReceipt(appleProductionURL, req.Receipt)
+	if err != nil {
+		return nil, err
+	}
+	if result.Status == appleStatusSandbox && ap.sandbox {
+		if result, err = ap.verifyReceipt(appleSandboxURL, req.Receipt); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.Status != 0 {
+		return nil, fmt.Errorf("apple receipt status: %d", result.Status)
+	}
+	if result.Receipt.BundleId != ap.bundleId {
+		return nil, errutil.ErrVerifyFailed
+	}
+
+	var (
+		latest   *appleInApp
+		latestAt int64
+	)
+	for i, item := range result.Receipt.InApp {
+		if item.ProductId != order.ProductId {
+			continue
+		}
+		at, _ := strconv.ParseInt(item.PurchaseDateMs, 10, 64)
+		if latest == nil || at > latestAt {
+			latest, latestAt = &result.Receipt.InApp[i], at
+		}
+	}
+	if latest == nil {
+		return nil, errutil.ErrVerifyFailed
+	}
+
+	payAt := time.Now().Unix()
+	if latestAt > 0 {
+		payAt = latestAt / 1000
+	}
+
+	// 收据中没有金额, 苹果商品的价格由商品ID确定, 商品ID与订单一致时支付金额即订单金额
+	return &model.Trade{
+		OrderId:     req.OrderId,
+		PayOrderId:  latest.TransactionId,
+		PayPlatform: PlatformApple,
+		PayAt:       payAt,
+		PayCreateAt: payAt,
+		MerchantId:  result.Receipt.BundleId,
+		Money:       order.Money,
+		Raw:         fmt.Sprintf("product_id=%s&transaction_id=%s", latest.ProductId, latest.TransactionId),
+	}, nil
+}
+
+// 收据由客户端上报, 直接返回处理结果
+func (ap *apple) Reply(w http.ResponseWriter, err error) {
+	replyJSON(w, err)
+}
+
+// 苹果没有提供订单查询接口, 只能通过客户端上报的收据确认
+func (ap *apple) Query(order *model.Order) (*model.Trade, error) {
+	return nil, nil
+}
+
+// 苹果的退款由用户向苹果申请
+func (ap *apple) Refund(order *model.Order, reason string) error {
+	return errutil.ErrNotImplemented
+}
+
+func (ap *apple) Setup() error {
+	log.Info("pay_provider: apple setup")
+
+	bundleId := viper.GetString("apple.bundle_id")
+	if bundleId == "" {
+		return errors.New("the apple's config is invalid")
+	}
+
+	ap.bundleId = bundleId
+	ap.password = viper.GetString("apple.password")
+	ap.sandbox = viper.GetBool("apple.sandbox")
+	return nil
+}
+
+// 返回给客户端的处理结果
+func replyJSON(w http.ResponseWriter, err error) {
+	resp := &protocol.ErrorResponse{}
+	if err != nil {
+		resp.Code = errutil.Code(err)
+		resp.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// 模拟支付, 用于本地测试, 调用回调接口即视为支付成功
+type fake struct{}
+
+var Fake = &fake{}
+
+func (f *fake) Name() string {
+	return PlatformFake
+}
+
+func (f *fake) CreateOrder(order *model.Order) (interface{}, error) {
+	return protocol.CreateOrderFakeResponse{
+		OrderId: order.OrderId,
+		Money:   order.Money,
+		Extra:   order.Extra,
+	}, nil
+}
+
+// Notify 参数order_id为订单号, money为支付金额(分)
+func (f *fake) Notify(r *http.Request) (*model.Trade, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	orderId := r.Form.Get("order_id")
+	money, _ := strconv.Atoi(r.Form.Get("money"))
+	if orderId == "" || money <= 0 {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	now := time.Now().Unix()
+	return &model.Trade{
+		OrderId:     orderId,
+		PayOrderId:  "fake_" + orderId,
+		PayPlatform: PlatformFake,
+		PayAt:       now,
+		PayCreateAt: now,
+		Money:       money,
+		Raw:         r.Form.Encode(),
+	}, nil
+}
+
+func (f *fake) Reply(w http.ResponseWriter, err error) {
+	replyJSON(w, err)
+}
+
+func (f *fake) Query(order *model.Order) (*model.Trade, error) {
+	return nil, nil
+}
+
+func (f *fake) Refund(order *model.Order, reason string) error {
+	log.Infof("模拟退款: OrderId=%s, Money=%d, Reason=%s", order.OrderId, order.Money, reason)
+	return nil
+}
+
+func (f *fake) Setup() error {
+	log.Warn("pay_provider: fake setup, 模拟支付只能用于测试环境")
+	return nil
+}
@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// 支付平台名称, 对应CreateOrderRequest.Platform和Order.PayPlatform
+const (
+	PlatformWechat = "wechat"
+	PlatformAlipay = "alipay"
+	PlatformApple  = "apple"
+	PlatformFake   = "fake"
+)
+
+// PaymentProvider 支付平台
+type PaymentProvider interface {
+	// Name 支付平台名称
+	Name() string
+
+	// Setup 读取配置, 配置无效时返回错误, 该平台不可用
+	Setup() error
+
+	// CreateOrder 在支付平台创建预支付订单, 返回客户端拉起支付需要的数据
+	CreateOrder(order *model.Order) (interface{}, error)
+
+	// Notify 校验支付平台的支付通知(苹果为客户端上报的收据), 返回支付成功的交易
+	Notify(r *http.Request) (*model.Trade, error)
+
+	// Reply 回复支付平台的通知, err为nil表示处理成功
+	Reply(w http.ResponseWriter, err error)
+
+	// Query 主动查询订单的支付状态, 还没有支付时返回nil
+	Query(order *model.Order) (*model.Trade, error)
+
+	// Refund 原路退还订单的全部金额, 使用订单号作为退款单号, 重试时支付平台不会重复退款
+	Refund(order *model.Order, reason string) error
+}
+
+var providers = map[string]PaymentProvider{}
+
+// Setup 初始化所有的支付平台, 模拟支付只在配置pay.fake为true时启用
+func Setup() {
+	all := []PaymentProvider{Wechat, Alipay, Apple}
+	if viper.GetBool("pay.fake") {
+		all = append(all, Fake)
+	}
+
+	for _, p := range all {
+		if err := p.Setup(); err != nil {
+			log.Warnf("支付平台不可用: %s, Error=%v", p.Name(), err)
+			continue
+		}
+		providers[p.Name()] = p
+	}
+}
+
+// Lookup 根据平台名称查找支付平台
+func Lookup(platform string) (PaymentProvider, error) {
+	p, ok := providers[strings.ToLower(strings.TrimSpace(platform))]
+	if !ok {
+		return nil, errutil.ErrInvalidPayPlatform
+	}
+	return p, nil
+}
@@ -3,10 +3,13 @@ package provider
 import (
 	"bytes"
 	"crypto/md5"
+	"crypto/tls"
 	"encoding/hex"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"sort"
 	"strconv"
@@ -21,12 +24,23 @@ import (
 	"github.com/spf13/viper"
 )
 
+const (
+	wechatSuccess = "SUCCESS"
+	wechatFail    = "FAIL"
+
+	defaultWechatQueryURL  = "https://api.mch.weixin.qq.com/pay/orderquery"
+	defaultWechatRefundURL = "https://api.mch.weixin.qq.com/secapi/pay/refund"
+)
+
 type wechat struct {
 	appkey        string
 	appId         string
 	merId         string
 	unifyOrderURL string
 	callbackURL   string
+	queryURL      string
+	refundURL     string
+	refundClient  *http.Client // 退款需要使用商户证书
 }
 
 var Wechat = &wechat{}
@@ -107,7 +121,11 @@ func verify(m map[string]interface{}, key, sign string) bool {
 	return sign == signed
 }
 
-func (wc *wechat) CreateOrderResponse(order *model.Order) (interface{}, error) {
+func (wc *wechat) Name() string {
+	return PlatformWechat
+}
+
+func (wc *wechat) CreateOrder(order *model.Order) (interface{}, error) {
 	req := UnifyOrderReq{
 		Appid:          wc.appId,             //微信开放平台的app的appid
 		Body:           order.ProductName,    //产品名
@@ -116,7 +134,7 @@ func (wc *wechat) CreateOrderResponse(order *model.Order) (interface{}, error) {
 		NotifyURL:      wc.callbackURL,
 		TradeType:      "APP",
 		SpbillCreateIP: strings.Split(order.Ip, ":")[0],
-		TotalFee:       order.ProductCount * 1,
+		TotalFee:       order.Money,
 		OutTradeNo:     order.OrderId,
 	}
 
@@ -162,7 +180,7 @@ func (wc *wechat) CreateOrderResponse(order *model.Order) (interface{}, error) {
 		return nil, err
 	}
 
-	println(response.StatusCode)
+	defer response.Body.Close()
 
 	xmlResp := &UnifyOrderResp{}
 	if err := xml.NewDecoder(response.Body).Decode(xmlResp); err != nil {
@@ -170,14 +188,10 @@ func (wc *wechat) CreateOrderResponse(order *model.Order) (interface{}, error) {
 		return nil, err
 	}
 
-	const (
-		fail = "FAIL"
-	)
-
 	log.Debugf("prepay id response: %+v", xmlResp)
 
-	if xmlResp.Return_code == fail {
-		fmt.Println("unify order request prepay id failed: " + xmlResp.Return_msg)
+	if xmlResp.Return_code == wechatFail || xmlResp.ResultCode == wechatFail {
+		log.Errorf("unify order request prepay id failed: %s, %s", xmlResp.Return_msg, xmlResp.ErrCode)
 		return nil, errutil.ErrRequestPrePayIDFailed
 	}
 
@@ -210,7 +224,18 @@ func (wc *wechat) CreateOrderResponse(order *model.Order) (interface{}, error) {
 
 const format = "20060102150405"
 
-func (wc *wechat) Notify(request *protocol.WechatOrderCallbackRequest) (*model.Trade, interface{}, error) {
+func (wc *wechat) Notify(r *http.Request) (*model.Trade, error) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &protocol.WechatOrderCallbackRequest{}
+	if err := xml.Unmarshal(data, request); err != nil {
+		return nil, err
+	}
+	request.Raw = string(data)
+
 	var reqMap map[string]interface{}
 	reqMap = make(map[string]interface{}, 0)
 
@@ -244,46 +269,164 @@ func (wc *wechat) Notify(request *protocol.WechatOrderCallbackRequest) (*model.T
 	reqMap["attach"] = request.Attach
 	reqMap["time_end"] = request.TimeEnd
 
-	var resp protocol.WechatOrderCallbackResponse
-	if verify(reqMap, wc.appkey, request.Sign) {
-		resp.ReturnCode = "SUCCESS"
-		resp.ReturnMsg = "OK"
-	} else {
-		resp.ReturnCode = "FAIL"
-		resp.ReturnMsg = "failed to verify sign, please retry!"
+	if !verify(reqMap, wc.appkey, request.Sign) {
+		return nil, errutil.ErrVerifyFailed
+	}
+	if request.ReturnCode != wechatSuccess || request.ResultCode != wechatSuccess {
+		return nil, fmt.Errorf("wechat pay failed: %s, %s", request.ErrCode, request.ErrCodeDes)
 	}
 
-	//bytes, err := xml.Marshal(resp)
-	//cbResp := strings.Replace(string(bytes), "WechatOrderCallbackResponse", "xml", -1)
-	//if err != nil {
-	//	return nil, nil, err
-	//}
-
-	format := "<xml><return_code><![CDATA[%s]]></return_code><return_msg><![CDATA[%s]]></return_msg></xml>"
-
-	cbResp := fmt.Sprintf(format, resp.ReturnCode, resp.ReturnMsg)
-
-	fmt.Println("response: ", cbResp)
 	trade := &model.Trade{}
+	trade.PayPlatform = PlatformWechat
 	trade.PayOrderId = request.TransactionID
 	trade.OrderId = request.OutTradeNo
+	trade.Money = request.TotalFee
 
-	createAt, err := time.Parse(format, request.TimeEnd)
-	if err != nil {
-		createAt = time.Now()
-	}
-	trade.PayCreateAt = createAt.Unix()
-
-	payAt, err := time.Parse(format, request.TimeEnd)
+	payAt, err := time.ParseInLocation(format, request.TimeEnd, time.Local)
 	if err != nil {
 		payAt = time.Now()
 	}
+	trade.PayCreateAt = payAt.Unix()
 	trade.PayAt = payAt.Unix()
 
 	trade.MerchantId = request.MchID
 	trade.ComsumerId = request.Openid
 	trade.Raw = request.Raw
-	return trade, cbResp, nil
+	return trade, nil
+}
+
+func (wc *wechat) Reply(w http.ResponseWriter, err error) {
+	code, msg := wechatSuccess, "OK"
+	if err != nil {
+		code, msg = wechatFail, err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/xml;charset=utf-8")
+	fmt.Fprintf(w, "<xml><return_code><![CDATA[%s]]></return_code><return_msg><![CDATA[%s]]></return_msg></xml>", code, msg)
+}
+
+// 签名后发送请求, 校验并返回应答的字段
+func (wc *wechat) request(client *http.Client, url string, params map[string]interface{}) (map[string]string, error) {
+	params["appid"] = wc.appId
+	params["mch_id"] = wc.merId
+	params["nonce_str"] = algoutil.RandStr(32)
+
+	sign, err := signCalculator(params, wc.appkey)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("<xml>")
+	for k, v := range params {
+		if str, ok := v.(string); ok && str == "" {
+			continue
+		}
+		fmt.Fprintf(buf, "<%s>", k)
+		xml.EscapeText(buf, []byte(fmt.Sprint(v)))
+		fmt.Fprintf(buf, "</%s>", k)
+	}
+	fmt.Fprintf(buf, "<sign>%s</sign></xml>", sign)
+
+	response, err := client.Post(url, "application/xml;charset=utf-8", buf)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	fields, err := decodeXMLFields(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if fields["return_code"] != wechatSuccess {
+		return nil, fmt.Errorf("wechat request failed: %s", fields["return_msg"])
+	}
+
+	m := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if k != "sign" {
+			m[k] = v
+		}
+	}
+	if !verify(m, wc.appkey, fields["sign"]) {
+		return nil, errutil.ErrVerifyFailed
+	}
+	if fields["result_code"] != wechatSuccess {
+		return nil, fmt.Errorf("wechat request failed: %s, %s", fields["err_code"], fields["err_code_des"])
+	}
+	return fields, nil
+}
+
+// 解析<xml>根节点下的所有字段
+func decodeXMLFields(r io.Reader) (map[string]string, error) {
+	fields := map[string]string{}
+	decoder := xml.NewDecoder(r)
+	depth, key := 0, ""
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return fields, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			key = t.Name.Local
+		case xml.CharData:
+			if depth == 2 {
+				fields[key] += string(t)
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+func (wc *wechat) Query(order *model.Order) (*model.Trade, error) {
+	fields, err := wc.request(http.DefaultClient, wc.queryURL, map[string]interface{}{
+		"out_trade_no": order.OrderId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if fields["trade_state"] != wechatSuccess {
+		return nil, nil
+	}
+
+	money, _ := strconv.Atoi(fields["total_fee"])
+	payAt, err := time.ParseInLocation(format, fields["time_end"], time.Local)
+	if err != nil {
+		payAt = time.Now()
+	}
+	return &model.Trade{
+		OrderId:     order.OrderId,
+		PayOrderId:  fields["transaction_id"],
+		PayPlatform: PlatformWechat,
+		PayAt:       payAt.Unix(),
+		PayCreateAt: payAt.Unix(),
+		ComsumerId:  fields["openid"],
+		MerchantId:  fields["mch_id"],
+		Money:       money,
+	}, nil
+}
+
+func (wc *wechat) Refund(order *model.Order, reason string) error {
+	if wc.refundClient == nil {
+		return errors.New("the wechat's certificate is not configured")
+	}
+
+	_, err := wc.request(wc.refundClient, wc.refundURL, map[string]interface{}{
+		"out_trade_no":  order.OrderId,
+		"out_refund_no": order.OrderId,
+		"total_fee":     order.Money,
+		"refund_fee":    order.Money,
+		"refund_desc":   reason,
+	})
+	return err
 }
 
 func (wc *wechat) Setup() error {
@@ -295,6 +438,10 @@ func (wc *wechat) Setup() error {
 		merId         = viper.GetString("wechat.mer_id")
 		unifyOrderURL = viper.GetString("wechat.unify_order_url")
 		callbackURL   = viper.GetString("wechat.callback_url")
+		queryURL      = viper.GetString("wechat.query_url")
+		refundURL     = viper.GetString("wechat.refund_url")
+		cert          = viper.GetString("wechat.cert")
+		key           = viper.GetString("wechat.key")
 	)
 	if unifyOrderURL == "" || callbackURL == "" || appId == "" || appKey == "" || merId == "" {
 		log.Debugf("appId=%s, appKey=%s, merId=%s, unifyOrderURL=%s, callbackURL=%s", appId,
@@ -309,5 +456,25 @@ func (wc *wechat) Setup() error {
 	wc.merId = merId
 	wc.callbackURL = callbackURL
 	wc.unifyOrderURL = unifyOrderURL
+
+	if queryURL == "" {
+		queryURL = defaultWechatQueryURL
+	}
+	if refundURL == "" {
+		refundURL = defaultWechatRefundURL
+	}
+	wc.queryURL = queryURL
+	wc.refundURL = refundURL
+
+	// 没有配置商户证书时不能退款
+	if cert != "" && key != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return err
+		}
+		wc.refundClient = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{Certificates: []tls.Certificate{pair}}},
+		}
+	}
 	return nil
 }
@@ -0,0 +1,49 @@
+package sms
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// 不发送短信, 验证码写入配置sms.file指定的文件, 没有配置时写入日志
+type logSender struct {
+	sync.Mutex
+	file string
+}
+
+var Log = &logSender{}
+
+func (l *logSender) Name() string {
+	return SenderLog
+}
+
+func (l *logSender) Setup() error {
+	log.Info("sms_sender: log setup")
+
+	l.file = viper.GetString("sms.file")
+	return nil
+}
+
+func (l *logSender) Send(phone, typ, code string) error {
+	if l.file == "" {
+		log.Infof("短信验证码: Phone=%s, Type=%s, Code=%s", phone, typ, code)
+		return nil
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	f, err := os.OpenFile(l.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\t%s\n", time.Now().Format("2006-01-02 15:04:05"), phone, typ, code)
+	return err
+}
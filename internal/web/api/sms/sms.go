@@ -0,0 +1,56 @@
+package sms
+
+import (
+	"errors"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// SenderLog 只记录到日志或文件的短信通道, 用于测试环境
+const SenderLog = "log"
+
+// Sender 短信通道, 接入短信平台时实现该接口并加入Setup的列表
+type Sender interface {
+	// Name 短信通道名称, 对应配置sms.sender
+	Name() string
+
+	// Setup 读取配置, 配置无效时返回错误, 该通道不可用
+	Setup() error
+
+	// Send 向手机号发送验证码, typ为验证码类型, 短信平台通常使用不同的模板
+	Send(phone, typ, code string) error
+}
+
+var sender Sender
+
+// Setup 初始化配置sms.sender指定的短信通道, 默认只记录日志
+func Setup() {
+	name := strings.ToLower(strings.TrimSpace(viper.GetString("sms.sender")))
+	if name == "" {
+		name = SenderLog
+	}
+
+	all := []Sender{Log}
+	for _, s := range all {
+		if s.Name() != name {
+			continue
+		}
+		if err := s.Setup(); err != nil {
+			log.Warnf("短信通道不可用: %s, Error=%v", name, err)
+			return
+		}
+		sender = s
+		return
+	}
+	log.Warnf("短信通道不存在: %s", name)
+}
+
+// Send 使用配置的短信通道发送验证码
+func Send(phone, typ, code string) error {
+	if sender == nil {
+		return errors.New("sms sender not available")
+	}
+	return sender.Send(phone, typ, code)
+}
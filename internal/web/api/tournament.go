@@ -0,0 +1,166 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/internal/game"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/pkg/whitelist"
+	"github.com/lonng/nanoserver/protocol"
+	"github.com/lonng/nex"
+)
+
+func MakeTournamentService() http.Handler {
+	router := mux.NewRouter()
+	router.Handle("/v1/tournament/create", nex.Handler(createTournament)).Methods("POST") //创建比赛
+	router.Handle("/v1/tournament/list", nex.Handler(tournamentList)).Methods("GET")      //比赛列表, 参数status, offset, count
+	router.Handle("/v1/tournament/{id}", nex.Handler(tournamentByID)).Methods("GET")      //比赛详情以及排名
+	return router
+}
+
+func tournamentInfo(t *model.Tournament) protocol.TournamentInfo {
+	count, _ := db.TournamentPlayerCount(t.Id)
+	return protocol.TournamentInfo{
+		Id:         t.Id,
+		Name:       t.Name,
+		RoomType:   t.RoomType,
+		Level:      t.Level,
+		Mode:       t.Mode,
+		Round:      t.Round,
+		EntryFee:   t.EntryFee,
+		Prizes:     db.DecodePrizes(t.Prizes),
+		MinPlayers: t.MinPlayers,
+		MaxPlayers: t.MaxPlayers,
+		Players:    int(count),
+		Stage:      t.Stage,
+		Status:     t.Status,
+		RegisterAt: t.RegisterAt,
+		StartAt:    t.StartAt,
+		FinishedAt: t.FinishedAt,
+	}
+}
+
+func createTournament(r *http.Request, data *protocol.CreateTournamentRequest) (*protocol.TournamentDetailResponse, error) {
+	if !whitelist.VerifyIP(r.RemoteAddr) {
+		return nil, errutil.ErrPermissionDenied
+	}
+
+	data.Name = strings.TrimSpace(data.Name)
+	switch {
+	case data.Name == "",
+		data.RoomType != protocol.RoomTypeDailyMatch && data.RoomType != protocol.RoomTypeMonthlyMatch && data.RoomType != protocol.RoomTypeFinalMatch,
+		data.Level < protocol.DailyMatchLevelJunior || data.Level > protocol.DailyMatchLevelMaster,
+		data.Mode != 3 && data.Mode != 4,
+		data.Round != 1 && data.Round != 4 && data.Round != 8 && data.Round != 16,
+		data.EntryFee < 0,
+		data.MinPlayers < data.Mode,
+		data.MaxPlayers > 0 && data.MaxPlayers < data.MinPlayers,
+		data.StartAt <= time.Now().Unix() || data.RegisterAt >= data.StartAt:
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	for _, p := range data.Prizes {
+		if p < 0 {
+			return nil, errutil.ErrInvalidParameter
+		}
+	}
+
+	t := &model.Tournament{
+		Name:       data.Name,
+		RoomType:   data.RoomType,
+		Level:      data.Level,
+		Mode:       data.Mode,
+		Round:      data.Round,
+		EntryFee:   data.EntryFee,
+		Prizes:     db.EncodePrizes(data.Prizes),
+		MinPlayers: data.MinPlayers,
+		MaxPlayers: data.MaxPlayers,
+		Status:     model.TournamentStatusRegistering,
+		RegisterAt: data.RegisterAt,
+		StartAt:    data.StartAt,
+		CreatedAt:  time.Now().Unix(),
+	}
+	if err := db.InsertTournament(t); err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	game.AddTournament(t)
+	logger.Infof("创建比赛: %+v", t)
+	return &protocol.TournamentDetailResponse{Data: tournamentInfo(t), Players: []protocol.TournamentPlayer{}}, nil
+}
+
+func tournamentList(form *nex.Form) (*protocol.TournamentListResponse, error) {
+	status := form.IntOrDefault("status", 0)
+	offset := form.IntOrDefault("offset", 0)
+	count := form.IntOrDefault("count", 20)
+	if offset < 0 || count <= 0 || count > 100 {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	list, total, err := db.TournamentList(status, offset, count)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]protocol.TournamentInfo, len(list))
+	for i := range list {
+		data[i] = tournamentInfo(&list[i])
+	}
+	return &protocol.TournamentListResponse{Data: data, Total: total}, nil
+}
+
+func tournamentByID(r *http.Request) (*protocol.TournamentDetailResponse, error) {
+	idStr, ok := mux.Vars(r)["id"]
+	if !ok || idStr == "" {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 0)
+	if err != nil {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	t, err := db.QueryTournament(id)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := db.TournamentPlayers(id)
+	if err != nil {
+		return nil, err
+	}
+
+	players := make([]protocol.TournamentPlayer, 0, len(list))
+	for _, tp := range list {
+		if tp.Status == model.TournamentPlayerRefunded && t.Status != model.TournamentStatusCanceled {
+			continue
+		}
+		players = append(players, protocol.TournamentPlayer{
+			Uid:    tp.Uid,
+			Name:   tp.Name,
+			Score:  tp.Score,
+			Stage:  tp.Stage,
+			Rank:   tp.Rank,
+			Prize:  tp.Prize,
+			Status: tp.Status,
+		})
+	}
+
+	// 已经有名次的按名次排在前面
+	sort.SliceStable(players, func(i, j int) bool {
+		ri, rj := players[i].Rank, players[j].Rank
+		if ri == 0 || rj == 0 {
+			return rj == 0 && ri != 0
+		}
+		return ri < rj
+	})
+	return &protocol.TournamentDetailResponse{Data: tournamentInfo(t), Players: players}, nil
+}
@@ -3,53 +3,51 @@ package web
 import (
 	"context"
 	"errors"
-	"net/http"
 	"strings"
 	"time"
 
 	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
 	"github.com/lonng/nanoserver/internal/game"
 	"github.com/lonng/nanoserver/internal/web/api"
 	"github.com/lonng/nanoserver/pkg/errutil"
 	"github.com/lonng/nanoserver/protocol"
 	"github.com/lonng/nex"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 )
 
-func authFilter(_ context.Context, r *http.Request) (context.Context, error) {
-	parts := strings.Split(r.RemoteAddr, ":")
-	if len(parts) < 2 {
-		return context.Background(), errutil.ErrPermissionDenied
-	}
-
-	if parts[0] != "127.0.0.1" {
-		return context.Background(), errutil.ErrPermissionDenied
-	}
-
-	return context.Background(), nil
-}
-
-func broadcast(query *nex.Form) (*protocol.StringMessage, error) {
+func broadcast(ctx context.Context, query *nex.Form) (*protocol.StringMessage, error) {
 	message := strings.TrimSpace(query.Get("message"))
 	if message == "" || len(message) < 5 {
 		return nil, errors.New("消息不可小于5个字")
 	}
 	api.AddMessage(message)
 	game.BroadcastSystemMessage(message)
+	audit(ctx, auditBroadcast, 0, "消息广播: %s", message)
+	return protocol.SuccessMessage, nil
+}
+
+func drainHandler(ctx context.Context, query *nex.Form) (*protocol.StringMessage, error) {
+	countdown := query.IntOrDefault("countdown", viper.GetInt("core.drain"))
+	log.Infof("停服维护: 倒计时=%d秒", countdown)
+	game.Drain(countdown)
+	audit(ctx, auditDrain, 0, "停服维护: 倒计时=%d秒", countdown)
 	return protocol.SuccessMessage, nil
 }
 
-func resetPlayerHandler(query *nex.Form) (*protocol.StringMessage, error) {
+func resetPlayerHandler(ctx context.Context, query *nex.Form) (*protocol.StringMessage, error) {
 	uid := query.Int64OrDefault("uid", -1)
 	if uid <= 0 {
 		return nil, errutil.ErrIllegalParameter
 	}
 	log.Infof("手动重置玩家数据: Uid=%d", uid)
 	game.Reset(uid)
+	audit(ctx, auditReset, uid, "重置玩家数据")
 	return protocol.SuccessMessage, nil
 }
 
-func kickHandler(query *nex.Form) (*protocol.StringMessage, error) {
+func kickHandler(ctx context.Context, query *nex.Form) (*protocol.StringMessage, error) {
 	uid := query.Int64OrDefault("uid", -1)
 	if uid <= 0 {
 		return nil, errutil.ErrIllegalParameter
@@ -60,6 +58,7 @@ func kickHandler(query *nex.Form) (*protocol.StringMessage, error) {
 		return nil, err
 	}
 
+	audit(ctx, auditKick, uid, "踢玩家下线")
 	return protocol.SuccessMessage, nil
 }
 
@@ -74,36 +73,45 @@ func onlineHandler(query *nex.Form) (interface{}, error) {
 	return db.OnlineStats(begin, end)
 }
 
-func rechargeHandler(data *protocol.RechargeRequest) (*protocol.StringMessage, error) {
-	if data.Uid < 1 || data.Count < 1 {
+func rechargeHandler(ctx context.Context, data *protocol.RechargeRequest) (*protocol.StringMessage, error) {
+	if data.Uid < 1 || data.Count < 1 || len(data.Key) > 32 {
 		return nil, errutil.ErrIllegalParameter
 	}
-	u, err := db.QueryUser(data.Uid)
-	if err != nil {
-		return nil, err
-	}
 
-	u.Coin += data.Count
-
-	if err := db.UpdateUser(u); err != nil {
+	// 客户端重试时使用相同的Key, 避免重复充值
+	var key string
+	if data.Key != "" {
+		key = "admin:" + data.Key
+	}
+	coin, err := db.ChangeWallet(&db.WalletChange{
+		Uid:     data.Uid,
+		Type:    model.WalletAdmin,
+		Amount:  data.Count,
+		RefType: model.WalletRefAdmin,
+		RefId:   currentAdmin(ctx).admin.Account,
+		Key:     key,
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	// 通知客户端
-	game.Recharge(u.Id, u.Coin)
+	game.Recharge(data.Uid, coin)
 
 	log.Infof("给玩家充值: Uid=%d, end=%d", data.Uid, data.Count)
+	audit(ctx, auditRecharge, data.Uid, "给玩家充值: 数量=%d, 充值后=%d", data.Count, coin)
 	return protocol.SuccessMessage, nil
 }
 
 // http://127.0.0.1:12306/v1/gm/consume?consume="4/1,8/1,16/2"
-func cardConsumeHandler(query *nex.Form) (*protocol.StringMessage, error) {
+func cardConsumeHandler(ctx context.Context, query *nex.Form) (*protocol.StringMessage, error) {
 	consume := query.Get("consume")
 	if consume == "" {
 		return nil, errutil.ErrIllegalParameter
 	}
 	log.Infof("手动重置房卡消耗数据: %s", consume)
 	game.SetCardConsume(consume)
+	audit(ctx, auditConsume, 0, "设置房卡消耗: %s", consume)
 	return protocol.SuccessMessage, nil
 }
 func userInfoHandler(query *nex.Form) (interface{}, error) {
@@ -114,3 +122,165 @@ func userInfoHandler(query *nex.Form) (interface{}, error) {
 
 	return db.QueryUserInfo(id)
 }
+
+// 玩家的房卡流水
+func walletLedgerHandler(form *nex.Form) (*protocol.WalletLedgerResponse, error) {
+	uid := form.Int64OrDefault("uid", 0)
+	offset := form.IntOrDefault("offset", 0)
+	count := form.IntOrDefault("count", 20)
+	if uid <= 0 || offset < 0 || count <= 0 || count > 100 {
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	list, total, err := db.WalletLedgers(uid, offset, count)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]protocol.WalletLedger, len(list))
+	for i, l := range list {
+		data[i] = protocol.WalletLedger{
+			Id:        l.Id,
+			Uid:       l.Uid,
+			Type:      l.Type,
+			Amount:    l.Amount,
+			Balance:   l.Balance,
+			RefType:   l.RefType,
+			RefId:     l.RefId,
+			Remark:    l.Remark,
+			CreatedAt: l.CreatedAt,
+		}
+	}
+	return &protocol.WalletLedgerResponse{Data: data, Total: total}, nil
+}
+
+func productDetail(p *model.Product) protocol.Product {
+	channels := []string{}
+	if p.Channels != "" {
+		channels = strings.Split(p.Channels, ",")
+	}
+	return protocol.Product{
+		Id:         p.Id,
+		Sku:        p.Sku,
+		Name:       p.Name,
+		Price:      p.Price,
+		CardCount:  p.CardCount,
+		BonusCount: p.BonusCount,
+		FirstBonus: p.FirstBonus,
+		FirstOnly:  p.FirstOnly == 1,
+		Channels:   channels,
+		Sort:       p.Sort,
+		Status:     p.Status,
+		CreatedAt:  p.CreatedAt,
+		UpdatedAt:  p.UpdatedAt,
+	}
+}
+
+// 商品列表, 包括已经下架的商品
+func productListHandler() (*protocol.ProductListResponse, error) {
+	list, err := db.ProductList()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]protocol.Product, len(list))
+	for i := range list {
+		data[i] = productDetail(&list[i])
+	}
+	return &protocol.ProductListResponse{Data: data}, nil
+}
+
+// 新增或者修改商品, SKU创建后不能修改
+func saveProductHandler(ctx context.Context, data *protocol.SaveProductRequest) (*protocol.SaveProductResponse, error) {
+	data.Sku = strings.TrimSpace(data.Sku)
+	data.Name = strings.TrimSpace(data.Name)
+	if data.Name == "" || data.Price <= 0 || data.CardCount <= 0 || data.BonusCount < 0 || data.FirstBonus < 0 {
+		return nil, errutil.ErrIllegalParameter
+	}
+	if data.Status != model.ProductStatusOnSale && data.Status != model.ProductStatusOff {
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	channels := make([]string, 0, len(data.Channels))
+	for _, c := range data.Channels {
+		if c = strings.TrimSpace(c); c != "" {
+			channels = append(channels, c)
+		}
+	}
+
+	p := &model.Product{
+		Id:         data.Id,
+		Name:       data.Name,
+		Price:      data.Price,
+		CardCount:  data.CardCount,
+		BonusCount: data.BonusCount,
+		FirstBonus: data.FirstBonus,
+		Channels:   strings.Join(channels, ","),
+		Sort:       data.Sort,
+		Status:     data.Status,
+		UpdatedAt:  time.Now().Unix(),
+	}
+	if data.FirstOnly {
+		p.FirstOnly = 1
+	}
+	if len(p.Channels) > 255 || len(p.Name) > 64 {
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	if p.Id == 0 {
+		if data.Sku == "" || len(data.Sku) > 32 {
+			return nil, errutil.ErrIllegalParameter
+		}
+		p.Sku = data.Sku
+		p.CreatedAt = p.UpdatedAt
+		if err := db.InsertProduct(p); err != nil {
+			return nil, err
+		}
+	} else {
+		old, err := db.QueryProduct(p.Id)
+		if err != nil {
+			return nil, err
+		}
+		p.Sku, p.CreatedAt = old.Sku, old.CreatedAt
+		if err := db.UpdateProduct(p); err != nil {
+			return nil, err
+		}
+	}
+
+	audit(ctx, auditProduct, p.Id, "保存商品: SKU=%s, 价格=%d, 房卡=%d+%d, 首充赠送=%d, 状态=%d",
+		p.Sku, p.Price, p.CardCount, p.BonusCount, p.FirstBonus, p.Status)
+	return &protocol.SaveProductResponse{Detail: productDetail(p)}, nil
+}
+
+// 指定俱乐部部长, 用于没有部长的俱乐部或者部长无法联系时
+func clubOwnerHandler(ctx context.Context, query *nex.Form) (*protocol.StringMessage, error) {
+	clubId := query.Int64OrDefault("club", -1)
+	uid := query.Int64OrDefault("uid", -1)
+	if clubId <= 0 || uid <= 0 {
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	c, err := db.AssignClubOwner(clubId, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	game.NotifyClub(uid, protocol.ClubNotifyRoleChanged, c, model.UserClubRoleOwner)
+	audit(ctx, auditClubOwner, uid, "指定俱乐部部长: 俱乐部ID=%d", clubId)
+	return protocol.SuccessMessage, nil
+}
+
+// 后台给俱乐部充值房卡
+func clubRechargeHandler(ctx context.Context, data *protocol.ClubRechargeRequest) (*protocol.ClubRechargeResponse, error) {
+	if data.ClubId <= 0 || data.Amount <= 0 || len(data.Remark) > 255 {
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	balance, err := db.AdminClubRecharge(currentAdmin(ctx).admin.Id, data.ClubId, data.Amount, data.Remark)
+	if err != nil {
+		return nil, err
+	}
+
+	audit(ctx, auditClubCharge, data.ClubId, "俱乐部充值: 数量=%d, 余额=%d, 备注=%s", data.Amount, balance, data.Remark)
+	return &protocol.ClubRechargeResponse{Balance: balance}, nil
+}
@@ -0,0 +1,17 @@
+package web
+
+import (
+	"github.com/lonng/nanoserver/internal/web/api"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
+	"github.com/lonng/nex"
+)
+
+// 牌局回放, 参数id为历史记录ID, step为回放的步数, 默认回放到最后一步
+func historyReplayHandler(form *nex.Form) (*protocol.HistoryReplayResponse, error) {
+	id := form.Int64OrDefault("id", 0)
+	if id <= 0 {
+		return nil, errutil.ErrIllegalParameter
+	}
+	return api.HistoryReplay(id, form.IntOrDefault("step", -1))
+}
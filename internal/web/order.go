@@ -0,0 +1,60 @@
+package web
+
+import (
+	"context"
+	"strings"
+
+	"github.com/lonng/nanoserver/internal/web/api"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
+	"github.com/lonng/nex"
+)
+
+// 订单列表
+func orderListHandler(form *nex.Form) (*protocol.OrderListResponse, error) {
+	request := &protocol.OrderListRequest{
+		Offset:    form.IntOrDefault("offset", 0),
+		Count:     form.IntOrDefault("count", -1),
+		PayBy:     strings.ToLower(form.Get("pay_by")),
+		Status:    uint8(form.IntOrDefault("status", 0)),
+		AppID:     form.Get("appid"),
+		ChannelID: form.Get("channel_id"),
+		Start:     form.Int64OrDefault("start", -1),
+		End:       form.Int64OrDefault("end", -1),
+		Uid:       form.Get("uid"),
+		OrderID:   form.Get("order_id"),
+	}
+
+	list, total, err := api.OrderList(request)
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.OrderListResponse{Data: list, Total: total}, nil
+}
+
+// 订单退款, 扣回房卡后向支付平台退款, 支付平台退款失败时可以重试
+func refundOrderHandler(ctx context.Context, data *protocol.RefundOrderRequest) (*protocol.RefundOrderResponse, error) {
+	if data.OrderId == "" || len(data.Reason) > 255 {
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	resp, err := api.RefundOrder(data.OrderId, data.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	audit(ctx, auditOrderRefund, 0, "订单退款: OrderId=%s, 原因=%s, 房卡余额=%d", data.OrderId, data.Reason, resp.Coin)
+	return resp, nil
+}
+
+// 订单对账
+func reconcileOrdersHandler(form *nex.Form) (*protocol.OrderReconcileResponse, error) {
+	start := form.Int64OrDefault("start", -1)
+	end := form.Int64OrDefault("end", -1)
+	offset := form.IntOrDefault("offset", 0)
+	count := form.IntOrDefault("count", 20)
+	if offset < 0 || count <= 0 || count > 100 {
+		return nil, errutil.ErrIllegalParameter
+	}
+	return api.ReconcileOrders(start, end, offset, count)
+}
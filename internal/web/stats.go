@@ -103,3 +103,28 @@ func activationUsersHandler(query *nex.Form) (interface{}, error) {
 	return &protocol.RetentionResponse{Data: ret}, nil
 
 }
+
+// 房卡对账, 列出余额与流水合计不一致的玩家
+func walletReconcileHandler(query *nex.Form) (*protocol.WalletReconcileResponse, error) {
+	offset := query.IntOrDefault("offset", 0)
+	count := query.IntOrDefault("count", 20)
+	if offset < 0 || count <= 0 || count > 100 {
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	list, total, err := db.ReconcileWallet(offset, count)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]protocol.WalletMismatch, len(list))
+	for i, m := range list {
+		data[i] = protocol.WalletMismatch{
+			Uid:    m.Uid,
+			Coin:   m.Coin,
+			Ledger: m.Ledger,
+			Diff:   m.Coin - m.Ledger,
+		}
+	}
+	return &protocol.WalletReconcileResponse{Data: data, Total: total}, nil
+}
@@ -9,8 +9,10 @@ import (
 	"syscall"
 
 	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/internal/game"
 	"github.com/lonng/nanoserver/internal/web/api"
 	"github.com/lonng/nanoserver/pkg/algoutil"
+	"github.com/lonng/nanoserver/pkg/async"
 	"github.com/lonng/nanoserver/pkg/whitelist"
 	"github.com/lonng/nanoserver/protocol"
 	"github.com/lonng/nex"
@@ -72,23 +74,50 @@ func startupService() http.Handler {
 	mux.Handle("/v1/order/", api.MakeOrderService())
 	mux.Handle("/v1/history/", api.MakeHistoryService())
 	mux.Handle("/v1/desk/", api.MakeDeskService())
+	mux.Handle("/v1/tournament/", api.MakeTournamentService())
+	mux.Handle("/v1/club/", api.MakeClubService())
+	mux.Handle("/v1/agent/", api.MakeAgentService())
 	mux.Handle("/v1/version", nex.Handler(version))
 
+	// 后台账号
+	mux.Handle("/v1/admin/login", nex.Handler(adminLogin))                                // 登录
+	mux.Handle("/v1/admin/info", nex.Handler(adminInfo).Before(authorize(permView)))      // 当前管理员信息
+	mux.Handle("/v1/admin/apikey", nex.Handler(resetApiKey).Before(authorize(permView)))  // 重新生成API Key
+	mux.Handle("/v1/admin/create", nex.Handler(createAdmin).Before(authorize(permAdmin))) // 新增管理员
+	mux.Handle("/v1/admin/update", nex.Handler(updateAdmin).Before(authorize(permAdmin))) // 修改管理员
+	mux.Handle("/v1/admin/list", nex.Handler(adminList).Before(authorize(permAdmin)))     // 管理员列表
+	mux.Handle("/v1/admin/audit", nex.Handler(adminAudits).Before(authorize(permAdmin)))  // 操作日志
+
 	// GM系统命令
-	mux.Handle("/v1/gm/reset", nex.Handler(resetPlayerHandler).Before(authFilter))   // 重置玩家未完成房间状态
-	mux.Handle("/v1/gm/consume", nex.Handler(cardConsumeHandler).Before(authFilter)) // 设置房卡消耗
-	mux.Handle("/v1/gm/broadcast", nex.Handler(broadcast).Before(authFilter))        // 消息广播
-	mux.Handle("/v1/gm/kick", nex.Handler(kickHandler).Before(authFilter))           // 踢人
-	mux.Handle("/v1/gm/online", nex.Handler(onlineHandler).Before(authFilter))       // 在线信息
-	mux.Handle("/v1/gm/recharge", nex.Handler(rechargeHandler).Before(authFilter))   // 玩家充值
-	mux.Handle("/v1/gm/query/user/", nex.Handler(userInfoHandler))                   // 玩家信息查询
+	mux.Handle("/v1/gm/reset", nex.Handler(resetPlayerHandler).Before(authorize(permOperate)))                // 重置玩家未完成房间状态
+	mux.Handle("/v1/gm/consume", nex.Handler(cardConsumeHandler).Before(authorize(permOperate)))              // 设置房卡消耗
+	mux.Handle("/v1/gm/broadcast", nex.Handler(broadcast).Before(authorize(permOperate)))                     // 消息广播
+	mux.Handle("/v1/gm/kick", nex.Handler(kickHandler).Before(authorize(permOperate)))                        // 踢人
+	mux.Handle("/v1/gm/online", nex.Handler(onlineHandler).Before(authorize(permView)))                       // 在线信息
+	mux.Handle("/v1/gm/recharge", nex.Handler(rechargeHandler).Before(authorize(permRecharge)))               // 玩家充值
+	mux.Handle("/v1/gm/query/user/", nex.Handler(userInfoHandler).Before(authorize(permView)))                // 玩家信息查询
+	mux.Handle("/v1/gm/drain", nex.Handler(drainHandler).Before(authorize(permOperate)))                      // 停服维护
+	mux.Handle("/v1/gm/wallet/ledger", nex.Handler(walletLedgerHandler).Before(authorize(permView)))          // 房卡流水
+	mux.Handle("/v1/gm/product/list", nex.Handler(productListHandler).Before(authorize(permView)))            // 商品列表
+	mux.Handle("/v1/gm/product/save", nex.Handler(saveProductHandler).Before(authorize(permRecharge)))        // 新增/修改商品
+	mux.Handle("/v1/gm/club/owner", nex.Handler(clubOwnerHandler).Before(authorize(permOperate)))             // 指定俱乐部部长
+	mux.Handle("/v1/gm/club/recharge", nex.Handler(clubRechargeHandler).Before(authorize(permRecharge)))      // 俱乐部充值
+	mux.Handle("/v1/gm/agent/register", nex.Handler(registerAgentHandler).Before(authorize(permRecharge)))    // 新增代理
+	mux.Handle("/v1/gm/agent/list", nex.Handler(agentListHandler).Before(authorize(permView)))                // 代理列表
+	mux.Handle("/v1/gm/agent/card", nex.Handler(addAgentCardHandler).Before(authorize(permRecharge)))         // 增加代理库存
+	mux.Handle("/v1/gm/agent/level", nex.Handler(setAgentLevelHandler).Before(authorize(permRecharge)))       // 修改代理等级
+	mux.Handle("/v1/gm/order/list", nex.Handler(orderListHandler).Before(authorize(permRecharge)))            // 订单列表
+	mux.Handle("/v1/gm/order/refund", nex.Handler(refundOrderHandler).Before(authorize(permRecharge)))        // 订单退款
+	mux.Handle("/v1/gm/order/reconcile", nex.Handler(reconcileOrdersHandler).Before(authorize(permRecharge))) // 订单对账
+	mux.Handle("/v1/gm/history/replay", nex.Handler(historyReplayHandler).Before(authorize(permView)))        // 牌局回放
 
 	//统计后台
-	mux.Handle("/v1/stats/user/register", nex.Handler(registerUsersHandler).Before(authFilter))     // 注册人数
-	mux.Handle("/v1/stats/user/activation", nex.Handler(activationUsersHandler).Before(authFilter)) // 活跃人数
-	mux.Handle("/v1/stats/online", nex.Handler(onlineLiteHandler).Before(authFilter))               // 同时在线人、桌数
-	mux.Handle("/v1/stats/retention", nex.Handler(retentionHandler).Before(authFilter))             // 留存
-	mux.Handle("/v1/stats/consume", nex.Handler(cardConsumeStatsHandler).Before(authFilter))        // 房卡消耗
+	mux.Handle("/v1/stats/user/register", nex.Handler(registerUsersHandler).Before(authorize(permView)))          // 注册人数
+	mux.Handle("/v1/stats/user/activation", nex.Handler(activationUsersHandler).Before(authorize(permView)))      // 活跃人数
+	mux.Handle("/v1/stats/online", nex.Handler(onlineLiteHandler).Before(authorize(permView)))                    // 同时在线人、桌数
+	mux.Handle("/v1/stats/retention", nex.Handler(retentionHandler).Before(authorize(permView)))                  // 留存
+	mux.Handle("/v1/stats/consume", nex.Handler(cardConsumeStatsHandler).Before(authorize(permView)))             // 房卡消耗
+	mux.Handle("/v1/stats/wallet/reconcile", nex.Handler(walletReconcileHandler).Before(authorize(permRecharge))) // 房卡对账
 
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(webDir))))
 	mux.Handle("/ping", nex.Handler(pongHandler))
@@ -104,6 +133,15 @@ func Startup() {
 	// enable white list
 	enableWhiteList()
 
+	// 创建初始的超级管理员
+	setupAdmin()
+
+	// 加载报名中的比赛
+	game.LoadTournaments()
+
+	// 加载俱乐部房间模板
+	game.LoadClubTemplates()
+
 	var (
 		addr      = viper.GetString("webserver.addr")
 		cert      = viper.GetString("webserver.certificates.cert")
@@ -122,11 +160,27 @@ func Startup() {
 		}
 	}()
 
-	sg := make(chan os.Signal)
-	signal.Notify(sg, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGKILL)
-	// stop server
-	select {
-	case s := <-sg:
-		log.Infof("got signal: %s", s.String())
+	sg := make(chan os.Signal, 1)
+	signal.Notify(sg, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGUSR2)
+
+	// stop server, SIGUSR2表示平滑停服: 等待所有房间结算后再关闭游戏服
+	for running := true; running; {
+		select {
+		case s := <-sg:
+			log.Infof("got signal: %s", s.String())
+			if s == syscall.SIGUSR2 {
+				game.Drain(viper.GetInt("core.drain"))
+				continue
+			}
+			game.Shutdown()
+			<-game.Stopped()
+			running = false
+
+		case <-game.Stopped():
+			running = false
+		}
 	}
+
+	// 等待异步任务完成后再关闭数据库
+	async.Wait()
 }
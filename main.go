@@ -9,6 +9,7 @@ import (
 
 	"github.com/lonng/nanoserver/internal/game"
 	"github.com/lonng/nanoserver/internal/web"
+	"github.com/lonng/nanoserver/pkg/token"
 
 	_ "github.com/go-sql-driver/mysql"
 	log "github.com/sirupsen/logrus"
@@ -63,6 +64,14 @@ func serve(c *cli.Context) error {
 		defer pprof.StopCPUProfile()
 	}
 
+	// 登录token的签名密钥和有效期, 游戏服和web服共用,
+	// 随机密钥在重启后失效, 恢复的房间中所有玩家都需要重新登录, 只允许在调试模式下使用
+	secret := viper.GetString("token.secret")
+	if secret == "" && !viper.GetBool("core.debug") {
+		log.Fatal("非调试模式必须配置token.secret")
+	}
+	token.Setup(secret, viper.GetInt("token.expires"))
+
 	wg := sync.WaitGroup{}
 	wg.Add(2)
 
@@ -70,5 +79,6 @@ func serve(c *cli.Context) error {
 	go func() { defer wg.Done(); web.Startup() }()  // 开启web服务器
 
 	wg.Wait()
+	log.Info("server stopped")
 	return nil
 }
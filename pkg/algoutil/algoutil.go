@@ -25,9 +25,9 @@ import (
 	"time"
 
 	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/pkg/security"
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/transform"
-	//"triple/modules/security"
 	"github.com/lonng/nanoserver/pkg/crypto"
 )
 
@@ -156,12 +156,13 @@ func VerifyRSAWithMD5(pubKey string, data []byte, sign string) error {
 	return errutil.ErrIllegalParameter
 }
 
-//func MaskPhone(phone string) (string, error) {
-//	if !security.ValidatePhone(phone) {
-//		return "", errutil.ErrWrongPhoneNumber
-//	}
-//	return fmt.Sprintf("%s****%s", phone[:3], phone[7:]), nil
-//}
+// MaskPhone 隐藏手机号中间4位
+func MaskPhone(phone string) (string, error) {
+	if !security.ValidatePhone(phone) {
+		return "", errutil.ErrWrongPhoneNumber
+	}
+	return fmt.Sprintf("%s****%s", phone[:3], phone[7:]), nil
+}
 
 // 生成随机字符串
 func RandStr(strlen int) string {
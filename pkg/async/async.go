@@ -1,6 +1,12 @@
 package async
 
-import "github.com/sirupsen/logrus"
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var wg sync.WaitGroup
 
 func pcall(fn func()) {
 	defer func() {
@@ -13,5 +19,14 @@ func pcall(fn func()) {
 }
 
 func Run(fn func()) {
-	go pcall(fn)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		pcall(fn)
+	}()
+}
+
+// Wait 等待所有异步任务执行完成, 用于关闭服务前
+func Wait() {
+	wg.Wait()
 }
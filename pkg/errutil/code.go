@@ -50,6 +50,26 @@ const (
 	yxProductionNotFound
 	yxRequestPrePayIDFailed
 	YXDeskNotFound
+	yxTokenExpired
+	yxTokenRevoked
+	yxClubNotFound
+	yxClubFull
+	yxClubMemberNotFound
+	yxClubApplyNotFound
+	yxClubTemplateNotFound
+	yxClubTemplateLimited
+	yxAgentNotFound
+	yxAgentDisabled
+	yxAgentCardNotEnough
+	yxAdminNotFound
+	yxWalletKeyConflict
+	yxOrderStatus
+	yxTradeUsed
+	yxProductNotFound
+	yxProductUnavailable
+	yxSkuExists
+	yxWrongPhoneNumber
+	yxVerificationInvalid
 )
 
 var errs = map[error]int{
@@ -96,4 +116,24 @@ var errs = map[error]int{
 	ErrProductionNotFound:    yxProductionNotFound,
 	ErrRequestPrePayIDFailed: yxRequestPrePayIDFailed,
 	ErrDeskNotFound:          YXDeskNotFound,
+	ErrTokenExpired:          yxTokenExpired,
+	ErrTokenRevoked:          yxTokenRevoked,
+	ErrClubNotFound:          yxClubNotFound,
+	ErrClubFull:              yxClubFull,
+	ErrClubMemberNotFound:    yxClubMemberNotFound,
+	ErrClubApplyNotFound:     yxClubApplyNotFound,
+	ErrClubTemplateNotFound:  yxClubTemplateNotFound,
+	ErrClubTemplateLimited:   yxClubTemplateLimited,
+	ErrAgentNotFound:         yxAgentNotFound,
+	ErrAgentDisabled:         yxAgentDisabled,
+	ErrAgentCardNotEnough:    yxAgentCardNotEnough,
+	ErrAdminNotFound:         yxAdminNotFound,
+	ErrWalletKeyConflict:     yxWalletKeyConflict,
+	ErrOrderStatus:           yxOrderStatus,
+	ErrTradeUsed:             yxTradeUsed,
+	ErrProductNotFound:       yxProductNotFound,
+	ErrProductUnavailable:    yxProductUnavailable,
+	ErrSkuExists:             yxSkuExists,
+	ErrWrongPhoneNumber:      yxWrongPhoneNumber,
+	ErrVerificationInvalid:   yxVerificationInvalid,
 }
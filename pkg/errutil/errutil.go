@@ -54,6 +54,26 @@ var (
 	ErrProductionNotFound    = errors.New("production not found")
 	ErrRequestPrePayIDFailed = errors.New("request prepay id failed")
 	ErrAccountExists         = errors.New("account exists")
+	ErrTokenExpired          = errors.New("token expired")
+	ErrTokenRevoked          = errors.New("token revoked")
+	ErrClubNotFound          = errors.New("club not found")
+	ErrClubFull              = errors.New("club is full")
+	ErrClubMemberNotFound    = errors.New("club member not found")
+	ErrClubApplyNotFound     = errors.New("club application not found")
+	ErrClubTemplateNotFound  = errors.New("club template not found")
+	ErrClubTemplateLimited   = errors.New("club template limited")
+	ErrAgentNotFound         = errors.New("agent not found")
+	ErrAgentDisabled         = errors.New("agent disabled")
+	ErrAgentCardNotEnough    = errors.New("agent card not enough")
+	ErrAdminNotFound         = errors.New("admin not found")
+	ErrWalletKeyConflict     = errors.New("wallet idempotency key conflict")
+	ErrOrderStatus           = errors.New("order status invalid")
+	ErrTradeUsed             = errors.New("trade used by another order")
+	ErrProductNotFound       = errors.New("product not found")
+	ErrProductUnavailable    = errors.New("product unavailable")
+	ErrSkuExists             = errors.New("sku has existed")
+	ErrWrongPhoneNumber      = errors.New("wrong phone number")
+	ErrVerificationInvalid   = errors.New("verification code invalid")
 )
 
 //Code code for the error
@@ -15,13 +15,14 @@ const (
 type Number string
 type numberManager struct {
 	lock sync.Mutex
+	used map[Number]bool // 还没有销毁的房间号, 还没有开局的房间在数据库中没有记录
 }
 
 var rn *numberManager
 var numbers = [...]byte{'0', '1', '2', '3', '4', '5', '6', '7', '8', '9'}
 
 func init() {
-	rn = &numberManager{}
+	rn = &numberManager{used: map[Number]bool{}}
 
 	rand.Seed(time.Now().Unix())
 }
@@ -36,22 +37,44 @@ func (rn *numberManager) next() Number {
 			no[i] = numbers[rand.Intn(10)]
 		}
 		temp := Number(no)
+		if rn.used[temp] {
+			continue
+		}
 		dn := string(no)
 		if !db.DeskNumberExists(dn) {
+			rn.used[temp] = true
 			return temp
 		}
 
 	}
 }
 
+func (rn *numberManager) reserve(no Number) {
+	rn.lock.Lock()
+	defer rn.lock.Unlock()
+	rn.used[no] = true
+}
+
 func (rn *numberManager) remove(no Number) {
-	//rn.noPool.Remove(string(no))
+	rn.lock.Lock()
+	defer rn.lock.Unlock()
+	delete(rn.used, no)
 }
 
 func Next() Number {
 	return rn.next()
 }
 
+// Reserve 占用恢复的房间号, 之后Next不会再返回该房间号
+func Reserve(no Number) {
+	rn.reserve(no)
+}
+
+// Release 房间销毁后释放房间号
+func Release(no Number) {
+	rn.remove(no)
+}
+
 func (n Number) String() string {
 	return string(n)
 }
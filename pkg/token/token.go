@@ -0,0 +1,178 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+const defaultExpires = 6 * time.Hour
+
+// token的使用范围, 不同范围的token不能混用
+const (
+	ScopePlayer = ""      // 玩家
+	ScopeAgent  = "agent" // 代理后台
+	ScopeAdmin  = "admin" // GM和统计后台
+)
+
+var (
+	lock    sync.RWMutex
+	secret  []byte
+	expires = defaultExpires
+	revoked = map[string]int64{} // 范围+ID -> 该时间(纳秒)之前签发的token全部失效
+)
+
+// Claims token中携带的数据
+type Claims struct {
+	Uid      int64  `json:"uid"`
+	Scope    string `json:"scp,omitempty"`
+	IssuedAt int64  `json:"iat"` // 签发时间(纳秒)
+	Expires  int64  `json:"exp"` // 过期时间(秒)
+}
+
+func revokeKey(id int64, scope string) string {
+	return scope + ":" + strconv.FormatInt(id, 10)
+}
+
+// Setup 设置签名密钥和过期时间(秒), 密钥为空时随机生成, 重启后之前签发的token全部失效
+func Setup(key string, expiresIn int) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if key == "" {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	} else {
+		secret = []byte(key)
+	}
+
+	if expiresIn > 0 {
+		expires = time.Duration(expiresIn) * time.Second
+	}
+}
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// New 为玩家签发token, 返回token和过期时间(秒)
+func New(uid int64) (string, int64, error) {
+	return NewScope(uid, ScopePlayer)
+}
+
+// NewScope 签发指定范围的token
+func NewScope(id int64, scope string) (string, int64, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if secret == nil {
+		return "", 0, errutil.ErrInitFailed
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		Uid:      id,
+		Scope:    scope,
+		IssuedAt: now.UnixNano(),
+		Expires:  now.Add(expires).Unix(),
+	}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", 0, err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + sign(payload), claims.Expires, nil
+}
+
+// Parse 校验玩家token的签名, 过期时间以及是否已经被吊销
+func Parse(token string) (*Claims, error) {
+	return ParseScope(token, ScopePlayer)
+}
+
+// ParseScope 校验指定范围的token
+func ParseScope(token, scope string) (*Claims, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if secret == nil {
+		return nil, errutil.ErrInitFailed
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, errutil.ErrInvalidToken
+	}
+
+	if !hmac.Equal([]byte(sign(parts[0])), []byte(parts[1])) {
+		return nil, errutil.ErrInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errutil.ErrInvalidToken
+	}
+
+	claims := &Claims{}
+	if err := json.Unmarshal(data, claims); err != nil || claims.Uid <= 0 || claims.Scope != scope {
+		return nil, errutil.ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.Expires {
+		return nil, errutil.ErrTokenExpired
+	}
+
+	if claims.IssuedAt <= revoked[revokeKey(claims.Uid, scope)] {
+		return nil, errutil.ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// Refresh 使用未过期的玩家token换取新的token, 旧的token同时失效
+func Refresh(token string) (string, int64, error) {
+	return RefreshScope(token, ScopePlayer)
+}
+
+// RefreshScope 使用未过期的指定范围的token换取新的token
+func RefreshScope(token, scope string) (string, int64, error) {
+	claims, err := ParseScope(token, scope)
+	if err != nil {
+		return "", 0, err
+	}
+
+	RevokeScope(claims.Uid, scope)
+	return NewScope(claims.Uid, scope)
+}
+
+// Revoke 吊销玩家之前签发的所有token
+func Revoke(uid int64) {
+	RevokeScope(uid, ScopePlayer)
+}
+
+// RevokeScope 吊销指定范围之前签发的所有token
+func RevokeScope(id int64, scope string) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	now := time.Now()
+	revoked[revokeKey(id, scope)] = now.UnixNano()
+
+	// 超过有效期的吊销记录已经没有意义
+	deadline := now.Add(-expires).UnixNano()
+	for id, t := range revoked {
+		if t < deadline {
+			delete(revoked, id)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+func TestToken(t *testing.T) {
+	Setup("test-secret", 60)
+
+	tk, exp, err := New(10086)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp <= time.Now().Unix() {
+		t.Fatalf("unexpected expire time: %d", exp)
+	}
+
+	claims, err := Parse(tk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Uid != 10086 {
+		t.Fatalf("expect uid 10086, got %d", claims.Uid)
+	}
+
+	// 篡改数据
+	if _, err := Parse("x" + tk); err != errutil.ErrInvalidToken {
+		t.Fatalf("expect invalid token, got %v", err)
+	}
+
+	// 不同密钥签发的token无效
+	Setup("another-secret", 60)
+	if _, err := Parse(tk); err != errutil.ErrInvalidToken {
+		t.Fatalf("expect invalid token, got %v", err)
+	}
+	Setup("test-secret", 60)
+
+	// 刷新后旧token失效
+	fresh, _, err := Refresh(tk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(tk); err != errutil.ErrTokenRevoked {
+		t.Fatalf("expect revoked token, got %v", err)
+	}
+	if _, err := Parse(fresh); err != nil {
+		t.Fatal(err)
+	}
+
+	Revoke(10086)
+	if _, err := Parse(fresh); err != errutil.ErrTokenRevoked {
+		t.Fatalf("expect revoked token, got %v", err)
+	}
+}
+
+func TestTokenExpired(t *testing.T) {
+	Setup("test-secret", 1)
+	defer Setup("test-secret", int(defaultExpires/time.Second))
+
+	tk, _, err := New(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := Parse(tk); err != errutil.ErrTokenExpired {
+		t.Fatalf("expect expired token, got %v", err)
+	}
+}
+
+func TestTokenScope(t *testing.T) {
+	Setup("test-secret", 60)
+
+	tk, _, err := NewScope(10086, ScopeAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 代理token不能当作玩家token使用
+	if _, err := Parse(tk); err != errutil.ErrInvalidToken {
+		t.Fatalf("expect invalid token, got %v", err)
+	}
+	claims, err := ParseScope(tk, ScopeAgent)
+	if err != nil || claims.Uid != 10086 {
+		t.Fatalf("unexpected claims: %+v, %v", claims, err)
+	}
+
+	// 吊销同ID的玩家token不影响代理token
+	Revoke(10086)
+	if _, err := ParseScope(tk, ScopeAgent); err != nil {
+		t.Fatal(err)
+	}
+	RevokeScope(10086, ScopeAgent)
+	if _, err := ParseScope(tk, ScopeAgent); err != errutil.ErrTokenRevoked {
+		t.Fatalf("expect revoked token, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package protocol
+
+type AdminLoginRequest struct {
+	Account  string `json:"account"`
+	Password string `json:"password"`
+}
+
+type AdminDetail struct {
+	Id        int64  `json:"id"`
+	Account   string `json:"account"`
+	Name      string `json:"name"`
+	Role      int    `json:"role"`
+	Status    int    `json:"status"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+type AdminLoginResponse struct {
+	Code    int         `json:"code"`
+	Token   string      `json:"token"`
+	Expires int64       `json:"expires"`
+	Detail  AdminDetail `json:"detail"`
+}
+
+type CreateAdminRequest struct {
+	Account  string `json:"account"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Role     int    `json:"role"`
+}
+
+// 修改管理员的角色和状态, 密码为空时不修改
+type UpdateAdminRequest struct {
+	Id       int64  `json:"id"`
+	Role     int    `json:"role"`
+	Status   int    `json:"status"`
+	Password string `json:"password"`
+}
+
+type AdminDetailResponse struct {
+	Code   int         `json:"code"`
+	Detail AdminDetail `json:"detail"`
+}
+
+type AdminListResponse struct {
+	Code  int           `json:"code"`
+	Data  []AdminDetail `json:"data"`
+	Total int64         `json:"total"`
+}
+
+// 新生成的API Key只返回一次, 服务器只保存摘要
+type AdminApiKeyResponse struct {
+	Code   int    `json:"code"`
+	ApiKey string `json:"apiKey"`
+}
+
+type AdminAudit struct {
+	Id         int64  `json:"id"`
+	AdminId    int64  `json:"adminId"`
+	Account    string `json:"account"`
+	Action     string `json:"action"`
+	Target     int64  `json:"target"`
+	Detail     string `json:"detail"`
+	RemoteAddr string `json:"remoteAddr"`
+	CreatedAt  int64  `json:"createdAt"`
+}
+
+type AdminAuditResponse struct {
+	Code  int          `json:"code"`
+	Data  []AdminAudit `json:"data"`
+	Total int64        `json:"total"`
+}
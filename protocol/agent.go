@@ -5,6 +5,8 @@ type RegisterAgentRequest struct {
 	Account  string `json:"account"`
 	Password string `json:"password"`
 	Extra    string `json:"extra"`
+	Level    int    `json:"level"`
+	Discount int    `json:"discount"` // 单独设置的佣金比例(%), 0表示按等级计算
 }
 
 type AgentLoginRequest struct {
@@ -18,6 +20,9 @@ type AgentDetail struct {
 	Account   string `json:"account"`
 	CardCount int64  `json:"card_count"`
 	CreateAt  int64  `json:"create_at"`
+	Level     int    `json:"level"`
+	Discount  int    `json:"discount"`
+	Rate      int    `json:"rate"` // 当前的佣金比例(%)
 }
 
 type AgentLoginResponse struct {
@@ -33,10 +38,11 @@ type AgentListResponse struct {
 }
 
 type RechargeDetail struct {
-	PlayerId  int64  `json:"player_id"`
-	Extra     string `json:"extra"`
-	CreateAt  int64  `json:"create_at"`
-	CardCount int64  `json:"card_count"`
+	PlayerId   int64  `json:"player_id"`
+	Extra      string `json:"extra"`
+	CreateAt   int64  `json:"create_at"`
+	CardCount  int64  `json:"card_count"`
+	Commission int64  `json:"commission"`
 }
 
 type RechargeListResponse struct {
@@ -44,3 +50,42 @@ type RechargeListResponse struct {
 	Recharges []RechargeDetail `json:"recharges"`
 	Total     int64            `json:"total"`
 }
+
+type AgentDetailResponse struct {
+	Code   int         `json:"code"`
+	Detail AgentDetail `json:"detail"`
+}
+
+// 后台给代理增加房卡库存或者修改等级
+type AgentCardRequest struct {
+	AgentId   int64  `json:"agent_id"`
+	CardCount int64  `json:"card_count"`
+	Extra     string `json:"extra"`
+}
+
+type AgentLevelRequest struct {
+	AgentId  int64 `json:"agent_id"`
+	Level    int   `json:"level"`
+	Discount int   `json:"discount"`
+}
+
+// 代理给玩家充值房卡
+type AgentRechargeRequest struct {
+	Token     string `json:"token"`
+	PlayerId  int64  `json:"player_id"`
+	CardCount int64  `json:"card_count"`
+	Extra     string `json:"extra"`
+}
+
+type AgentRechargeResponse struct {
+	Code       int   `json:"code"`
+	CardCount  int64 `json:"card_count"` // 代理剩余的库存
+	Commission int64 `json:"commission"` // 本次充值的佣金(分)
+}
+
+type AgentCommissionResponse struct {
+	Code       int   `json:"code"`
+	CardCount  int64 `json:"card_count"`
+	Commission int64 `json:"commission"`
+	Rate       int   `json:"rate"`
+}
@@ -7,6 +7,7 @@ type (
 		Desc      string `json:"desc"`
 		Member    int    `json:"member"`
 		MaxMember int    `json:"maxMember"`
+		Balance   int64  `json:"balance"` // 俱乐部房卡余额
 	}
 
 	ClubListResponse struct {
@@ -17,4 +18,158 @@ type (
 	ApplyClubRequest struct {
 		ClubId int64 `json:"clubId"`
 	}
+
+	// 俱乐部管理请求, 通过http请求时需要带上登录时获得的token
+	ClubRequest struct {
+		Token  string `json:"token"`
+		ClubId int64  `json:"clubId"`
+	}
+
+	// 审核/踢人/转让部长/设置角色
+	ClubMemberRequest struct {
+		Token  string `json:"token"`
+		ClubId int64  `json:"clubId"`
+		Uid    int64  `json:"uid"`
+		Role   int    `json:"role"` // 只在设置角色时使用
+	}
+
+	UpdateClubRequest struct {
+		Token  string `json:"token"`
+		ClubId int64  `json:"clubId"`
+		Name   string `json:"name"`
+		Desc   string `json:"desc"`
+	}
+
+	ClubMember struct {
+		Uid       int64  `json:"uid"`
+		Name      string `json:"name"`
+		HeadUrl   string `json:"headUrl"`
+		Role      int    `json:"role"`
+		CreatedAt int64  `json:"createdAt"`
+	}
+
+	ClubMemberListResponse struct {
+		Code int          `json:"code"`
+		Data []ClubMember `json:"data"`
+	}
+
+	ClubInfoResponse struct {
+		Code int      `json:"code"`
+		Data ClubItem `json:"data"`
+	}
+
+	// 俱乐部房间模板, 由部长设置, 每个模板始终保留一张空闲的房间
+	ClubTemplate struct {
+		Id      int64       `json:"id"`
+		ClubId  int64       `json:"clubId"`
+		Name    string      `json:"name"`
+		Options DeskOptions `json:"options"`
+	}
+
+	// 新增/修改/删除模板, Id为0时新增
+	ClubTemplateRequest struct {
+		Token   string       `json:"token"`
+		ClubId  int64        `json:"clubId"`
+		Id      int64        `json:"id"`
+		Name    string       `json:"name"`
+		Options *DeskOptions `json:"options"`
+	}
+
+	ClubTemplateListResponse struct {
+		Code int            `json:"code"`
+		Data []ClubTemplate `json:"data"`
+	}
+
+	ClubTemplateResponse struct {
+		Code int          `json:"code"`
+		Data ClubTemplate `json:"data"`
+	}
+
+	ClubDeskPlayer struct {
+		Uid     int64  `json:"uid"`
+		Name    string `json:"name"`
+		HeadUrl string `json:"headUrl"`
+	}
+
+	// 俱乐部大厅的房间, 通过Join加入
+	ClubDesk struct {
+		TableInfo TableInfo        `json:"tableInfo"`
+		Template  int64            `json:"template"` // 模板ID, 玩家自己创建的房间为0
+		MaxRound  int              `json:"maxRound"`
+		Players   []ClubDeskPlayer `json:"players"`
+	}
+
+	ClubDeskListResponse struct {
+		Code int        `json:"code"`
+		Data []ClubDesk `json:"data"`
+	}
+
+	// 俱乐部充值, 部长使用玩家token, 代理使用代理token, 后台充值不需要token
+	ClubRechargeRequest struct {
+		Token  string `json:"token"`
+		ClubId int64  `json:"clubId"`
+		Amount int64  `json:"amount"`
+		Remark string `json:"remark"`
+	}
+
+	ClubRechargeResponse struct {
+		Code    int   `json:"code"`
+		Balance int64 `json:"balance"`
+	}
+
+	// 俱乐部房卡流水
+	ClubBalanceLog struct {
+		Id        int64  `json:"id"`
+		Type      int    `json:"type"`   // 1: 开房消耗, 2: 部长充值, 3: 代理充值, 4: 退还, 5: 后台充值
+		Amount    int64  `json:"amount"` // 消耗为负数
+		Balance   int64  `json:"balance"`
+		DeskId    int64  `json:"deskId"`
+		DeskNo    string `json:"deskNo"`
+		Operator  int64  `json:"operator"`
+		Remark    string `json:"remark"`
+		CreatedAt int64  `json:"createdAt"`
+	}
+
+	ClubLedgerResponse struct {
+		Code  int              `json:"code"`
+		Data  []ClubBalanceLog `json:"data"`
+		Total int64            `json:"total"`
+	}
+
+	// 俱乐部每日汇总
+	ClubDailyReport struct {
+		Date     int64 `json:"date"`
+		Consume  int64 `json:"consume"`
+		Desks    int   `json:"desks"` // 消耗房卡的房间数
+		Recharge int64 `json:"recharge"`
+	}
+
+	ClubReportResponse struct {
+		Code  int               `json:"code"`
+		Data  []ClubDailyReport `json:"data"`
+		Total int               `json:"total"`
+	}
+
+	// 俱乐部房卡不足提醒, 推送给在线的部长和管理员
+	ClubBalanceAlert struct {
+		Club      ClubItem `json:"club"`
+		Threshold int64    `json:"threshold"`
+		Message   string   `json:"message"`
+	}
+
+	// 俱乐部通知, 推送给被审核/踢出/修改角色的玩家
+	ClubNotify struct {
+		Type    int      `json:"type"`
+		Club    ClubItem `json:"club"`
+		Role    int      `json:"role"`
+		Message string   `json:"message"`
+	}
+)
+
+// 俱乐部通知类型
+const (
+	ClubNotifyApproved    = 1 // 申请通过
+	ClubNotifyRejected    = 2 // 申请被拒绝
+	ClubNotifyKicked      = 3 // 被踢出俱乐部
+	ClubNotifyRoleChanged = 4 // 角色变化
 )
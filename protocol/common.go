@@ -122,6 +122,7 @@ var SuccessResponse = StringResponse{0, "success"}
 
 const (
 	RegTypeThird = 5 //三方平台添加账号
+	RegTypePhone = 6 //手机号注册
 )
 
 var EmptyMessage = &None{}
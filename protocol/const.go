@@ -27,6 +27,7 @@ const (
 const (
 	VerificationTypeRegister = "register"
 	VerificationTypeFindPW   = "findPW"
+	VerificationTypeLogin    = "login"
 )
 
 // 匹配类型
@@ -123,6 +124,7 @@ const (
 	OptypeGang    = 3
 	OptypeHu      = 4
 	OptypePass    = 5
+	OptypeChi     = 6 // 吃上家的牌
 
 	OptyMoPai = 500 //摸牌
 	//以下三种杠的分类主要用以解决上面的 OptypeGang分类不细致,导致抢杠等操作处理麻烦的问题
@@ -154,3 +156,22 @@ const (
 	ChannelOptionAll  = "allChannel"
 	ChannelOptionHalf = "halfChannel"
 )
+
+// 机器人难度
+const (
+	RobotLevelEasy   = 1 // 简单
+	RobotLevelNormal = 2 // 普通
+	RobotLevelHard   = 3 // 困难
+)
+
+// 房卡支付方式, 俱乐部房间固定由俱乐部支付
+const (
+	PaymentHost   = 0 // 房主支付
+	PaymentAA     = 1 // 每个玩家平摊
+	PaymentWinner = 2 // 大赢家支付, 房间结束时扣除
+)
+
+// 玩法规则
+const (
+	RulesetXueZhan = "xuezhan" // 四川血战到底
+)
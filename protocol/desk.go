@@ -15,6 +15,7 @@ type EnterDeskInfo struct {
 	Score    int    `json:"score"`
 	IP       string `json:"ip"`
 	Offline  bool   `json:"offline"`
+	Trustee  bool   `json:"trustee"`
 }
 
 type ExitResponse struct {
@@ -37,6 +38,16 @@ type QueItem struct {
 	Que int   `json:"que"`
 }
 
+// 开启/取消托管
+type TrusteeRequest struct {
+	Trustee bool `json:"trustee"`
+}
+
+type Trustee struct {
+	Uid     int64 `json:"acId"`
+	Trustee bool  `json:"trustee"`
+}
+
 type DingQue struct {
 	Que int `json:"que"`
 }
@@ -178,6 +189,9 @@ type DeskOptions struct {
 
 	Zimo string `json:"zimo"`
 
+	// 玩法规则, 为空时使用血战到底
+	Ruleset string `json:"ruleset"`
+
 	// 玩法
 	Menqing  bool `json:"menqing"`  // 门清中张
 	Jiangdui bool `json:"jiangdui"` // 幺九将对
@@ -185,6 +199,20 @@ type DeskOptions struct {
 	Pengpeng bool `json:"pengpeng"` // 碰碰胡两番
 	Pinghu   bool `json:"pinghu"`   // 点炮可平胡
 	Yaojiu   bool `json:"yaojiu"`   // 全幺九
+	Chi      bool `json:"chi"`      // 可以吃上家的牌
+
+	// 观战者只能在每局结束后查看牌局
+	HideSpectator bool `json:"hideSpectator"`
+
+	// 出牌/碰杠吃胡的操作时间(秒), 超时后自动操作并进入托管, 0表示不限制
+	Timeout int `json:"timeout"`
+
+	// 房卡支付方式
+	Payment int `json:"payment"`
+
+	// 机器人
+	Robot      bool `json:"robot"`      // 是否允许机器人补位
+	RobotLevel int  `json:"robotLevel"` // 机器人难度
 }
 
 type CreateDeskRequest struct {
@@ -200,6 +228,7 @@ type CreateDeskResponse struct {
 }
 
 type ReConnect struct {
+	Token   string `json:"token"`
 	Uid     int64  `json:"uid"`
 	Name    string `json:"name"`
 	HeadUrl string `json:"headUrl"`
@@ -57,3 +57,28 @@ type HistoryByIDResponse struct {
 	Code int      `json:"code"`
 	Data *History `json:"data"`
 }
+
+type ReplayPlayer struct {
+	Uid       int64  `json:"uid"`
+	Name      string `json:"name"`
+	HandTiles []int  `json:"hand_tiles"` //手牌
+	ChuTiles  []int  `json:"chu_tiles"`  //出牌
+	PGTiles   []int  `json:"pg_tiles"`   //碰杠牌
+	IsHu      bool   `json:"is_hu"`
+	HuPai     int    `json:"hu_pai"`
+	Score     int    `json:"score"` //当前分数变化
+}
+
+type ReplayState struct {
+	Step    int            `json:"step"`  //当前步数
+	Total   int            `json:"total"` //总步数
+	Op      *OpTypeDo      `json:"op"`    //当前步的操作
+	Players []ReplayPlayer `json:"players"`
+}
+
+type HistoryReplayResponse struct {
+	Code       int          `json:"code"`
+	Data       *ReplayState `json:"data"`
+	Verified   bool         `json:"verified"`   //回放结果是否与结算一致
+	Mismatches []string     `json:"mismatches"` //不一致的地方
+}
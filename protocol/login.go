@@ -1,5 +1,7 @@
 package protocol
 
+import "fmt"
+
 type ThirdUserLoginRequest struct {
 	Platform    string `json:"platform"`     //三方平台/渠道
 	AppID       string `json:"appId"`        //用户来自于哪一个应用
@@ -55,8 +57,17 @@ type ClientConfig struct {
 	AppKey string `json:"appKey"`
 }
 
+// 游客的默认头像和昵称
+const GuestHeadUrl = "http://wx.qlogo.cn/mmopen/s962LEwpLxhQSOnarDnceXjSxVGaibMRsvRM4EIWic0U6fQdkpqz4Vr8XS8D81QKfyYuwjwm2M2ibsFY8mia8ic51ww/0"
+
+func GuestName(uid int64) string {
+	return fmt.Sprintf("G%d", uid)
+}
+
 type LoginResponse struct {
 	Code     int          `json:"code"`
+	Token    string       `json:"token"`   //登录游戏服使用的token
+	Expires  int64        `json:"expires"` //token过期时间
 	Name     string       `json:"name"`
 	Uid      int64        `json:"uid"`
 	HeadUrl  string       `json:"headUrl"`
@@ -72,14 +83,19 @@ type LoginResponse struct {
 }
 
 type LoginToGameServerResponse struct {
+	Code     int    `json:"code"`
+	Error    string `json:"error"`
 	Uid      int64  `json:"acId"`
 	Nickname string `json:"nickname"`
 	HeadUrl  string `json:"headURL"`
 	Sex      int    `json:"sex"`
 	FangKa   int    `json:"fangka"`
+	Gold     int64  `json:"gold"`
+	Silver   int64  `json:"silver"`
 }
 
 type LoginToGameServerRequest struct {
+	Token   string `json:"token"` //登录接口返回的token, 其他字段仅做兼容, 以数据库为准
 	Name    string `json:"name"`
 	Uid     int64  `json:"uid"`
 	HeadUrl string `json:"headUrl"`
@@ -96,3 +112,49 @@ type EncryptTest struct {
 type EncryptTestTest struct {
 	Result string `json:"result"`
 }
+
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+type TokenResponse struct {
+	Code    int    `json:"code"`
+	Token   string `json:"token"`
+	Expires int64  `json:"expires"`
+}
+
+type VerificationRequest struct {
+	Phone string `json:"phone"`
+	Type  string `json:"type"` //register, findPW, login
+}
+
+type VerificationResponse struct {
+	Code     int `json:"code"`
+	Expires  int `json:"expires"`  //验证码有效期(秒)
+	Interval int `json:"interval"` //重新发送的间隔(秒)
+}
+
+type PhoneRegisterRequest struct {
+	AppID     string `json:"appId"`     //用户来自于哪一个应用
+	ChannelID string `json:"channelId"` //用户来自于哪一个渠道
+	Device    Device `json:"device"`    //设备信息
+	Phone     string `json:"phone"`
+	Password  string `json:"password"`
+	VerifyNo  string `json:"verifyNo"` //短信验证码
+}
+
+// 手机号登录, 使用密码或者短信验证码二选一
+type PhoneLoginRequest struct {
+	AppID     string `json:"appId"`     //用户来自于哪一个应用
+	ChannelID string `json:"channelId"` //用户来自于哪一个渠道
+	Device    Device `json:"device"`    //设备信息
+	Phone     string `json:"phone"`
+	Password  string `json:"password"`
+	VerifyNo  string `json:"verifyNo"` //短信验证码
+}
+
+type ResetPasswordRequest struct {
+	Phone    string `json:"phone"`
+	Password string `json:"password"` //新密码
+	VerifyNo string `json:"verifyNo"` //短信验证码
+}
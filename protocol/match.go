@@ -0,0 +1,52 @@
+package protocol
+
+// 公共房间匹配请求
+type MatchRequest struct {
+	Type     int    `json:"type"`     // 匹配类型: MatchTypeClassic/MatchTypeDaily
+	Mode     int    `json:"mode"`     // 3人/4人
+	Level    int    `json:"level"`    // 场次等级: ClassicLevel*/DailyMatchLevel*
+	CoinType int    `json:"coinType"` // 经典场使用的货币: CoinTypeSliver/CoinTypeGold
+	Version  string `json:"version"`
+}
+
+type MatchResponse struct {
+	Code     int    `json:"code"`
+	Error    string `json:"error"`
+	Position int    `json:"position"` // 排队位置, 从1开始
+	Count    int    `json:"count"`    // 当前排队人数
+	Timeout  int    `json:"timeout"`  // 排队超时时间(秒)
+}
+
+// 排队状态变化时推送
+type MatchStatus struct {
+	Position int `json:"position"`
+	Count    int `json:"count"`
+	Wait     int `json:"wait"` // 已等待时间(秒)
+}
+
+// 匹配成功, 客户端收到后进入房间
+type Matched struct {
+	RoomType  int       `json:"roomType"`
+	Level     int       `json:"level"`
+	TableInfo TableInfo `json:"tableInfo"`
+}
+
+// 匹配被服务器取消, 比如排队超时且没有机器人补位
+type MatchCanceled struct {
+	Reason string `json:"reason"`
+}
+
+// 金币场/银币场每局结束后的结算
+type CoinSettle struct {
+	CoinType int          `json:"coinType"`
+	Stake    int64        `json:"stake"` // 底分, 每1分对应的金额
+	Changes  []CoinChange `json:"changes"`
+}
+
+type CoinChange struct {
+	Uid    int64 `json:"uid"`
+	Change int64 `json:"change"` // 扣除抽水后的输赢
+	Rake   int64 `json:"rake"`   // 抽水
+	Remain int64 `json:"remain"`
+	Bust   bool  `json:"bust"` // 低于入场金额, 自动离桌
+}
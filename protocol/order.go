@@ -1,14 +1,13 @@
 package protocol
 
 type CreateOrderRequest struct {
-	AppID          string //来自哪个应用的订单
-	ChannelID      string //来自哪个渠道的订单
-	Platform       string //支付平台
-	ProductionName string
-	ProductCount   int    //房卡数量
-	Extra          string //描述信息
-	Device         Device //设备信息
-	Uid            int64  //Token
+	AppID     string //来自哪个应用的订单
+	ChannelID string //来自哪个渠道的订单
+	Platform  string //支付平台
+	Sku       string //商品SKU, 价格和房卡数量以商品为准
+	Extra     string //描述信息
+	Device    Device //设备信息
+	Uid       int64  //Token
 }
 
 type CreateOrderByAdminRequest struct {
@@ -168,6 +167,61 @@ type WechatOrderCallbackResponse struct {
 }
 
 type RechargeRequest struct {
-	Count int64 `json:"count"`
-	Uid   int64 `json:"uid"`
+	Count int64  `json:"count"`
+	Uid   int64  `json:"uid"`
+	Key   string `json:"key"` // 幂等键, 可选
+}
+
+type CreateOrderAlipayResponse struct {
+	OrderId     string `json:"orderid"`
+	OrderString string `json:"orderString"` //签名后的订单信息, 客户端直接用于调起支付宝
+	Extra       string `json:"extData"`
+}
+
+type CreateOrderAppleResponse struct {
+	OrderId   string `json:"orderid"`
+	ProductId string `json:"productId"` //App Store中的商品ID
+	Extra     string `json:"extData"`
+}
+
+type CreateOrderFakeResponse struct {
+	OrderId string `json:"orderid"`
+	Money   int    `json:"money"`
+	Extra   string `json:"extData"`
+}
+
+//AppleReceiptRequest 苹果内购完成后客户端上报的收据
+type AppleReceiptRequest struct {
+	OrderId string `json:"orderid"`
+	Receipt string `json:"receipt"` //base64编码的收据
+}
+
+type RefundOrderRequest struct {
+	OrderId string `json:"orderid"`
+	Reason  string `json:"reason"`
+}
+
+type RefundOrderResponse struct {
+	Code int   `json:"code"`
+	Coin int64 `json:"coin"` //扣回房卡后玩家的房卡数量
+}
+
+//OrderMismatch 订单, 交易和房卡流水不一致的订单
+type OrderMismatch struct {
+	OrderId      string `json:"orderid"`
+	Uid          int64  `json:"uid"`
+	Status       int    `json:"status"`
+	Money        int    `json:"money"`
+	ProductCount int    `json:"productCount"`
+	PayOrderId   string `json:"payOrderId"` //支付平台的交易号, 为空表示没有交易记录
+	TradeMoney   int    `json:"tradeMoney"`
+	Credited     int64  `json:"credited"` //购买发放的房卡
+	Refunded     int64  `json:"refunded"` //退款扣回的房卡
+	Problem      string `json:"problem"`
+}
+
+type OrderReconcileResponse struct {
+	Code  int             `json:"code"`
+	Data  []OrderMismatch `json:"data"`
+	Total int64           `json:"total"`
 }
@@ -0,0 +1,49 @@
+package protocol
+
+// 商城商品
+type Product struct {
+	Id         int64    `json:"id"`
+	Sku        string   `json:"sku"`
+	Name       string   `json:"name"`
+	Price      int      `json:"price"` // 价格(分)
+	CardCount  int      `json:"cardCount"`
+	BonusCount int      `json:"bonusCount"`
+	FirstBonus int      `json:"firstBonus"` // 首充额外赠送的房卡
+	FirstOnly  bool     `json:"firstOnly"`  // 只有没有充值过的玩家可以购买
+	Channels   []string `json:"channels"`   // 可以购买的渠道, 为空表示所有渠道
+	Sort       int      `json:"sort"`
+	Status     int      `json:"status"`
+	CreatedAt  int64    `json:"createdAt"`
+	UpdatedAt  int64    `json:"updatedAt"`
+}
+
+type ProductListResponse struct {
+	Code int       `json:"code"`
+	Data []Product `json:"data"`
+}
+
+// 新增或者修改商品, Id为0时新增
+type SaveProductRequest struct {
+	Product
+}
+
+type SaveProductResponse struct {
+	Code   int     `json:"code"`
+	Detail Product `json:"detail"`
+}
+
+// 客户端商城展示的商品, Total为本次购买实际获得的房卡
+type ShopProduct struct {
+	Sku        string `json:"sku"`
+	Name       string `json:"name"`
+	Price      int    `json:"price"`
+	CardCount  int    `json:"cardCount"`
+	BonusCount int    `json:"bonusCount"`
+	FirstBonus int    `json:"firstBonus"`
+	Total      int    `json:"total"`
+}
+
+type ShopProductResponse struct {
+	Code int           `json:"code"`
+	Data []ShopProduct `json:"data"`
+}
@@ -3,4 +3,16 @@ package protocol
 const (
 	RouteOpTypeHint = "onOpTypeHint"
 	RouteTypeDo     = "onOpTypeDo"
+	RouteTrustee    = "onTrustee"
+
+	RouteMatched       = "onMatched"
+	RouteMatchStatus   = "onMatchStatus"
+	RouteMatchCanceled = "onMatchCanceled"
+	RouteCoinSettle    = "onCoinSettle"
+
+	RouteTournamentStage  = "onTournamentStage"
+	RouteTournamentResult = "onTournamentResult"
+
+	RouteClubNotify     = "onClubNotify"
+	RouteClubBalanceLow = "onClubBalanceLow"
 )
@@ -0,0 +1,88 @@
+package protocol
+
+type (
+	CreateTournamentRequest struct {
+		Name       string  `json:"name"`
+		RoomType   int     `json:"roomType"`   // RoomTypeDailyMatch/RoomTypeMonthlyMatch/RoomTypeFinalMatch
+		Level      int     `json:"level"`      // DailyMatchLevel*
+		Mode       int     `json:"mode"`       // 3人/4人
+		Round      int     `json:"round"`      // 每个阶段打多少局
+		EntryFee   int64   `json:"entryFee"`   // 报名费(房卡)
+		Prizes     []int64 `json:"prizes"`     // 按名次发放的奖励(房卡), 第一个为冠军
+		MinPlayers int     `json:"minPlayers"` // 开赛时人数不足则取消比赛并退还报名费
+		MaxPlayers int     `json:"maxPlayers"`
+		RegisterAt int64   `json:"registerAt"` // 开始报名时间
+		StartAt    int64   `json:"startAt"`    // 开赛时间, 同时截止报名
+	}
+
+	TournamentInfo struct {
+		Id         int64   `json:"id"`
+		Name       string  `json:"name"`
+		RoomType   int     `json:"roomType"`
+		Level      int     `json:"level"`
+		Mode       int     `json:"mode"`
+		Round      int     `json:"round"`
+		EntryFee   int64   `json:"entryFee"`
+		Prizes     []int64 `json:"prizes"`
+		MinPlayers int     `json:"minPlayers"`
+		MaxPlayers int     `json:"maxPlayers"`
+		Players    int     `json:"players"` // 已报名人数
+		Stage      int     `json:"stage"`   // 当前阶段, 从1开始
+		Status     int     `json:"status"`
+		RegisterAt int64   `json:"registerAt"`
+		StartAt    int64   `json:"startAt"`
+		FinishedAt int64   `json:"finishedAt"`
+	}
+
+	TournamentPlayer struct {
+		Uid    int64  `json:"uid"`
+		Name   string `json:"name"`
+		Score  int    `json:"score"` // 所有阶段的总分
+		Stage  int    `json:"stage"` // 参加到第几个阶段
+		Rank   int    `json:"rank"`  // 最终名次, 比赛结束前为0
+		Prize  int64  `json:"prize"`
+		Status int    `json:"status"`
+	}
+
+	TournamentListResponse struct {
+		Code  int              `json:"code"`
+		Total int64            `json:"total"`
+		Data  []TournamentInfo `json:"data"`
+	}
+
+	TournamentDetailResponse struct {
+		Code    int                `json:"code"`
+		Data    TournamentInfo     `json:"data"`
+		Players []TournamentPlayer `json:"players"`
+	}
+
+	TournamentRequest struct {
+		Id int64 `json:"id"`
+	}
+
+	TournamentResponse struct {
+		Code  int    `json:"code"`
+		Error string `json:"error"`
+		Coin  int64  `json:"coin"` // 报名或退赛后的房卡数量
+	}
+
+	// 比赛阶段变化时推送给还在比赛中的玩家
+	TournamentStage struct {
+		Id        int64      `json:"id"`
+		Name      string     `json:"name"`
+		Stage     int        `json:"stage"`
+		Players   int        `json:"players"`   // 本阶段参赛人数
+		Advance   int        `json:"advance"`   // 本阶段晋级人数, 决赛为0
+		RestDesks int        `json:"restDesks"` // 本阶段还没有结束的牌桌数量
+		TableInfo *TableInfo `json:"tableInfo"` // 本阶段分配的牌桌, 等待其他牌桌时为空
+	}
+
+	// 玩家被淘汰或比赛结束时推送
+	TournamentResult struct {
+		Id       int64  `json:"id"`
+		Name     string `json:"name"`
+		Rank     int    `json:"rank"`
+		Prize    int64  `json:"prize"`
+		Canceled bool   `json:"canceled"` // 比赛取消, 已退还报名费
+	}
+)
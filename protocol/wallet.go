@@ -0,0 +1,33 @@
+package protocol
+
+type WalletLedger struct {
+	Id        int64  `json:"id"`
+	Uid       int64  `json:"uid"`
+	Type      int    `json:"type"`
+	Amount    int64  `json:"amount"`
+	Balance   int64  `json:"balance"`
+	RefType   int    `json:"refType"`
+	RefId     string `json:"refId"`
+	Remark    string `json:"remark"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+type WalletLedgerResponse struct {
+	Code  int            `json:"code"`
+	Data  []WalletLedger `json:"data"`
+	Total int64          `json:"total"`
+}
+
+// 房卡余额与流水合计不一致的玩家, Diff = Coin - Ledger
+type WalletMismatch struct {
+	Uid    int64 `json:"uid"`
+	Coin   int64 `json:"coin"`
+	Ledger int64 `json:"ledger"`
+	Diff   int64 `json:"diff"`
+}
+
+type WalletReconcileResponse struct {
+	Code  int              `json:"code"`
+	Data  []WalletMismatch `json:"data"`
+	Total int64            `json:"total"`
+}